@@ -0,0 +1,131 @@
+// This file stores the login and the state of unfinished uploads.
+//
+// LEARNING NOTES:
+// ===============
+// The config file holds an API key, so it is written with mode 0600 (only
+// the owner can read it), in a directory with mode 0700. It lives in the
+// platform's config directory: ~/.config/fsctl on Linux, ~/Library/
+// Application Support/fsctl on macOS, %AppData%\fsctl on Windows.
+//
+// Unfinished uploads are kept in a second file next to it, so that an
+// interrupted `fsctl put` resumes instead of starting over.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// config is what `fsctl login` saves.
+type config struct {
+	Server string `json:"server"` // API base URL, e.g. https://files.example.com/api/v1
+	Email  string `json:"email"`
+	APIKey string `json:"api_key"`
+}
+
+// defaultConfigPath is the config file in the user's config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "fsctl.json"
+	}
+	return filepath.Join(dir, "fsctl", "config.json")
+}
+
+// loadConfig reads the config file. A missing file is an empty config.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if err := readJSON(path, cfg); err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the config file, readable only by its owner.
+func saveConfig(path string, cfg *config) error {
+	return writeJSON(path, cfg)
+}
+
+// =============================================================================
+// UNFINISHED UPLOADS
+// =============================================================================
+
+// uploadState maps an upload (see uploadKey) to its tus URL.
+type uploadState map[string]string
+
+// uploadStatePath is the upload state file next to the config file.
+func uploadStatePath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "uploads.json")
+}
+
+// uploadKey identifies an upload of a local file to a remote path. The size
+// and modification time make a changed local file start a new upload
+// instead of resuming with the old one's bytes.
+func uploadKey(localPath, remotePath string, info os.FileInfo) string {
+	return fmt.Sprintf("%s|%s|%d|%d", localPath, remotePath, info.Size(), info.ModTime().UnixNano())
+}
+
+// updateUploadState loads the upload state, applies change and saves it.
+func updateUploadState(configPath string, change func(uploadState)) error {
+	path := uploadStatePath(configPath)
+	state := uploadState{}
+	if err := readJSON(path, &state); err != nil {
+		return err
+	}
+	change(state)
+	return writeJSON(path, state)
+}
+
+// loadUploadState reads the upload state.
+func loadUploadState(configPath string) uploadState {
+	state := uploadState{}
+	_ = readJSON(uploadStatePath(configPath), &state) // No state just means no resume
+	return state
+}
+
+// =============================================================================
+// FILES
+// =============================================================================
+
+// readJSON decodes a JSON file into v. A missing file leaves v as it is.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON replaces a file with v as JSON, atomically: it writes a
+// temporary file and renames it over the old one, so a crash never
+// leaves half a file.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fsctl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly after the rename
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes files with mode 0600 already
+	return os.Rename(tmp.Name(), path)
+}
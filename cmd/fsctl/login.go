@@ -0,0 +1,79 @@
+// This file implements `fsctl login`.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+)
+
+// apiKeyEnv is read when neither --api-key nor a terminal is available,
+// e.g. in CI jobs.
+const apiKeyEnv = "FSCTL_API_KEY"
+
+func (a *app) loginCommand() *cobra.Command {
+	var email, apiKey string
+	cmd := &cobra.Command{
+		Use:   "login SERVER_URL",
+		Short: "Save the server and credentials to use",
+		Long: `Save the API base URL, your email and an API key, after checking that
+they work. Without --api-key the key is read from $` + apiKeyEnv + ` or
+prompted for.`,
+		Example: "  fsctl login https://files.example.com/api/v1 --email me@example.com",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if email == "" {
+				return fmt.Errorf("--email is required")
+			}
+			if apiKey == "" {
+				apiKey = os.Getenv(apiKeyEnv)
+			}
+			if apiKey == "" {
+				var err error
+				if apiKey, err = promptSecret("API key: "); err != nil {
+					return err
+				}
+			}
+
+			cfg := &config{Server: strings.TrimSuffix(args[0], "/"), Email: email, APIKey: apiKey}
+			c := client.New(client.Config{BaseURL: cfg.Server, Email: cfg.Email, APIKey: cfg.APIKey})
+			if _, err := c.Resolve(cmd.Context(), "/"); err != nil {
+				return fmt.Errorf("login failed: %w", err)
+			}
+			if err := saveConfig(a.configPath, cfg); err != nil {
+				return err
+			}
+
+			return a.output(map[string]string{"server": cfg.Server, "email": cfg.Email}, func() {
+				fmt.Printf("Logged in to %s as %s\n", cfg.Server, cfg.Email)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&email, "email", "", "account email")
+	cmd.Flags().StringVar(&apiKey, "api-key", "", "API key (visible in the process list; prefer the prompt)")
+	return cmd
+}
+
+// promptSecret asks for a secret on the terminal without echoing it. From
+// a pipe it reads one line.
+func promptSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		secret, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(secret)), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no API key given")
+	}
+	return strings.TrimSpace(line), nil
+}
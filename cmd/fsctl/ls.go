@@ -0,0 +1,70 @@
+// This file implements `fsctl ls`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+func (a *app) lsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls [PATH]",
+		Short: "List a folder",
+		Long:  "List a folder's contents, folders first. PATH defaults to the root; a file lists itself.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			target := "/"
+			if len(args) == 1 {
+				target = remotePath(args[0])
+			}
+
+			entry, err := c.Resolve(ctx, target)
+			if err != nil {
+				return err
+			}
+
+			var items []client.Item
+			switch {
+			case entry.File != nil:
+				items = []client.Item{{Type: models.ItemTypeFile, File: entry.File}}
+			case entry.Folder != nil:
+				items, err = c.List(ctx, &entry.Folder.ID)
+			default:
+				items, err = c.List(ctx, nil)
+			}
+			if err != nil {
+				return err
+			}
+
+			return a.output(map[string]any{"path": entry.Path, "items": items}, func() {
+				printItems(items)
+			})
+		}),
+	}
+}
+
+// printItems prints a listing as aligned columns: size, modified, name.
+func printItems(items []client.Item) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, item := range items {
+		if item.Folder != nil {
+			fmt.Fprintf(w, "-\t%s\t %s/\n", formatTime(item.Folder.UpdatedAt), item.Folder.Name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t %s\n", formatBytes(item.File.FileSize), formatTime(item.File.UpdatedAt), item.File.FileName)
+	}
+	w.Flush()
+}
+
+// formatTime prints a time in the local time zone, to the minute.
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
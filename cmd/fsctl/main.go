@@ -0,0 +1,142 @@
+// Command fsctl is a command-line client for the file storage service.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This program demonstrates:
+// 1. Subcommands with cobra (the library behind kubectl, hugo and gh)
+// 2. Output for people and for scripts from the same command (--json)
+// 3. Thin commands over a client library (pkg/client)
+//
+// USAGE:
+//
+//	fsctl login https://files.example.com/api/v1 --email me@example.com
+//	fsctl ls /Photos
+//	fsctl put beach.jpg /Photos/          # resumable, with a progress bar
+//	fsctl get /Photos/beach.jpg .
+//	fsctl mv /Photos/beach.jpg /Archive/
+//	fsctl cp /Reports /Backups --name "Reports 2024"
+//	fsctl rm /Archive/old.zip
+//	fsctl share /Reports bob@example.com --permission write
+//	fsctl versions /Reports/q3.xlsx
+//	fsctl restore /Reports/q3.xlsx --version 2
+//	fsctl sync ~/Reports /Reports         # both directions, see pkg/filesync
+//
+// SCRIPTING:
+// With --json every command prints one JSON document on stdout instead of
+// text, and progress bars are off. Errors still go to stderr and the exit
+// status is 1, so `fsctl --json ls / | jq ...` composes as expected.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+)
+
+// app holds the global flags.
+type app struct {
+	configPath string
+	jsonOutput bool
+	noProgress bool
+}
+
+func main() {
+	a := &app{}
+	root := &cobra.Command{
+		Use:           "fsctl",
+		Short:         "Command-line client for the file storage service",
+		SilenceUsage:  true, // Usage is for wrong arguments, not failed requests
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&a.configPath, "config", defaultConfigPath(), "config file")
+	root.PersistentFlags().BoolVar(&a.jsonOutput, "json", false, "print JSON for scripts")
+	root.PersistentFlags().BoolVar(&a.noProgress, "no-progress", false, "don't show progress bars")
+
+	root.AddCommand(
+		a.loginCommand(),
+		a.lsCommand(),
+		a.putCommand(),
+		a.getCommand(),
+		a.mvCommand(),
+		a.cpCommand(),
+		a.rmCommand(),
+		a.shareCommand(),
+		a.versionsCommand(),
+		a.restoreCommand(),
+		a.syncCommand(),
+	)
+
+	// Ctrl-C cancels the context, so transfers stop cleanly and an
+	// interrupted upload can be resumed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := root.ExecuteContext(ctx); err != nil {
+		if a.jsonOutput {
+			_ = json.NewEncoder(os.Stderr).Encode(errorJSON(err))
+		} else {
+			fmt.Fprintln(os.Stderr, "fsctl:", err)
+		}
+		stop()
+		os.Exit(1)
+	}
+}
+
+// client returns an API client for the logged-in account.
+func (a *app) client() (*client.Client, error) {
+	cfg, err := loadConfig(a.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("not logged in; run fsctl login first")
+	}
+	return client.New(client.Config{BaseURL: cfg.Server, Email: cfg.Email, APIKey: cfg.APIKey}), nil
+}
+
+// withClient is the RunE of commands that talk to the server: it loads the
+// login and passes the client on.
+func (a *app) withClient(run func(ctx context.Context, c *client.Client, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		c, err := a.client()
+		if err != nil {
+			return err
+		}
+		return run(cmd.Context(), c, args)
+	}
+}
+
+// remotePath makes a command-line argument an absolute remote path:
+// "Photos/beach.jpg" -> "/Photos/beach.jpg".
+func remotePath(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		return "/" + arg
+	}
+	return arg
+}
+
+// output prints v as JSON with --json, or calls text otherwise.
+func (a *app) output(v any, text func()) error {
+	if a.jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	text()
+	return nil
+}
+
+// errorJSON is how a failure looks with --json.
+func errorJSON(err error) any {
+	if apiErr, ok := err.(*client.Error); ok {
+		return map[string]any{"error": apiErr.Message, "code": apiErr.Code, "status": apiErr.StatusCode}
+	}
+	return map[string]any{"error": err.Error()}
+}
@@ -0,0 +1,214 @@
+// This file implements `fsctl mv`, `cp`, `rm` and `restore`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// jobPollInterval is how often `cp --wait` checks a background copy.
+const jobPollInterval = time.Second
+
+func (a *app) mvCommand() *cobra.Command {
+	var conflict string
+	cmd := &cobra.Command{
+		Use:   "mv SOURCE DEST",
+		Short: "Move or rename a file or folder",
+		Long: `Move or rename a file or folder. Like mv: a DEST that is a folder, or
+ends in "/", receives SOURCE under its own name; otherwise SOURCE is
+renamed to DEST.`,
+		Example: "  fsctl mv /Inbox/report.pdf /Archive/\n  fsctl mv /Drafts/v2.docx /Drafts/final.docx",
+		Args:    cobra.ExactArgs(2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			source, target, err := transferArgs(ctx, c, args, conflict)
+			if err != nil {
+				return err
+			}
+			result, err := c.Move(ctx, source, target)
+			if err != nil {
+				return err
+			}
+			return a.output(result, func() {
+				fmt.Printf("%s -> %s (%s)\n", source.Path, resultPath(result), result.Outcome)
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&conflict, "conflict", "fail", "if the target exists: fail, overwrite, rename or skip")
+	return cmd
+}
+
+func (a *app) cpCommand() *cobra.Command {
+	var conflict string
+	var wait bool
+	cmd := &cobra.Command{
+		Use:   "cp SOURCE DEST",
+		Short: "Copy a file or folder on the server",
+		Long: `Copy a file or folder without downloading it. DEST works as for mv.
+Large folders are copied in the background; the command waits for the
+copy to finish unless --wait=false.`,
+		Example: "  fsctl cp /Templates/invoice.docx /Clients/Acme/\n  fsctl cp /Photos /Backups/Photos-2024",
+		Args:    cobra.ExactArgs(2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			source, target, err := transferArgs(ctx, c, args, conflict)
+			if err != nil {
+				return err
+			}
+			result, err := c.Copy(ctx, source, target)
+			if err != nil {
+				return err
+			}
+			if result.Job != nil && wait {
+				job, err := c.WaitJob(ctx, result.Job.ID, jobPollInterval)
+				if err != nil {
+					return err
+				}
+				if job.Status != models.JobCompleted {
+					return fmt.Errorf("copy failed: %s", job.LastError)
+				}
+				result.Job = job
+			}
+
+			return a.output(result, func() {
+				if result.Job != nil && !wait {
+					fmt.Printf("%s -> %s: copying in the background (job %s)\n", source.Path, resultPath(result), result.Job.ID.Hex())
+					return
+				}
+				fmt.Printf("%s -> %s (%s)\n", source.Path, resultPath(result), result.Outcome)
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&conflict, "conflict", "fail", "if the target exists: fail, overwrite, rename or skip")
+	cmd.Flags().BoolVar(&wait, "wait", true, "wait for background copies of large folders")
+	return cmd
+}
+
+// transferArgs resolves the SOURCE of mv or cp and works out where DEST
+// puts it.
+func transferArgs(ctx context.Context, c *client.Client, args []string, conflict string) (*client.Entry, client.Target, error) {
+	source, err := c.Resolve(ctx, remotePath(args[0]))
+	if err != nil {
+		return nil, client.Target{}, err
+	}
+
+	dest := remotePath(args[1])
+	target := client.Target{To: dest, Conflict: conflict}
+	if strings.HasSuffix(dest, "/") {
+		return source, target, nil
+	}
+
+	entry, err := c.Resolve(ctx, dest)
+	switch {
+	case client.IsNotFound(err) || (err == nil && entry.File != nil):
+		// A new name, or an existing file that --conflict decides about
+		target.To, target.Name = path.Dir(dest), path.Base(dest)
+	case err != nil:
+		return nil, client.Target{}, err
+	}
+	return source, target, nil
+}
+
+// resultPath is where a move or copy ended up.
+func resultPath(result *client.Result) string {
+	switch {
+	case result.File != nil:
+		return result.File.FilePath
+	case result.Folder != nil:
+		return result.Folder.Path
+	default:
+		return "?"
+	}
+}
+
+func (a *app) rmCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm PATH...",
+		Short: "Move files or folders to the trash",
+		Long: `Move files or folders, with everything in them, to the trash. A file
+can be taken out of the trash again with fsctl restore --id.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			var removed []*client.Entry
+			for _, arg := range args {
+				entry, err := c.Resolve(ctx, remotePath(arg))
+				if err != nil {
+					return fmt.Errorf("%s: %w", arg, err)
+				}
+				if err := c.Delete(ctx, entry); err != nil {
+					return fmt.Errorf("%s: %w", entry.Path, err)
+				}
+				removed = append(removed, entry)
+			}
+
+			return a.output(map[string]any{"removed": removed}, func() {
+				for _, entry := range removed {
+					if entry.File != nil {
+						fmt.Printf("%s moved to the trash (fsctl restore --id %s)\n", entry.Path, entry.File.ID.Hex())
+						continue
+					}
+					fmt.Printf("%s moved to the trash\n", entry.Path)
+				}
+			})
+		}),
+	}
+}
+
+func (a *app) restoreCommand() *cobra.Command {
+	var version int
+	var fileID string
+	cmd := &cobra.Command{
+		Use:   "restore {PATH --version N | --id FILE_ID}",
+		Short: "Restore an earlier version, or a file from the trash",
+		Long: `With PATH and --version, make an earlier version of a file current
+again. The restore is itself a new version, so it can be undone.
+
+With --id, take a file out of the trash (fsctl rm prints the ID).`,
+		Example: "  fsctl restore /Reports/q3.xlsx --version 2\n  fsctl restore --id 65f1c2a9e4b0a1b2c3d4e5f6",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			switch {
+			case fileID != "" && len(args) == 0 && version == 0:
+				id, err := primitive.ObjectIDFromHex(fileID)
+				if err != nil {
+					return fmt.Errorf("invalid file ID %q", fileID)
+				}
+				if err := c.RestoreFile(ctx, id); err != nil {
+					return err
+				}
+				return a.output(map[string]any{"file_id": id, "restored": true}, func() {
+					fmt.Printf("File %s restored from the trash\n", fileID)
+				})
+
+			case fileID == "" && len(args) == 1 && version > 0:
+				entry, err := c.Resolve(ctx, remotePath(args[0]))
+				if err != nil {
+					return err
+				}
+				if entry.File == nil {
+					return fmt.Errorf("%s is not a file", entry.Path)
+				}
+				file, err := c.RestoreVersion(ctx, entry.File.ID, version)
+				if err != nil {
+					return err
+				}
+				return a.output(file, func() {
+					fmt.Printf("%s: version %d restored as version %d\n", file.FilePath, version, file.Version)
+				})
+
+			default:
+				return fmt.Errorf("give either PATH and --version, or --id")
+			}
+		}),
+	}
+	cmd.Flags().IntVar(&version, "version", 0, "version number to restore (see fsctl versions)")
+	cmd.Flags().StringVar(&fileID, "id", "", "ID of a trashed file to restore")
+	return cmd
+}
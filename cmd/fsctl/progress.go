@@ -0,0 +1,105 @@
+// This file draws transfer progress bars.
+//
+// LEARNING NOTES:
+// ===============
+// A progress bar is one line redrawn in place: "\r" moves the cursor back
+// to the start of the line without starting a new one. It goes to stderr
+// so that stdout stays clean for output that might be piped, and only
+// when stderr is a terminal - in a log file, hundreds of redraws would be
+// noise.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress bar settings
+const (
+	barWidth      = 30
+	redrawEvery   = 100 * time.Millisecond
+	clearLineCode = "\r\033[K" // Back to column 0, then erase to the end of the line
+)
+
+// progressBar shows how much of a transfer is done. Updates may come from
+// the HTTP client's goroutine, hence the mutex.
+type progressBar struct {
+	label string
+	total int64
+	start time.Time
+
+	mu       sync.Mutex
+	lastDraw time.Time
+}
+
+// newProgress returns a progress bar, or nil when bars are off (--json,
+// --no-progress, or stderr isn't a terminal). A nil bar ignores updates.
+func (a *app) newProgress(label string, total int64) *progressBar {
+	if a.jsonOutput || a.noProgress || !isTerminal(os.Stderr) {
+		return nil
+	}
+	return &progressBar{label: label, total: total, start: time.Now()}
+}
+
+// Update redraws the bar with done bytes transferred, at most every
+// redrawEvery.
+func (p *progressBar) Update(done int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastDraw) < redrawEvery && done < p.total {
+		return
+	}
+	p.lastDraw = now
+
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = min(float64(done)/float64(p.total), 1)
+	}
+	filled := int(fraction * barWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+
+	rate := ""
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0.5 {
+		rate = "  " + formatBytes(int64(float64(done)/elapsed)) + "/s"
+	}
+	fmt.Fprintf(os.Stderr, "%s%s [%s] %3.0f%%  %s / %s%s",
+		clearLineCode, p.label, bar, fraction*100, formatBytes(done), formatBytes(p.total), rate)
+}
+
+// Done ends the bar's line.
+func (p *progressBar) Done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(os.Stderr)
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatBytes prints a size in binary units: 512 B, 1.5 KiB, 3.2 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,91 @@
+// This file implements `fsctl share` and `fsctl versions`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+func (a *app) shareCommand() *cobra.Command {
+	var permission string
+	var revoke bool
+	cmd := &cobra.Command{
+		Use:   "share PATH EMAIL",
+		Short: "Share a file or folder with another user",
+		Long: `Give another user read, write or admin permission on a file or folder.
+Sharing a folder shares everything in it. Sharing again changes the
+permission; --revoke takes the access away.`,
+		Example: "  fsctl share /Reports bob@example.com --permission write\n  fsctl share /Reports bob@example.com --revoke",
+		Args:    cobra.ExactArgs(2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			entry, err := c.Resolve(ctx, remotePath(args[0]))
+			if err != nil {
+				return err
+			}
+			email := args[1]
+
+			var updated *client.Entry
+			if revoke {
+				updated, err = c.Unshare(ctx, entry, email)
+			} else {
+				updated, err = c.Share(ctx, entry, email, models.FilePermission(permission))
+			}
+			if err != nil {
+				return err
+			}
+
+			return a.output(updated, func() {
+				if revoke {
+					fmt.Printf("%s is no longer shared with %s\n", entry.Path, email)
+					return
+				}
+				fmt.Printf("%s shared with %s (%s)\n", entry.Path, email, permission)
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&permission, "permission", string(models.PermissionRead), "read, write or admin")
+	cmd.Flags().BoolVar(&revoke, "revoke", false, "stop sharing with EMAIL")
+	return cmd
+}
+
+func (a *app) versionsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "versions PATH",
+		Short: "List a file's earlier versions",
+		Long:  "List a file's earlier versions, newest first. Restore one with fsctl restore.",
+		Args:  cobra.ExactArgs(1),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			entry, err := c.Resolve(ctx, remotePath(args[0]))
+			if err != nil {
+				return err
+			}
+			if entry.File == nil {
+				return fmt.Errorf("%s is not a file", entry.Path)
+			}
+			file := entry.File
+
+			versions, err := c.Versions(ctx, file.ID)
+			if err != nil {
+				return err
+			}
+
+			out := map[string]any{"path": entry.Path, "current_version": file.Version, "versions": versions}
+			return a.output(out, func() {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tSIZE\tCREATED\tCHANGES")
+				fmt.Fprintf(w, "%d (current)\t%s\t%s\t\n", file.Version, formatBytes(file.FileSize), formatTime(file.UpdatedAt))
+				for _, v := range versions {
+					fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", v.VersionNumber, formatBytes(v.FileSize), formatTime(v.CreatedAt), v.ChangesDescription)
+				}
+				w.Flush()
+			})
+		}),
+	}
+}
@@ -0,0 +1,115 @@
+// This file implements `fsctl sync`.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+	"github.com/emaad/file-storage-service/pkg/filesync"
+)
+
+func (a *app) syncCommand() *cobra.Command {
+	var dryRun bool
+	var watch time.Duration
+	cmd := &cobra.Command{
+		Use:   "sync LOCAL_DIR REMOTE_FOLDER",
+		Short: "Keep a local directory and a remote folder in sync",
+		Long: `Sync a local directory and a remote folder in both directions: new and
+changed files are copied across, renames and deletes are repeated on the
+other side. When a file changed on both sides, both versions are kept:
+the local one is renamed to "NAME (conflict DATE).EXT".
+
+The state of the last sync is kept in LOCAL_DIR/.fsctl-sync.db. With
+--watch the sync repeats at that interval until Ctrl-C.`,
+		Example: "  fsctl sync ~/Reports /Reports\n  fsctl sync ~/Reports /Reports --dry-run\n  fsctl sync ~/Reports /Reports --watch 1m",
+		Args:    cobra.ExactArgs(2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			engine, err := filesync.Open(filesync.Options{
+				Client:     c,
+				LocalRoot:  args[0],
+				RemoteRoot: remotePath(args[1]),
+				DryRun:     dryRun,
+				Progress: func(action filesync.Action) {
+					if !a.jsonOutput && action.Error == "" {
+						printAction(action) // Failures are listed at the end
+					}
+				},
+			})
+			if err != nil {
+				return err
+			}
+			defer engine.Close()
+
+			for {
+				report, err := engine.Sync(ctx)
+				if err != nil {
+					if ctx.Err() != nil {
+						return fmt.Errorf("sync interrupted; run it again to continue")
+					}
+					return err
+				}
+				if err := a.output(report, func() { printReport(report, dryRun) }); err != nil {
+					return err
+				}
+				if watch <= 0 {
+					if len(report.Failed) > 0 {
+						return fmt.Errorf("%d actions failed", len(report.Failed))
+					}
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil // Ctrl-C between passes is the way to stop --watch
+				case <-time.After(watch):
+				}
+			}
+		}),
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be done without doing it")
+	cmd.Flags().DurationVar(&watch, "watch", 0, "sync again at this interval, e.g. 30s")
+	return cmd
+}
+
+// printAction prints one action; failed ones go to stderr.
+func printAction(action filesync.Action) {
+	line := fmt.Sprintf("%-13s %s", action.Kind, action.Path)
+	switch {
+	case action.From != "":
+		line = fmt.Sprintf("%-13s %s -> %s", action.Kind, action.From, action.Path)
+	case action.ConflictCopy != "":
+		line += " (local version kept as " + action.ConflictCopy + ")"
+	}
+	if action.Error != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", line, action.Error)
+		return
+	}
+	fmt.Println(line)
+}
+
+// printReport prints the failures and a summary of a pass. In a dry run
+// nothing was printed as it happened, so the plan is listed too.
+func printReport(report *filesync.Report, dryRun bool) {
+	if dryRun {
+		for _, action := range report.Actions {
+			printAction(action)
+		}
+	}
+	for _, action := range report.Failed {
+		printAction(action)
+	}
+
+	switch {
+	case dryRun:
+		fmt.Printf("Dry run: %d actions planned, %d can't be done\n", len(report.Actions), len(report.Failed))
+	case len(report.Actions) == 0 && len(report.Failed) == 0:
+		fmt.Println("Everything up to date")
+	default:
+		fmt.Printf("%d actions done, %d failed\n", len(report.Actions), len(report.Failed))
+	}
+}
@@ -0,0 +1,266 @@
+// This file implements `fsctl put` and `fsctl get`.
+//
+// LEARNING NOTES:
+// ===============
+// BOTH DIRECTIONS RESUME:
+//   - put saves the upload's URL before sending anything (config.go), so
+//     running the same command again after Ctrl-C or a crash continues
+//     the upload instead of starting it over.
+//   - get writes to NAME.fsctl-part and renames it when complete. Running
+//     it again asks the server for the rest only (a Range request).
+//
+// A resumed download could stitch together bytes of two versions if the
+// file changed in between. The server prevents most of that (If-Range),
+// and the finished file is checked against the file's SHA-256 checksum,
+// which catches the rest.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+)
+
+// partSuffix marks a download in progress.
+const partSuffix = ".fsctl-part"
+
+// =============================================================================
+// PUT
+// =============================================================================
+
+func (a *app) putCommand() *cobra.Command {
+	var conflict string
+	var chunkMiB int64
+	cmd := &cobra.Command{
+		Use:   "put LOCAL_FILE [REMOTE_PATH]",
+		Short: "Upload a file (resumable)",
+		Long: `Upload a file in chunks. If the upload is interrupted, running the same
+command again continues where it stopped.
+
+REMOTE_PATH defaults to the file's name in the root folder. A REMOTE_PATH
+that is a folder, or ends in "/", receives the file under its own name.`,
+		Example: "  fsctl put report.pdf /Documents/\n  fsctl put backup.tar /Backups/2024.tar --conflict overwrite",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			localPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(localPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return fmt.Errorf("%s is a directory", args[0])
+			}
+
+			target := "/"
+			if len(args) == 2 {
+				target = args[1]
+			}
+			target, err = uploadTarget(ctx, c, target, filepath.Base(localPath))
+			if err != nil {
+				return err
+			}
+
+			// An earlier, interrupted upload of the same file resumes
+			key := uploadKey(localPath, target, info)
+			bar := a.newProgress(path.Base(target), info.Size())
+			result, err := c.Upload(ctx, file, info.Size(), client.UploadOptions{
+				Path:      target,
+				MimeType:  mime.TypeByExtension(filepath.Ext(localPath)),
+				Conflict:  conflict,
+				ChunkSize: chunkMiB << 20,
+				ResumeURL: loadUploadState(a.configPath)[key],
+				OnCreate: func(uploadURL string) {
+					_ = updateUploadState(a.configPath, func(state uploadState) { state[key] = uploadURL })
+				},
+				Progress: func(sent, total int64) { bar.Update(sent) },
+			})
+			bar.Done()
+			if err != nil {
+				if ctx.Err() != nil {
+					return fmt.Errorf("upload interrupted; run the same command again to resume")
+				}
+				return err
+			}
+			_ = updateUploadState(a.configPath, func(state uploadState) { delete(state, key) })
+
+			return a.output(map[string]any{"path": target, "file_id": result.FileID, "outcome": result.Outcome}, func() {
+				fmt.Printf("%s: %s\n", target, result.Outcome)
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&conflict, "conflict", "fail", "if the target exists: fail, overwrite (new version), rename or skip")
+	cmd.Flags().Int64Var(&chunkMiB, "chunk-size", client.DefaultChunkSize>>20, "chunk size in MiB")
+	return cmd
+}
+
+// uploadTarget returns the remote path a file named name is uploaded to,
+// given the REMOTE_PATH argument.
+func uploadTarget(ctx context.Context, c *client.Client, arg, name string) (string, error) {
+	target := remotePath(arg)
+	if strings.HasSuffix(target, "/") {
+		return target + name, nil
+	}
+
+	entry, err := c.Resolve(ctx, target)
+	switch {
+	case client.IsNotFound(err):
+		return target, nil // A new file
+	case err != nil:
+		return "", err
+	case entry.File == nil:
+		return path.Join(target, name), nil // An existing folder
+	default:
+		return target, nil // An existing file; --conflict decides
+	}
+}
+
+// =============================================================================
+// GET
+// =============================================================================
+
+func (a *app) getCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get REMOTE_FILE [LOCAL_PATH]",
+		Short: "Download a file (resumable)",
+		Long: `Download a file. An interrupted download continues where it stopped
+when the command is run again. The result is checked against the file's
+checksum.
+
+LOCAL_PATH defaults to the file's name in the current directory; an
+existing directory receives the file under its own name.`,
+		Example: "  fsctl get /Documents/report.pdf\n  fsctl get /Backups/2024.tar /mnt/restore/",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: a.withClient(func(ctx context.Context, c *client.Client, args []string) error {
+			entry, err := c.Resolve(ctx, remotePath(args[0]))
+			if err != nil {
+				return err
+			}
+			if entry.File == nil {
+				return fmt.Errorf("%s is a folder", entry.Path)
+			}
+			remote := entry.File
+
+			localPath := remote.FileName
+			if len(args) == 2 {
+				localPath = args[1]
+				if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+					localPath = filepath.Join(localPath, remote.FileName)
+				}
+			}
+
+			bar := a.newProgress(remote.FileName, remote.FileSize)
+			err = download(ctx, c, entry, localPath, bar)
+			bar.Done()
+			if err != nil {
+				if ctx.Err() != nil {
+					return fmt.Errorf("download interrupted; run the same command again to resume")
+				}
+				return err
+			}
+
+			return a.output(map[string]any{"path": entry.Path, "local_path": localPath, "size": remote.FileSize}, func() {
+				fmt.Printf("%s -> %s\n", entry.Path, localPath)
+			})
+		}),
+	}
+}
+
+// download fetches a file into localPath, resuming a partial download.
+func download(ctx context.Context, c *client.Client, entry *client.Entry, localPath string, bar *progressBar) error {
+	remote := entry.File
+	partPath := localPath + partSuffix
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+
+	// Resume from what the part file holds, unless it can't be this file
+	info, err := part.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if offset > remote.FileSize {
+		offset = 0
+	}
+
+	dl, err := c.Download(ctx, remote.ID, offset, client.FileETag(remote))
+	if err != nil {
+		return err
+	}
+	defer dl.Body.Close()
+
+	// The checksum covers the whole file, including what is already here
+	hasher := sha256.New()
+	if err := part.Truncate(dl.Offset); err != nil {
+		return err
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(hasher, part, dl.Offset); err != nil {
+		return err
+	}
+
+	body := &countingReader{r: dl.Body, n: dl.Offset, report: bar.Update}
+	if _, err := io.Copy(io.MultiWriter(part, hasher), body); err != nil {
+		return err
+	}
+	if err := part.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyChecksum(hasher, remote.Checksum); err != nil {
+		os.Remove(partPath) // Start over next time
+		return err
+	}
+	return os.Rename(partPath, localPath)
+}
+
+// verifyChecksum compares a SHA-256 hash with the file's checksum. Files
+// stored before checksums were recorded can't be checked.
+func verifyChecksum(hasher hash.Hash, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		return errors.New("downloaded content doesn't match the file's checksum; run the command again")
+	}
+	return nil
+}
+
+// countingReader reports the running total of bytes read through it.
+type countingReader struct {
+	r      io.Reader
+	n      int64
+	report func(n int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.report(c.n)
+	return n, err
+}
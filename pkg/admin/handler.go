@@ -0,0 +1,123 @@
+// Package admin exposes administrator-only HTTP endpoints.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Protecting a whole route group with middleware
+// 2. Thin handlers that delegate every rule to a service
+//
+// DEFENSE IN DEPTH:
+// The routes sit behind auth.RequireAdmin, and the service methods check
+// actor.IsAdmin() again. If someone later mounts the handler without the
+// middleware, the service still refuses regular users.
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/processing"
+)
+
+// defaultListLimit caps list responses when no ?limit= is given
+const defaultListLimit = 100
+
+// Handler serves the admin endpoints.
+type Handler struct {
+	files     *files.Service
+	processor *processing.Processor
+}
+
+// NewHandler creates an admin Handler. The processor is used to resume
+// processing of released files.
+func NewHandler(fileService *files.Service, processor *processing.Processor) *Handler {
+	return &Handler{files: fileService, processor: processor}
+}
+
+// RegisterRoutes mounts the admin routes on a router group.
+//
+// USAGE:
+//
+//	admin.NewHandler(fileService, processor).RegisterRoutes(api)
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	group := r.Group("/admin", auth.RequireAdmin())
+	group.GET("/quarantine", h.ListQuarantined)
+	group.POST("/quarantine/:id/release", h.ReleaseQuarantine)
+	group.DELETE("/quarantine/:id", h.PurgeQuarantined)
+}
+
+// ListQuarantined lists quarantined files.
+//
+// GET /admin/quarantine?limit=100
+func (h *Handler) ListQuarantined(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	limit := int64(defaultListLimit)
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			_ = c.Error(apperrors.ErrBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	quarantined, err := h.files.ListQuarantined(c.Request.Context(), user, limit)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"files": quarantined})
+}
+
+// ReleaseQuarantine releases a file and resumes its processing.
+//
+// POST /admin/quarantine/:id/release
+func (h *Handler) ReleaseQuarantine(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	fileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	ctx := c.Request.Context()
+	file, err := h.files.ReleaseQuarantine(ctx, user, fileID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Thumbnails and compression were skipped while the file was blocked
+	if err := h.processor.EnqueueFollowUps(ctx, file); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// PurgeQuarantined permanently deletes a quarantined file.
+//
+// DELETE /admin/quarantine/:id
+func (h *Handler) PurgeQuarantined(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	fileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	if err := h.files.PurgeQuarantined(c.Request.Context(), user, fileID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
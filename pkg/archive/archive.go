@@ -0,0 +1,236 @@
+// Package archive streams zip and tar.gz archives of stored files.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Writing archives with the standard library (archive/zip, archive/tar)
+// 2. Streaming each entry from the object store into the archive writer
+// 3. Writing to any io.Writer - an HTTP response, or a pipe into storage
+//
+// ZIP64:
+// The classic zip format stores sizes and offsets in 32 bits, so it can't
+// describe files over 4 GiB, archives over 4 GiB or more than 65,535
+// entries. archive/zip switches to the ZIP64 extensions on its own when
+// any of those limits is crossed, so we only have to stream. Setting
+// UncompressedSize64 up front lets it reserve the ZIP64 fields early.
+//
+// WHY TAR.GZ TOO?
+// Tar needs each file's size *before* its content, which we know from the
+// object store. In exchange it has no central directory at the end, so a
+// truncated download still extracts up to the point where it broke.
+//
+// This package knows nothing about users or permissions: callers decide
+// which entries go in (see files.Service.PlanArchive).
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// =============================================================================
+// FORMATS
+// =============================================================================
+
+// Format is an archive format.
+type Format string
+
+// Supported formats
+const (
+	FormatZip   Format = "zip"
+	FormatTarGz Format = "tar.gz"
+)
+
+// ErrInvalidFormat is returned for unknown archive formats.
+var ErrInvalidFormat = apperrors.New("INVALID_ARCHIVE_FORMAT", "Archive format must be zip or tar.gz", http.StatusBadRequest)
+
+// ParseFormat parses a format name. An empty string means FormatZip.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "zip":
+		return FormatZip, nil
+	case "tar.gz", "tgz":
+		return FormatTarGz, nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// Extension returns the file name extension, including the dot.
+func (f Format) Extension() string {
+	if f == FormatTarGz {
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// =============================================================================
+// ENTRIES
+// =============================================================================
+
+// Entry is one file or folder in an archive.
+type Entry struct {
+	Name     string    // Path inside the archive, "/"-separated, e.g. "Photos/2024/beach.jpg"
+	Dir      bool      // A folder; Key and Size are unused
+	Key      string    // Object key of the content
+	Size     int64     // Content length in bytes
+	Modified time.Time // Modification time shown by archive tools
+	Compress bool      // Deflate in zip archives; false stores already-compressed data as is
+}
+
+// =============================================================================
+// WRITING
+// =============================================================================
+
+// Write streams an archive of entries to w. Folders must come before the
+// entries inside them.
+//
+// Content that has vanished from the object store since the entries were
+// listed (the file was purged meanwhile) is left out rather than failing
+// the whole archive. Any other error stops the archive; what was already
+// written to w is then an incomplete archive.
+func Write(ctx context.Context, w io.Writer, backend storage.Backend, format Format, entries []Entry) error {
+	switch format {
+	case FormatZip:
+		return writeZip(ctx, w, backend, entries)
+	case FormatTarGz:
+		return writeTarGz(ctx, w, backend, entries)
+	}
+	return ErrInvalidFormat
+}
+
+// writeZip writes a zip archive.
+func writeZip(ctx context.Context, w io.Writer, backend storage.Backend, entries []Entry) error {
+	zw := zip.NewWriter(w)
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header := &zip.FileHeader{Name: entry.Name, Modified: entry.Modified}
+		if entry.Dir {
+			header.Name += "/"
+			header.SetMode(os.ModeDir | 0o755)
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, ok, err := open(ctx, backend, entry)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		header.UncompressedSize64 = uint64(entry.Size)
+		header.Method = zip.Store
+		if entry.Compress {
+			header.Method = zip.Deflate
+		}
+		header.SetMode(0o644)
+
+		dst, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(dst, content)
+		}
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("failed to archive %q: %w", entry.Name, err)
+		}
+	}
+
+	// Close writes the central directory (and the ZIP64 end records if needed)
+	return zw.Close()
+}
+
+// writeTarGz writes a gzip-compressed tar archive.
+func writeTarGz(ctx context.Context, w io.Writer, backend storage.Backend, entries []Entry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.Dir {
+			err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     entry.Name + "/",
+				Mode:     0o755,
+				ModTime:  entry.Modified,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, ok, err := open(ctx, backend, entry)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		// tar.Writer picks the PAX format by itself for long names and
+		// files over 8 GiB
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.Name,
+			Mode:     0o644,
+			Size:     entry.Size,
+			ModTime:  entry.Modified,
+		})
+		if err == nil {
+			// A short copy fails here too: tar.Writer rejects a header
+			// whose size doesn't match the bytes written
+			_, err = io.CopyN(tw, content, entry.Size)
+		}
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("failed to archive %q: %w", entry.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// open opens an entry's content. ok is false if the object no longer exists.
+func open(ctx context.Context, backend storage.Backend, entry Entry) (io.ReadCloser, bool, error) {
+	content, _, err := backend.Get(ctx, entry.Key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %q: %w", entry.Name, err)
+	}
+	return content, true, nil
+}
@@ -0,0 +1,168 @@
+// This file implements HTTP Basic authentication against User records.
+//
+// LEARNING NOTES:
+// ===============
+// WHO NEEDS BASIC AUTH:
+// Desktop WebDAV clients (Finder, Windows Explorer, davfs2) can't log in
+// and refresh JWTs; they send "Authorization: Basic base64(user:pass)" on
+// every request. The user name is the account's email and the password is
+// either the account password or one of its API keys. API keys are the
+// better choice: they can be revoked one by one without changing the
+// password everywhere.
+//
+// TWO KINDS OF HASHES:
+//   - Passwords are chosen by people and guessable, so they are stored with
+//     bcrypt, which is deliberately slow (~250 ms at cost 12).
+//   - API keys are 256 random bits; nobody can guess them, so a fast
+//     SHA-256 is enough (HashAPIKey) and the check costs nothing.
+//
+// A file manager sends dozens of requests per folder it opens, and each
+// would pay the bcrypt cost again. So a successful password check is
+// remembered for a few minutes under a hash of the user, their current
+// password hash and the password. Changing the password changes the
+// stored hash, which retires the cached entries.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Password check cache settings
+const (
+	verifiedTTL = 5 * time.Minute
+	maxVerified = 10000 // Entries before the cache is cleared
+)
+
+// dummyHash is compared against when the email is unknown, so that
+// unknown and known emails take about as long to reject. It is made on
+// first use, not when the program starts.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// HashAPIKey returns the form in which an API key is stored in
+// APIKey.Key: the hex SHA-256 of the key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// BasicAuthenticator checks email and password (or API key) pairs.
+type BasicAuthenticator struct {
+	users repository.UserRepository
+
+	mu       sync.Mutex
+	verified map[string]time.Time // Cache key -> expiry of a successful password check
+}
+
+// NewBasicAuthenticator creates a BasicAuthenticator.
+func NewBasicAuthenticator(users repository.UserRepository) *BasicAuthenticator {
+	return &BasicAuthenticator{users: users, verified: make(map[string]time.Time)}
+}
+
+// Authenticate returns the active user with the email whose password or
+// unexpired API key is secret.
+func (a *BasicAuthenticator) Authenticate(ctx context.Context, email, secret string) (*models.User, error) {
+	user, err := a.users.GetByEmail(ctx, email)
+	if apperrors.Is(err, apperrors.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(secret))
+		return nil, apperrors.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive() {
+		return nil, apperrors.ErrUnauthorized
+	}
+
+	hashed := HashAPIKey(secret)
+	now := time.Now()
+	for _, key := range user.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(hashed)) == 1 {
+			if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+				return nil, apperrors.ErrUnauthorized
+			}
+			return user, nil
+		}
+	}
+
+	if a.checkPassword(user, secret) {
+		return user, nil
+	}
+	return nil, apperrors.ErrUnauthorized
+}
+
+// checkPassword compares a password with the user's bcrypt hash, or with
+// the cache of recent successful checks.
+func (a *BasicAuthenticator) checkPassword(user *models.User, password string) bool {
+	sum := sha256.Sum256([]byte(user.ID.Hex() + "\x00" + user.PasswordHash + "\x00" + password))
+	cacheKey := string(sum[:])
+	now := time.Now()
+
+	a.mu.Lock()
+	expiry, ok := a.verified[cacheKey]
+	a.mu.Unlock()
+	if ok && now.Before(expiry) {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+
+	a.mu.Lock()
+	if len(a.verified) >= maxVerified {
+		a.verified = make(map[string]time.Time)
+	}
+	a.verified[cacheKey] = now.Add(verifiedTTL)
+	a.mu.Unlock()
+	return true
+}
+
+// Middleware authenticates requests with Basic credentials and calls
+// SetUser. Requests without valid credentials get 401 with a
+// WWW-Authenticate challenge, which makes clients ask for a password.
+//
+// USAGE:
+//
+//	basic := auth.NewBasicAuthenticator(userRepo)
+//	dav := router.Group("/dav", basic.Middleware("File Storage"))
+func (a *BasicAuthenticator) Middleware(realm string) gin.HandlerFunc {
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(c *gin.Context) {
+		email, secret, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", challenge)
+			apperrors.AbortWithError(c, apperrors.ErrUnauthorized)
+			return
+		}
+
+		user, err := a.Authenticate(c.Request.Context(), email, secret)
+		if err != nil {
+			if !apperrors.Is(err, apperrors.ErrUnauthorized) {
+				apperrors.AbortWithError(c, apperrors.ErrInternalServer)
+				return
+			}
+			c.Header("WWW-Authenticate", challenge)
+			apperrors.AbortWithError(c, apperrors.ErrUnauthorized)
+			return
+		}
+
+		SetUser(c, user)
+		c.Next()
+	}
+}
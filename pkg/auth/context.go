@@ -0,0 +1,78 @@
+// Package auth carries the authenticated user through HTTP requests.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Storing request-scoped values in gin.Context
+// 2. Type assertions when reading values back out
+// 3. Small middleware that guards a group of routes
+//
+// HOW IT FITS TOGETHER:
+// The authentication middleware (JWT or API key) verifies the caller and
+// calls SetUser. Handlers further down the chain call CurrentUser instead of
+// knowing anything about tokens. That keeps every feature handler
+// independent of how users log in.
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// userKey is the gin.Context key under which the user is stored.
+// It is unexported so other packages can't read or overwrite it directly.
+const userKey = "auth.user"
+
+// SetUser records the authenticated user for the rest of the request.
+func SetUser(c *gin.Context, user *models.User) {
+	c.Set(userKey, user)
+}
+
+// CurrentUser returns the authenticated user, if any.
+//
+// TYPE ASSERTION:
+// c.Get returns an interface{}. value.(*models.User) checks that the dynamic
+// type really is *models.User; the two-value form reports failure with ok
+// instead of panicking.
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	value, exists := c.Get(userKey)
+	if !exists {
+		return nil, false
+	}
+	user, ok := value.(*models.User)
+	return user, ok && user != nil
+}
+
+// RequireUser rejects requests that reach it without an authenticated user.
+//
+// USAGE:
+//
+//	api := router.Group("/api/v1", authMiddleware, auth.RequireUser())
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUser(c); !ok {
+			apperrors.AbortWithError(c, apperrors.ErrUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects requests from users without the admin role.
+// Place it after the authentication middleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			apperrors.AbortWithError(c, apperrors.ErrUnauthorized)
+			return
+		}
+		if !user.IsAdmin() {
+			apperrors.AbortWithError(c, apperrors.ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
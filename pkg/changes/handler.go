@@ -0,0 +1,98 @@
+// This file exposes the change feed over HTTP.
+package changes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+)
+
+// Handler serves the change feed endpoints.
+type Handler struct {
+	journal *Journal
+}
+
+// NewHandler creates a change feed Handler.
+func NewHandler(journal *Journal) *Handler {
+	return &Handler{journal: journal}
+}
+
+// RegisterRoutes mounts the change feed routes on a router group.
+//
+// A long poll holds the request open for up to MaxWait, so the server's
+// WriteTimeout must be longer than that.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/changes", h.Changes)
+	r.GET("/changes/latest", h.Latest)
+}
+
+// Latest returns the cursor to start following the feed from.
+//
+// GET /changes/latest
+func (h *Handler) Latest(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	cursor, err := h.journal.Latest(c.Request.Context(), user.ID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cursor": cursor})
+}
+
+// Changes returns what changed after a cursor. With wait (seconds, at
+// most 60) the request is held open until something changes.
+//
+// GET /changes?cursor=41&limit=100&wait=60
+func (h *Handler) Changes(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	cursor := c.Query("cursor")
+	if cursor == "" {
+		_ = c.Error(ErrInvalidCursor)
+		return
+	}
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	wait, err := queryInt(c, "wait")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	delta, err := h.journal.Wait(c.Request.Context(), user.ID, cursor, limit, time.Duration(wait)*time.Second)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, delta)
+}
+
+// queryInt reads an optional, non-negative integer URL parameter.
+func queryInt(c *gin.Context, name string) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, apperrors.ErrBadRequest
+	}
+	return value, nil
+}
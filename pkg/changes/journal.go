@@ -0,0 +1,245 @@
+// Package changes keeps a per-user change feed: a journal of every file
+// and folder that was created, updated, moved, deleted or shared, which
+// clients read from a cursor instead of listing everything again.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Capturing changes with repository decorators (observer.go)
+// 2. Cursors over a per-user sequence number, and the gaps they must survive
+// 3. Long polling with channels: requests that wait until there is news
+//
+// HOW A CLIENT USES IT:
+//
+//	GET /changes/latest             -> {"cursor": "41"}   (then list everything once)
+//	GET /changes?cursor=41&wait=60  -> waits until something changes, then
+//	                                   {"changes": [...], "cursor": "44", "has_more": false}
+//	GET /changes?cursor=44&wait=60  -> ...
+//
+// Each response's cursor goes into the next request, so no change is seen
+// twice or missed, even across restarts of the client.
+//
+// GAPS:
+// Sequence numbers are handed out before the change is written (see
+// repository/change_repository.go), so for a moment change 43 may be
+// readable while 42 isn't yet. Returning 43 would move the client's cursor
+// past 42 for good. Since therefore stops at the first gap, unless the
+// change after it is older than gapTimeout - then 42 is never coming (its
+// write failed) and the gap is skipped.
+//
+// LONG POLLING:
+// A waiting request parks on a channel of its user. Record closes that
+// channel after every change, waking all of the user's waiters at once.
+// With several API servers, a change recorded by another server doesn't
+// close our channels, so waiters also look at the journal every
+// recheckInterval.
+package changes
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Feed settings
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// MaxWait caps how long a long-poll request is held open
+	MaxWait = 60 * time.Second
+
+	// recheckInterval is how often a waiting request looks for changes
+	// recorded by other servers
+	recheckInterval = 5 * time.Second
+
+	// gapTimeout is how long a missing sequence number is waited for
+	gapTimeout = 10 * time.Second
+)
+
+var (
+	// ErrInvalidCursor is returned for cursors that are malformed or ahead
+	// of the journal.
+	ErrInvalidCursor = apperrors.New("INVALID_CURSOR", "The cursor is invalid", http.StatusBadRequest)
+
+	// ErrCursorExpired means changes after the cursor have expired from
+	// the journal; the client must list everything again.
+	ErrCursorExpired = apperrors.New("CURSOR_EXPIRED", "Changes since this cursor are no longer available; get a new cursor and list everything again", http.StatusGone)
+)
+
+// Journal records changes and serves them from cursors.
+type Journal struct {
+	changes repository.ChangeRepository
+
+	mu   sync.Mutex
+	wake map[primitive.ObjectID]chan struct{} // Closed on the user's next change
+}
+
+// NewJournal creates a Journal.
+func NewJournal(changes repository.ChangeRepository) *Journal {
+	return &Journal{changes: changes, wake: make(map[primitive.ObjectID]chan struct{})}
+}
+
+// Delta is one response of the feed.
+type Delta struct {
+	Changes []*models.Change `json:"changes"`
+	Cursor  string           `json:"cursor"`   // Pass to the next request
+	HasMore bool             `json:"has_more"` // More changes are ready; ask again right away
+}
+
+// Record appends a change to the journal of each user (duplicates are
+// recorded once) and wakes their waiting requests.
+//
+// Recording is best effort, like search indexing: the item has already
+// been written, so a failure here is not reported to the caller. The lost
+// sequence number becomes a gap that readers skip after gapTimeout.
+//
+// INSIDE A TRANSACTION:
+// When the item is written in a transaction (events.Outbox.Commit), the
+// change is recorded after the commit (repository.AfterCommit), not in
+// it. Waiters must not wake for a write that may still be rolled back,
+// and the user's sequence counter must not join every transaction - two
+// concurrent writes of one user would then conflict on it. A crash right
+// after the commit loses the change, as a failed Append does.
+func (j *Journal) Record(ctx context.Context, change *models.Change, userIDs ...primitive.ObjectID) {
+	seen := make(map[primitive.ObjectID]bool, len(userIDs))
+	var audience []primitive.ObjectID
+	for _, userID := range userIDs {
+		if !seen[userID] {
+			seen[userID] = true
+			audience = append(audience, userID)
+		}
+	}
+
+	repository.AfterCommit(ctx, func(ctx context.Context) {
+		for _, userID := range audience {
+			entry := *change
+			entry.UserID = userID
+			_ = j.changes.Append(ctx, &entry)
+			j.notify(userID)
+		}
+	})
+}
+
+// Latest returns a cursor for "now": changes from here on.
+func (j *Journal) Latest(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	_, latest, err := j.changes.Bounds(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return encodeCursor(latest), nil
+}
+
+// Since returns up to limit changes after the cursor.
+func (j *Journal) Since(ctx context.Context, userID primitive.ObjectID, cursor string, limit int) (*Delta, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+
+	oldest, latest, err := j.changes.Bounds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case after > latest:
+		return nil, ErrInvalidCursor
+	case after < latest && (oldest == 0 || oldest > after+1):
+		return nil, ErrCursorExpired
+	}
+
+	changes, err := j.changes.ListSince(ctx, userID, after, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop at a gap that may still fill (see GAPS above)
+	full := len(changes) == limit
+	next := after
+	for n, change := range changes {
+		if change.Seq != next+1 && time.Since(change.CreatedAt) < gapTimeout {
+			changes, full = changes[:n], false
+			break
+		}
+		next = change.Seq
+	}
+
+	if changes == nil {
+		changes = []*models.Change{}
+	}
+	return &Delta{Changes: changes, Cursor: encodeCursor(next), HasMore: full}, nil
+}
+
+// Wait is Since, but if there are no changes yet it waits up to wait
+// (at most MaxWait) for some. An empty Delta means nothing happened.
+func (j *Journal) Wait(ctx context.Context, userID primitive.ObjectID, cursor string, limit int, wait time.Duration) (*Delta, error) {
+	deadline := time.NewTimer(min(wait, MaxWait))
+	defer deadline.Stop()
+
+	for {
+		// Subscribe before looking, so a change in between still wakes us
+		wake := j.waiter(userID)
+
+		delta, err := j.Since(ctx, userID, cursor, limit)
+		if err != nil || len(delta.Changes) > 0 || wait <= 0 {
+			return delta, err
+		}
+
+		select {
+		case <-wake:
+		case <-time.After(recheckInterval):
+		case <-deadline.C:
+			return delta, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// waiter returns the channel closed on the user's next change.
+func (j *Journal) waiter(userID primitive.ObjectID) <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ch, ok := j.wake[userID]
+	if !ok {
+		ch = make(chan struct{})
+		j.wake[userID] = ch
+	}
+	return ch
+}
+
+// notify wakes everyone waiting for the user's changes. The channel is
+// removed, so the map only holds users somebody is waiting for.
+func (j *Journal) notify(userID primitive.ObjectID) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if ch, ok := j.wake[userID]; ok {
+		close(ch)
+		delete(j.wake, userID)
+	}
+}
+
+// encodeCursor and decodeCursor convert sequence numbers to cursors.
+// Clients treat cursors as opaque strings.
+func encodeCursor(seq int64) string {
+	return strconv.FormatInt(seq, 10)
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	seq, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
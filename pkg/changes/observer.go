@@ -0,0 +1,312 @@
+// This file records changes as files and folders are written.
+//
+// LEARNING NOTES:
+// ===============
+// SAME PATTERN AS SEARCH INDEXING:
+// JournaledFiles and JournaledFolders wrap the repositories exactly like
+// search.IndexedFiles does, so every service and worker feeds the journal
+// without knowing it exists. Decorators stack:
+//
+//	files := repository.NewFileRepository(db)
+//	files = search.NewIndexedFiles(files, index)
+//	files = changes.NewJournaledFiles(files, journal)
+//
+// WHAT THE OLD DOCUMENT IS FOR:
+// Update receives only the new version of a document. To say what kind
+// of change it was - a move, a new version, a trip to the trash - the
+// decorator reads the stored document first and compares. That is one
+// extra read per update, in exchange for a journal nobody has to
+// remember to write to.
+//
+// WHO HEARS ABOUT IT:
+// A change goes to the owner's journal and to the journal of everyone
+// the item is shared with directly. Items inside a shared folder are only
+// in their owner's journal; clients of a shared folder see its own
+// changes and list it again.
+//
+// Only what a client mirrors is journaled: existence, path, content and
+// sharing. Thumbnails, metadata, scan results and tags are not.
+package changes
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// =============================================================================
+// FILES
+// =============================================================================
+
+// JournaledFiles is a FileRepository that records every successful write
+// that changes a file's existence, path, content or sharing.
+type JournaledFiles struct {
+	repository.FileRepository
+	journal *Journal
+}
+
+// NewJournaledFiles wraps a FileRepository.
+func NewJournaledFiles(files repository.FileRepository, journal *Journal) *JournaledFiles {
+	return &JournaledFiles{FileRepository: files, journal: journal}
+}
+
+func (r *JournaledFiles) Create(ctx context.Context, file *models.File) error {
+	if err := r.FileRepository.Create(ctx, file); err != nil {
+		return err
+	}
+	if file.IsActive() {
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeCreated, file), fileAudience(file)...)
+	}
+	return nil
+}
+
+func (r *JournaledFiles) Update(ctx context.Context, file *models.File) error {
+	old, err := r.FileRepository.GetByID(ctx, file.ID)
+	if err != nil {
+		return r.FileRepository.Update(ctx, file) // Update reports the real problem
+	}
+	if err := r.FileRepository.Update(ctx, file); err != nil {
+		return err
+	}
+
+	switch {
+	case old.IsActive() && !file.IsActive():
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeDeleted, file), fileAudience(old)...)
+		return nil
+	case !old.IsActive() && file.IsActive():
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeRestored, file), fileAudience(file)...)
+		return nil
+	case !file.IsActive():
+		return nil // Changes in the trash concern nobody
+	}
+
+	if old.FilePath != file.FilePath {
+		change := models.NewFileChange(models.ChangeMoved, file)
+		change.OldPath = old.FilePath
+		r.journal.Record(ctx, change, fileAudience(file)...)
+	}
+	if old.Version != file.Version || old.Checksum != file.Checksum {
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeUpdated, file), fileAudience(file)...)
+	}
+	r.journal.recordSharing(ctx, file.UserID, old.SharedWith, file.SharedWith, func(changeType models.ChangeType) *models.Change {
+		return models.NewFileChange(changeType, file)
+	})
+	return nil
+}
+
+func (r *JournaledFiles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	old, lookupErr := r.FileRepository.GetByID(ctx, id)
+	if err := r.FileRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	// A purge from the trash was journaled when the file went there
+	if lookupErr == nil && old.IsActive() {
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeDeleted, old), fileAudience(old)...)
+	}
+	return nil
+}
+
+func (r *JournaledFiles) SoftDeleteUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, deletedAt time.Time) (int64, error) {
+	affected, err := r.FileRepository.FindUnderPath(ctx, userID, folderPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.FileRepository.SoftDeleteUnderPath(ctx, userID, folderPath, deletedAt)
+	if err != nil {
+		return count, err
+	}
+	for _, file := range affected {
+		r.journal.Record(ctx, models.NewFileChange(models.ChangeDeleted, file), fileAudience(file)...)
+	}
+	return count, nil
+}
+
+func (r *JournaledFiles) MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error) {
+	affected, err := r.FileRepository.FindUnderPath(ctx, userID, from)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.FileRepository.MoveUnderPath(ctx, userID, from, to)
+	if err != nil {
+		return count, err
+	}
+	for _, file := range affected {
+		change := models.NewFileChange(models.ChangeMoved, file)
+		change.OldPath = file.FilePath
+		change.Path = to + strings.TrimPrefix(file.FilePath, from)
+		r.journal.Record(ctx, change, fileAudience(file)...)
+	}
+	return count, nil
+}
+
+// fileAudience is everyone whose journal hears about a file.
+func fileAudience(file *models.File) []primitive.ObjectID {
+	return audience(file.UserID, file.SharedWith)
+}
+
+// =============================================================================
+// FOLDERS
+// =============================================================================
+
+// JournaledFolders is a FolderRepository that records every successful
+// write that changes a folder's existence, path or sharing.
+type JournaledFolders struct {
+	repository.FolderRepository
+	journal *Journal
+}
+
+// NewJournaledFolders wraps a FolderRepository.
+func NewJournaledFolders(folders repository.FolderRepository, journal *Journal) *JournaledFolders {
+	return &JournaledFolders{FolderRepository: folders, journal: journal}
+}
+
+func (r *JournaledFolders) Create(ctx context.Context, folder *models.Folder) error {
+	if err := r.FolderRepository.Create(ctx, folder); err != nil {
+		return err
+	}
+	r.journal.Record(ctx, models.NewFolderChange(models.ChangeCreated, folder), folderAudience(folder)...)
+	return nil
+}
+
+func (r *JournaledFolders) Ensure(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	ensured, err := r.FolderRepository.Ensure(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	// Our folder was inserted, rather than an existing one found
+	if ensured.ID == folder.ID {
+		r.journal.Record(ctx, models.NewFolderChange(models.ChangeCreated, ensured), folderAudience(ensured)...)
+	}
+	return ensured, nil
+}
+
+func (r *JournaledFolders) Update(ctx context.Context, folder *models.Folder) error {
+	old, err := r.FolderRepository.GetByID(ctx, folder.ID)
+	if err != nil {
+		return r.FolderRepository.Update(ctx, folder)
+	}
+	if err := r.FolderRepository.Update(ctx, folder); err != nil {
+		return err
+	}
+
+	switch {
+	case old.IsActive() && !folder.IsActive():
+		r.journal.Record(ctx, models.NewFolderChange(models.ChangeDeleted, folder), folderAudience(old)...)
+		return nil
+	case !old.IsActive() && folder.IsActive():
+		r.journal.Record(ctx, models.NewFolderChange(models.ChangeRestored, folder), folderAudience(folder)...)
+		return nil
+	case !folder.IsActive():
+		return nil
+	}
+
+	if old.Path != folder.Path {
+		change := models.NewFolderChange(models.ChangeMoved, folder)
+		change.OldPath = old.Path
+		r.journal.Record(ctx, change, folderAudience(folder)...)
+	}
+	r.journal.recordSharing(ctx, folder.UserID, old.SharedWith, folder.SharedWith, func(changeType models.ChangeType) *models.Change {
+		return models.NewFolderChange(changeType, folder)
+	})
+	return nil
+}
+
+func (r *JournaledFolders) SoftDeleteSubtree(ctx context.Context, folder *models.Folder, deletedAt time.Time) (int64, error) {
+	below, err := r.FolderRepository.FindUnderPath(ctx, folder.UserID, folder.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.FolderRepository.SoftDeleteSubtree(ctx, folder, deletedAt)
+	if err != nil {
+		return count, err
+	}
+	for _, deleted := range append([]*models.Folder{folder}, below...) {
+		r.journal.Record(ctx, models.NewFolderChange(models.ChangeDeleted, deleted), folderAudience(deleted)...)
+	}
+	return count, nil
+}
+
+func (r *JournaledFolders) Delete(ctx context.Context, id primitive.ObjectID) error {
+	old, lookupErr := r.FolderRepository.GetByID(ctx, id)
+	if err := r.FolderRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	if lookupErr == nil && old.IsActive() {
+		r.journal.Record(ctx, models.NewFolderChange(models.ChangeDeleted, old), folderAudience(old)...)
+	}
+	return nil
+}
+
+func (r *JournaledFolders) MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error) {
+	affected, err := r.FolderRepository.FindUnderPath(ctx, userID, from)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.FolderRepository.MoveUnderPath(ctx, userID, from, to)
+	if err != nil {
+		return count, err
+	}
+	for _, folder := range affected {
+		change := models.NewFolderChange(models.ChangeMoved, folder)
+		change.OldPath = folder.Path
+		change.Path = to + strings.TrimPrefix(folder.Path, from)
+		r.journal.Record(ctx, change, folderAudience(folder)...)
+	}
+	return count, nil
+}
+
+// folderAudience is everyone whose journal hears about a folder.
+func folderAudience(folder *models.Folder) []primitive.ObjectID {
+	return audience(folder.UserID, folder.SharedWith)
+}
+
+// =============================================================================
+// SHARING
+// =============================================================================
+
+// audience is an item's owner followed by its direct recipients.
+func audience(ownerID primitive.ObjectID, shares []models.SharedUser) []primitive.ObjectID {
+	users := []primitive.ObjectID{ownerID}
+	for _, share := range shares {
+		users = append(users, share.UserID)
+	}
+	return users
+}
+
+// recordSharing records a change of an item's shares, if there is one:
+// "unshared" for those who lost access, "shared" for the owner and
+// everyone who has access now.
+func (j *Journal) recordSharing(ctx context.Context, ownerID primitive.ObjectID, before, after []models.SharedUser, newChange func(models.ChangeType) *models.Change) {
+	permissions := make(map[primitive.ObjectID]models.FilePermission, len(before))
+	for _, share := range before {
+		permissions[share.UserID] = share.Permission
+	}
+	changed := len(before) != len(after)
+	for _, share := range after {
+		if permission, ok := permissions[share.UserID]; !ok || permission != share.Permission {
+			changed = true
+		}
+		delete(permissions, share.UserID)
+	}
+	if !changed {
+		return
+	}
+
+	var removed []primitive.ObjectID
+	for userID := range permissions {
+		removed = append(removed, userID)
+	}
+	if len(removed) > 0 {
+		j.Record(ctx, newChange(models.ChangeUnshared), removed...)
+	}
+	j.Record(ctx, newChange(models.ChangeShared), audience(ownerID, after)...)
+}
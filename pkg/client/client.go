@@ -0,0 +1,459 @@
+// Package client is a Go client for the file storage REST API. The fsctl
+// command-line tool is built on it, and it suits scripts and integrations
+// that would rather not speak HTTP themselves.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Wrapping a REST API in typed methods with net/http
+// 2. Turning error responses back into Go errors callers can inspect
+// 3. Resumable transfers: tus uploads and ranged downloads (transfer.go)
+//
+// AUTHENTICATION:
+// Every request carries the account email and an API key as HTTP Basic
+// credentials, which auth.BasicAuthenticator checks on the server. The API
+// group must accept them:
+//
+//	basic := auth.NewBasicAuthenticator(userRepo)
+//	api := router.Group("/api/v1", basic.Middleware("File Storage"))
+//
+// API keys rather than passwords: a key can be revoked without changing
+// the password, and a leaked config file doesn't expose the account.
+//
+// SHARED MODELS:
+// Responses decode into the server's own models (models.File,
+// models.Folder). The few response shapes defined by handler packages
+// are mirrored here, so that a client binary doesn't link gin and the
+// repositories just to read JSON.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Client calls the API as one user. It is safe for concurrent use.
+type Client struct {
+	baseURL string // e.g. "https://files.example.com/api/v1", no trailing slash
+	email   string
+	apiKey  string
+	http    *http.Client
+}
+
+// Config holds what a Client needs to reach the API.
+type Config struct {
+	BaseURL string
+	Email   string
+	APIKey  string
+
+	// HTTPClient is optional; the default has no overall timeout, because
+	// transfers of large files take as long as they take
+	HTTPClient *http.Client
+}
+
+// New creates a Client.
+func New(cfg Config) *Client {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		email:   cfg.Email,
+		apiKey:  cfg.APIKey,
+		http:    httpClient,
+	}
+}
+
+// =============================================================================
+// ERRORS
+// =============================================================================
+
+// Error is an error response from the API, e.g. 404 NOT_FOUND.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// hasStatus reports whether err is an API error with the status code.
+func hasStatus(err error, status int) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == status
+}
+
+// readError builds an Error from a failed response and closes its body.
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(body, apiErr) // Non-JSON bodies leave just the status
+	return apiErr
+}
+
+// =============================================================================
+// REQUESTS
+// =============================================================================
+
+// newRequest builds an authenticated request for an API path such as
+// "/resolve". Query parameters go in query, which may be nil.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.email, c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// do sends a request and returns the response if it succeeded (2xx).
+// Otherwise the body is read into an *Error.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+// call sends a JSON request (in may be nil) and decodes the JSON response
+// into out (which may be nil).
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// =============================================================================
+// FOLDERS AND PATHS
+// =============================================================================
+
+// Entry is what is at a path: the root (neither set), a folder or a file.
+type Entry struct {
+	Path   string         `json:"path"`
+	Folder *models.Folder `json:"folder,omitempty"`
+	File   *models.File   `json:"file,omitempty"`
+}
+
+// IsRoot reports whether the entry is the top of the tree.
+func (e *Entry) IsRoot() bool { return e.Folder == nil && e.File == nil }
+
+// Item is one entry of a folder listing.
+type Item struct {
+	Type   models.ItemType `json:"type"`
+	Folder *models.Folder  `json:"folder,omitempty"`
+	File   *models.File    `json:"file,omitempty"`
+}
+
+// listing is one page of GET /folders/:id/items.
+type listing struct {
+	Items      []Item `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Resolve returns what is at a path, like "/Documents/report.pdf".
+func (c *Client) Resolve(ctx context.Context, path string) (*Entry, error) {
+	var entry Entry
+	if err := c.call(ctx, http.MethodGet, "/resolve", url.Values{"path": {path}}, nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// List returns everything in a folder, folders first, following the
+// pages. A nil folderID lists the root.
+func (c *Client) List(ctx context.Context, folderID *primitive.ObjectID) ([]Item, error) {
+	id := "root"
+	if folderID != nil {
+		id = folderID.Hex()
+	}
+
+	var items []Item
+	query := url.Values{"limit": {"200"}}
+	for {
+		var page listing
+		if err := c.call(ctx, http.MethodGet, "/folders/"+id+"/items", query, nil, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.NextCursor == "" {
+			return items, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// Mkdir creates a folder and any missing parents. An existing folder is
+// returned as it is.
+func (c *Client) Mkdir(ctx context.Context, path string) (*models.Folder, error) {
+	var folder models.Folder
+	if err := c.call(ctx, http.MethodPost, "/folders", nil, map[string]string{"path": path}, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// =============================================================================
+// MOVE, COPY AND TRASH
+// =============================================================================
+
+// Target says where a move or copy goes. Conflict is fail (default),
+// overwrite, rename or skip.
+type Target struct {
+	To       string `json:"to"`
+	Name     string `json:"name,omitempty"`
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Result is the outcome of an upload, move or copy. Large folder copies
+// run in the background and return a Job instead.
+type Result struct {
+	File    *models.File          `json:"file,omitempty"`
+	Folder  *models.Folder        `json:"folder,omitempty"`
+	Job     *models.ProcessingJob `json:"job,omitempty"`
+	Outcome string                `json:"outcome"`
+}
+
+// Move moves and/or renames what entry describes.
+func (c *Client) Move(ctx context.Context, entry *Entry, target Target) (*Result, error) {
+	path, err := itemPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	var result Result
+	if err := c.call(ctx, http.MethodPost, path+"/move", nil, target, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Copy copies what entry describes.
+func (c *Client) Copy(ctx context.Context, entry *Entry, target Target) (*Result, error) {
+	path, err := itemPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	var result Result
+	if err := c.call(ctx, http.MethodPost, path+"/copy", nil, target, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Delete moves what entry describes to the trash.
+func (c *Client) Delete(ctx context.Context, entry *Entry) error {
+	path, err := itemPath(entry)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// RestoreFile takes a file back out of the trash.
+func (c *Client) RestoreFile(ctx context.Context, fileID primitive.ObjectID) error {
+	return c.call(ctx, http.MethodPost, "/files/"+fileID.Hex()+"/restore", nil, nil, nil)
+}
+
+// itemPath returns the API path of a file or folder: "/files/{id}" or
+// "/folders/{id}". The root can't be moved, copied or deleted.
+func itemPath(entry *Entry) (string, error) {
+	switch {
+	case entry.File != nil:
+		return "/files/" + entry.File.ID.Hex(), nil
+	case entry.Folder != nil:
+		return "/folders/" + entry.Folder.ID.Hex(), nil
+	default:
+		return "", fmt.Errorf("the root folder can't be changed")
+	}
+}
+
+// =============================================================================
+// VERSIONS
+// =============================================================================
+
+// Versions returns the earlier versions of a file, newest first.
+func (c *Client) Versions(ctx context.Context, fileID primitive.ObjectID) ([]*models.FileVersion, error) {
+	var out struct {
+		Versions []*models.FileVersion `json:"versions"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/files/"+fileID.Hex()+"/versions", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Versions, nil
+}
+
+// RestoreVersion makes an earlier version current again (as a new
+// version) and returns the file.
+func (c *Client) RestoreVersion(ctx context.Context, fileID primitive.ObjectID, version int) (*models.File, error) {
+	var file models.File
+	path := "/files/" + fileID.Hex() + "/versions/" + strconv.Itoa(version) + "/restore"
+	if err := c.call(ctx, http.MethodPost, path, nil, nil, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// =============================================================================
+// SHARING
+// =============================================================================
+
+// Share gives a user read, write or admin permission on what entry
+// describes, and returns the updated item.
+func (c *Client) Share(ctx context.Context, entry *Entry, email string, permission models.FilePermission) (*Entry, error) {
+	body := map[string]string{"email": email, "permission": string(permission)}
+	return c.share(ctx, http.MethodPut, entry, nil, body)
+}
+
+// Unshare takes a user's access away, and returns the updated item.
+func (c *Client) Unshare(ctx context.Context, entry *Entry, email string) (*Entry, error) {
+	return c.share(ctx, http.MethodDelete, entry, url.Values{"email": {email}}, nil)
+}
+
+func (c *Client) share(ctx context.Context, method string, entry *Entry, query url.Values, body any) (*Entry, error) {
+	path, err := itemPath(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &Entry{Path: entry.Path}
+	var out any = &updated.Folder
+	if entry.File != nil {
+		out = &updated.File
+	}
+	if err := c.call(ctx, method, path+"/shares", query, body, out); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// =============================================================================
+// JOBS
+// =============================================================================
+
+// Job returns a background job, e.g. a large folder copy.
+func (c *Client) Job(ctx context.Context, jobID primitive.ObjectID) (*models.ProcessingJob, error) {
+	var job models.ProcessingJob
+	if err := c.call(ctx, http.MethodGet, "/jobs/"+jobID.Hex(), nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitJob polls a job until it finishes or ctx ends.
+func (c *Client) WaitJob(ctx context.Context, jobID primitive.ObjectID, interval time.Duration) (*models.ProcessingJob, error) {
+	for {
+		job, err := c.Job(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == models.JobCompleted || job.Status == models.JobDead {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// =============================================================================
+// CHANGES
+// =============================================================================
+
+// Delta is one response of the change feed, mirroring changes.Delta.
+type Delta struct {
+	Changes []*models.Change `json:"changes"`
+	Cursor  string           `json:"cursor"`
+	HasMore bool             `json:"has_more"`
+}
+
+// IsCursorExpired reports whether err means the changes since a cursor
+// are gone; the caller must list everything again with a new cursor.
+func IsCursorExpired(err error) bool {
+	return hasStatus(err, http.StatusGone)
+}
+
+// LatestCursor returns a cursor for "now". Get it before listing
+// everything, then follow Changes from it.
+func (c *Client) LatestCursor(ctx context.Context) (string, error) {
+	var out struct {
+		Cursor string `json:"cursor"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/changes/latest", nil, nil, &out); err != nil {
+		return "", err
+	}
+	return out.Cursor, nil
+}
+
+// Changes returns what changed after cursor. A positive wait (at most a
+// minute) holds the request open until something changes.
+func (c *Client) Changes(ctx context.Context, cursor string, wait time.Duration) (*Delta, error) {
+	query := url.Values{"cursor": {cursor}}
+	if wait > 0 {
+		query.Set("wait", strconv.Itoa(int(wait/time.Second)))
+	}
+	var delta Delta
+	if err := c.call(ctx, http.MethodGet, "/changes", query, nil, &delta); err != nil {
+		return nil, err
+	}
+	return &delta, nil
+}
@@ -0,0 +1,355 @@
+// This file implements uploads over tus and resumable downloads.
+//
+// LEARNING NOTES:
+// ===============
+// UPLOADS SURVIVE DISCONNECTS:
+// Upload sends a file in chunks over the tus protocol (see package tus).
+// When a chunk fails - a dropped connection, a 5xx, a checksum mismatch -
+// the client waits, asks the server how much arrived (HEAD) and carries on
+// from there, up to maxAttempts times in a row. Every chunk carries a SHA-1
+// checksum, so a chunk damaged on the way is refused rather than stored.
+//
+// UPLOADS SURVIVE RESTARTS:
+// The upload URL is handed to UploadOptions.OnCreate as soon as it
+// exists. A caller that saves it can pass it back as ResumeURL after a
+// crash or Ctrl-C, and the upload continues where the server says it
+// stopped. An expired or finished upload starts over.
+//
+// DOWNLOADS:
+// Download asks for the bytes from an offset on (Range) only if the file
+// is still the one the offset belongs to (If-Range with its ETag). If the
+// file changed in the meantime, the server sends all of it and Offset
+// reports 0, so the caller starts its local copy over.
+package client
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Upload settings
+const (
+	// DefaultChunkSize is the size of the PATCH requests of an upload
+	DefaultChunkSize = 8 << 20 // 8 MiB
+
+	// tusVersion is the protocol version sent with every tus request
+	tusVersion = "1.0.0"
+
+	// maxAttempts is how often one chunk is tried before giving up
+	maxAttempts = 5
+)
+
+// errUploadGone means a resumed upload no longer exists on the server.
+var errUploadGone = errors.New("upload expired or finished")
+
+// UploadOptions describe an upload.
+type UploadOptions struct {
+	Path     string // Target path, e.g. "/Photos/beach.jpg"
+	MimeType string // Defaults to application/octet-stream
+	Conflict string // fail (default), overwrite, rename or skip
+
+	ChunkSize int64 // Defaults to DefaultChunkSize
+
+	// ResumeURL continues an upload created earlier (see OnCreate)
+	ResumeURL string
+
+	// OnCreate is called with the URL of a new upload, for ResumeURL
+	OnCreate func(uploadURL string)
+
+	// Progress is called as bytes are sent, with the total sent so far
+	Progress func(sent, total int64)
+}
+
+// UploadResult names the file an upload ended up in. FileID is zero when
+// the upload was skipped because of a conflict.
+type UploadResult struct {
+	FileID  primitive.ObjectID `json:"file_id"`
+	Outcome string             `json:"outcome"` // created, overwritten, renamed or skipped
+}
+
+// Upload sends size bytes of content to opts.Path, resumably.
+func (c *Client) Upload(ctx context.Context, content io.ReaderAt, size int64, opts UploadOptions) (*UploadResult, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(sent, total int64) {}
+	}
+
+	uploadURL := opts.ResumeURL
+	var offset int64
+	if uploadURL != "" {
+		var err error
+		offset, err = c.uploadOffset(ctx, uploadURL)
+		if errors.Is(err, errUploadGone) {
+			uploadURL, offset = "", 0
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if uploadURL == "" {
+		var result *UploadResult
+		var err error
+		uploadURL, result, err = c.createUpload(ctx, size, opts)
+		if err != nil || result != nil {
+			return result, err // Failed, or an empty file that is complete already
+		}
+		if opts.OnCreate != nil {
+			opts.OnCreate(uploadURL)
+		}
+	}
+
+	attempt := 0
+	for {
+		progress(offset, size)
+		n := min(chunkSize, size-offset)
+		body := &progressReader{
+			r:      io.NewSectionReader(content, offset, n),
+			report: func(sent int64) { progress(offset+sent, size) },
+		}
+
+		next, result, err := c.patchUpload(ctx, uploadURL, offset, n, body, io.NewSectionReader(content, offset, n))
+		if err == nil {
+			if result != nil {
+				progress(size, size)
+				return result, nil
+			}
+			offset, attempt = next, 0
+			continue
+		}
+
+		attempt++
+		if attempt >= maxAttempts || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff(attempt)):
+		}
+		// Whatever arrived of the failed chunk counts; ask how much that was
+		if offset, err = c.uploadOffset(ctx, uploadURL); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// createUpload starts a tus upload and returns its URL. An empty file is
+// complete at once; then the result is returned instead.
+func (c *Client) createUpload(ctx context.Context, size int64, opts UploadOptions) (string, *UploadResult, error) {
+	mimeType := opts.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	metadata := []string{
+		"filename " + base64.StdEncoding.EncodeToString([]byte(path.Base(opts.Path))),
+		"path " + base64.StdEncoding.EncodeToString([]byte(opts.Path)),
+		"filetype " + base64.StdEncoding.EncodeToString([]byte(mimeType)),
+	}
+	if opts.Conflict != "" {
+		metadata = append(metadata, "conflict "+base64.StdEncoding.EncodeToString([]byte(opts.Conflict)))
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/uploads", nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", strings.Join(metadata, ","))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	resp.Body.Close()
+
+	if result := uploadResult(resp); result != nil {
+		return "", result, nil
+	}
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", nil, fmt.Errorf("upload created without a valid Location")
+	}
+	return location.String(), nil, nil
+}
+
+// uploadOffset asks how many bytes of an upload the server has.
+func (c *Client) uploadOffset(ctx context.Context, uploadURL string) (int64, error) {
+	req, err := c.newUploadRequest(ctx, http.MethodHead, uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(req)
+	if hasStatus(err, http.StatusNotFound) || hasStatus(err, http.StatusGone) {
+		return 0, errUploadGone
+	}
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Upload-Offset from server")
+	}
+	return offset, nil
+}
+
+// patchUpload sends one chunk of n bytes at offset and returns the new
+// offset. The last chunk returns the result instead. hashed is a second
+// reader over the same bytes, read first to compute the checksum.
+func (c *Client) patchUpload(ctx context.Context, uploadURL string, offset, n int64, body, hashed io.Reader) (int64, *UploadResult, error) {
+	hasher := sha1.New()
+	if _, err := io.Copy(hasher, hashed); err != nil {
+		return 0, nil, err
+	}
+
+	req, err := c.newUploadRequest(ctx, http.MethodPatch, uploadURL, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp.Body.Close()
+
+	if result := uploadResult(resp); result != nil {
+		return 0, result, nil
+	}
+	next, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || next <= offset {
+		return 0, nil, fmt.Errorf("server did not accept the chunk at offset %d", offset)
+	}
+	return next, nil, nil
+}
+
+// newUploadRequest builds a tus request for an upload URL.
+func (c *Client) newUploadRequest(ctx context.Context, method, uploadURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uploadURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.email, c.apiKey)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req, nil
+}
+
+// uploadResult reads the outcome headers of a completed upload, or
+// returns nil if the upload isn't complete.
+func uploadResult(resp *http.Response) *UploadResult {
+	outcome := resp.Header.Get("X-Upload-Outcome")
+	if outcome == "" {
+		return nil
+	}
+	result := &UploadResult{Outcome: outcome}
+	if id, err := primitive.ObjectIDFromHex(resp.Header.Get("X-File-Id")); err == nil {
+		result.FileID = id
+	}
+	return result
+}
+
+// retryable reports whether a failed chunk is worth sending again:
+// network errors, server errors, checksum mismatches (460) and offset
+// mismatches (409, another attempt's bytes arrived after all).
+func retryable(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return true // Transport error
+	}
+	return apiErr.StatusCode >= 500 || apiErr.StatusCode == 460 || apiErr.StatusCode == http.StatusConflict
+}
+
+// backoff is the wait before retry number attempt: 1s, 2s, 4s, ...
+func backoff(attempt int) time.Duration {
+	return time.Second << (attempt - 1)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	report func(read int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.report(p.read)
+	return n, err
+}
+
+// =============================================================================
+// DOWNLOADS
+// =============================================================================
+
+// Download is an open file download.
+type Download struct {
+	Body   io.ReadCloser
+	Offset int64 // Where Body starts in the file: the requested offset, or 0 if the file changed
+	Size   int64 // Size of the whole file
+}
+
+// Download opens a file's content from offset on. etag (see FileETag)
+// is the version the offset belongs to; without it the whole file is
+// sent. The caller must close Body.
+func (c *Client) Download(ctx context.Context, fileID primitive.ObjectID, offset int64, etag string) (*Download, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/files/"+fileID.Hex()+"/content", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The stored bytes, not a compressed variant with its own ETag, so
+	// ranges and checksums refer to the file itself
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 && etag != "" {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", etag)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return &Download{Body: resp.Body, Size: resp.ContentLength}, nil
+	}
+	// Content-Range: bytes 1048576-5242879/5242880
+	var start, end, size int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != offset {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+	}
+	return &Download{Body: resp.Body, Offset: start, Size: size}, nil
+}
+
+// FileETag returns the ETag the server sends with a file's content.
+func FileETag(file *models.File) string {
+	tag := file.Checksum
+	if tag == "" {
+		tag = file.ID.Hex() + "-" + strconv.Itoa(file.Version)
+	}
+	return `"` + tag + `"`
+}
@@ -53,6 +53,9 @@ type Config struct {
 	RateLimit     RateLimitConfig     // Rate limiting configuration
 	Observability ObservabilityConfig // Logging, metrics, tracing configuration
 	Worker        WorkerConfig        // Background worker configuration
+	Processing    ProcessingConfig    // File processing (thumbnails, etc.)
+	Search        SearchConfig        // Embedded full-text search index
+	S3Gateway     S3GatewayConfig     // S3-compatible API over users' files
 	Email         EmailConfig         // Email notification configuration
 	Security      SecurityConfig      // Security settings
 	Services      ServicesConfig      // URLs for inter-service communication
@@ -225,8 +228,73 @@ type ObservabilityConfig struct {
 // Workers process tasks in the background.
 //
 // Concurrency controls how many tasks run simultaneously.
+//
+// RETRIES:
+// A failed task is retried after RetryBaseDelay, then 2x, 4x, 8x... that delay
+// (capped at RetryMaxDelay). After MaxAttempts it goes to the dead-letter queue.
+//
+// A worker holds a lease on the job it runs and renews it while the job is
+// running. A job whose lease ran out (its worker crashed) may be claimed again.
 type WorkerConfig struct {
-	Concurrency int `mapstructure:"worker_concurrency"` // Number of concurrent workers
+	Concurrency    int           `mapstructure:"worker_concurrency"`      // Number of concurrent workers
+	MaxAttempts    int           `mapstructure:"worker_max_attempts"`     // Attempts before dead-lettering
+	RetryBaseDelay time.Duration `mapstructure:"worker_retry_base_delay"` // Delay before the first retry
+	RetryMaxDelay  time.Duration `mapstructure:"worker_retry_max_delay"`  // Upper bound for retry delay
+	JobLease       time.Duration `mapstructure:"worker_job_lease"`        // How long a claimed job stays claimed without renewal
+}
+
+// ProcessingConfig holds settings for background file processing.
+//
+// SLICES FROM ENVIRONMENT VARIABLES:
+// THUMBNAIL_SIZES=150,300,600 is a single string. Viper splits it on commas
+// and converts each part to an int when unmarshalling into []int.
+type ProcessingConfig struct {
+	ThumbnailSizes   []int `mapstructure:"thumbnail_sizes"`   // Thumbnail widths in pixels
+	ThumbnailQuality int   `mapstructure:"thumbnail_quality"` // JPEG quality (1-100)
+
+	CompressionEnabled bool `mapstructure:"compression_enabled"` // Store gzip/zstd copies of compressible files
+
+	FFmpegPath            string        `mapstructure:"ffmpeg_path"`             // ffmpeg binary (name in $PATH or absolute path)
+	FFprobePath           string        `mapstructure:"ffprobe_path"`            // ffprobe binary
+	VideoTimeout          time.Duration `mapstructure:"video_timeout"`           // Upper bound for one ffmpeg run
+	VideoRenditionEnabled bool          `mapstructure:"video_rendition_enabled"` // Transcode videos for web playback
+	VideoRenditionHeight  int           `mapstructure:"video_rendition_height"`  // Max rendition height in pixels
+	VideoRenditionKbps    int           `mapstructure:"video_rendition_kbps"`    // Rendition video bitrate
+
+	PreviewPages   int           `mapstructure:"preview_pages"`   // Document pages rendered as images
+	PreviewWidth   int           `mapstructure:"preview_width"`   // Rendered page width in pixels
+	PreviewTimeout time.Duration `mapstructure:"preview_timeout"` // Upper bound for one preview job
+	PDFToPPMPath   string        `mapstructure:"pdftoppm_path"`   // poppler's page renderer
+	PDFInfoPath    string        `mapstructure:"pdfinfo_path"`    // poppler's page counter
+	PDFToTextPath  string        `mapstructure:"pdftotext_path"`  // poppler's text extractor, for search
+	SofficePath    string        `mapstructure:"soffice_path"`    // LibreOffice, for office documents
+
+	VirusScanEnabled bool          `mapstructure:"virus_scan_enabled"` // Scan uploads before any other processing
+	ClamAVAddress    string        `mapstructure:"clamav_address"`     // clamd socket, e.g. "tcp://clamav:3310"
+	ScanTimeout      time.Duration `mapstructure:"virus_scan_timeout"` // Upper bound for scanning one file
+}
+
+// SearchConfig holds settings for the embedded search index.
+//
+// The index lives in memory and is saved to IndexPath every
+// SnapshotInterval, so a restart doesn't have to re-extract document text.
+type SearchConfig struct {
+	Enabled          bool          `mapstructure:"search_enabled"`           // Index files and serve /search
+	IndexPath        string        `mapstructure:"search_index_path"`        // Snapshot file ("" = memory only)
+	SnapshotInterval time.Duration `mapstructure:"search_snapshot_interval"` // How often changes are saved
+	MaxContentBytes  int           `mapstructure:"search_max_content_bytes"` // Extracted text indexed per file
+}
+
+// S3GatewayConfig holds settings for the S3-compatible API.
+//
+// The gateway listens on its own port, because S3 clients expect buckets
+// at the root of the URL. A user's S3 secret keys are derived from their
+// API keys with Secret, so rotating Secret invalidates all of them.
+type S3GatewayConfig struct {
+	Enabled bool   `mapstructure:"s3_gateway_enabled"` // Serve the S3-compatible API
+	Port    int    `mapstructure:"s3_gateway_port"`    // Port to listen on
+	Secret  string `mapstructure:"s3_gateway_secret"`  // Key for deriving S3 credentials
+	Region  string `mapstructure:"s3_gateway_region"`  // Region reported to clients
 }
 
 // EmailConfig holds email notification settings.
@@ -405,6 +473,42 @@ func setDefaults(v *viper.Viper) {
 
 	// Worker defaults
 	v.SetDefault("worker_concurrency", 10)
+	v.SetDefault("worker_max_attempts", 5)
+	v.SetDefault("worker_retry_base_delay", "5s")
+	v.SetDefault("worker_retry_max_delay", "10m")
+	v.SetDefault("worker_job_lease", "2m")
+
+	// Processing defaults
+	v.SetDefault("thumbnail_sizes", []int{150, 300, 600})
+	v.SetDefault("thumbnail_quality", 85)
+	v.SetDefault("compression_enabled", true)
+	v.SetDefault("ffmpeg_path", "ffmpeg")
+	v.SetDefault("ffprobe_path", "ffprobe")
+	v.SetDefault("video_timeout", "30m")
+	v.SetDefault("video_rendition_enabled", false)
+	v.SetDefault("video_rendition_height", 720)
+	v.SetDefault("video_rendition_kbps", 1500)
+	v.SetDefault("preview_pages", 3)
+	v.SetDefault("preview_width", 1024)
+	v.SetDefault("preview_timeout", "5m")
+	v.SetDefault("pdftoppm_path", "pdftoppm")
+	v.SetDefault("pdfinfo_path", "pdfinfo")
+	v.SetDefault("pdftotext_path", "pdftotext")
+	v.SetDefault("soffice_path", "soffice")
+	v.SetDefault("virus_scan_enabled", false)
+	v.SetDefault("clamav_address", "tcp://localhost:3310")
+	v.SetDefault("virus_scan_timeout", "2m")
+
+	// Search defaults
+	v.SetDefault("search_enabled", true)
+	v.SetDefault("search_index_path", "data/search-index.gob")
+	v.SetDefault("search_snapshot_interval", "1m")
+	v.SetDefault("search_max_content_bytes", 65536) // 64 KB of text per file
+
+	// S3 gateway defaults
+	v.SetDefault("s3_gateway_enabled", false)
+	v.SetDefault("s3_gateway_port", 8090)
+	v.SetDefault("s3_gateway_region", "us-east-1")
 
 	// Email defaults
 	v.SetDefault("smtp_host", "")
@@ -459,6 +563,11 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("JWT secret must be set to a secure random string")
 	}
 
+	// The S3 gateway can't derive credentials without its secret
+	if c.S3Gateway.Enabled && c.S3Gateway.Secret == "" {
+		return fmt.Errorf("S3 gateway secret is required when the gateway is enabled")
+	}
+
 	// Check RabbitMQ URL
 	if c.RabbitMQ.URL == "" {
 		return fmt.Errorf("RabbitMQ URL is required")
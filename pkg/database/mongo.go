@@ -0,0 +1,58 @@
+// Package database provides the MongoDB connection used by all services.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Creating a MongoDB client with connection pooling
+// 2. Using context.Context for timeouts
+// 3. Verifying connectivity with Ping
+//
+// CONTEXT EXPLANATION:
+// context.Context carries deadlines and cancellation signals across API calls.
+// Almost every MongoDB call takes a context as its first argument, so a slow
+// database can never block a request forever.
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+)
+
+// Connect opens a MongoDB client using the pool settings from DatabaseConfig
+// and returns a handle to the configured database.
+//
+// The caller owns the client and must call client.Disconnect(ctx) on shutdown.
+func Connect(ctx context.Context, cfg config.DatabaseConfig) (*mongo.Client, *mongo.Database, error) {
+	// Build client options from our configuration
+	// options.Client() returns a builder; each Set* call returns the builder
+	// again, which is why the calls can be chained.
+	opts := options.Client().
+		ApplyURI(cfg.URI).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetMaxConnIdleTime(cfg.MaxConnIdleTime).
+		SetConnectTimeout(cfg.ConnectTimeout)
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to mongodb: %w", err)
+	}
+
+	// mongo.Connect does not actually talk to the server.
+	// Ping forces a round trip so we fail fast on bad credentials or hosts.
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel() // defer runs when the function returns - always release timers
+
+	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, nil, fmt.Errorf("failed to ping mongodb: %w", err)
+	}
+
+	return client, client.Database(cfg.Database), nil
+}
@@ -0,0 +1,260 @@
+// This file implements the webdav.File values the file system hands out.
+//
+// LEARNING NOTES:
+// ===============
+// THREE KINDS OF OPEN FILES:
+//   - dirFile: a folder; Readdir lists its children
+//   - readFile: a file's content, streamed from storage with seeking for ranges
+//   - writeFile: a PUT in progress; the body is spooled to a temp file and
+//     uploaded on Close, because WebDAV clients often stream without a
+//     Content-Length and an upload needs to know its size
+//
+// SERVER-SIDE COPY THROUGH io.Copy:
+// The webdav package copies a file by opening the source for reading, the
+// destination for writing, and calling io.Copy(dst, src). io.Copy lets
+// the destination do the work if it has a ReadFrom method. writeFile's
+// ReadFrom notices that the source is one of our readFiles and, instead
+// of pulling the bytes through this process, remembers the source and
+// calls files.CopyFile on Close - a storage-side copy. Lock checks and
+// multi-status handling stay with the webdav package.
+package dav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// errIsDirectory is returned when a folder is read as a file.
+var errIsDirectory = errors.New("dav: is a directory")
+
+// =============================================================================
+// FILE INFO
+// =============================================================================
+
+// fileInfo describes a file or folder. It also implements webdav.ETager
+// and webdav.ContentTyper, so PROPFIND reports our checksums and MIME
+// types instead of guessing.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	file    *models.File // nil for folders and files being written
+}
+
+// entryInfo describes a resolved path.
+func entryInfo(entry *paths.Entry) *fileInfo {
+	switch {
+	case entry.File != nil:
+		return fileFileInfo(entry.File)
+	case entry.Folder != nil:
+		return &fileInfo{name: entry.Folder.Name, modTime: entry.Folder.UpdatedAt, dir: true}
+	default:
+		return &fileInfo{name: "/", dir: true}
+	}
+}
+
+func fileFileInfo(file *models.File) *fileInfo {
+	return &fileInfo{name: file.FileName, size: file.FileSize, modTime: file.UpdatedAt, file: file}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ETag is the file's checksum, like the S3 API's ETag.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.file == nil || fi.file.Checksum == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.file.Checksum + `"`, nil
+}
+
+// ContentType is the MIME type stored with the file.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.file == nil || fi.file.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.file.MimeType, nil
+}
+
+// =============================================================================
+// FOLDERS
+// =============================================================================
+
+// dirFile is an open folder.
+type dirFile struct {
+	fs    *fileSystem
+	ctx   context.Context
+	entry *paths.Entry
+
+	children []os.FileInfo // Loaded on the first Readdir
+	loaded   bool
+}
+
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.loaded {
+		folders, fileList, err := d.fs.handler.folders.Contents(d.ctx, d.fs.user, d.entry.Path, false)
+		if err != nil {
+			return nil, osError(err)
+		}
+		for _, folder := range folders {
+			d.children = append(d.children, &fileInfo{name: folder.Name, modTime: folder.UpdatedAt, dir: true})
+		}
+		for _, file := range fileList {
+			d.children = append(d.children, fileFileInfo(file))
+		}
+		d.loaded = true
+	}
+
+	// Like os.File.Readdir: count > 0 returns at most count entries per
+	// call and io.EOF at the end, count <= 0 returns everything at once
+	if count <= 0 {
+		children := d.children
+		d.children = nil
+		return children, nil
+	}
+	if len(d.children) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.children))
+	children := d.children[:n]
+	d.children = d.children[n:]
+	return children, nil
+}
+
+func (d *dirFile) Stat() (os.FileInfo, error)                   { return entryInfo(d.entry), nil }
+func (d *dirFile) Read(p []byte) (int, error)                   { return 0, errIsDirectory }
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) { return 0, errIsDirectory }
+func (d *dirFile) Write(p []byte) (int, error)                  { return 0, errIsDirectory }
+func (d *dirFile) Close() error                                 { return nil }
+
+// =============================================================================
+// READING
+// =============================================================================
+
+// readFile is a file opened for reading. The embedded Seeker provides
+// Read, Seek and Close.
+type readFile struct {
+	*storage.Seeker
+	file *models.File
+}
+
+func (r *readFile) Stat() (os.FileInfo, error)               { return fileFileInfo(r.file), nil }
+func (r *readFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (r *readFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+// =============================================================================
+// WRITING
+// =============================================================================
+
+// writeFile collects the content of a PUT (or the copy source of a COPY)
+// and stores it when closed.
+type writeFile struct {
+	fs   *fileSystem
+	ctx  context.Context
+	name string
+
+	tmp    *os.File
+	size   int64
+	copyOf *models.File // Set by ReadFrom for server-side copies
+	tooBig bool
+}
+
+func newWriteFile(ctx context.Context, fs *fileSystem, name string) (*writeFile, error) {
+	tmp, err := os.CreateTemp("", "dav-*")
+	if err != nil {
+		return nil, err
+	}
+	return &writeFile{fs: fs, ctx: ctx, name: name, tmp: tmp}, nil
+}
+
+func (w *writeFile) Write(p []byte) (int, error) {
+	if maxSize := w.fs.handler.maxSize; maxSize > 0 && w.size+int64(len(p)) > maxSize {
+		w.tooBig = true
+		return 0, apperrors.ErrFileTooLarge
+	}
+	n, err := w.tmp.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// ReadFrom is called by io.Copy. A copy from one of our own files becomes
+// a server-side copy (see the notes at the top of the file).
+func (w *writeFile) ReadFrom(r io.Reader) (int64, error) {
+	if source, ok := r.(*readFile); ok && w.size == 0 {
+		w.copyOf = source.file
+		w.size = source.file.FileSize
+		return source.file.FileSize, nil
+	}
+	// A plain copy; writeOnly hides ReadFrom so io.Copy doesn't call us again
+	return io.Copy(writeOnly{w}, r)
+}
+
+// writeOnly exposes only the Write method of a writer.
+type writeOnly struct{ io.Writer }
+
+func (w *writeFile) Close() error {
+	defer os.Remove(w.tmp.Name())
+	defer w.tmp.Close()
+	if w.tooBig {
+		return apperrors.ErrFileTooLarge
+	}
+
+	if w.copyOf != nil {
+		_, err := w.fs.handler.files.CopyFile(w.ctx, w.fs.user, w.copyOf.ID, files.CopyRequest{
+			To:       path.Dir(w.name),
+			Name:     path.Base(w.name),
+			Conflict: files.ConflictOverwrite,
+		})
+		return osError(err)
+	}
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	mimeType := mime.TypeByExtension(path.Ext(w.name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	_, err := w.fs.handler.files.Upload(w.ctx, w.fs.user, files.UploadRequest{
+		Path:     w.name,
+		Content:  w.tmp,
+		Size:     w.size,
+		MimeType: mimeType,
+		Conflict: files.ConflictOverwrite,
+	})
+	return osError(err)
+}
+
+// Stat describes the file being written. The webdav package asks before
+// Close, so ETag() falls back to its default until the file is stored.
+func (w *writeFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{name: path.Base(w.name), size: w.size, modTime: time.Now()}, nil
+}
+
+func (w *writeFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (w *writeFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (w *writeFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
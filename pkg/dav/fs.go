@@ -0,0 +1,177 @@
+// This file adapts the folder tree to webdav.FileSystem.
+//
+// LEARNING NOTES:
+// ===============
+// SPEAKING os ERRORS:
+// The webdav package picks status codes by asking os.IsNotExist and
+// os.IsExist about our errors, the way it would for a disk. So service
+// errors are translated at this boundary: a missing item becomes
+// os.ErrNotExist (404, or 409 when a parent is missing), a taken name
+// os.ErrExist, and anything we refuse os.ErrPermission (403).
+package dav
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"golang.org/x/net/webdav"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// fileSystem is one user's tree as a webdav.FileSystem. Names are slash
+// paths below the mount point, like "/Photos/beach.jpg".
+type fileSystem struct {
+	handler *Handler
+	user    *models.User
+}
+
+// resolve returns what is at name. Names that can't be valid paths don't
+// exist.
+func (fs *fileSystem) resolve(ctx context.Context, name string) (*paths.Entry, error) {
+	entry, err := fs.handler.folders.Resolve(ctx, fs.user, name)
+	if err != nil {
+		if appErr, ok := apperrors.As(err); ok && appErr.Code == "INVALID_PATH" {
+			return nil, os.ErrNotExist
+		}
+		return nil, osError(err)
+	}
+	return entry, nil
+}
+
+// parentFolder checks that the folder name would be created in exists.
+// WebDAV never creates missing parents: that is a 409 Conflict.
+func (fs *fileSystem) parentFolder(ctx context.Context, name string) error {
+	parent, err := fs.resolve(ctx, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if parent.File != nil {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, err := fs.resolve(ctx, name); err == nil {
+		return os.ErrExist
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := fs.parentFolder(ctx, name); err != nil {
+		return err
+	}
+
+	_, err := fs.handler.folders.Mkdir(ctx, fs.user, name)
+	return osError(err)
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return fs.create(ctx, name)
+	}
+
+	entry, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.File == nil {
+		return &dirFile{fs: fs, ctx: ctx, entry: entry}, nil
+	}
+
+	file, err := fs.handler.files.GetDownloadable(ctx, fs.user, entry.File.ID)
+	if err != nil {
+		return nil, osError(err)
+	}
+	return &readFile{
+		Seeker: storage.NewSeeker(ctx, fs.handler.storage, file.S3Key, file.FileSize),
+		file:   file,
+	}, nil
+}
+
+// create opens a file for writing. Folders can't be written, and the
+// parent must exist.
+func (fs *fileSystem) create(ctx context.Context, name string) (webdav.File, error) {
+	entry, err := fs.resolve(ctx, name)
+	switch {
+	case err == nil && entry.File == nil:
+		return nil, os.ErrExist // A folder (or the root)
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	}
+	if err := fs.parentFolder(ctx, name); err != nil {
+		return nil, err
+	}
+	if _, err := paths.Clean(name); err != nil {
+		return nil, os.ErrPermission
+	}
+	return newWriteFile(ctx, fs, name)
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	entry, err := fs.resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry.File != nil:
+		err = fs.handler.files.Delete(ctx, fs.user, entry.File.ID)
+	case entry.Folder != nil:
+		err = fs.handler.files.DeleteFolder(ctx, fs.user, entry.Folder.ID)
+	default:
+		err = os.ErrPermission // The root stays
+	}
+	return osError(err)
+}
+
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	entry, err := fs.resolve(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if err := fs.parentFolder(ctx, newName); err != nil {
+		return err
+	}
+
+	req := files.MoveRequest{To: path.Dir(newName), Name: path.Base(newName), Conflict: files.ConflictFail}
+	switch {
+	case entry.File != nil:
+		_, err = fs.handler.files.MoveFile(ctx, fs.user, entry.File.ID, req)
+	case entry.Folder != nil:
+		_, err = fs.handler.files.MoveFolder(ctx, fs.user, entry.Folder.ID, req)
+	default:
+		err = os.ErrPermission
+	}
+	return osError(err)
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	entry, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return entryInfo(entry), nil
+}
+
+// osError translates service errors into the os errors webdav expects.
+func osError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apperrors.Is(err, apperrors.ErrNotFound):
+		return os.ErrNotExist
+	case apperrors.Is(err, repository.ErrNameTaken):
+		return os.ErrExist
+	}
+	if appErr, ok := apperrors.As(err); ok && appErr.StatusCode < 500 {
+		return &os.PathError{Op: "dav", Path: appErr.Code, Err: os.ErrPermission}
+	}
+	return err
+}
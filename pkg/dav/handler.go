@@ -0,0 +1,141 @@
+// Package dav serves users' folder trees over WebDAV, so that the storage
+// can be mounted as a drive in desktop file managers.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Implementing a library's interface (webdav.FileSystem) as an adapter
+// 2. Serving a standard library http.Handler from gin
+// 3. Per-user state kept in a mutex-guarded map
+//
+// WEBDAV IN ONE PARAGRAPH:
+// WebDAV extends HTTP with methods for files: PROPFIND lists a folder
+// (Depth: 1) or describes one item (Depth: 0), MKCOL creates a folder
+// ("collection"), MOVE and COPY take a Destination header, and LOCK/UNLOCK
+// let editors like Word keep others out while a document is open. GET,
+// PUT and DELETE mean what they always mean.
+//
+// WHO DOES WHAT:
+// golang.org/x/net/webdav speaks the protocol: it parses the XML, checks
+// lock tokens and writes the multi-status responses. It asks a FileSystem
+// for the actual files, and that is what this package provides (fs.go):
+//
+//	PROPFIND  -> Stat, OpenFile + Readdir   -> folders.Resolve / Contents
+//	GET       -> OpenFile (read)            -> files.GetDownloadable + storage
+//	PUT       -> OpenFile (write) + Close   -> files.Upload (new version if it exists)
+//	MKCOL     -> Mkdir                      -> folders.Mkdir
+//	MOVE      -> Rename                     -> files.MoveFile / MoveFolder
+//	COPY      -> OpenFile + io.Copy         -> files.CopyFile (server-side, see file.go)
+//	DELETE    -> RemoveAll                  -> files.Delete / DeleteFolder (trash)
+//
+// Every call goes through the services with the signed-in user as the
+// actor, so the usual permission, quarantine, retention and quota checks
+// apply. Deleting from a mounted drive moves items to the trash.
+//
+// LOCKS:
+// Locks live in memory, one lock system per user, because lock names are
+// paths and two users' "/Report.docx" are different files. They are lost
+// on restart and not shared between instances; clients refresh their
+// locks anyway, so the worst case is a lock that silently disappears.
+package dav
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/net/webdav"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/folders"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Methods are the HTTP methods of WebDAV (class 1 and 2).
+var Methods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// Deps holds the Handler's dependencies.
+type Deps struct {
+	Files       *files.Service
+	Folders     *folders.Service
+	Storage     storage.Backend
+	MaxFileSize int64 // config.S3.MaxFileSize
+}
+
+// Handler serves WebDAV.
+type Handler struct {
+	files   *files.Service
+	folders *folders.Service
+	storage storage.Backend
+	maxSize int64
+
+	mu    sync.Mutex
+	locks map[primitive.ObjectID]webdav.LockSystem // Per user, see LOCKS above
+}
+
+// NewHandler creates a WebDAV Handler.
+func NewHandler(deps Deps) *Handler {
+	return &Handler{
+		files:   deps.Files,
+		folders: deps.Folders,
+		storage: deps.Storage,
+		maxSize: deps.MaxFileSize,
+		locks:   make(map[primitive.ObjectID]webdav.LockSystem),
+	}
+}
+
+// RegisterRoutes mounts WebDAV on a router group, which must authenticate
+// with Basic credentials: desktop clients can't do anything else.
+//
+// USAGE:
+//
+//	basic := auth.NewBasicAuthenticator(userRepo)
+//	davGroup := router.Group("/dav", basic.Middleware("File Storage"))
+//	dav.NewHandler(dav.Deps{...}).RegisterRoutes(davGroup)
+//
+// Then mount https://host/dav/ in Finder ("Connect to Server"), Windows
+// ("Map network drive") or davfs2, with your email and an API key.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	for _, method := range Methods {
+		r.Handle(method, "/*path", h.serve)
+	}
+}
+
+// serve hands the request to the webdav package with the user's file
+// system.
+func (h *Handler) serve(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		apperrors.AbortWithError(c, apperrors.ErrUnauthorized)
+		return
+	}
+
+	server := &webdav.Handler{
+		// "/dav/*path" -> "/dav": the part of the URL that isn't a path
+		Prefix:     strings.TrimSuffix(c.FullPath(), "/*path"),
+		FileSystem: &fileSystem{handler: h, user: user},
+		LockSystem: h.lockSystem(user.ID),
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// lockSystem returns the user's lock system, creating it on first use.
+func (h *Handler) lockSystem(userID primitive.ObjectID) webdav.LockSystem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	locks, ok := h.locks[userID]
+	if !ok {
+		locks = webdav.NewMemLS()
+		h.locks[userID] = locks
+	}
+	return locks
+}
@@ -0,0 +1,183 @@
+// This file serves folders and selections as zip or tar.gz archives.
+//
+// LEARNING NOTES:
+// ===============
+// NO CONTENT-LENGTH:
+// The size of a zip or tar.gz isn't known until the last byte is written,
+// so archives are sent with chunked transfer encoding. Browsers show the
+// progress in bytes without a percentage.
+//
+// ERRORS HALFWAY THROUGH:
+// Once the first bytes are out, the status line has been sent and can't
+// become a 500 anymore. If streaming fails, the handler panics with
+// http.ErrAbortHandler: net/http then drops the connection without the
+// final chunk, so the client sees a failed download rather than a
+// complete response. The archive also lacks its trailer (zip central
+// directory, gzip checksum), so archive tools refuse what was saved.
+//
+// The panic has to reach net/http. gin.Recovery stops it and lets the
+// response end normally, so it must not sit in front of these routes.
+package download
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/archive"
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+)
+
+// archiveRequest is the body of POST /archives.
+type archiveRequest struct {
+	FileIDs    []string `json:"file_ids"`
+	FolderIDs  []string `json:"folder_ids"`
+	Format     string   `json:"format"`     // zip (default) or tar.gz
+	Name       string   `json:"name"`       // Download name without extension
+	Background bool     `json:"background"` // Build the archive in a job even if it's small
+}
+
+// DownloadFolder streams a folder and everything in it as one archive.
+//
+// GET /folders/:id/archive?format=zip
+func (h *Handler) DownloadFolder(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	folderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+	format, err := archive.ParseFormat(c.Query("format"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	plan, err := h.files.PlanArchive(c.Request.Context(), user, files.ArchiveRequest{
+		FolderIDs: []primitive.ObjectID{folderID},
+		Format:    format,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	h.streamArchive(c, plan)
+}
+
+// CreateArchive downloads a selection of files and folders as one archive.
+// Small selections are streamed in the response. Large ones (or any, with
+// "background": true) are built by a job: the response is 202 Accepted
+// with the job, and once GET /jobs/:id reports it completed, the archive
+// is at GET /archives/:id/content.
+//
+// POST /archives {"file_ids": ["..."], "folder_ids": ["..."], "format": "zip"}
+func (h *Handler) CreateArchive(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var body archiveRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+	format, err := archive.ParseFormat(body.Format)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	fileIDs, err1 := parseIDs(body.FileIDs)
+	folderIDs, err2 := parseIDs(body.FolderIDs)
+	if err1 != nil || err2 != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	result, err := h.files.Archive(c.Request.Context(), user, files.ArchiveRequest{
+		FileIDs:   fileIDs,
+		FolderIDs: folderIDs,
+		Format:    format,
+		Name:      body.Name,
+	}, body.Background)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if result.Job != nil {
+		c.JSON(http.StatusAccepted, gin.H{"job": result.Job})
+		return
+	}
+	h.streamArchive(c, result.Plan)
+}
+
+// ArchiveContent downloads an archive built in the background. With S3 the
+// response is a redirect to a pre-signed link, so the bytes come straight
+// from the object store.
+//
+// GET /archives/:id/content
+func (h *Handler) ArchiveContent(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	download, err := h.files.OpenArchive(c.Request.Context(), user, jobID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if download.URL != nil {
+		c.Redirect(http.StatusFound, download.URL.String())
+		return
+	}
+	defer download.Content.Close()
+
+	headers := map[string]string{
+		"Content-Disposition": attachment(download.Name),
+	}
+	c.DataFromReader(http.StatusOK, download.Size, download.Format.ContentType(), download.Content, headers)
+}
+
+// streamArchive writes a planned archive as the response body.
+func (h *Handler) streamArchive(c *gin.Context, plan *files.ArchivePlan) {
+	c.Header("Content-Type", plan.Format.ContentType())
+	c.Header("Content-Disposition", attachment(plan.Name))
+	c.Status(http.StatusOK)
+
+	// The status is out; an error can only cut the response short (see the notes at the top)
+	if err := archive.Write(c.Request.Context(), c.Writer, h.storage, plan.Format, plan.Entries); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// parseIDs parses hex object IDs.
+func parseIDs(hexIDs []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(hexIDs))
+	for _, hex := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,75 @@
+// This file builds Content-Disposition headers.
+//
+// LEARNING NOTES:
+// ===============
+// HTTP headers are ASCII, but file names aren't: "Résumé.pdf",
+// "報告書.docx". RFC 6266 sends the name twice:
+//
+//	Content-Disposition: attachment; filename="R_sum_.pdf";
+//	                     filename*=UTF-8''R%C3%A9sum%C3%A9.pdf
+//
+// Every current browser reads filename* (percent-encoded UTF-8) and
+// ignores filename; very old clients only understand filename, so it
+// carries an ASCII approximation instead of mangled bytes.
+package download
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// attachment returns a Content-Disposition that saves the response as name.
+func attachment(name string) string {
+	fallback, exact := asciiFallback(name)
+	header := `attachment; filename="` + fallback + `"`
+	if !exact {
+		header += "; filename*=UTF-8''" + percentEncode(name)
+	}
+	return header
+}
+
+// asciiFallback replaces characters that can't appear in a quoted ASCII
+// filename with "_". exact reports whether nothing had to be replaced.
+func asciiFallback(name string) (string, bool) {
+	var b strings.Builder
+	exact := true
+	for _, r := range name {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' || r == '%' {
+			// '%' is valid, but some browsers percent-decode filename too
+			b.WriteByte('_')
+			exact = false
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), exact
+}
+
+// percentEncode encodes name for filename*. Only RFC 5987 attr-chars are
+// left as they are; everything else is sent as %XX bytes of UTF-8.
+func percentEncode(name string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c may appear unencoded in an RFC 5987 value.
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= utf8.RuneSelf:
+		return false
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,68 @@
+// This file implements Accept-Encoding negotiation.
+//
+// LEARNING NOTES:
+// ===============
+// A client lists the encodings it understands, optionally with a quality
+// ("q") weight between 0 and 1:
+//
+//	Accept-Encoding: zstd, gzip;q=0.8, *;q=0
+//
+// RULES:
+// A missing q means q=1, and q=0 means "never send me this". "*" matches
+// any encoding not listed explicitly. "identity" (no encoding) is acceptable
+// unless explicitly refused, and we always fall back to it.
+package download
+
+import (
+	"strconv"
+	"strings"
+)
+
+// negotiateEncoding picks the best encoding from available (ordered by our
+// preference) that the client accepts. It returns "" for identity.
+func negotiateEncoding(acceptEncoding string, available []string) string {
+	if acceptEncoding == "" || len(available) == 0 {
+		return ""
+	}
+
+	weights := parseAcceptEncoding(acceptEncoding)
+
+	best, bestQ := "", 0.0
+	for _, encoding := range available {
+		q, listed := weights[encoding]
+		if !listed {
+			q = weights["*"] // 0 if "*" isn't listed either
+		}
+		// Strictly greater: on a tie, the earlier (preferred) encoding wins
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding turns the header into a map of encoding -> q value.
+func parseAcceptEncoding(header string) map[string]float64 {
+	weights := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[name] = q
+	}
+	return weights
+}
@@ -0,0 +1,243 @@
+// Package download serves file content over HTTP.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Streaming a response from object storage without buffering it
+// 2. HTTP content negotiation (Accept-Encoding / Content-Encoding)
+// 3. Cache-friendly headers (ETag, Vary)
+// 4. Range and conditional requests with http.ServeContent
+//
+// TRANSPARENT COMPRESSION:
+// If the compression job stored a zstd or gzip copy of a file and the client
+// accepts that encoding, we stream the compressed bytes and set
+// Content-Encoding. Browsers and HTTP libraries decompress automatically,
+// so the user still receives the original file - just faster.
+//
+// RANGES AND CONDITIONAL REQUESTS:
+// http.ServeContent implements the fiddly parts of RFC 9110 for us:
+//
+//	Range: bytes=1000-1999          -> 206 with just those bytes
+//	Range: bytes=0-99,500-599       -> 206 multipart/byteranges
+//	If-None-Match: "<etag>"         -> 304 if the ETag still matches
+//	If-Modified-Since: <date>       -> 304 if not changed since (no ETag sent)
+//	If-Range: "<etag>" + Range      -> the range if unchanged, else all of it
+//
+// It needs an io.ReadSeeker; storage.Seeker provides one that fetches
+// only the requested ranges from the object store.
+package download
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/processing"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// preferredEncodings lists the encodings we can serve, best first.
+var preferredEncodings = []string{processing.EncodingZstd, processing.EncodingGzip}
+
+// AccessRecorder is told about every download, to maintain
+// File.LastAccessedAt (implemented by library.AccessTracker).
+type AccessRecorder interface {
+	Record(fileID primitive.ObjectID)
+}
+
+// Handler serves file downloads.
+type Handler struct {
+	files   *files.Service
+	storage storage.Backend
+	access  AccessRecorder
+}
+
+// NewHandler creates a download Handler. access may be nil.
+func NewHandler(fileService *files.Service, backend storage.Backend, access AccessRecorder) *Handler {
+	return &Handler{files: fileService, storage: backend, access: access}
+}
+
+// RegisterRoutes mounts the download routes on a router group.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/files/:id/content", h.Download)
+	r.GET("/files/:id/previews/:page", h.PreviewPage)
+	r.GET("/folders/:id/archive", h.DownloadFolder)
+	r.POST("/archives", h.CreateArchive)
+	r.GET("/archives/:id/content", h.ArchiveContent)
+}
+
+// Download streams a file's content.
+//
+// GET /files/:id/content
+//
+// Range, If-Range, If-None-Match and If-Modified-Since are handled by
+// http.ServeContent (see the notes at the top of this file), so video
+// players can seek and interrupted downloads can resume. Responses are
+// 200 (whole file), 206 (one range, or several as multipart/byteranges),
+// 304 (the client's copy is current) or 416 (range outside the file).
+func (h *Handler) Download(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	fileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	// Quarantined files are refused with 403 FILE_QUARANTINED
+	file, err := h.files.GetDownloadable(c.Request.Context(), user, fileID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	content, encoding, err := h.open(c, file)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	defer content.Close()
+
+	header := c.Writer.Header()
+	// VARY: tells caches that the body depends on Accept-Encoding,
+	// so a gzip response is never served to a client that can't read it
+	header.Set("Vary", "Accept-Encoding")
+	header.Set("ETag", etag(file, encoding))
+	header.Set("Content-Type", file.MimeType)
+	header.Set("Content-Disposition", attachment(file.FileName))
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+
+	// ServeContent answers conditional and range requests from the
+	// headers above, seeking in content as needed. It copies in chunks,
+	// so even multi-gigabyte files use a constant amount of memory.
+	// The ETag is checked first; Last-Modified is the content's own time,
+	// so a thumbnail or rename doesn't make cached copies look stale.
+	http.ServeContent(c.Writer, c.Request, "", file.LastModified(), content)
+
+	if h.access != nil && c.Request.Method == http.MethodGet && isContentStatus(c.Writer.Status()) {
+		h.access.Record(file.ID)
+	}
+}
+
+// PreviewPage streams one rendered page of a document preview.
+//
+// GET /files/:id/previews/:page
+func (h *Handler) PreviewPage(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	fileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+	pageNumber, err := strconv.Atoi(c.Param("page"))
+	if err != nil || pageNumber < 1 {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	// A preview shows the content, so it is refused exactly like a download
+	file, err := h.files.GetDownloadable(c.Request.Context(), user, fileID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	page := file.PreviewPageFor(pageNumber)
+	if page == nil {
+		_ = c.Error(apperrors.ErrNotFound)
+		return
+	}
+
+	reader, _, err := h.storage.Get(c.Request.Context(), page.S3Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			err = apperrors.ErrNotFound
+		}
+		_ = c.Error(err)
+		return
+	}
+	defer reader.Close()
+
+	headers := map[string]string{
+		"ETag": etag(file, "p"+strconv.Itoa(pageNumber)),
+	}
+	c.DataFromReader(http.StatusOK, page.FileSize, page.ContentType, reader, headers)
+}
+
+// open returns the best representation of the file for this request.
+// A missing compressed copy is not fatal: we fall back to the original.
+//
+// Range requests always get the original: byte offsets into a compressed
+// copy mean nothing to a video player. Apart from range requests, the
+// content is opened right away, so a missing object is still reported as
+// an error instead of a cut-off response; a range request opens it at the
+// requested offset once ServeContent has parsed the range.
+func (h *Handler) open(c *gin.Context, file *models.File) (*storage.Seeker, string, error) {
+	ctx := c.Request.Context()
+	ranged := c.GetHeader("Range") != ""
+
+	var available []string
+	for _, encoding := range preferredEncodings {
+		if file.CompressedCopyFor(encoding) != nil {
+			available = append(available, encoding)
+		}
+	}
+
+	if encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), available); encoding != "" && !ranged {
+		compressed := file.CompressedCopyFor(encoding)
+		content := storage.NewSeeker(ctx, h.storage, compressed.S3Key, compressed.FileSize)
+		err := content.Open()
+		if err == nil {
+			return content, encoding, nil
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, "", err
+		}
+	}
+
+	content := storage.NewSeeker(ctx, h.storage, file.S3Key, file.FileSize)
+	if !ranged {
+		if err := content.Open(); err != nil {
+			return nil, "", err
+		}
+	}
+	return content, "", nil
+}
+
+// isContentStatus reports whether a response status means content was sent.
+func isContentStatus(status int) bool {
+	return status == http.StatusOK || status == http.StatusPartialContent
+}
+
+// etag builds the entity tag for a representation.
+//
+// Each variant (an encoding, a preview page) is a different sequence of
+// bytes, so it gets its own ETag. The checksum changes with every version.
+func etag(file *models.File, variant string) string {
+	tag := file.Checksum
+	if tag == "" {
+		tag = file.ID.Hex() + "-" + strconv.Itoa(file.Version)
+	}
+	if variant != "" {
+		tag += "-" + variant
+	}
+	return `"` + tag + `"`
+}
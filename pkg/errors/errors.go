@@ -235,6 +235,37 @@ var (
 		Message:    "File type is not supported",
 		StatusCode: http.StatusBadRequest,  // 400
 	}
+
+	// ErrRetentionLocked indicates a retention lock prevents the operation
+	// Use when: Deleting, overwriting, pruning or purging a locked file/folder
+	ErrRetentionLocked = &AppError{
+		Code:       "RETENTION_LOCKED",
+		Message:    "Object is protected by a retention lock",
+		StatusCode: http.StatusLocked,  // 423
+	}
+
+	// ErrLegalHold indicates a legal hold prevents the operation
+	ErrLegalHold = &AppError{
+		Code:       "LEGAL_HOLD",
+		Message:    "Object is under legal hold",
+		StatusCode: http.StatusLocked,  // 423
+	}
+
+	// ErrComplianceLock indicates an attempt to lift or shorten a compliance lock
+	// Compliance locks cannot be lifted by anyone (not even admins) before they expire
+	ErrComplianceLock = &AppError{
+		Code:       "COMPLIANCE_LOCK",
+		Message:    "Compliance retention cannot be shortened or removed before it expires",
+		StatusCode: http.StatusForbidden,  // 403
+	}
+
+	// ErrFileQuarantined indicates the file was flagged by the virus scanner
+	// and can't be downloaded or shared until an administrator releases it
+	ErrFileQuarantined = &AppError{
+		Code:       "FILE_QUARANTINED",
+		Message:    "File is quarantined because a virus was detected",
+		StatusCode: http.StatusForbidden,  // 403
+	}
 )
 
 // =============================================================================
@@ -520,6 +551,7 @@ func AbortWithError(c *gin.Context, err *AppError) {
 // - 404 Not Found: Resource doesn't exist
 // - 409 Conflict: Resource already exists, version conflict
 // - 413 Payload Too Large: File/request too large
+// - 423 Locked: Retention lock or legal hold prevents the change
 // - 429 Too Many Requests: Rate limit exceeded
 //
 // 5xx Server Errors (server did something wrong):
@@ -0,0 +1,338 @@
+// Package events defines the domain events of the service and moves them
+// between services: "a file was uploaded", "a folder was moved", "a user
+// ran out of quota".
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Typed, versioned events inside a generic envelope
+// 2. Publish/subscribe with interchangeable implementations (RabbitMQ, memory)
+// 3. The transactional outbox, so no event is lost when the broker is down
+//
+// JOBS VS EVENTS:
+// pkg/jobs sends commands: "make a thumbnail of file X", handled by exactly
+// one worker. An event states a fact that already happened, and any number
+// of services may care - search, notifications, billing, an audit log. The
+// publisher doesn't know who listens, which is what decouples the services.
+//
+// ARCHITECTURE:
+//
+//	Service                                 Consumers (one queue per group)
+//	-------                                 -------------------------------
+//	Outbox.Commit --> data + events_outbox     +--> group "notifications" --> Handler
+//	                   (one transaction)       |
+//	Outbox.Relay  --> Publisher (RabbitMQ) ----+--> group "search" ---------> Handler
+//	                                           |
+//	                                           +--> group "audit" ----------> Handler
+//
+// Every group receives every event it subscribed to; the subscribers of
+// one group share that group's events between them.
+//
+// DELIVERY GUARANTEE: AT LEAST ONCE
+// An event can arrive twice: the relay may crash after the broker took an
+// event but before marking it published, and a subscriber may crash before
+// acknowledging. Handlers must therefore be idempotent; Event.ID is unique
+// and can be used to skip duplicates.
+//
+// VERSIONING:
+// Every event type has a schema version, stored in Event.Version. Adding
+// an optional field is compatible and keeps the version. Removing, renaming
+// or changing the meaning of a field is not: such a change bumps the
+// payload's EventVersion, and Decode refuses events newer than the struct
+// it decodes into, rather than misreading them.
+//
+// USAGE:
+//
+//	event, err := events.New(file.UserID, events.FileUploaded{FileID: file.ID, ...})
+//	err = outbox.Commit(ctx, func(ctx context.Context) ([]*events.Event, error) {
+//	    if err := files.Create(ctx, file); err != nil {
+//	        return nil, err
+//	    }
+//	    return []*events.Event{event}, nil
+//	})
+//
+//	bus.Subscribe(ctx, "notifications", func(ctx context.Context, event *events.Event) error {
+//	    var uploaded events.FileUploaded
+//	    if err := events.Decode(event, &uploaded); err != nil {
+//	        return err
+//	    }
+//	    ...
+//	}, events.TypeFileUploaded)
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// =============================================================================
+// ENVELOPE
+// =============================================================================
+
+// Type names an event: "<subject>.<what happened>", in the past tense.
+type Type string
+
+// Event is the envelope every event travels in. The type-specific part is
+// Data, a JSON-encoded payload; Decode turns it back into a struct.
+type Event struct {
+	ID         string    `json:"id"`      // Unique; use it to skip duplicates
+	Type       Type      `json:"type"`    // What happened
+	Version    int       `json:"version"` // Schema version of Data
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// UserID is the user the event is about; all zeros if none
+	UserID primitive.ObjectID `json:"user_id"`
+
+	Data json.RawMessage `json:"data"`
+}
+
+// Payload is implemented by every event's data struct.
+type Payload interface {
+	EventType() Type
+	EventVersion() int
+}
+
+// Errors returned by Decode.
+var (
+	ErrTypeMismatch       = errors.New("events: payload does not match the event type")
+	ErrUnsupportedVersion = errors.New("events: event is newer than its payload type")
+)
+
+// New wraps a payload in a new envelope.
+func New(userID primitive.ObjectID, payload Payload) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", payload.EventType(), err)
+	}
+	return &Event{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       payload.EventType(),
+		Version:    payload.EventVersion(),
+		OccurredAt: time.Now().UTC(),
+		UserID:     userID,
+		Data:       data,
+	}, nil
+}
+
+// Decode unpacks an event's data into payload, which must be a pointer to
+// the struct for the event's type.
+func Decode(event *Event, payload Payload) error {
+	if event.Type != payload.EventType() {
+		return fmt.Errorf("%w: %s is not %s", ErrTypeMismatch, event.Type, payload.EventType())
+	}
+	if event.Version > payload.EventVersion() {
+		return fmt.Errorf("%w: %s v%d, known up to v%d", ErrUnsupportedVersion, event.Type, event.Version, payload.EventVersion())
+	}
+	if err := json.Unmarshal(event.Data, payload); err != nil {
+		return fmt.Errorf("failed to decode %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// =============================================================================
+// PUBLISH / SUBSCRIBE
+// =============================================================================
+
+// Handler processes one event. Returning an error hands the event back for
+// one more try; if that fails too, the event is dead-lettered.
+type Handler func(ctx context.Context, event *Event) error
+
+// Publisher sends events to whoever subscribed to them.
+type Publisher interface {
+	// Publish returns once the broker has safely taken the event.
+	Publish(ctx context.Context, event *Event) error
+
+	// Close releases the publisher's resources.
+	Close() error
+}
+
+// Subscriber delivers events to handlers.
+type Subscriber interface {
+	// Subscribe starts delivering events of the given types to handler,
+	// in the background, until ctx is cancelled or the bus is closed.
+	//
+	// group names the consumer: each group gets every event once, and
+	// subscriptions with the same group share its events. A group's events
+	// wait in the broker while none of its subscribers runs. types may use
+	// the wildcards "*" (one word, "file.*") and "#" (any number of
+	// words); no types means all events.
+	Subscribe(ctx context.Context, group string, handler Handler, types ...Type) error
+
+	// Close stops all subscriptions.
+	Close() error
+}
+
+// Bus is both ends of the pipe.
+//
+// Two implementations exist:
+// - RabbitMQBus for production
+// - MemoryBus for tests and single-process development
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// handle runs a handler, turning a panic into an error so one bad event
+// can't take the subscription down.
+func handle(ctx context.Context, handler Handler, event *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("events: handler panicked on %s: %v", event.Type, r)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// =============================================================================
+// EVENT TYPES
+// =============================================================================
+
+// Event type constants
+const (
+	TypeFileUploaded    Type = "file.uploaded"
+	TypeFileDeleted     Type = "file.deleted"
+	TypeFileRestored    Type = "file.restored"
+	TypeFileMoved       Type = "file.moved"
+	TypeFolderCreated   Type = "folder.created"
+	TypeFolderMoved     Type = "folder.moved"
+	TypeFolderDeleted   Type = "folder.deleted"
+	TypeShareCreated    Type = "share.created"
+	TypeShareRevoked    Type = "share.revoked"
+	TypeVersionRestored Type = "version.restored"
+	TypeQuotaExceeded   Type = "quota.exceeded"
+)
+
+// FileUploaded: a new file, or a new version of one, was stored.
+type FileUploaded struct {
+	FileID   primitive.ObjectID `json:"file_id"`
+	Path     string             `json:"path"`
+	Size     int64              `json:"size"`
+	MimeType string             `json:"mime_type"`
+	Checksum string             `json:"checksum"`
+	Version  int                `json:"version"`
+}
+
+func (FileUploaded) EventType() Type   { return TypeFileUploaded }
+func (FileUploaded) EventVersion() int { return 1 }
+
+// NewFileUploaded describes a file as it was just stored.
+func NewFileUploaded(file *models.File) FileUploaded {
+	return FileUploaded{
+		FileID:   file.ID,
+		Path:     file.FilePath,
+		Size:     file.FileSize,
+		MimeType: file.MimeType,
+		Checksum: file.Checksum,
+		Version:  file.Version,
+	}
+}
+
+// FileDeleted: a file went to the trash, or was purged for good.
+type FileDeleted struct {
+	FileID primitive.ObjectID `json:"file_id"`
+	Path   string             `json:"path"`
+	Size   int64              `json:"size"`
+	Purged bool               `json:"purged"` // Gone for good, not in the trash
+}
+
+func (FileDeleted) EventType() Type   { return TypeFileDeleted }
+func (FileDeleted) EventVersion() int { return 1 }
+
+// FileRestored: a file came back out of the trash.
+type FileRestored struct {
+	FileID primitive.ObjectID `json:"file_id"`
+	Path   string             `json:"path"`
+	Size   int64              `json:"size"`
+}
+
+func (FileRestored) EventType() Type   { return TypeFileRestored }
+func (FileRestored) EventVersion() int { return 1 }
+
+// FileMoved: a file was moved or renamed.
+type FileMoved struct {
+	FileID  primitive.ObjectID `json:"file_id"`
+	OldPath string             `json:"old_path"`
+	NewPath string             `json:"new_path"`
+}
+
+func (FileMoved) EventType() Type   { return TypeFileMoved }
+func (FileMoved) EventVersion() int { return 1 }
+
+// FolderCreated: a new, empty folder was created.
+type FolderCreated struct {
+	FolderID primitive.ObjectID `json:"folder_id"`
+	Path     string             `json:"path"`
+}
+
+func (FolderCreated) EventType() Type   { return TypeFolderCreated }
+func (FolderCreated) EventVersion() int { return 1 }
+
+// FolderMoved: a folder was moved or renamed, and everything inside it
+// with it. One event covers the whole subtree.
+type FolderMoved struct {
+	FolderID primitive.ObjectID `json:"folder_id"`
+	OldPath  string             `json:"old_path"`
+	NewPath  string             `json:"new_path"`
+}
+
+func (FolderMoved) EventType() Type   { return TypeFolderMoved }
+func (FolderMoved) EventVersion() int { return 1 }
+
+// FolderDeleted: a folder and everything inside it went to the trash.
+type FolderDeleted struct {
+	FolderID primitive.ObjectID `json:"folder_id"`
+	Path     string             `json:"path"`
+}
+
+func (FolderDeleted) EventType() Type   { return TypeFolderDeleted }
+func (FolderDeleted) EventVersion() int { return 1 }
+
+// ShareCreated: an item was shared with a user, or their permission changed.
+type ShareCreated struct {
+	ItemType    models.ItemType       `json:"item_type"`
+	ItemID      primitive.ObjectID    `json:"item_id"`
+	Path        string                `json:"path"`
+	RecipientID primitive.ObjectID    `json:"recipient_id"`
+	Permission  models.FilePermission `json:"permission"`
+}
+
+func (ShareCreated) EventType() Type   { return TypeShareCreated }
+func (ShareCreated) EventVersion() int { return 1 }
+
+// ShareRevoked: a user lost access to an item.
+type ShareRevoked struct {
+	ItemType    models.ItemType    `json:"item_type"`
+	ItemID      primitive.ObjectID `json:"item_id"`
+	RecipientID primitive.ObjectID `json:"recipient_id"`
+}
+
+func (ShareRevoked) EventType() Type   { return TypeShareRevoked }
+func (ShareRevoked) EventVersion() int { return 1 }
+
+// VersionRestored: an old version's content became the latest version.
+type VersionRestored struct {
+	FileID      primitive.ObjectID `json:"file_id"`
+	Path        string             `json:"path"`
+	FromVersion int                `json:"from_version"` // The version restored
+	NewVersion  int                `json:"new_version"`  // The version it became
+}
+
+func (VersionRestored) EventType() Type   { return TypeVersionRestored }
+func (VersionRestored) EventVersion() int { return 1 }
+
+// QuotaExceeded: a write was refused because the user's storage is full.
+type QuotaExceeded struct {
+	Used      int64 `json:"used"`      // Bytes stored
+	Quota     int64 `json:"quota"`     // Bytes allowed
+	Requested int64 `json:"requested"` // Bytes the refused write needed
+}
+
+func (QuotaExceeded) EventType() Type   { return TypeQuotaExceeded }
+func (QuotaExceeded) EventVersion() int { return 1 }
@@ -0,0 +1,205 @@
+// This file implements Bus in memory, inside a single process.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Fan-out to groups, competing consumers within a group
+// 2. Topic matching with "*" and "#", the way RabbitMQ does it
+// 3. sync.RWMutex for a list that is read often and changed rarely
+//
+// It behaves like RabbitMQBus - including one retry and dead-lettering -
+// so tests written against it hold in production. Events are lost when
+// the process exits; never use it in production.
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBusClosed is returned when using a closed bus.
+var ErrBusClosed = errors.New("events: bus closed")
+
+// memoryQueueSize bounds the undelivered events per group. Publish blocks
+// (until ctx is done) when a group's queue is full.
+const memoryQueueSize = 1024
+
+// DeadLetter is an event whose handler failed twice.
+type DeadLetter struct {
+	Event  *Event
+	Group  string
+	Reason string
+	At     time.Time
+}
+
+// MemoryBus is an in-process Bus.
+type MemoryBus struct {
+	done chan struct{}
+	once sync.Once
+
+	mu          sync.RWMutex
+	groups      map[string]*memoryGroup
+	deadLetters []DeadLetter
+}
+
+// memoryGroup is the in-memory counterpart of a group's queue.
+type memoryGroup struct {
+	queue    chan memoryDelivery
+	patterns []string // Union of all subscriptions' types
+}
+
+type memoryDelivery struct {
+	event       *Event
+	redelivered bool
+}
+
+// NewMemoryBus creates a bus without subscribers.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{done: make(chan struct{}), groups: make(map[string]*memoryGroup)}
+}
+
+// Publish hands the event to every group subscribed to its type. Like a
+// broker without a matching queue, it drops events nobody subscribed to.
+func (b *MemoryBus) Publish(ctx context.Context, event *Event) error {
+	b.mu.RLock()
+	var targets []*memoryGroup
+	for _, group := range b.groups {
+		if group.wants(event.Type) {
+			targets = append(targets, group)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, group := range targets {
+		// Each group gets its own copy, as it would from a broker
+		clone := *event
+		select {
+		case <-b.done:
+			return ErrBusClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case group.queue <- memoryDelivery{event: &clone}:
+		}
+	}
+	return nil
+}
+
+// Subscribe starts a goroutine delivering the group's events to handler.
+func (b *MemoryBus) Subscribe(ctx context.Context, group string, handler Handler, types ...Type) error {
+	b.mu.Lock()
+	select {
+	case <-b.done:
+		b.mu.Unlock()
+		return ErrBusClosed
+	default:
+	}
+	g, ok := b.groups[group]
+	if !ok {
+		g = &memoryGroup{queue: make(chan memoryDelivery, memoryQueueSize)}
+		b.groups[group] = g
+	}
+	g.patterns = append(g.patterns, patterns(types)...)
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			case d := <-g.queue:
+				b.deliver(ctx, group, g, d, handler)
+			}
+		}
+	}()
+	return nil
+}
+
+// deliver runs the handler; a failure is retried once, then dead-lettered.
+func (b *MemoryBus) deliver(ctx context.Context, group string, g *memoryGroup, d memoryDelivery, handler Handler) {
+	err := handle(ctx, handler, d.event)
+	switch {
+	case err == nil:
+	case !d.redelivered:
+		// Requeue from another goroutine: we are the one emptying the
+		// queue, so sending to a full one here would block forever
+		go func() {
+			select {
+			case g.queue <- memoryDelivery{event: d.event, redelivered: true}:
+			case <-b.done:
+			}
+		}()
+	default:
+		b.mu.Lock()
+		b.deadLetters = append(b.deadLetters, DeadLetter{Event: d.event, Group: group, Reason: err.Error(), At: time.Now()})
+		b.mu.Unlock()
+	}
+}
+
+// DeadLetters returns a copy of all dead-lettered events.
+func (b *MemoryBus) DeadLetters() []DeadLetter {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	out := make([]DeadLetter, len(b.deadLetters))
+	copy(out, b.deadLetters)
+	return out
+}
+
+// Close stops all subscriptions. It is safe to call more than once.
+func (b *MemoryBus) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+// wants reports whether the group subscribed to an event type.
+func (g *memoryGroup) wants(eventType Type) bool {
+	for _, pattern := range g.patterns {
+		if matchTopic(strings.Split(pattern, "."), strings.Split(string(eventType), ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// patterns turns a subscription's types into topic patterns; none means
+// everything.
+func patterns(types []Type) []string {
+	if len(types) == 0 {
+		return []string{"#"}
+	}
+	out := make([]string, len(types))
+	for i, t := range types {
+		out[i] = string(t)
+	}
+	return out
+}
+
+// matchTopic matches dot-separated words against a pattern in which "*"
+// stands for exactly one word and "#" for zero or more.
+//
+// RECURSION:
+// "#" can swallow any number of words, so we try every possibility: the
+// rest of the pattern against the words from here, or from one further,
+// and so on.
+func matchTopic(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	if pattern[0] == "#" {
+		for skip := 0; skip <= len(words); skip++ {
+			if matchTopic(pattern[1:], words[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(words) == 0 || (pattern[0] != "*" && pattern[0] != words[0]) {
+		return false
+	}
+	return matchTopic(pattern[1:], words[1:])
+}
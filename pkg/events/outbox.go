@@ -0,0 +1,257 @@
+// This file implements the transactional outbox.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. MongoDB multi-document transactions with sessions
+// 2. A relay loop that polls, but can also be woken up early
+// 3. Exponential backoff while the broker is down
+//
+// THE PROBLEM:
+// A service changes a document and then publishes an event. If RabbitMQ is
+// down at that moment - or the process dies between the two steps - the
+// change is committed and the event is gone. Nobody will ever hear of it.
+//
+// THE OUTBOX:
+//
+//	Commit:  BEGIN
+//	           write the file document
+//	           write the event into events_outbox
+//	         COMMIT                          <- both or neither
+//
+//	Relay:   claim a pending entry -> Publish -> mark it published
+//	                                     |
+//	                                     +-> failed: retry later, with backoff
+//
+// The broker can be down for hours; the events wait in MongoDB and go out
+// once it is back. The price is at-least-once delivery (see the package
+// documentation) and a short delay.
+//
+// NO ORDERING:
+// Events are not guaranteed to arrive in the order they were committed.
+// An entry whose publish failed waits out its backoff while later entries
+// go ahead, and several relays publish side by side. Consumers that care
+// compare Event.OccurredAt, or re-read the current state.
+//
+// TRANSACTIONS NEED A REPLICA SET:
+// MongoDB only supports transactions on replica sets and sharded clusters.
+// On a standalone server (like the one in docker-compose.yml) Commit writes
+// the data and then the events without one. An outage of the broker still
+// loses nothing; only a crash between the two writes can.
+//
+// USAGE:
+//
+//	outbox := events.NewOutbox(client, repository.NewOutboxRepository(db))
+//	go outbox.Relay(ctx, bus)
+//
+//	err := outbox.Commit(ctx, func(ctx context.Context) ([]*events.Event, error) { ... })
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Relay settings
+const (
+	// relayInterval is how often the relay looks for events committed by
+	// other processes (its own process wakes it right away)
+	relayInterval = time.Second
+
+	// claimLease is how long a claimed entry is hidden from other relays
+	// while it is being published
+	claimLease = 30 * time.Second
+
+	// Retry delays after a failed publish: 2s, 4s, 8s, ... up to 10 minutes
+	relayRetryDelay    = 2 * time.Second
+	relayMaxRetryDelay = 10 * time.Minute
+)
+
+// Outbox stores events together with data changes and relays them to a
+// Publisher.
+type Outbox struct {
+	client  *mongo.Client
+	entries repository.OutboxRepository
+
+	// kick wakes the relay after a commit. It holds at most one signal;
+	// more commits before the relay looks add nothing.
+	kick chan struct{}
+
+	mu           sync.Mutex
+	transactions *bool // Whether the server supports them; nil until asked
+}
+
+// NewOutbox creates an Outbox. The client is needed to start sessions.
+func NewOutbox(client *mongo.Client, entries repository.OutboxRepository) *Outbox {
+	return &Outbox{client: client, entries: entries, kick: make(chan struct{}, 1)}
+}
+
+// =============================================================================
+// WRITING
+// =============================================================================
+
+// Commit runs fn and stores the events it returns in one transaction: if
+// fn or storing the events fails, none of fn's writes persist.
+//
+// fn must do all its writes with the ctx it is given - that context
+// carries the transaction. MongoDB may run fn again when a transaction
+// hits a transient error, so fn must not have effects outside the
+// database.
+func (o *Outbox) Commit(ctx context.Context, fn func(ctx context.Context) ([]*Event, error)) error {
+	transactions, err := o.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !transactions {
+		events, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		return o.Add(ctx, events...)
+	}
+
+	session, err := o.client.StartSession()
+	if err != nil {
+		return apperrors.Wrap(err, "failed to start a database session")
+	}
+	defer session.EndSession(ctx)
+
+	// WithTransaction commits when the callback returns nil and aborts
+	// otherwise, retrying the whole callback on transient errors. Work fn
+	// defers with repository.AfterCommit runs once it has committed.
+	hooks := repository.NewCommitHooks()
+	_, err = session.WithTransaction(hooks.Context(ctx), func(sc mongo.SessionContext) (interface{}, error) {
+		hooks.Reset()
+		events, err := fn(sc)
+		if err != nil {
+			return nil, err
+		}
+		return nil, o.store(sc, events)
+	})
+	if err != nil {
+		return err
+	}
+	hooks.Run(ctx)
+	o.wake()
+	return nil
+}
+
+// Add stores events without a transaction of its own: for events that
+// don't go with a data change (quota.exceeded), or inside a transaction the
+// caller runs, by passing its mongo.SessionContext as ctx.
+func (o *Outbox) Add(ctx context.Context, events ...*Event) error {
+	if err := o.store(ctx, events); err != nil {
+		return err
+	}
+	o.wake()
+	return nil
+}
+
+func (o *Outbox) store(ctx context.Context, events []*Event) error {
+	entries := make([]*models.OutboxEntry, 0, len(events))
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+		}
+		entries = append(entries, models.NewOutboxEntry(event.ID, string(event.Type), string(body)))
+	}
+	return o.entries.Add(ctx, entries...)
+}
+
+// supportsTransactions asks the server once whether it is part of a
+// replica set (setName) or a sharded cluster (mongos says "isdbgrid").
+func (o *Outbox) supportsTransactions(ctx context.Context) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.transactions != nil {
+		return *o.transactions, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := o.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, apperrors.Wrap(err, "failed to query database topology")
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	o.transactions = &supported
+	return supported, nil
+}
+
+// wake tells the relay there is something new, without ever blocking.
+func (o *Outbox) wake() {
+	select {
+	case o.kick <- struct{}{}:
+	default:
+	}
+}
+
+// =============================================================================
+// RELAYING
+// =============================================================================
+
+// Relay publishes pending events until ctx is cancelled. Any number of
+// processes may run a relay on the same outbox.
+func (o *Outbox) Relay(ctx context.Context, publisher Publisher) error {
+	for {
+		o.drain(ctx, publisher)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.kick:
+		case <-time.After(relayInterval):
+		}
+	}
+}
+
+// drain publishes due entries until none is left or a publish fails. After
+// a failure it stops: the broker is likely down, and every other entry
+// would fail the same way. An entry that can't even be decoded is marked
+// failed instead - retrying it would never help.
+func (o *Outbox) drain(ctx context.Context, publisher Publisher) {
+	for ctx.Err() == nil {
+		entry, err := o.entries.Claim(ctx, claimLease)
+		if err != nil {
+			return // Nothing due (ErrNotFound), or the database is unwell
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(entry.Body), &event); err != nil {
+			_ = o.entries.MarkFailed(ctx, entry.ID, fmt.Sprintf("failed to decode outbox entry: %v", err))
+			continue
+		}
+
+		if err := publisher.Publish(ctx, &event); err != nil {
+			retryAt := time.Now().Add(retryDelay(entry.Attempts))
+			_ = o.entries.Release(ctx, entry.ID, retryAt, err.Error())
+			return
+		}
+
+		// If this fails, the lease runs out and the event goes out again -
+		// a duplicate, which consumers are prepared for
+		_ = o.entries.MarkPublished(ctx, entry.ID)
+	}
+}
+
+// retryDelay doubles with every failed attempt, up to relayMaxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := relayRetryDelay
+	for i := 1; i < attempts && delay < relayMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, relayMaxRetryDelay)
+}
@@ -0,0 +1,324 @@
+// This file implements Bus on top of RabbitMQ.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Fan-out with a topic exchange: one queue per subscriber group
+// 2. Dead-lettering rejected messages with queue arguments
+// 3. Reconnecting - and not hammering a server that is down
+//
+// TOPOLOGY:
+//
+//	                     routing key "events.<type>"
+//	Publish ----> [exchange: file-storage-exchange (topic)] --+--> events.group.notifications
+//	                                                          |    (bound to "events.file.*", ...)
+//	                                                          +--> events.group.search
+//	                                                          |    (bound to "events.#")
+//	                                                          ...
+//	rejected twice ----> events.dead (inspected by humans)
+//
+// The exchange is shared with pkg/jobs. Job messages are routed as
+// "jobs.<type>", so the two never reach each other's queues.
+//
+// RECONNECTING:
+// A subscription whose connection drops reconnects every ReconnectDelay,
+// like the job consumer. Publishing reconnects on demand, but after a
+// failed dial it fails fast until ReconnectDelay has passed: when the
+// broker is down, the outbox relay asks again and again, and every one of
+// those calls would otherwise wait for a TCP timeout.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+)
+
+// Queue names
+const (
+	QueueDead = "events.dead" // Events whose handler failed twice
+
+	queueGroupPrefix = "events.group."
+	routingKeyPrefix = "events."
+)
+
+// defaultReconnectDelay is used when the configuration has none.
+const defaultReconnectDelay = 5 * time.Second
+
+// ErrBrokerUnavailable is returned while waiting to dial again after a
+// failed connection attempt.
+var ErrBrokerUnavailable = errors.New("events: broker unavailable")
+
+// RabbitMQBus is a Bus backed by a RabbitMQ server.
+type RabbitMQBus struct {
+	cfg config.RabbitMQConfig
+
+	// mu guards everything below. AMQP channels are not safe for
+	// concurrent publishing, so every publish takes the lock.
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	publishCh *amqp.Channel
+	redialAt  time.Time // No dialing before this, after a failed attempt
+	closed    bool
+}
+
+// NewRabbitMQBus connects to RabbitMQ and declares the exchange.
+func NewRabbitMQBus(cfg config.RabbitMQConfig) (*RabbitMQBus, error) {
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = defaultReconnectDelay
+	}
+	b := &RabbitMQBus{cfg: cfg}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.connectLocked(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// connectLocked (re)dials the server unless a recent attempt failed. The
+// caller must hold b.mu.
+func (b *RabbitMQBus) connectLocked() error {
+	if time.Now().Before(b.redialAt) {
+		return ErrBrokerUnavailable
+	}
+	if err := b.dialLocked(); err != nil {
+		b.redialAt = time.Now().Add(b.cfg.ReconnectDelay)
+		return err
+	}
+	return nil
+}
+
+func (b *RabbitMQBus) dialLocked() error {
+	conn, err := amqp.Dial(b.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	// durable=true: survive broker restarts
+	if err := ch.ExchangeDeclare(b.cfg.Exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(QueueDead, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare queue %s: %w", QueueDead, err)
+	}
+
+	// The outbox marks an event published only once the broker confirms
+	// it (see pkg/jobs for how confirms work)
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	b.conn = conn
+	b.publishCh = ch
+	return nil
+}
+
+// =============================================================================
+// PUBLISHING
+// =============================================================================
+
+// Publish sends an event to the exchange and waits for the confirm.
+func (b *RabbitMQBus) Publish(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	publishing := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID,
+		Type:         string(event.Type),
+		Timestamp:    event.OccurredAt,
+		Body:         body,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+	if b.publishCh == nil || b.publishCh.IsClosed() {
+		if err := b.connectLocked(); err != nil {
+			return err
+		}
+	}
+
+	key := routingKeyPrefix + string(event.Type)
+	confirm, err := b.publishCh.PublishWithDeferredConfirmWithContext(ctx, b.cfg.Exchange, key, false, false, publishing)
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("events: broker rejected event")
+	}
+	return nil
+}
+
+// =============================================================================
+// SUBSCRIBING
+// =============================================================================
+
+// Subscribe declares the group's queue, binds it to the types and consumes
+// it in the background, reconnecting after ReconnectDelay when the
+// connection drops.
+func (b *RabbitMQBus) Subscribe(ctx context.Context, group string, handler Handler, types ...Type) error {
+	bindings := patterns(types)
+	deliveries, err := b.openConsumer(group, bindings)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			b.consume(ctx, deliveries, handler)
+
+			// Either we're shutting down or the connection dropped
+			for {
+				if ctx.Err() != nil || b.isClosed() {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(b.cfg.ReconnectDelay):
+				}
+				if deliveries, err = b.openConsumer(group, bindings); err == nil {
+					break
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// openConsumer declares and binds the group's queue on a channel of its
+// own and starts consuming it.
+//
+// DEAD-LETTER ARGUMENTS:
+// x-dead-letter-exchange "" (the default exchange) with routing key
+// events.dead makes RabbitMQ move every message we reject without
+// requeueing into the dead-letter queue, instead of dropping it.
+func (b *RabbitMQBus) openConsumer(group string, bindings []string) (<-chan amqp.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	if b.conn == nil || b.conn.IsClosed() {
+		if err := b.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	queue := queueGroupPrefix + group
+	args := amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": QueueDead,
+	}
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, args); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare queue %s: %w", queue, err)
+	}
+	for _, pattern := range bindings {
+		if err := ch.QueueBind(queue, routingKeyPrefix+pattern, b.cfg.Exchange, false, nil); err != nil {
+			ch.Close()
+			return nil, fmt.Errorf("failed to bind queue %s: %w", queue, err)
+		}
+	}
+
+	if err := ch.Qos(b.cfg.PrefetchCount, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	deliveries, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to consume %s: %w", queue, err)
+	}
+	return deliveries, nil
+}
+
+// consume runs the handler for each delivery until the source closes or
+// ctx ends.
+//
+// RETRY ONCE:
+// A failed event is requeued; RabbitMQ sets Redelivered on the second
+// delivery. If the handler fails again, the event is rejected and lands in
+// events.dead - a handler that keeps failing must not block the queue.
+func (b *RabbitMQBus) consume(ctx context.Context, deliveries <-chan amqp.Delivery, handler Handler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				return
+			}
+
+			var event Event
+			if err := json.Unmarshal(d.Body, &event); err != nil {
+				_ = d.Nack(false, false) // Never going to decode
+				continue
+			}
+
+			if err := handle(ctx, handler, &event); err != nil {
+				_ = d.Nack(false, !d.Redelivered)
+				continue
+			}
+			_ = d.Ack(false)
+		}
+	}
+}
+
+func (b *RabbitMQBus) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close closes the connection; subscriptions stop.
+func (b *RabbitMQBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.conn != nil && !b.conn.IsClosed() {
+		return b.conn.Close()
+	}
+	return nil
+}
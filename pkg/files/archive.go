@@ -0,0 +1,423 @@
+// This file implements downloading folders and selections as one archive.
+//
+// LEARNING NOTES:
+// ===============
+// PLAN FIRST, STREAM SECOND:
+// PlanArchive decides what goes into an archive: it checks access to
+// every selected item, walks selected folders, and turns the result into
+// a flat list of archive.Entry values. archive.Write then streams those
+// entries from the object store. Planning touches only MongoDB, so all
+// permission errors surface before the first byte of the response.
+//
+// PERMISSIONS PER ENTRY:
+// Each selected file and folder is loaded with Get/GetFolder, which honor
+// inherited shares. Everything below a selected folder is readable through
+// that folder, so for those entries the remaining question is whether the
+// content may be served at all: quarantined files are left out and
+// counted in ArchivePlan.Skipped. A selected file that is quarantined
+// fails the request instead, as a single download would.
+//
+// VERY LARGE SELECTIONS:
+// Streaming uses constant memory, but a 50 GB download over a flaky
+// connection can't be resumed. Above InlineArchiveLimit (or on request)
+// a background job (JobBuildArchive) streams the archive into the object
+// store instead, and OpenArchive hands out a pre-signed link to it.
+// Archives live under their own prefix (storage.ArchiveKey), where a
+// bucket lifecycle rule expires them.
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/archive"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// JobBuildArchive builds an archive in the object store (see Archive).
+const JobBuildArchive models.JobType = "build_archive"
+
+// Archive limits
+const (
+	MaxArchiveEntries        = 10000   // Files and folders in one archive
+	InlineArchiveLimit int64 = 2 << 30 // Larger selections are built in the background (2 GiB)
+)
+
+// defaultArchiveName names archives of multiple items, before the extension.
+const defaultArchiveName = "Download"
+
+var (
+	// ErrArchiveEmpty is returned when nothing was selected.
+	ErrArchiveEmpty = apperrors.New("ARCHIVE_EMPTY", "Select at least one file or folder", http.StatusBadRequest)
+
+	// ErrArchiveTooLarge is returned for selections with more than
+	// MaxArchiveEntries entries.
+	ErrArchiveTooLarge = apperrors.New("ARCHIVE_TOO_LARGE",
+		fmt.Sprintf("Archives can't hold more than %d files and folders", MaxArchiveEntries),
+		http.StatusUnprocessableEntity)
+
+	// ErrArchiveNotReady is returned while an archive job hasn't finished.
+	ErrArchiveNotReady = apperrors.New("ARCHIVE_NOT_READY", "The archive is still being built", http.StatusConflict)
+
+	// ErrArchiveGone is returned when an archive job failed or its archive
+	// has expired.
+	ErrArchiveGone = apperrors.New("ARCHIVE_GONE", "The archive failed or has expired", http.StatusGone)
+)
+
+// ArchiveRequest selects what goes into an archive.
+type ArchiveRequest struct {
+	FileIDs   []primitive.ObjectID
+	FolderIDs []primitive.ObjectID
+	Format    archive.Format
+	Name      string // Download name without extension; empty picks one
+}
+
+// ArchivePlan is the content of an archive, ready for archive.Write.
+type ArchivePlan struct {
+	Name    string          // Download name, e.g. "Photos.zip"
+	Format  archive.Format  // Archive format
+	Entries []archive.Entry // Folders before their contents
+	Files   int             // Number of file entries
+	Size    int64           // Total content size in bytes (before compression)
+	Skipped int             // Files below selected folders that may not be served
+}
+
+// ArchiveResult is what Archive decided: stream Plan now, or wait for Job.
+// Exactly one is set.
+type ArchiveResult struct {
+	Plan *ArchivePlan
+	Job  *models.ProcessingJob
+}
+
+// =============================================================================
+// PLANNING
+// =============================================================================
+
+// PlanArchive checks access to the selection and lists its entries. Each
+// selected item becomes a top-level entry; items with the same name are
+// numbered like uploads ("report (1).pdf").
+func (s *Service) PlanArchive(ctx context.Context, actor *models.User, req ArchiveRequest) (*ArchivePlan, error) {
+	if len(req.FileIDs)+len(req.FolderIDs) == 0 {
+		return nil, ErrArchiveEmpty
+	}
+
+	plan := &ArchivePlan{Format: req.Format}
+	taken := map[string]bool{}
+	var single string // name of the only selected item, if there is one
+
+	for _, folderID := range req.FolderIDs {
+		folder, err := s.GetFolder(ctx, actor, folderID)
+		if err != nil {
+			return nil, err
+		}
+		single = folder.Name
+		if err := s.planFolder(ctx, plan, folder, topName(taken, folder.Name)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fileID := range req.FileIDs {
+		file, err := s.Get(ctx, actor, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckDownloadable(file); err != nil {
+			return nil, err
+		}
+		single = strings.TrimSuffix(file.FileName, path.Ext(file.FileName))
+		if err := plan.addFile(file, topName(taken, file.FileName)); err != nil {
+			return nil, err
+		}
+	}
+
+	name := req.Name
+	if name == "" {
+		name = defaultArchiveName
+		if len(req.FileIDs)+len(req.FolderIDs) == 1 {
+			name = single
+		}
+	}
+	cleaned, err := paths.CleanName(name + req.Format.Extension())
+	if err != nil {
+		return nil, err
+	}
+	plan.Name = cleaned
+	return plan, nil
+}
+
+// planFolder adds a folder and everything below it, named name in the archive.
+func (s *Service) planFolder(ctx context.Context, plan *ArchivePlan, folder *models.Folder, name string) error {
+	subfolders, err := s.folders.FindUnderPath(ctx, folder.UserID, folder.Path)
+	if err != nil {
+		return err
+	}
+	folderFiles, err := s.files.FindUnderPath(ctx, folder.UserID, folder.Path)
+	if err != nil {
+		return err
+	}
+	if len(plan.Entries)+1+len(subfolders)+len(folderFiles) > MaxArchiveEntries {
+		return ErrArchiveTooLarge
+	}
+
+	// Paths below the folder keep their part after the folder's own path:
+	// "/Work/Photos/2024/a.jpg" in "/Work/Photos" becomes "Photos/2024/a.jpg".
+	// FindUnderPath sorts folders by path, so parents come first.
+	plan.Entries = append(plan.Entries, archive.Entry{Name: name, Dir: true, Modified: folder.UpdatedAt})
+	for _, sub := range subfolders {
+		plan.Entries = append(plan.Entries, archive.Entry{
+			Name:     name + sub.Path[len(folder.Path):],
+			Dir:      true,
+			Modified: sub.UpdatedAt,
+		})
+	}
+	for _, file := range folderFiles {
+		if CheckDownloadable(file) != nil {
+			plan.Skipped++
+			continue
+		}
+		if err := plan.addFile(file, name+file.FilePath[len(folder.Path):]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFile adds a file entry.
+func (p *ArchivePlan) addFile(file *models.File, name string) error {
+	if len(p.Entries) >= MaxArchiveEntries {
+		return ErrArchiveTooLarge
+	}
+	p.Entries = append(p.Entries, archive.Entry{
+		Name:     name,
+		Key:      file.S3Key,
+		Size:     file.FileSize,
+		Modified: file.UpdatedAt,
+		Compress: file.CanCompress(),
+	})
+	p.Files++
+	p.Size += file.FileSize
+	return nil
+}
+
+// topName returns name, or a numbered variant if another top-level entry
+// already has it (ignoring case, like the rest of the tree).
+func topName(taken map[string]bool, name string) string {
+	unique := name
+	for n := 1; taken[strings.ToLower(unique)]; n++ {
+		unique = paths.Numbered(name, n)
+	}
+	taken[strings.ToLower(unique)] = true
+	return unique
+}
+
+// =============================================================================
+// BUILDING
+// =============================================================================
+
+// Archive plans an archive of the selection. Small selections are
+// returned as a plan to stream right away. A background job builds the
+// archive instead if the caller asks for it or the content exceeds
+// InlineArchiveLimit - as long as a job queue is configured; without one,
+// everything is streamed.
+func (s *Service) Archive(ctx context.Context, actor *models.User, req ArchiveRequest, background bool) (*ArchiveResult, error) {
+	plan, err := s.PlanArchive(ctx, actor, req)
+	if err != nil {
+		return nil, err
+	}
+	if s.queue == nil || (!background && plan.Size <= InlineArchiveLimit) {
+		return &ArchiveResult{Plan: plan}, nil
+	}
+
+	payload := map[string]interface{}{
+		"file_ids":   hexIDs(req.FileIDs),
+		"folder_ids": hexIDs(req.FolderIDs),
+		"format":     string(req.Format),
+		"name":       req.Name,
+	}
+	job, err := s.queue.EnqueueTask(ctx, JobBuildArchive, actor.ID, payload)
+	if job == nil {
+		return nil, err
+	}
+	return &ArchiveResult{Job: job}, nil
+}
+
+// HandleBuildArchive is the job handler for JobBuildArchive. The selection
+// is planned again when the job runs, so access revoked in the meantime
+// is respected.
+//
+// USAGE:
+//
+//	pool.Register(files.JobBuildArchive, fileService.HandleBuildArchive)
+func (s *Service) HandleBuildArchive(ctx context.Context, job *models.ProcessingJob) error {
+	format, err := archive.ParseFormat(fmt.Sprint(job.Payload["format"]))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	req := ArchiveRequest{Format: format}
+	req.FileIDs, err = objectIDs(job.Payload["file_ids"])
+	if err == nil {
+		req.FolderIDs, err = objectIDs(job.Payload["folder_ids"])
+	}
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid archive job payload: %v", job.Payload))
+	}
+	if name, ok := job.Payload["name"].(string); ok {
+		req.Name = name
+	}
+
+	actor, err := s.users.GetByID(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	plan, err := s.PlanArchive(ctx, actor, req)
+	if err != nil {
+		if appErr, ok := apperrors.As(err); ok && appErr.StatusCode < http.StatusInternalServerError {
+			return jobs.Permanent(err) // not found, forbidden, too large: retrying won't help
+		}
+		return err
+	}
+
+	// The archive is written into one end of a pipe while Put reads the
+	// other, so it goes to the object store without touching disk or
+	// memory. Closing the reader with Put's error stops the writer.
+	key := storage.ArchiveKey(job.UserID, job.ID, format.Extension())
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(archive.Write(ctx, writer, s.storage, format, plan.Entries))
+	}()
+	info, err := s.storage.Put(ctx, key, reader, -1, format.ContentType())
+	reader.CloseWithError(err)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to store archive")
+	}
+
+	// Saved with the final job update
+	job.Progress = &models.JobProgress{Total: int64(plan.Files), Done: int64(plan.Files), Failed: int64(plan.Skipped), Bytes: plan.Size}
+	job.Result = map[string]interface{}{
+		"archive_key": key,
+		"name":        plan.Name,
+		"size":        info.Size,
+	}
+	return nil
+}
+
+// =============================================================================
+// DOWNLOADING
+// =============================================================================
+
+// ArchiveDownload is a finished archive. URL is set if the storage
+// backend can pre-sign links; otherwise Content must be streamed and closed.
+type ArchiveDownload struct {
+	Name    string
+	Format  archive.Format
+	URL     *url.URL
+	Content io.ReadCloser
+	Size    int64
+}
+
+// OpenArchive returns the archive built by one of the actor's archive jobs.
+func (s *Service) OpenArchive(ctx context.Context, actor *models.User, jobID primitive.ObjectID) (*ArchiveDownload, error) {
+	job, err := s.GetJob(ctx, actor, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Type != JobBuildArchive {
+		return nil, apperrors.ErrNotFound
+	}
+	switch {
+	case job.Status == models.JobDead:
+		return nil, ErrArchiveGone
+	case job.Status != models.JobCompleted:
+		return nil, ErrArchiveNotReady
+	}
+
+	key, _ := job.Result["archive_key"].(string)
+	name, _ := job.Result["name"].(string)
+	format, err := archive.ParseFormat(fmt.Sprint(job.Payload["format"]))
+	if key == "" || err != nil {
+		return nil, ErrArchiveGone
+	}
+	download := &ArchiveDownload{Name: name, Format: format}
+
+	if presigner, ok := s.storage.(storage.Presigner); ok {
+		// Pre-signing doesn't check that the object exists
+		if _, err := s.storage.Stat(ctx, key); err != nil {
+			return nil, archiveError(err)
+		}
+		if download.URL, err = presigner.PresignGet(ctx, key, name); err != nil {
+			return nil, err
+		}
+		return download, nil
+	}
+
+	content, info, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	download.Content = content
+	download.Size = info.Size
+	return download, nil
+}
+
+// archiveError reports an archive the lifecycle rule removed as gone.
+func archiveError(err error) error {
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return ErrArchiveGone
+	}
+	return err
+}
+
+// =============================================================================
+// PAYLOAD HELPERS
+// =============================================================================
+
+// hexIDs converts IDs for a job payload.
+func hexIDs(ids []primitive.ObjectID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.Hex()
+	}
+	return out
+}
+
+// objectIDs reads IDs back from a job payload. MongoDB returns arrays as
+// primitive.A, so any slice of strings is accepted.
+func objectIDs(v interface{}) ([]primitive.ObjectID, error) {
+	var values []interface{}
+	switch list := v.(type) {
+	case nil:
+		return nil, nil
+	case primitive.A:
+		values = list
+	case []interface{}:
+		values = list
+	case []string:
+		for _, s := range list {
+			values = append(values, s)
+		}
+	default:
+		return nil, fmt.Errorf("not a list: %T", v)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		id, err := primitive.ObjectIDFromHex(fmt.Sprint(value))
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
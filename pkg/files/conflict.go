@@ -0,0 +1,181 @@
+// This file defines what happens when a new or moved item's name is taken.
+//
+// LEARNING NOTES:
+// ===============
+// ONE RULE, MANY ENTRY POINTS:
+// Uploads, moves and copies all end with "put an item at this path". The
+// unique path indexes guarantee a folder never holds two items with the
+// same name; the ConflictPolicy decides what to do instead of failing.
+//
+//	policy     target is a file                    target is a folder
+//	---------  ----------------------------------  --------------------------
+//	fail       NAME_TAKEN                          NAME_TAKEN
+//	overwrite  new version of the existing file    NAME_TAKEN for files; a
+//	           (a moved folder trashes it)         moved folder trashes it
+//	rename     "report (1).pdf"                    "Photos (1)"
+//	skip       nothing happens                     nothing happens
+//
+// Folders have no versions, so "overwrite" can't merge into one: when a
+// folder is moved over an existing item, the item goes to the trash, where
+// it can still be restored from.
+//
+// A FILE AND A FOLDER AT ONE PATH:
+// Files and folders live in separate collections, each with its own unique
+// path index, so neither index sees the other. Two requests can both find
+// "/a" free, and one inserts a file there while the other inserts a
+// folder. Checking inside the transaction doesn't help: it reads a
+// snapshot that can't see the other request's uncommitted insert.
+//
+// So once a write that gives an item a new path has committed, the writer
+// looks in the other collection, and if the path is there too, takes its
+// own write back (an insert is deleted, a move is moved back) and reports
+// NAME_TAKEN. Each side looks after its own write is in, so at least one of
+// them sees the other: both may back out, but they can't both stay.
+package files
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// ConflictPolicy decides what happens when the target name is taken.
+type ConflictPolicy string
+
+// Conflict policies
+const (
+	ConflictFail      ConflictPolicy = "fail"      // Return repository.ErrNameTaken (default)
+	ConflictOverwrite ConflictPolicy = "overwrite" // Replace the existing item (see above)
+	ConflictRename    ConflictPolicy = "rename"    // Pick a free numbered name
+	ConflictSkip      ConflictPolicy = "skip"      // Leave everything as it is
+)
+
+// ErrInvalidConflictPolicy is returned for an unknown policy name.
+var ErrInvalidConflictPolicy = apperrors.New("INVALID_CONFLICT_POLICY", "Conflict policy must be fail, overwrite, rename or skip", http.StatusBadRequest)
+
+// ParseConflictPolicy reads a policy from a request parameter. An empty
+// string means ConflictFail.
+func ParseConflictPolicy(raw string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(raw); policy {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictOverwrite, ConflictRename, ConflictSkip:
+		return policy, nil
+	default:
+		return "", ErrInvalidConflictPolicy
+	}
+}
+
+// Outcome reports what an operation did about a conflict.
+type Outcome string
+
+// Outcomes
+const (
+	OutcomeCreated     Outcome = "created"     // No conflict (or moved to a free name)
+	OutcomeOverwritten Outcome = "overwritten" // The existing item was replaced
+	OutcomeRenamed     Outcome = "renamed"     // A numbered name was used
+	OutcomeSkipped     Outcome = "skipped"     // Nothing was changed
+)
+
+// maxNameRaces bounds how often a write is retried after another request
+// took the name we had picked.
+const maxNameRaces = 3
+
+// target is where an item should go, after the conflict policy was applied.
+type target struct {
+	name     string
+	existing *paths.Entry // what is in the way (nil if the name is free)
+	outcome  Outcome
+}
+
+// resolveConflict looks for an item named name in the folder at parentPath
+// and applies policy. Callers handle existing for OutcomeOverwritten and
+// OutcomeSkipped; for the other outcomes, name is free.
+//
+// self is the ID of the item being moved (NilObjectID for new items). It
+// is never in its own way: renaming "report.pdf" to "Report.pdf" is fine.
+func (s *Service) resolveConflict(ctx context.Context, ownerID primitive.ObjectID, parentPath, name string, self primitive.ObjectID, policy ConflictPolicy) (*target, error) {
+	existing, err := s.paths.Resolve(ctx, ownerID, joinName(parentPath, name))
+	if apperrors.Is(err, apperrors.ErrNotFound) || (err == nil && !self.IsZero() && existing.ID() == self) {
+		return &target{name: name, outcome: OutcomeCreated}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return &target{name: name, existing: existing, outcome: OutcomeSkipped}, nil
+	case ConflictOverwrite:
+		return &target{name: name, existing: existing, outcome: OutcomeOverwritten}, nil
+	case ConflictRename:
+		free, err := s.paths.FreeName(ctx, ownerID, parentPath, name)
+		if err != nil {
+			return nil, err
+		}
+		return &target{name: free, outcome: OutcomeRenamed}, nil
+	default:
+		return nil, repository.ErrNameTaken
+	}
+}
+
+// fileAt and folderAt report whether the owner has an active item of the
+// other kind at path (see A FILE AND A FOLDER AT ONE PATH). A failed
+// lookup counts as no: the write has succeeded, and a clash is rare.
+func (s *Service) fileAt(ctx context.Context, ownerID primitive.ObjectID, path string) bool {
+	_, err := s.files.GetByPath(ctx, ownerID, path)
+	return err == nil
+}
+
+func (s *Service) folderAt(ctx context.Context, ownerID primitive.ObjectID, path string) bool {
+	_, err := s.folders.GetByPath(ctx, ownerID, path)
+	return err == nil
+}
+
+// withdrawFile deletes a file that was just inserted at a path a folder
+// took at the same time. It reports false if the file is still there.
+func (s *Service) withdrawFile(ctx context.Context, file *models.File) bool {
+	err := s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Delete(ctx, file.ID); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FileDeleted{FileID: file.ID, Path: file.FilePath, Size: file.FileSize, Purged: true}}, nil
+	})
+	return err == nil
+}
+
+// withdrawFolder deletes a folder that was just inserted at a path a file
+// took at the same time. It reports false if the folder is still there.
+func (s *Service) withdrawFolder(ctx context.Context, folder *models.Folder) bool {
+	err := s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.folders.Delete(ctx, folder.ID); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FolderDeleted{FolderID: folder.ID, Path: folder.Path}}, nil
+	})
+	return err == nil
+}
+
+// trashExisting moves the item in the way to the trash. Folder moves,
+// copies and extractions use it for OutcomeOverwritten.
+func (s *Service) trashExisting(ctx context.Context, actor *models.User, existing *paths.Entry) error {
+	if existing.File != nil {
+		return s.Delete(ctx, actor, existing.File.ID)
+	}
+	return s.DeleteFolder(ctx, actor, existing.Folder.ID)
+}
+
+// joinName builds the path of name inside the folder at parentPath.
+func joinName(parentPath, name string) string {
+	if parentPath == paths.Root {
+		parentPath = ""
+	}
+	return parentPath + "/" + name
+}
@@ -0,0 +1,447 @@
+// This file implements server-side copies of files and folder trees.
+//
+// LEARNING NOTES:
+// ===============
+// COPY THE OBJECT, DON'T SHARE IT:
+// A copy could simply point at the original's object (deduplication), but
+// two things here assume every file owns its key: Overwrite writes the new
+// content over the current key, and Purge deletes it. A shared object would
+// change or vanish under the other file. So each copy gets its own object
+// through the backend's server-side Copy - the bytes never pass through
+// this service - and a fresh File with a new ID, Version 1 and no history.
+//
+// SMALL TREES NOW, LARGE TREES LATER:
+// A folder with a handful of items is copied during the request. Larger
+// trees are copied by a background job (JobCopyFolder) that reports its
+// progress on the job document, so clients can poll GET /jobs/:id.
+// Either way the quota is checked for the whole tree before anything is
+// copied, and the top folder of the copy exists when the request returns.
+//
+// RETRIES:
+// A job may run more than once (worker crash, S3 hiccup). Every step is
+// safe to repeat: subfolders are created with FolderRepository.Ensure, and
+// files that are already in the copy are skipped.
+package files
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// JobCopyFolder copies a folder tree in the background (see CopyFolder).
+const JobCopyFolder models.JobType = "copy_folder"
+
+// Copy limits
+const (
+	InlineCopyLimit = 50    // Trees with at most this many items are copied during the request
+	MaxCopyItems    = 10000 // Files and folders in one folder copy
+)
+
+// progressEvery is how many items a copy job handles between progress updates.
+const progressEvery = 25
+
+var (
+	// ErrCopyIntoItself is returned when a folder would be copied into
+	// itself or one of its own subfolders.
+	ErrCopyIntoItself = apperrors.New("COPY_INTO_ITSELF", "A folder can't be copied into itself", http.StatusBadRequest)
+
+	// ErrCopyTooLarge is returned for folders with more than MaxCopyItems items.
+	ErrCopyTooLarge = apperrors.New("COPY_TOO_LARGE",
+		fmt.Sprintf("Folders with more than %d items can't be copied in one go", MaxCopyItems),
+		http.StatusUnprocessableEntity)
+)
+
+// CopyRequest says where a copy should go. The fields mean the same as for
+// a move; the copy always goes into the actor's own tree.
+type CopyRequest = MoveRequest
+
+// CopyResult is where a copy ended up.
+type CopyResult struct {
+	File   *models.File   `json:"file,omitempty"`
+	Folder *models.Folder `json:"folder,omitempty"`
+
+	// Job is set when the folder's contents are copied in the background.
+	// Folder is the (still filling) copy.
+	Job *models.ProcessingJob `json:"job,omitempty"`
+
+	Outcome Outcome `json:"outcome"`
+}
+
+// =============================================================================
+// FILES
+// =============================================================================
+
+// CopyFile copies a file the actor can read into the actor's tree.
+//
+// With ConflictOverwrite, a file in the way receives the content as a new
+// version, as with uploads.
+func (s *Service) CopyFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID, req CopyRequest) (*CopyResult, error) {
+	source, err := s.Get(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckDownloadable(source); err != nil {
+		return nil, err
+	}
+
+	name, err := newName(req.Name, source.FileName)
+	if err != nil {
+		return nil, err
+	}
+	parent, parentPath, err := s.destination(ctx, actor.ID, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.resolveConflict(ctx, actor.ID, parentPath, name, primitive.NilObjectID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &CopyResult{File: target.existing.File, Folder: target.existing.Folder, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if target.existing.File == nil {
+			return nil, repository.ErrNameTaken
+		}
+		replaced, err := s.overwriteFrom(ctx, actor, target.existing.File, source)
+		if err != nil {
+			return nil, err
+		}
+		return &CopyResult{File: replaced, Outcome: OutcomeOverwritten}, nil
+	}
+
+	dup, err := s.copyFile(ctx, actor, source, parent, parentPath, target.name, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	outcome := target.outcome
+	if dup.FileName != target.name {
+		outcome = OutcomeRenamed
+	}
+	return &CopyResult{File: dup, Outcome: outcome}, nil
+}
+
+// copyFile creates a copy of source named name in parent, owned by actor.
+func (s *Service) copyFile(ctx context.Context, actor *models.User, source *models.File, parent *models.Folder, parentPath, name string, policy ConflictPolicy) (*models.File, error) {
+	if err := s.checkQuota(ctx, actor.ID, source.FileSize); err != nil {
+		return nil, err
+	}
+
+	dup := models.NewFile(actor.ID, name, source.FileSize, source.MimeType, "", source.S3Bucket, source.S3Region, source.Checksum)
+	dup.S3Key = storage.FileKey(dup.UserID, dup.ID, dup.FileName)
+	dup.PlaceIn(parent)
+	for key, value := range source.Metadata {
+		dup.Metadata[key] = value
+	}
+
+	if err := s.storage.Copy(ctx, source.S3Key, dup.S3Key); err != nil {
+		return nil, apperrors.Wrap(err, "failed to copy file content")
+	}
+	if err := s.insertPlaced(ctx, dup, parentPath, policy); err != nil {
+		_ = s.storage.Delete(ctx, dup.S3Key)
+		return nil, err
+	}
+	if err := s.users.AdjustStorageUsed(ctx, dup.UserID, dup.FileSize); err != nil {
+		return nil, err
+	}
+
+	// Thumbnails and previews are keyed by file ID, so the copy needs its own
+	s.startPipeline(ctx, dup)
+	return dup, nil
+}
+
+// overwriteFrom stores source's content as a new version of target.
+func (s *Service) overwriteFrom(ctx context.Context, actor *models.User, target, source *models.File) (*models.File, error) {
+	content, _, err := s.storage.Get(ctx, source.S3Key)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to read file")
+	}
+	defer content.Close()
+
+	replaced, err := s.Overwrite(ctx, actor, target.ID, content, source.FileSize, source.MimeType, "Replaced by "+source.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	s.startPipeline(ctx, replaced)
+	return replaced, nil
+}
+
+// =============================================================================
+// FOLDERS
+// =============================================================================
+
+// CopyFolder copies a folder the actor can read, with everything in it,
+// into the actor's tree. Large trees are copied by a background job; see
+// the notes at the top of this file.
+//
+// With ConflictOverwrite, the file or folder in the way goes to the trash.
+// Quarantined files are left out of the copy.
+func (s *Service) CopyFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID, req CopyRequest) (*CopyResult, error) {
+	source, err := s.GetFolder(ctx, actor, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := newName(req.Name, source.Name)
+	if err != nil {
+		return nil, err
+	}
+	to, err := paths.Clean(req.To)
+	if err != nil {
+		return nil, err
+	}
+	if source.UserID == actor.ID && isWithin(to, source.Path) {
+		return nil, ErrCopyIntoItself
+	}
+
+	// Size up the tree before creating anything
+	fileCount, size, err := s.files.SumUnderPath(ctx, source.UserID, source.Path)
+	if err != nil {
+		return nil, err
+	}
+	folderCount, err := s.folders.CountUnderPath(ctx, source.UserID, source.Path)
+	if err != nil {
+		return nil, err
+	}
+	items := fileCount + folderCount
+	if items > MaxCopyItems {
+		return nil, ErrCopyTooLarge
+	}
+	if err := s.checkQuota(ctx, actor.ID, size); err != nil {
+		return nil, err
+	}
+
+	parent, parentPath, err := s.destination(ctx, actor.ID, to)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.resolveConflict(ctx, actor.ID, parentPath, name, primitive.NilObjectID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &CopyResult{File: target.existing.File, Folder: target.existing.Folder, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if err := s.trashExisting(ctx, actor, target.existing); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := s.createFolderCopy(ctx, actor, source, parent, parentPath, target.name, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	result := &CopyResult{Folder: root, Outcome: target.outcome}
+	if root.Name != target.name {
+		result.Outcome = OutcomeRenamed
+	}
+
+	if items <= InlineCopyLimit || s.queue == nil {
+		if err := s.copyTree(ctx, actor, source, root, &models.JobProgress{}, nil); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	payload := map[string]interface{}{
+		"source_folder_id": source.ID.Hex(),
+		"target_folder_id": root.ID.Hex(),
+	}
+	job, err := s.queue.EnqueueTask(ctx, JobCopyFolder, actor.ID, payload)
+	if job == nil {
+		return nil, err
+	}
+	// A publish error leaves the job queued for Queue.Resume, so it still counts
+	result.Job = job
+	return result, nil
+}
+
+// createFolderCopy creates the top folder of a copy (or, with a nil
+// source, of an extracted archive).
+func (s *Service) createFolderCopy(ctx context.Context, actor *models.User, source, parent *models.Folder, parentPath, name string, policy ConflictPolicy) (*models.Folder, error) {
+	var parentID *primitive.ObjectID
+	if parent != nil {
+		parentID = &parent.ID
+	}
+
+	for race := 0; ; race++ {
+		folder := newFolderCopy(actor.ID, source, name, parentID, parentPath)
+		err := s.createFolder(ctx, folder)
+		if err == nil {
+			return folder, nil
+		}
+		if !apperrors.Is(err, repository.ErrNameTaken) || policy != ConflictRename || race == maxNameRaces {
+			return nil, err
+		}
+		if name, err = s.paths.FreeName(ctx, actor.ID, parentPath, name); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// HandleCopyFolder is the job handler for JobCopyFolder.
+//
+// USAGE:
+//
+//	pool.Register(files.JobCopyFolder, fileService.HandleCopyFolder)
+func (s *Service) HandleCopyFolder(ctx context.Context, job *models.ProcessingJob) error {
+	sourceID, err1 := primitive.ObjectIDFromHex(fmt.Sprint(job.Payload["source_folder_id"]))
+	targetID, err2 := primitive.ObjectIDFromHex(fmt.Sprint(job.Payload["target_folder_id"]))
+	if err1 != nil || err2 != nil {
+		return jobs.Permanent(fmt.Errorf("invalid copy job payload: %v", job.Payload))
+	}
+
+	actor, err := s.users.GetByID(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Access may have been revoked, or the copy deleted, since the job was
+	// queued. Neither gets better with retries.
+	source, err := s.GetFolder(ctx, actor, sourceID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	root, err := s.folders.GetByID(ctx, targetID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if !root.IsActive() {
+		return jobs.Permanent(fmt.Errorf("copy target %s was deleted", root.Path))
+	}
+
+	job.Progress = &models.JobProgress{}
+	report := func() {
+		// job.Progress is also saved with the final job update
+		_ = s.jobs.SetProgress(ctx, job.ID, job.Progress)
+	}
+
+	err = s.copyTree(ctx, actor, source, root, job.Progress, report)
+	if apperrors.Is(err, apperrors.ErrStorageQuotaExceeded) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// copyTree copies the contents of source into root, parents before
+// children. Items already in root are counted as done. report, if not
+// nil, is called every few items and at the end.
+func (s *Service) copyTree(ctx context.Context, actor *models.User, source, root *models.Folder, progress *models.JobProgress, report func()) error {
+	subfolders, err := s.folders.FindUnderPath(ctx, source.UserID, source.Path)
+	if err != nil {
+		return err
+	}
+	sourceFiles, err := s.files.FindUnderPath(ctx, source.UserID, source.Path)
+	if err != nil {
+		return err
+	}
+
+	*progress = models.JobProgress{Total: int64(len(subfolders) + len(sourceFiles))}
+	step := func() {
+		if report != nil && (progress.Done+progress.Failed)%progressEvery == 0 {
+			report()
+		}
+	}
+
+	// copies maps source folder IDs to their copies. FindUnderPath sorts by
+	// path, so a folder's parent has always been copied before it.
+	copies := map[primitive.ObjectID]*models.Folder{source.ID: root}
+	for _, folder := range subfolders {
+		var parent *models.Folder
+		if folder.ParentFolderID != nil {
+			parent = copies[*folder.ParentFolderID]
+		}
+		if parent == nil {
+			progress.Failed++ // its parent is being moved or was trashed meanwhile
+			step()
+			continue
+		}
+
+		dup := newFolderCopy(actor.ID, folder, folder.Name, &parent.ID, parent.Path)
+		ensured, err := s.ensureFolder(ctx, dup)
+		if err != nil {
+			return err
+		}
+		copies[folder.ID] = ensured
+		progress.Done++
+		step()
+	}
+
+	for _, file := range sourceFiles {
+		var parent *models.Folder
+		if file.FolderID != nil {
+			parent = copies[*file.FolderID]
+		}
+		if parent == nil || CheckDownloadable(file) != nil {
+			progress.Failed++
+			step()
+			continue
+		}
+
+		target, err := s.resolveConflict(ctx, actor.ID, parent.Path, file.FileName, primitive.NilObjectID, ConflictSkip)
+		if err != nil {
+			return err
+		}
+		if target.outcome == OutcomeCreated {
+			if _, err := s.copyFile(ctx, actor, file, parent, parent.Path, file.FileName, ConflictFail); err != nil {
+				return err
+			}
+			progress.Bytes += file.FileSize
+		}
+		progress.Done++
+		step()
+	}
+
+	if report != nil {
+		report()
+	}
+	return nil
+}
+
+// newFolderCopy returns a new folder that looks like source (name aside),
+// or a plain one if source is nil. Shares, tags and locks belong to the
+// original and are not copied.
+func newFolderCopy(ownerID primitive.ObjectID, source *models.Folder, name string, parentID *primitive.ObjectID, parentPath string) *models.Folder {
+	if parentPath == paths.Root {
+		parentPath = ""
+	}
+	folder := models.NewFolder(ownerID, name, parentID, parentPath)
+	if source != nil {
+		folder.Color = source.Color
+		folder.Icon = source.Icon
+	}
+	return folder
+}
+
+// =============================================================================
+// JOB STATUS
+// =============================================================================
+
+// GetJob returns a job started by the actor, e.g. to poll a copy's progress.
+// Other users' jobs are reported as not found.
+func (s *Service) GetJob(ctx context.Context, actor *models.User, jobID primitive.ObjectID) (*models.ProcessingJob, error) {
+	job, err := s.jobs.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != actor.ID && !actor.IsAdmin() {
+		return nil, apperrors.ErrNotFound
+	}
+	return job, nil
+}
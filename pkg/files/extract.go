@@ -0,0 +1,584 @@
+// This file implements extracting an uploaded zip or tar into a folder.
+//
+// LEARNING NOTES:
+// ===============
+// TWO PASSES OVER THE ARCHIVE:
+// The archive is downloaded once into a temp file (zip needs random
+// access to read its central directory). Then:
+//
+//  1. Scan: read every header, reject unsafe entries, add up the sizes.
+//     Nothing is created yet, so a bomb or a quota overrun costs nothing.
+//  2. Extract: create a Folder for every directory and a File for every
+//     regular entry, streaming the content into storage like an upload.
+//
+// NEVER TRUST AN ARCHIVE:
+//   - Path traversal: entries like "../../etc/passwd" or "/etc/passwd" must
+//     not escape the target folder. Every name goes through paths.Split,
+//     which rejects "..", and absolute names are refused outright.
+//   - Zip bombs: a 42 KB file can claim petabytes. We refuse archives whose
+//     declared content exceeds MaxExtractBytes or expands more than
+//     MaxCompressionRatio times, and we never read more bytes from an entry
+//     than its header declared - a header that lies gets the entry cut off.
+//   - Links and devices: symlinks could point anywhere; only folders and
+//     regular files are extracted.
+//
+// PER-ENTRY FAILURES:
+// One bad entry (an invalid name, a name taken by a folder) doesn't stop
+// the rest. Failures are counted in the job's progress and listed in its
+// result, so the client can show what was left out.
+//
+// RETRIES:
+// As with folder copies, a retried job skips files that already exist in
+// the target, so it picks up where the previous attempt stopped.
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+)
+
+// JobExtractArchive extracts an archive file in the background (see ExtractArchive).
+const JobExtractArchive models.JobType = "extract_archive"
+
+// Extraction limits
+const (
+	MaxExtractEntries         = 10000    // Entries in one archive
+	MaxExtractBytes     int64 = 20 << 30 // Declared content of one archive (20 GiB)
+	MaxCompressionRatio       = 100      // Content may be at most this many times the archive size
+
+	// ratioExemptSize is the content size below which the compression
+	// ratio isn't checked: a 1 MB text file of spaces is harmless.
+	ratioExemptSize int64 = 1 << 20
+
+	// maxReportedFailures bounds the failure list stored on the job.
+	maxReportedFailures = 100
+)
+
+var (
+	// ErrNotAnArchive is returned for files that can't be extracted.
+	ErrNotAnArchive = apperrors.New("NOT_AN_ARCHIVE", "Only .zip, .tar, .tar.gz and .tgz files can be extracted", http.StatusUnprocessableEntity)
+
+	// ErrArchiveBomb is returned for archives that expand suspiciously much.
+	ErrArchiveBomb = apperrors.New("ARCHIVE_BOMB", "The archive expands to far more than its own size", http.StatusUnprocessableEntity)
+
+	// ErrExtractTooLarge is returned for archives over the extraction limits.
+	ErrExtractTooLarge = apperrors.New("EXTRACT_TOO_LARGE",
+		fmt.Sprintf("Archives with more than %d entries or %d GiB of content can't be extracted", MaxExtractEntries, MaxExtractBytes>>30),
+		http.StatusUnprocessableEntity)
+)
+
+// ExtractRequest says where an archive should be extracted. To is the
+// folder that receives a new folder named Name (by default the archive's
+// name without its extension).
+type ExtractRequest = MoveRequest
+
+// ExtractResult is where an extraction ended up.
+type ExtractResult struct {
+	// Folder holds the extracted tree (still filling if Job is set)
+	Folder *models.Folder `json:"folder,omitempty"`
+
+	// Job is set when the archive is extracted in the background
+	Job *models.ProcessingJob `json:"job,omitempty"`
+
+	// Failures lists entries that were left out (inline extraction only;
+	// a job stores them in its result)
+	Failures []ExtractFailure `json:"failures,omitempty"`
+
+	Outcome Outcome `json:"outcome"`
+}
+
+// ExtractFailure is an archive entry that wasn't extracted.
+type ExtractFailure struct {
+	Name   string `bson:"name" json:"name"`     // Name in the archive
+	Reason string `bson:"reason" json:"reason"` // Why it was left out
+}
+
+// =============================================================================
+// STARTING
+// =============================================================================
+
+// ExtractArchive expands a zip or tar file the actor can read into a new
+// folder in the actor's tree. The folder is created right away; its
+// contents are extracted by a background job if a queue is configured.
+//
+// With ConflictOverwrite, the file or folder in the way goes to the trash.
+func (s *Service) ExtractArchive(ctx context.Context, actor *models.User, fileID primitive.ObjectID, req ExtractRequest) (*ExtractResult, error) {
+	source, err := s.Get(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckDownloadable(source); err != nil {
+		return nil, err
+	}
+	kind := archiveKindOf(source.FileName)
+	if kind == "" {
+		return nil, ErrNotAnArchive
+	}
+
+	name := req.Name
+	if name == "" {
+		name = source.FileName[:len(source.FileName)-len(kind)]
+	}
+	if name, err = paths.CleanName(name); err != nil {
+		return nil, err
+	}
+
+	parent, parentPath, err := s.destination(ctx, actor.ID, req.To)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.resolveConflict(ctx, actor.ID, parentPath, name, primitive.NilObjectID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &ExtractResult{Folder: target.existing.Folder, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if err := s.trashExisting(ctx, actor, target.existing); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := s.createFolderCopy(ctx, actor, nil, parent, parentPath, target.name, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExtractResult{Folder: root, Outcome: target.outcome}
+	if root.Name != target.name {
+		result.Outcome = OutcomeRenamed
+	}
+
+	if s.queue == nil {
+		result.Failures, err = s.extract(ctx, actor, source, root, &models.JobProgress{}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	payload := map[string]interface{}{
+		"source_file_id":   source.ID.Hex(),
+		"target_folder_id": root.ID.Hex(),
+	}
+	job, err := s.queue.EnqueueTask(ctx, JobExtractArchive, actor.ID, payload)
+	if job == nil {
+		return nil, err
+	}
+	result.Job = job
+	return result, nil
+}
+
+// HandleExtractArchive is the job handler for JobExtractArchive. Entries
+// that were left out are listed under "failures" in the job's result.
+//
+// USAGE:
+//
+//	pool.Register(files.JobExtractArchive, fileService.HandleExtractArchive)
+func (s *Service) HandleExtractArchive(ctx context.Context, job *models.ProcessingJob) error {
+	sourceID, err1 := primitive.ObjectIDFromHex(fmt.Sprint(job.Payload["source_file_id"]))
+	targetID, err2 := primitive.ObjectIDFromHex(fmt.Sprint(job.Payload["target_folder_id"]))
+	if err1 != nil || err2 != nil {
+		return jobs.Permanent(fmt.Errorf("invalid extract job payload: %v", job.Payload))
+	}
+
+	actor, err := s.users.GetByID(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	source, err := s.Get(ctx, actor, sourceID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if err := CheckDownloadable(source); err != nil {
+		return jobs.Permanent(err) // quarantined by the scanner since the request
+	}
+	root, err := s.folders.GetByID(ctx, targetID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if !root.IsActive() {
+		return jobs.Permanent(fmt.Errorf("extract target %s was deleted", root.Path))
+	}
+
+	job.Progress = &models.JobProgress{}
+	report := func() {
+		_ = s.jobs.SetProgress(ctx, job.ID, job.Progress)
+	}
+
+	failures, err := s.extract(ctx, actor, source, root, job.Progress, report)
+	job.Result = map[string]interface{}{"failures": failures}
+	if appErr, ok := apperrors.As(err); ok && appErr.StatusCode < http.StatusInternalServerError {
+		return jobs.Permanent(err) // a bomb, a damaged archive, no quota left: retrying won't help
+	}
+	return err
+}
+
+// =============================================================================
+// EXTRACTING
+// =============================================================================
+
+// extract scans the archive and then extracts it into root (see the notes
+// at the top of this file). report, if not nil, is called every few
+// entries and at the end.
+func (s *Service) extract(ctx context.Context, actor *models.User, source *models.File, root *models.Folder, progress *models.JobProgress, report func()) ([]ExtractFailure, error) {
+	tmp, err := s.download(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	kind := archiveKindOf(source.FileName)
+	var failures []ExtractFailure
+	fail := func(name, reason string) {
+		progress.Failed++
+		if len(failures) < maxReportedFailures {
+			failures = append(failures, ExtractFailure{Name: name, Reason: reason})
+		}
+	}
+
+	// Pass 1: scan
+	entries, total, err := scanArchive(tmp, source.FileSize, kind, fail)
+	if err != nil {
+		return failures, err
+	}
+
+	if err := s.checkQuota(ctx, actor.ID, total); err != nil {
+		return failures, err
+	}
+
+	// Pass 2: extract
+	progress.Total = int64(entries)
+	step := func() {
+		if report != nil && (progress.Done+progress.Failed)%progressEvery == 0 {
+			report()
+		}
+	}
+	x := &extraction{service: s, actor: actor, root: root, folders: map[string]*models.Folder{}}
+
+	err = walkArchive(tmp, source.FileSize, kind, func(entry archiveEntry, open func() (io.ReadCloser, error)) error {
+		names, reason := entry.check()
+		if reason != "" {
+			return nil // reported by the scan
+		}
+
+		written, err := x.add(ctx, entry, names, open)
+		if err != nil {
+			appErr, ok := apperrors.As(err)
+			if !ok || appErr.StatusCode >= http.StatusInternalServerError || appErr == apperrors.ErrStorageQuotaExceeded {
+				return err
+			}
+			fail(entry.name, appErr.Message) // e.g. NAME_TAKEN by a folder, INVALID_PATH
+			step()
+			return nil
+		}
+		progress.Done++
+		progress.Bytes += written
+		step()
+		return nil
+	})
+
+	if report != nil {
+		report()
+	}
+	return failures, err
+}
+
+// scanArchive is pass 1: it checks every entry, reporting the unsafe ones
+// through fail, and returns how many entries will be extracted and their
+// declared size. Archives over the limits are refused as a whole.
+func scanArchive(f *os.File, size int64, kind string, fail func(name, reason string)) (int, int64, error) {
+	var entries int
+	var total int64
+	err := walkArchive(f, size, kind, func(entry archiveEntry, _ func() (io.ReadCloser, error)) error {
+		if _, reason := entry.check(); reason != "" {
+			fail(entry.name, reason)
+			return nil
+		}
+		entries++
+		total += entry.size
+		switch {
+		case entries > MaxExtractEntries || total > MaxExtractBytes:
+			return ErrExtractTooLarge
+		case entry.compressed > 0 && entry.size > ratioExemptSize && entry.size/entry.compressed > MaxCompressionRatio:
+			return ErrArchiveBomb
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if total > ratioExemptSize && total/max(size, 1) > MaxCompressionRatio {
+		return 0, 0, ErrArchiveBomb
+	}
+	return entries, total, nil
+}
+
+// download copies the archive into a temp file. The caller removes it.
+func (s *Service) download(ctx context.Context, file *models.File) (*os.File, error) {
+	content, _, err := s.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to read archive")
+	}
+	defer content.Close()
+
+	tmp, err := os.CreateTemp("", "extract-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, apperrors.Wrap(err, "failed to read archive")
+	}
+	return tmp, nil
+}
+
+// extraction creates the items of one archive below its root folder.
+type extraction struct {
+	service *Service
+	actor   *models.User
+	root    *models.Folder
+	folders map[string]*models.Folder // created folders by lowercase path, to save lookups
+}
+
+// add creates the folder or file for an entry and returns the bytes stored.
+// Files that already exist are left alone (see RETRIES above).
+func (x *extraction) add(ctx context.Context, entry archiveEntry, names []string, open func() (io.ReadCloser, error)) (int64, error) {
+	if entry.dir {
+		_, err := x.mkdirAll(ctx, names)
+		return 0, err
+	}
+
+	parent, err := x.mkdirAll(ctx, names[:len(names)-1])
+	if err != nil {
+		return 0, err
+	}
+	name := names[len(names)-1]
+
+	s := x.service
+	target, err := s.resolveConflict(ctx, x.actor.ID, parent.Path, name, primitive.NilObjectID, ConflictSkip)
+	if err != nil {
+		return 0, err
+	}
+	if target.outcome == OutcomeSkipped {
+		return 0, nil
+	}
+
+	content, err := open()
+	if err != nil {
+		return 0, apperrors.WrapWithCode(err, "INVALID_ARCHIVE_ENTRY", "The entry can't be read", http.StatusUnprocessableEntity)
+	}
+	defer content.Close()
+
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	// Never read more than the header declared (see the notes)
+	reader := &entryReader{r: io.LimitReader(content, entry.size), left: entry.size}
+	file, err := s.create(ctx, x.actor, parent, parent.Path, name, UploadRequest{
+		Content:  reader,
+		Size:     entry.size,
+		MimeType: mimeType,
+		Conflict: ConflictFail,
+	})
+	if err != nil {
+		if reader.err != nil {
+			return 0, apperrors.WrapWithCode(reader.err, "INVALID_ARCHIVE_ENTRY", "The entry is damaged", http.StatusUnprocessableEntity)
+		}
+		return 0, err
+	}
+	s.startPipeline(ctx, file)
+	return file.FileSize, nil
+}
+
+// entryReader reads an entry's content and remembers read errors, which
+// are the archive's fault, not the storage's. Content that ends before the
+// declared size counts as an error too.
+type entryReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (e *entryReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.left -= int64(n)
+	switch {
+	case err == io.EOF && e.left > 0:
+		e.err = io.ErrUnexpectedEOF
+	case err != nil && err != io.EOF:
+		e.err = err
+	}
+	return n, err
+}
+
+// mkdirAll returns the folder at names below the root, creating it if needed.
+func (x *extraction) mkdirAll(ctx context.Context, names []string) (*models.Folder, error) {
+	if len(names) == 0 {
+		return x.root, nil
+	}
+
+	folderPath := x.root.Path + paths.Join(names...)
+	key := strings.ToLower(folderPath)
+	if folder, ok := x.folders[key]; ok {
+		return folder, nil
+	}
+	folder, err := x.service.paths.MkdirAll(ctx, x.actor.ID, folderPath)
+	if err != nil {
+		return nil, err
+	}
+	x.folders[key] = folder
+	return folder, nil
+}
+
+// =============================================================================
+// READING ARCHIVES
+// =============================================================================
+
+// Archive kinds, by file name extension
+var archiveKinds = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// archiveKindOf returns the archive extension of a file name, or "".
+func archiveKindOf(name string) string {
+	lower := strings.ToLower(name)
+	for _, kind := range archiveKinds {
+		if strings.HasSuffix(lower, kind) && len(lower) > len(kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// archiveEntry is one header of a zip or tar archive.
+type archiveEntry struct {
+	name       string // As stored in the archive
+	dir        bool
+	regular    bool  // A folder or regular file (not a link or device)
+	size       int64 // Declared content size
+	compressed int64 // Compressed size (zip only; 0 if unknown)
+}
+
+// check validates an entry and returns its path components below the
+// target folder, or why it is left out.
+func (e archiveEntry) check() ([]string, string) {
+	if !e.regular {
+		return nil, "only folders and regular files are extracted"
+	}
+	// Windows tools sometimes write "\" as the separator
+	name := strings.ReplaceAll(e.name, `\`, "/")
+	if strings.HasPrefix(name, "/") {
+		return nil, "absolute paths are not allowed"
+	}
+	names, err := paths.Split(strings.TrimPrefix(name, "./"))
+	if err != nil {
+		if appErr, ok := apperrors.As(err); ok {
+			return nil, appErr.Message
+		}
+		return nil, err.Error()
+	}
+	if len(names) == 0 && !e.dir {
+		return nil, "empty name" // "./" as a folder is the target itself
+	}
+	if e.size < 0 {
+		return nil, "invalid size"
+	}
+	return names, ""
+}
+
+// walkArchive calls fn for every entry of the archive in f. open returns
+// the entry's content; it is only valid during the call.
+func walkArchive(f *os.File, size int64, kind string, fn func(archiveEntry, func() (io.ReadCloser, error)) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if kind == ".zip" {
+		return walkZip(f, size, fn)
+	}
+
+	var r io.Reader = f
+	if kind != ".tar" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return apperrors.WrapWithCode(err, ErrNotAnArchive.Code, "The file is not a valid tar.gz archive", http.StatusUnprocessableEntity)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return walkTar(r, fn)
+}
+
+// walkZip walks a zip archive through its central directory.
+func walkZip(f *os.File, size int64, fn func(archiveEntry, func() (io.ReadCloser, error)) error) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return apperrors.WrapWithCode(err, ErrNotAnArchive.Code, "The file is not a valid zip archive", http.StatusUnprocessableEntity)
+	}
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		entry := archiveEntry{
+			name:       zf.Name,
+			dir:        mode.IsDir(),
+			regular:    mode.IsDir() || mode.IsRegular(),
+			size:       int64(zf.UncompressedSize64),
+			compressed: int64(zf.CompressedSize64),
+		}
+		if err := fn(entry, zf.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkTar walks a tar stream from start to end.
+func walkTar(r io.Reader, fn func(archiveEntry, func() (io.ReadCloser, error)) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return apperrors.WrapWithCode(err, ErrNotAnArchive.Code, "The file is not a valid tar archive", http.StatusUnprocessableEntity)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue // archive-wide metadata, not an entry
+		}
+
+		entry := archiveEntry{
+			name:    header.Name,
+			dir:     header.Typeflag == tar.TypeDir,
+			regular: header.Typeflag == tar.TypeDir || header.Typeflag == tar.TypeReg,
+			size:    header.Size,
+		}
+		if entry.dir {
+			entry.size = 0
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := fn(entry, open); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveEntryCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry archiveEntry
+		want  []string // nil when the entry must be refused
+	}{
+		{"plain file", archiveEntry{name: "docs/a.txt", regular: true}, []string{"docs", "a.txt"}},
+		{"leading dot", archiveEntry{name: "./docs/a.txt", regular: true}, []string{"docs", "a.txt"}},
+		{"backslashes", archiveEntry{name: `docs\a.txt`, regular: true}, []string{"docs", "a.txt"}},
+		{"root folder", archiveEntry{name: "./", dir: true, regular: true}, []string{}},
+
+		{"parent", archiveEntry{name: "../a.txt", regular: true}, nil},
+		{"nested parent", archiveEntry{name: "docs/../../a.txt", regular: true}, nil},
+		{"backslash parent", archiveEntry{name: `..\..\a.txt`, regular: true}, nil},
+		{"dot dot folder", archiveEntry{name: "docs/..", dir: true, regular: true}, nil},
+		{"absolute", archiveEntry{name: "/etc/passwd", regular: true}, nil},
+		{"backslash absolute", archiveEntry{name: `\etc\passwd`, regular: true}, nil},
+		{"drive letter", archiveEntry{name: "C:/Windows/a.txt", regular: true}, nil},
+		{"symlink", archiveEntry{name: "link", regular: false}, nil},
+		{"empty file name", archiveEntry{name: "./", regular: true}, nil},
+		{"negative size", archiveEntry{name: "a.txt", regular: true, size: -1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, reason := tt.entry.check()
+			if tt.want == nil {
+				if reason == "" {
+					t.Fatalf("check(%q) accepted it as %q", tt.entry.name, names)
+				}
+				return
+			}
+			if reason != "" {
+				t.Fatalf("check(%q) refused it: %s", tt.entry.name, reason)
+			}
+			if len(names) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("check(%q) = %q, want %q", tt.entry.name, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanArchive(t *testing.T) {
+	zeros := bytes.Repeat([]byte{0}, 4<<20) // Deflates about a thousand times
+
+	tests := []struct {
+		name    string
+		kind    string
+		archive []byte
+		wantErr error
+		entries int
+		failed  int
+	}{
+		{
+			name:    "small zip",
+			kind:    ".zip",
+			archive: buildZip(t, map[string][]byte{"a.txt": []byte("hello"), "docs/b.txt": []byte("world")}),
+			entries: 2,
+		},
+		{
+			name:    "traversal entries are left out",
+			kind:    ".zip",
+			archive: buildZip(t, map[string][]byte{"../evil.txt": []byte("x"), "/etc/passwd": []byte("x"), "ok.txt": []byte("x")}),
+			entries: 1,
+			failed:  2,
+		},
+		{
+			name:    "zip entry over the compression ratio",
+			kind:    ".zip",
+			archive: buildZip(t, map[string][]byte{"zeros.bin": zeros}),
+			wantErr: ErrArchiveBomb,
+		},
+		{
+			name:    "tar.gz over the compression ratio",
+			kind:    ".tar.gz",
+			archive: buildTarGz(t, map[string][]byte{"zeros.bin": zeros}),
+			wantErr: ErrArchiveBomb,
+		},
+		{
+			name:    "compressible but small",
+			kind:    ".tar.gz",
+			archive: buildTarGz(t, map[string][]byte{"zeros.bin": zeros[:ratioExemptSize]}),
+			entries: 1,
+		},
+		{
+			name:    "declared size over the limit",
+			kind:    ".zip",
+			archive: buildLyingZip(t, "huge.bin", uint64(MaxExtractBytes)+1),
+			wantErr: ErrExtractTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tempArchive(t, tt.archive)
+			failed := 0
+			entries, _, err := scanArchive(f, int64(len(tt.archive)), tt.kind, func(string, string) { failed++ })
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if entries != tt.entries || failed != tt.failed {
+				t.Fatalf("entries, failed = %d, %d, want %d, %d", entries, failed, tt.entries, tt.failed)
+			}
+		})
+	}
+}
+
+func buildZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// buildLyingZip writes an entry whose header claims size bytes of content
+// it doesn't have.
+func buildLyingZip(t *testing.T, name string, size uint64) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: name, Method: zip.Store, CompressedSize64: size, UncompressedSize64: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("not nearly enough")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func buildTarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func tempArchive(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := io.Copy(f, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
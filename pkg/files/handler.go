@@ -0,0 +1,451 @@
+// This file exposes uploads, moves, copies, extractions, the trash,
+// versions and sharing over HTTP.
+package files
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Handler serves the file lifecycle endpoints.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a Handler.
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the routes on a router group.
+//
+// USAGE:
+//
+//	files.NewHandler(fileService).RegisterRoutes(api)
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.PUT("/upload", h.Upload)
+	r.POST("/files/:id/move", h.MoveFile)
+	r.POST("/folders/:id/move", h.MoveFolder)
+	r.POST("/files/:id/copy", h.CopyFile)
+	r.POST("/folders/:id/copy", h.CopyFolder)
+	r.POST("/files/:id/extract", h.Extract)
+	r.GET("/jobs/:id", h.GetJob)
+
+	r.DELETE("/files/:id", h.DeleteFile)
+	r.DELETE("/folders/:id", h.DeleteFolder)
+	r.POST("/files/:id/restore", h.RestoreFile)
+
+	r.GET("/files/:id/versions", h.ListVersions)
+	r.POST("/files/:id/versions/:version/restore", h.RestoreVersion)
+
+	r.PUT("/files/:id/shares", h.ShareFile)
+	r.DELETE("/files/:id/shares", h.UnshareFile)
+	r.PUT("/folders/:id/shares", h.ShareFolder)
+	r.DELETE("/folders/:id/shares", h.UnshareFolder)
+}
+
+// Upload stores the request body as a file. Missing folders are created.
+// Responds 201 if a file was created, 200 if one was overwritten or the
+// upload was skipped.
+//
+// PUT /upload?path=/Documents/report.pdf&conflict=rename
+// Content-Type: application/pdf
+// Content-Length: 48213
+//
+// conflict is fail (default), overwrite, rename or skip.
+func (h *Handler) Upload(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	policy, err := ParseConflictPolicy(c.Query("conflict"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if c.Request.ContentLength < 0 {
+		// The size is checked against the quota before anything is stored
+		_ = c.Error(apperrors.New("LENGTH_REQUIRED", "Content-Length is required", http.StatusLengthRequired))
+		return
+	}
+
+	mimeType := c.ContentType()
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	result, err := h.service.Upload(c.Request.Context(), user, UploadRequest{
+		Path:     c.Query("path"),
+		Content:  c.Request.Body,
+		Size:     c.Request.ContentLength,
+		MimeType: mimeType,
+		Conflict: policy,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Outcome == OutcomeCreated || result.Outcome == OutcomeRenamed {
+		status = http.StatusCreated
+	}
+	c.JSON(status, result)
+}
+
+// moveRequest is the body of the move and copy endpoints.
+type moveRequest struct {
+	To       string `json:"to" binding:"required"`
+	Name     string `json:"name"`
+	Conflict string `json:"conflict"`
+}
+
+// MoveFile moves and/or renames a file.
+//
+// POST /files/:id/move {"to": "/Archive/2024", "name": "old-report.pdf", "conflict": "rename"}
+func (h *Handler) MoveFile(c *gin.Context) {
+	h.move(c, h.service.MoveFile)
+}
+
+// MoveFolder moves and/or renames a folder with everything in it.
+//
+// POST /folders/:id/move {"to": "/Archive", "conflict": "fail"}
+func (h *Handler) MoveFolder(c *gin.Context) {
+	h.move(c, h.service.MoveFolder)
+}
+
+// move parses a move request and runs it with the given service method.
+func (h *Handler) move(c *gin.Context, run func(context.Context, *models.User, primitive.ObjectID, MoveRequest) (*MoveResult, error)) {
+	user, id, req, ok := parseMoveRequest(c)
+	if !ok {
+		return
+	}
+
+	result, err := run(c.Request.Context(), user, id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CopyFile copies a file into the current user's tree.
+//
+// POST /files/:id/copy {"to": "/Documents", "conflict": "rename"}
+func (h *Handler) CopyFile(c *gin.Context) {
+	h.copy(c, h.service.CopyFile)
+}
+
+// CopyFolder copies a folder with everything in it into the current
+// user's tree. Large folders are copied in the background: the response is
+// 202 Accepted with a job to poll at GET /jobs/:id.
+//
+// POST /folders/:id/copy {"to": "/Backups", "name": "Photos 2024"}
+func (h *Handler) CopyFolder(c *gin.Context) {
+	h.copy(c, h.service.CopyFolder)
+}
+
+// copy parses a copy request and runs it with the given service method.
+func (h *Handler) copy(c *gin.Context, run func(context.Context, *models.User, primitive.ObjectID, CopyRequest) (*CopyResult, error)) {
+	user, id, req, ok := parseMoveRequest(c)
+	if !ok {
+		return
+	}
+
+	result, err := run(c.Request.Context(), user, id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	switch {
+	case result.Job != nil:
+		c.JSON(http.StatusAccepted, result)
+	case result.Outcome == OutcomeCreated || result.Outcome == OutcomeRenamed:
+		c.JSON(http.StatusCreated, result)
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Extract expands a zip or tar file into a new folder. The folder is
+// created right away and filled by a background job: the response is 202
+// Accepted with the job, whose result lists entries that were left out.
+//
+// POST /files/:id/extract {"to": "/Projects", "name": "site-backup", "conflict": "rename"}
+func (h *Handler) Extract(c *gin.Context) {
+	user, id, req, ok := parseMoveRequest(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.service.ExtractArchive(c.Request.Context(), user, id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	switch {
+	case result.Job != nil:
+		c.JSON(http.StatusAccepted, result)
+	case result.Outcome == OutcomeSkipped:
+		c.JSON(http.StatusOK, result)
+	default:
+		c.JSON(http.StatusCreated, result)
+	}
+}
+
+// GetJob returns a background job of the current user, with its progress.
+//
+// GET /jobs/:id
+func (h *Handler) GetJob(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	job, err := h.service.GetJob(c.Request.Context(), user, id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// =============================================================================
+// TRASH
+// =============================================================================
+
+// DeleteFile moves a file to the trash.
+//
+// DELETE /files/:id
+func (h *Handler) DeleteFile(c *gin.Context) {
+	h.trash(c, h.service.Delete)
+}
+
+// DeleteFolder moves a folder and everything in it to the trash.
+//
+// DELETE /folders/:id
+func (h *Handler) DeleteFolder(c *gin.Context) {
+	h.trash(c, h.service.DeleteFolder)
+}
+
+// RestoreFile takes a file back out of the trash.
+//
+// POST /files/:id/restore
+func (h *Handler) RestoreFile(c *gin.Context) {
+	h.trash(c, h.service.Restore)
+}
+
+// trash runs a trash operation on the :id and responds 204 No Content.
+func (h *Handler) trash(c *gin.Context, run func(context.Context, *models.User, primitive.ObjectID) error) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := run(c.Request.Context(), user, id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// =============================================================================
+// VERSIONS
+// =============================================================================
+
+// ListVersions returns the earlier versions of a file, newest first.
+//
+// GET /files/:id/versions
+func (h *Handler) ListVersions(c *gin.Context) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.service.ListVersions(c.Request.Context(), user, id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// RestoreVersion makes an earlier version's content current again, as a
+// new version, and returns the file.
+//
+// POST /files/:id/versions/3/restore
+func (h *Handler) RestoreVersion(c *gin.Context) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	file, err := h.service.RestoreVersion(c.Request.Context(), user, id, version)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// =============================================================================
+// SHARING
+// =============================================================================
+
+// shareRequest is the body of PUT /files/:id/shares and /folders/:id/shares.
+type shareRequest struct {
+	Email      string                `json:"email" binding:"required"`
+	Permission models.FilePermission `json:"permission" binding:"required"`
+}
+
+// ShareFile shares a file with a user, or changes their permission, and
+// returns the file.
+//
+// PUT /files/:id/shares {"email": "bob@example.com", "permission": "read"}
+func (h *Handler) ShareFile(c *gin.Context) {
+	user, id, req, ok := parseShareRequest(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.service.ShareFile(c.Request.Context(), user, id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// UnshareFile takes a user's access to a file away.
+//
+// DELETE /files/:id/shares?email=bob@example.com
+func (h *Handler) UnshareFile(c *gin.Context) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.service.UnshareFile(c.Request.Context(), user, id, c.Query("email"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// ShareFolder shares a folder with a user, or changes their permission,
+// and returns the folder.
+//
+// PUT /folders/:id/shares {"email": "bob@example.com", "permission": "write"}
+func (h *Handler) ShareFolder(c *gin.Context) {
+	user, id, req, ok := parseShareRequest(c)
+	if !ok {
+		return
+	}
+
+	folder, err := h.service.ShareFolder(c.Request.Context(), user, id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// UnshareFolder takes a user's access to a folder away.
+//
+// DELETE /folders/:id/shares?email=bob@example.com
+func (h *Handler) UnshareFolder(c *gin.Context) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	folder, err := h.service.UnshareFolder(c.Request.Context(), user, id, c.Query("email"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// =============================================================================
+// REQUEST PARSING
+// =============================================================================
+
+// parseID reads the user and the :id. On failure it records the error and
+// returns false.
+func parseID(c *gin.Context) (*models.User, primitive.ObjectID, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return nil, primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return nil, primitive.NilObjectID, false
+	}
+	return user, id, true
+}
+
+// parseShareRequest reads the user, the :id and the body of a share.
+func parseShareRequest(c *gin.Context) (*models.User, primitive.ObjectID, ShareRequest, bool) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return nil, primitive.NilObjectID, ShareRequest{}, false
+	}
+
+	var body shareRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return nil, primitive.NilObjectID, ShareRequest{}, false
+	}
+	return user, id, ShareRequest{Email: body.Email, Permission: body.Permission}, true
+}
+
+// parseMoveRequest reads the user, the :id and the body shared by the move
+// and copy endpoints. On failure it records the error and returns false.
+func parseMoveRequest(c *gin.Context) (*models.User, primitive.ObjectID, MoveRequest, bool) {
+	user, id, ok := parseID(c)
+	if !ok {
+		return nil, primitive.NilObjectID, MoveRequest{}, false
+	}
+
+	var body moveRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return nil, primitive.NilObjectID, MoveRequest{}, false
+	}
+	policy, err := ParseConflictPolicy(body.Conflict)
+	if err != nil {
+		_ = c.Error(err)
+		return nil, primitive.NilObjectID, MoveRequest{}, false
+	}
+
+	return user, id, MoveRequest{To: body.To, Name: body.Name, Conflict: policy}, true
+}
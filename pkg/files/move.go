@@ -0,0 +1,328 @@
+// This file implements moving and renaming files and folders.
+//
+// LEARNING NOTES:
+// ===============
+// MOVING A FOLDER TOUCHES ITS WHOLE SUBTREE:
+// Every item stores its full path, so moving "/A" to "/B/A" rewrites the
+// path of everything below it. We do that bottom-up:
+//
+//  1. Files below the folder:      "/A/..." -> "/B/A/..."
+//  2. Subfolders below the folder: "/A/..." -> "/B/A/..."
+//  3. The folder itself:           "/A"     -> "/B/A"
+//
+// Each step is a single UpdateMany, but there is no transaction around
+// them. If we stop after step 1 or 2, the folder is still at "/A" with
+// nothing left under that path, and repeating the move finishes the job:
+// steps 1 and 2 find nothing more to do and step 3 runs. Step 3 is
+// committed together with the folder.moved event, so the event only goes
+// out for a move that completed.
+//
+// FolderID and ParentFolderID links never change during a folder move,
+// which is why GetAncestors (and with it permission checks and retention)
+// stays correct while paths are being rewritten.
+package files
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/retention"
+)
+
+// ErrMoveIntoItself is returned when a folder would be moved into itself
+// or one of its own subfolders.
+var ErrMoveIntoItself = apperrors.New("MOVE_INTO_ITSELF", "A folder can't be moved into itself", http.StatusBadRequest)
+
+// MoveRequest says where an item should go.
+type MoveRequest struct {
+	To       string         // Destination folder path ("/" = top level); created if missing
+	Name     string         // New name; empty keeps the current one
+	Conflict ConflictPolicy // What to do if the name is taken at the destination
+}
+
+// MoveResult is where a move ended up. Exactly one of File and Folder is
+// set: the moved item, or the overwritten file that received its content.
+type MoveResult struct {
+	File    *models.File   `json:"file,omitempty"`
+	Folder  *models.Folder `json:"folder,omitempty"`
+	Outcome Outcome        `json:"outcome"`
+}
+
+// MoveFile moves and/or renames a file within its owner's tree.
+//
+// With ConflictOverwrite, a file in the way receives the moved file's
+// content as a new version and the moved file goes to the trash, so the
+// target keeps its history, shares and links.
+func (s *Service) MoveFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID, req MoveRequest) (*MoveResult, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFile(actor, file, models.PermissionAdmin) {
+		return nil, apperrors.ErrForbidden
+	}
+	if err := s.guard.CheckFile(ctx, file, retention.OpMove); err != nil {
+		return nil, err
+	}
+
+	name, err := newName(req.Name, file.FileName)
+	if err != nil {
+		return nil, err
+	}
+	parent, parentPath, err := s.destination(ctx, file.UserID, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.resolveConflict(ctx, file.UserID, parentPath, name, file.ID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &MoveResult{File: file, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if target.existing.File == nil {
+			return nil, repository.ErrNameTaken
+		}
+		replaced, err := s.replaceWith(ctx, actor, target.existing.File, file)
+		if err != nil {
+			return nil, err
+		}
+		return &MoveResult{File: replaced, Outcome: OutcomeOverwritten}, nil
+	}
+
+	before := *file
+	file.FileName = target.name
+	file.PlaceIn(parent)
+
+	outcome := target.outcome
+	for race := 0; ; race++ {
+		err := s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+			if err := s.files.Update(ctx, file); err != nil {
+				return nil, err
+			}
+			return []events.Payload{events.FileMoved{FileID: file.ID, OldPath: before.FilePath, NewPath: file.FilePath}}, nil
+		})
+		if err == nil && s.folderAt(ctx, file.UserID, file.FilePath) && s.moveFileBack(ctx, file, before) {
+			err = repository.ErrNameTaken // a folder took the path (see conflict.go)
+		}
+		if err == nil {
+			break
+		}
+		if !apperrors.Is(err, repository.ErrNameTaken) || req.Conflict != ConflictRename || race == maxNameRaces {
+			return nil, err
+		}
+
+		// Someone took the name since we looked: pick the next one
+		if file.FileName, err = s.paths.FreeName(ctx, file.UserID, parentPath, file.FileName); err != nil {
+			return nil, err
+		}
+		file.PlaceIn(parent)
+		outcome = OutcomeRenamed
+	}
+	return &MoveResult{File: file, Outcome: outcome}, nil
+}
+
+// moveFileBack returns a just moved file to where it was before, keeping
+// file as the move's target so the caller can try another name. It
+// reports false if the file stays where it was moved to.
+func (s *Service) moveFileBack(ctx context.Context, file *models.File, before models.File) bool {
+	back := before
+	back.UpdatedAt = file.UpdatedAt // as the move stored it
+	err := s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, &back); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FileMoved{FileID: file.ID, OldPath: file.FilePath, NewPath: back.FilePath}}, nil
+	})
+	if err != nil {
+		return false
+	}
+	file.UpdatedAt = back.UpdatedAt
+	return true
+}
+
+// replaceWith stores source's content as a new version of target and moves
+// source to the trash.
+func (s *Service) replaceWith(ctx context.Context, actor *models.User, target, source *models.File) (*models.File, error) {
+	replaced, err := s.overwriteFrom(ctx, actor, target, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Delete(ctx, actor, source.ID); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// MoveFolder moves and/or renames a folder, with everything in it, within
+// its owner's tree.
+//
+// With ConflictOverwrite, the file or folder in the way goes to the trash.
+func (s *Service) MoveFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID, req MoveRequest) (*MoveResult, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFolder(actor, folder, models.PermissionAdmin) {
+		return nil, apperrors.ErrForbidden
+	}
+	if err := s.guard.CheckFolder(ctx, folder, retention.OpMove); err != nil {
+		return nil, err
+	}
+
+	name, err := newName(req.Name, folder.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check before MkdirAll, which would otherwise create folders inside
+	// the folder we are about to move
+	to, err := paths.Clean(req.To)
+	if err != nil {
+		return nil, err
+	}
+	if isWithin(to, folder.Path) {
+		return nil, ErrMoveIntoItself
+	}
+
+	parent, parentPath, err := s.destination(ctx, folder.UserID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.resolveConflict(ctx, folder.UserID, parentPath, name, folder.ID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &MoveResult{Folder: folder, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if err := s.trashExisting(ctx, actor, target.existing); err != nil {
+			return nil, err
+		}
+	}
+
+	var parentID *primitive.ObjectID
+	if parent != nil {
+		parentID = &parent.ID
+	}
+
+	outcome := target.outcome
+	for race := 0; ; race++ {
+		err := s.relocate(ctx, folder, parentID, parentPath, target.name)
+		if err == nil {
+			break
+		}
+		if !apperrors.Is(err, repository.ErrNameTaken) || req.Conflict != ConflictRename || race == maxNameRaces {
+			return nil, err
+		}
+
+		if target.name, err = s.paths.FreeName(ctx, folder.UserID, parentPath, target.name); err != nil {
+			return nil, err
+		}
+		outcome = OutcomeRenamed
+	}
+	return &MoveResult{Folder: folder, Outcome: outcome}, nil
+}
+
+// relocate moves a folder and everything in it to a new path. If a file
+// took that path meanwhile, the folder is moved back and the result is
+// repository.ErrNameTaken (see conflict.go).
+func (s *Service) relocate(ctx context.Context, folder *models.Folder, parentID *primitive.ObjectID, parentPath, name string) error {
+	before := *folder
+	if err := s.moveSubtree(ctx, folder, parentID, parentPath, name); err != nil {
+		return err
+	}
+	if !s.fileAt(ctx, folder.UserID, folder.Path) {
+		return nil
+	}
+
+	beforeParent := strings.TrimSuffix(before.Path, "/"+before.Name)
+	if err := s.moveSubtree(ctx, folder, before.ParentFolderID, beforeParent, before.Name); err != nil {
+		return nil // it stays where it was moved to
+	}
+	return repository.ErrNameTaken
+}
+
+// moveSubtree rewrites the paths below a folder and then the folder itself
+// (see the notes at the top of this file). If the folder can't take its
+// new path, the subtree is moved back before the error is returned.
+func (s *Service) moveSubtree(ctx context.Context, folder *models.Folder, parentID *primitive.ObjectID, parentPath, name string) error {
+	from, to := folder.Path, joinName(parentPath, name)
+
+	if _, err := s.files.MoveUnderPath(ctx, folder.UserID, from, to); err != nil {
+		return err
+	}
+	if _, err := s.folders.MoveUnderPath(ctx, folder.UserID, from, to); err != nil {
+		_, _ = s.files.MoveUnderPath(ctx, folder.UserID, to, from)
+		return err
+	}
+
+	moved := *folder
+	moved.Name = name
+	moved.ParentFolderID = parentID
+	moved.Path = to
+	err := s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.folders.Update(ctx, &moved); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FolderMoved{FolderID: folder.ID, OldPath: from, NewPath: to}}, nil
+	})
+	if err != nil {
+		_, _ = s.folders.MoveUnderPath(ctx, folder.UserID, to, from)
+		_, _ = s.files.MoveUnderPath(ctx, folder.UserID, to, from)
+		return err
+	}
+
+	*folder = moved
+	return nil
+}
+
+// destination returns the folder at path in the owner's tree, creating it
+// if needed, and its path. The folder is nil for the top level.
+func (s *Service) destination(ctx context.Context, ownerID primitive.ObjectID, path string) (*models.Folder, string, error) {
+	parent, err := s.paths.MkdirAll(ctx, ownerID, path)
+	if err != nil {
+		return nil, "", err
+	}
+	if parent == nil {
+		return nil, paths.Root, nil
+	}
+	return parent, parent.Path, nil
+}
+
+// newName returns the cleaned requested name, or current if none was given.
+func newName(requested, current string) (string, error) {
+	if requested == "" {
+		return current, nil
+	}
+	return paths.CleanName(requested)
+}
+
+// isWithin reports whether path is folderPath or below it. Paths are
+// compared ignoring case, like the path indexes do.
+func isWithin(path, folderPath string) bool {
+	path, folderPath = strings.ToLower(path), strings.ToLower(folderPath)
+	return path == folderPath || strings.HasPrefix(path, folderPath+"/")
+}
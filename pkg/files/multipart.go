@@ -0,0 +1,168 @@
+// This file implements multipart uploads the way S3 clients make them:
+// numbered parts, possibly in parallel, and a total size that is only
+// known when the client completes the upload.
+//
+// LEARNING NOTES:
+// ===============
+// TWO KINDS OF UPLOADS, ONE COLLECTION:
+// Resumable (tus) uploads know their length up front and arrive in order.
+// Both kinds are models.File documents in the uploads collection with a
+// storage multipart upload behind them, so they share expiry, termination
+// and PurgeExpiredUploads. The differences:
+//
+//   - Parts go to storage as they are. S3 clients already keep every part
+//     but the last at 5 MiB or more, so there is no tail to park.
+//   - Parts are recorded with RecordChunk, which is safe when several
+//     arrive at once, instead of the lock-and-Save of WriteChunk.
+//   - Parts may arrive in any order, so the SHA-256 can't be computed on
+//     the way through. The joined object is read back once at completion.
+//
+// A resumable upload has a saved hash state from the start; a multipart
+// upload never does, which is how the two are told apart.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// MaxPartNumber is the highest part number S3 allows.
+const MaxPartNumber = 10000
+
+// Multipart upload errors
+var (
+	ErrInvalidPartNumber = apperrors.New("INVALID_PART_NUMBER", "Part numbers must be between 1 and 10000", http.StatusBadRequest)
+	ErrInvalidPartOrder  = apperrors.New("INVALID_PART_ORDER", "Parts must be listed in ascending order", http.StatusBadRequest)
+	ErrInvalidPart       = apperrors.New("INVALID_PART", "A listed part was not uploaded or its ETag doesn't match", http.StatusBadRequest)
+)
+
+// StartMultipart starts a multipart upload to a path. The conflict policy
+// is applied when the upload completes.
+func (s *Service) StartMultipart(ctx context.Context, actor *models.User, path, mimeType string, policy ConflictPolicy) (*models.File, error) {
+	if s.uploads == nil {
+		return nil, ErrResumableUnavailable
+	}
+	names, err := paths.Split(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, paths.ErrRootPath
+	}
+	name := names[len(names)-1]
+
+	upload := models.NewFileForChunkedUpload(actor.ID, name, 0, mimeType, "", s.bucket, s.region, "")
+	upload.S3Key = storage.FileKey(upload.UserID, upload.ID, name)
+	upload.FilePath = paths.Join(names...)
+	upload.Resumable = &models.ResumableUpload{
+		Conflict:  string(policy),
+		ExpiresAt: time.Now().Add(ResumableExpiry),
+	}
+
+	upload.UploadID, err = s.storage.CreateMultipartUpload(ctx, upload.S3Key, mimeType)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to start upload")
+	}
+	if err := s.uploads.Create(ctx, upload); err != nil {
+		_ = s.storage.AbortMultipartUpload(ctx, upload.S3Key, upload.UploadID)
+		return nil, err
+	}
+	return upload, nil
+}
+
+// UploadPart stores one part of a multipart upload. Sending a part number
+// again replaces the part.
+func (s *Service) UploadPart(ctx context.Context, actor *models.User, uploadID primitive.ObjectID, number int, content io.Reader, size int64) (*models.UploadChunk, error) {
+	if number < 1 || number > MaxPartNumber {
+		return nil, ErrInvalidPartNumber
+	}
+	upload, err := s.getMultipart(ctx, actor, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	etag, err := s.storage.UploadPart(ctx, upload.S3Key, upload.UploadID, number, content, size)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to store part")
+	}
+
+	chunk := models.UploadChunk{PartNumber: number, ETag: etag, UploadedAt: time.Now(), Size: size}
+	if err := s.uploads.RecordChunk(ctx, upload.ID, chunk, time.Now().Add(ResumableExpiry)); err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// CompleteMultipart joins the listed parts, in order, into a file at the
+// upload's path. Recorded parts that aren't listed are dropped.
+func (s *Service) CompleteMultipart(ctx context.Context, actor *models.User, uploadID primitive.ObjectID, parts []storage.Part) (*UploadResult, error) {
+	upload, err := s.getMultipart(ctx, actor, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, ErrInvalidPart
+	}
+	if !sort.SliceIsSorted(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number }) {
+		return nil, ErrInvalidPartOrder
+	}
+
+	recorded := make(map[int]models.UploadChunk, len(upload.Chunks))
+	for _, chunk := range upload.Chunks {
+		recorded[chunk.PartNumber] = chunk
+	}
+	listed := make([]models.UploadChunk, 0, len(parts))
+	for i, part := range parts {
+		chunk, ok := recorded[part.Number]
+		if !ok || strings.Trim(part.ETag, `"`) != strings.Trim(chunk.ETag, `"`) {
+			return nil, ErrInvalidPart
+		}
+		parts[i].ETag = chunk.ETag
+		listed = append(listed, chunk)
+	}
+
+	info, err := s.storage.CompleteMultipartUpload(ctx, upload.S3Key, upload.UploadID, parts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to complete upload")
+	}
+	upload.Chunks = listed
+	upload.FileSize = info.Size
+
+	// Read the content back once for its checksum (see the notes above)
+	content, _, err := s.storage.Get(ctx, upload.S3Key)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to read upload")
+	}
+	defer content.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, content); err != nil {
+		return nil, apperrors.Wrap(err, "failed to read upload")
+	}
+
+	return s.finishUpload(ctx, actor, upload, hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// getMultipart loads an unexpired multipart (not resumable) upload.
+func (s *Service) getMultipart(ctx context.Context, actor *models.User, uploadID primitive.ObjectID) (*models.File, error) {
+	upload, err := s.GetUpload(ctx, actor, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Resumable.HashState != nil {
+		return nil, apperrors.ErrNotFound
+	}
+	return upload, nil
+}
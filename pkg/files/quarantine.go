@@ -0,0 +1,159 @@
+// This file implements quarantine: blocking infected files and the
+// administrator decisions that end it.
+//
+// LEARNING NOTES:
+// ===============
+// QUARANTINE LIFECYCLE:
+//
+//	scanned --infected--> quarantined --ReleaseQuarantine--> active
+//	                           |
+//	                           +--PurgeQuarantined--> gone
+//
+// The virus scan job (pkg/processing) puts files into quarantine. Only
+// administrators take them out again, either because the detection was a
+// false positive (release) or to get rid of the file for good (purge).
+package files
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/retention"
+)
+
+// ErrNotQuarantined indicates a release or purge of a file that isn't quarantined.
+var ErrNotQuarantined = apperrors.New("NOT_QUARANTINED", "File is not quarantined", http.StatusConflict)
+
+// =============================================================================
+// SERVING CONTENT
+// =============================================================================
+
+// CheckDownloadable returns ErrFileQuarantined if the file's content must
+// not be served. Every path that hands out content (downloads, sharing,
+// archives) calls it, so the rule lives in one place.
+func CheckDownloadable(file *models.File) error {
+	if file.IsQuarantined() {
+		return apperrors.ErrFileQuarantined
+	}
+	return nil
+}
+
+// GetDownloadable returns a file whose content the actor may download.
+//
+// Permission checks come first, so someone who can't see the file gets
+// 404 rather than learning that it is quarantined.
+func (s *Service) GetDownloadable(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.Get(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckDownloadable(file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// =============================================================================
+// ADMINISTRATION
+// =============================================================================
+
+// ListQuarantined returns quarantined files, oldest detection first.
+func (s *Service) ListQuarantined(ctx context.Context, actor *models.User, limit int64) ([]*models.File, error) {
+	if !actor.IsAdmin() {
+		return nil, apperrors.ErrForbidden
+	}
+	return s.files.FindQuarantined(ctx, limit)
+}
+
+// ReleaseQuarantine makes a quarantined file available again, e.g. after
+// an administrator confirmed the detection was a false positive.
+// It returns the released file so callers can resume its processing.
+func (s *Service) ReleaseQuarantine(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.getQuarantined(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &models.QuarantineRelease{
+		Signature:  file.Quarantine.Signature,
+		ReleasedBy: actor.ID,
+		ReleasedAt: time.Now(),
+	}
+	if err := s.files.ReleaseQuarantine(ctx, file.ID, release); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil, ErrNotQuarantined // released concurrently
+		}
+		return nil, err
+	}
+
+	s.notify(ctx, models.NewFileNotification(
+		models.NotificationFileReleased,
+		file,
+		"File released",
+		fmt.Sprintf("%q was reviewed by an administrator and is available again.", file.FileName),
+	))
+
+	file.Quarantine = nil
+	file.QuarantineRelease = release
+	return file, nil
+}
+
+// PurgeQuarantined permanently deletes a quarantined file without passing
+// through the trash. Retention locks and legal holds still apply: an
+// infected file under legal hold stays quarantined until the hold ends.
+func (s *Service) PurgeQuarantined(ctx context.Context, actor *models.User, fileID primitive.ObjectID) error {
+	file, err := s.getQuarantined(ctx, actor, fileID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.guard.CheckFile(ctx, file, retention.OpPurge); err != nil {
+		return err
+	}
+
+	if _, err := s.purgeFile(ctx, file); err != nil {
+		return err
+	}
+
+	s.notify(ctx, models.NewFileNotification(
+		models.NotificationFilePurged,
+		file,
+		"File deleted",
+		fmt.Sprintf("%q was permanently deleted because it contained a virus (%s).", file.FileName, file.Quarantine.Signature),
+	))
+	return nil
+}
+
+// getQuarantined loads a file for an administrator quarantine decision.
+func (s *Service) getQuarantined(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	if !actor.IsAdmin() {
+		return nil, apperrors.ErrForbidden
+	}
+
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsQuarantined() {
+		return nil, ErrNotQuarantined
+	}
+	return file, nil
+}
+
+// notify delivers a notification on a best-effort basis.
+//
+// WHY IGNORE THE ERROR?
+// The administrator's decision has already been stored. Failing the request
+// now would suggest it hadn't, and retrying would release or purge twice.
+func (s *Service) notify(ctx context.Context, notification *models.Notification) {
+	if s.notifications == nil {
+		return
+	}
+	_ = s.notifications.Create(ctx, notification)
+}
@@ -0,0 +1,125 @@
+// This file implements read access to files.
+//
+// INHERITED SHARES:
+// Sharing a folder shares everything inside it. A file is readable if it
+// is shared with you directly OR if its folder, or any folder above that,
+// is. Only the direct check is possible without the database; the
+// inherited one walks the folder chain, so it lives on the Service.
+package files
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Get returns an active file the actor may read.
+//
+// WHY 404 INSTEAD OF 403?
+// Answering "forbidden" would confirm that a file with this ID exists.
+// For files the actor can't see at all, "not found" leaks nothing.
+func (s *Service) Get(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.MayRead(ctx, actor, file)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	return file, nil
+}
+
+// GetFolder returns an active folder the actor may read.
+func (s *Service) GetFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID) (*models.Folder, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.MayReadFolder(ctx, actor, folder)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	return folder, nil
+}
+
+// MayRead reports whether the actor may see an active file, directly or
+// through a shared folder.
+func (s *Service) MayRead(ctx context.Context, actor *models.User, file *models.File) (bool, error) {
+	if !file.IsActive() {
+		return false, nil
+	}
+	if CanRead(actor, file) {
+		return true, nil
+	}
+	return s.sharedViaFolder(ctx, actor, file.FolderID)
+}
+
+// MayReadFolder is MayRead for folders.
+func (s *Service) MayReadFolder(ctx context.Context, actor *models.User, folder *models.Folder) (bool, error) {
+	if !folder.IsActive() {
+		return false, nil
+	}
+	if CanReadFolder(actor, folder) {
+		return true, nil
+	}
+	return s.sharedViaFolder(ctx, actor, folder.ParentFolderID)
+}
+
+// SharedFolders returns the active folders other users shared with the
+// actor directly. Everything below them is readable too.
+func (s *Service) SharedFolders(ctx context.Context, actor *models.User) ([]*models.Folder, error) {
+	return s.folders.FindSharedWith(ctx, actor.ID, 0)
+}
+
+// CanRead reports whether the actor may see an active file, considering
+// only the file's own shares. Other packages use it to filter files they
+// loaded themselves, e.g. in bulk queries.
+func CanRead(actor *models.User, file *models.File) bool {
+	return file.IsActive() && canAccessFile(actor, file, models.PermissionRead)
+}
+
+// CanReadFolder reports whether the actor may see an active folder,
+// considering only the folder's own shares.
+func CanReadFolder(actor *models.User, folder *models.Folder) bool {
+	return folder.IsActive() && canAccessFolder(actor, folder, models.PermissionRead)
+}
+
+// sharedViaFolder reports whether a folder or one of its ancestors is
+// readable by the actor. A nil folderID (top level) shares nothing.
+func (s *Service) sharedViaFolder(ctx context.Context, actor *models.User, folderID *primitive.ObjectID) (bool, error) {
+	if folderID == nil {
+		return false, nil
+	}
+
+	folder, err := s.folders.GetByID(ctx, *folderID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if CanReadFolder(actor, folder) {
+		return true, nil
+	}
+
+	ancestors, err := s.folders.GetAncestors(ctx, folder)
+	if err != nil {
+		return false, err
+	}
+	for _, ancestor := range ancestors {
+		if CanReadFolder(actor, ancestor) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
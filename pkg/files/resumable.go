@@ -0,0 +1,574 @@
+// This file implements resumable uploads: content that arrives in pieces,
+// possibly over many connections, and becomes a file when complete.
+//
+// LEARNING NOTES:
+// ===============
+// MAPPING CHUNKS ONTO MULTIPART UPLOADS:
+// A resumable upload is a models.File in the uploads collection with an
+// S3 multipart upload behind it (File.UploadID). Each chunk the client
+// sends is cut into parts, recorded in File.Chunks:
+//
+//	client chunks:   |--- 3 MiB ---|------- 9 MiB -------|-- 1 MiB --|
+//	S3 parts:        |------ 5 MiB ------|------ 5 MiB ------|- 3 -|
+//	                               tail: ^^^^^^^  (parked between chunks)
+//
+// Every part but the last must be at least 5 MiB, so bytes that don't fill
+// a part yet are parked as a "tail" object and prepended to the next
+// chunk. Offset = sum of the chunk sizes + the tail size.
+//
+// ALL OR NOTHING PER CHUNK:
+// A chunk is spooled to a temp file first, so its checksum can be checked
+// before anything is stored. Parts and the new tail are then written, and
+// only the final Save makes them count. If anything fails in between, the
+// upload still describes its old state: the next attempt reuses the same
+// part numbers (S3 replaces them) and writes a new tail key (the recorded
+// tail is never overwritten).
+//
+// CHECKSUMS:
+// File.Checksum is the SHA-256 of the whole content, but the content is
+// never in one place before it's complete. The SHA-256 state is saved
+// after every chunk (hash.Hash implements encoding.BinaryMarshaler) and
+// restored for the next one, so the sum is ready when the last byte is.
+//
+// WHEN THE LAST BYTE ARRIVES:
+// The parts are joined under the file's own key, and the file is placed
+// at its path. The conflict policy chosen at creation is only applied
+// now, because the folder may have changed while the upload ran.
+package files
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Resumable upload settings
+const (
+	// ResumableExpiry is how long an upload may go without a chunk
+	// before it is abandoned (each chunk extends it)
+	ResumableExpiry = 24 * time.Hour
+
+	// resumablePartSize is the size of the parts chunks are cut into.
+	// S3 allows 10,000 parts, so uploads of up to 50 GiB fit.
+	resumablePartSize = storage.MinPartSize
+
+	// chunkLockTimeout bounds how long a crashed request blocks an upload
+	chunkLockTimeout = 30 * time.Minute
+
+	// chunkStoreTimeout bounds storing a received chunk and saving the
+	// upload, which go on after the client hung up (see WriteChunk)
+	chunkStoreTimeout = 5 * time.Minute
+)
+
+// ChecksumAlgorithms lists the algorithms a chunk checksum may use.
+var ChecksumAlgorithms = []string{"sha1", "md5", "sha256"}
+
+// Resumable upload errors
+var (
+	ErrResumableUnavailable = apperrors.New("RESUMABLE_UNAVAILABLE", "Resumable uploads are not enabled", http.StatusNotImplemented)
+	ErrUploadExpired        = apperrors.New("UPLOAD_EXPIRED", "The upload has expired", http.StatusGone)
+	ErrUploadOffsetMismatch = apperrors.New("UPLOAD_OFFSET_MISMATCH", "The chunk doesn't start at the upload's offset", http.StatusConflict)
+	ErrUploadLocked         = apperrors.New("UPLOAD_LOCKED", "Another request is writing to the upload", http.StatusLocked)
+	ErrUploadTooLong        = apperrors.New("UPLOAD_TOO_LONG", "The chunk goes past the upload's length", http.StatusRequestEntityTooLarge)
+	ErrInvalidChecksum      = apperrors.New("INVALID_CHECKSUM", "Unsupported checksum algorithm", http.StatusBadRequest)
+
+	// 460 is the status the tus protocol defines for a checksum mismatch
+	ErrChecksumMismatch = apperrors.New("CHECKSUM_MISMATCH", "The chunk doesn't match its checksum", 460)
+)
+
+// ResumableRequest describes a resumable upload to start.
+type ResumableRequest struct {
+	Path     string         // Where the file goes; missing folders are created at the end
+	Size     int64          // Total length of the content
+	MimeType string         // Content type
+	Conflict ConflictPolicy // Applied when the upload completes
+}
+
+// ChunkChecksum is the checksum a client sent along with a chunk.
+type ChunkChecksum struct {
+	Algorithm string // One of ChecksumAlgorithms
+	Sum       []byte // The raw digest
+}
+
+// ResumableResult is the state of a resumable upload after a request.
+type ResumableResult struct {
+	// Upload is the upload, with Resumable.Offset bytes received
+	Upload *models.File
+
+	// Result is set once the upload is complete
+	Result *UploadResult
+}
+
+// CreateUpload starts a resumable upload. The quota is checked for the
+// full size up front, and a name taken under ConflictFail is reported
+// now rather than after the whole file has been sent.
+//
+// An empty upload is complete right away: it has nothing to resume.
+func (s *Service) CreateUpload(ctx context.Context, actor *models.User, req ResumableRequest) (*ResumableResult, error) {
+	if s.uploads == nil {
+		return nil, ErrResumableUnavailable
+	}
+	if req.Size < 0 {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	names, err := paths.Split(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, paths.ErrRootPath
+	}
+
+	if req.Size == 0 {
+		result, err := s.Upload(ctx, actor, UploadRequest{
+			Path:     req.Path,
+			Content:  strings.NewReader(""),
+			MimeType: req.MimeType,
+			Conflict: req.Conflict,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ResumableResult{Result: result}, nil
+	}
+
+	if err := s.checkQuota(ctx, actor.ID, req.Size); err != nil {
+		return nil, err
+	}
+	name := names[len(names)-1]
+	if _, err := s.resolveConflict(ctx, actor.ID, paths.Join(names[:len(names)-1]...), name, primitive.NilObjectID, req.Conflict); err != nil {
+		return nil, err
+	}
+
+	hashState, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	upload := models.NewFileForChunkedUpload(actor.ID, name, req.Size, req.MimeType, "", s.bucket, s.region, "")
+	upload.S3Key = storage.FileKey(upload.UserID, upload.ID, name)
+	upload.FilePath = paths.Join(names...)
+	upload.Resumable = &models.ResumableUpload{
+		HashState: hashState,
+		Conflict:  string(req.Conflict),
+		ExpiresAt: time.Now().Add(ResumableExpiry),
+	}
+
+	upload.UploadID, err = s.storage.CreateMultipartUpload(ctx, upload.S3Key, req.MimeType)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to start upload")
+	}
+	if err := s.uploads.Create(ctx, upload); err != nil {
+		_ = s.storage.AbortMultipartUpload(ctx, upload.S3Key, upload.UploadID)
+		return nil, err
+	}
+	return &ResumableResult{Upload: upload}, nil
+}
+
+// GetUpload returns one of the actor's unfinished uploads.
+func (s *Service) GetUpload(ctx context.Context, actor *models.User, uploadID primitive.ObjectID) (*models.File, error) {
+	upload, err := s.getUpload(ctx, actor, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.Resumable.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// getUpload loads an upload owned by the actor, expired or not.
+func (s *Service) getUpload(ctx context.Context, actor *models.User, uploadID primitive.ObjectID) (*models.File, error) {
+	if s.uploads == nil {
+		return nil, ErrResumableUnavailable
+	}
+	upload, err := s.uploads.GetByID(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UserID != actor.ID || upload.Resumable == nil {
+		// Other people's uploads don't exist, as far as the actor knows
+		return nil, apperrors.ErrNotFound
+	}
+	return upload, nil
+}
+
+// WriteChunk appends content to an upload at offset, which must be the
+// upload's current offset. checksum may be nil.
+//
+// If the content stops early (the connection dropped) and there is no
+// checksum to verify, the bytes that did arrive are kept, so the client
+// resumes from there. With a checksum, the whole chunk is discarded.
+//
+// The chunk that brings the upload to its full size also completes it;
+// if completing fails, sending an empty chunk at the final offset retries.
+//
+// HANGING UP MID-CHUNK:
+// That's the case resumable uploads exist for, and it cancels ctx. Once
+// the body has been read, storing it and saving the upload run on a
+// context that isn't cancelled with the request, so what arrived is kept
+// and the lock is released. Whatever happens, the lock is released before
+// WriteChunk returns, or the client would get UPLOAD_LOCKED until
+// chunkLockTimeout.
+func (s *Service) WriteChunk(ctx context.Context, actor *models.User, uploadID primitive.ObjectID, offset int64, content io.Reader, checksum *ChunkChecksum) (*ResumableResult, error) {
+	upload, err := s.GetUpload(ctx, actor, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Resumable.HashState == nil {
+		return nil, apperrors.ErrNotFound // a multipart upload, see multipart.go
+	}
+	if offset != upload.Resumable.Offset {
+		return nil, ErrUploadOffsetMismatch
+	}
+
+	locked, err := s.uploads.Lock(ctx, upload.ID, offset, time.Now().Add(chunkLockTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrUploadLocked
+	}
+
+	detached := context.WithoutCancel(ctx)
+	saved := false
+	defer func() {
+		if !saved {
+			unlockCtx, cancel := context.WithTimeout(detached, chunkStoreTimeout)
+			defer cancel()
+			_ = s.uploads.Unlock(unlockCtx, upload.ID)
+		}
+	}()
+
+	oldTail := upload.Resumable.TailKey
+	appendErr := s.appendChunk(detached, upload, content, checksum)
+
+	// Saving also releases the lock, so it happens even if nothing changed
+	saveCtx, cancel := context.WithTimeout(detached, chunkStoreTimeout)
+	defer cancel()
+	if err := s.uploads.Save(saveCtx, upload); err != nil {
+		return nil, err
+	}
+	saved = true
+	if oldTail != "" && oldTail != upload.Resumable.TailKey {
+		_ = s.storage.Delete(saveCtx, oldTail)
+	}
+	if appendErr != nil {
+		return nil, appendErr
+	}
+
+	if upload.Resumable.Offset < upload.FileSize {
+		return &ResumableResult{Upload: upload}, nil
+	}
+
+	result, err := s.completeUpload(ctx, actor, upload)
+	if err != nil {
+		return nil, err
+	}
+	return &ResumableResult{Upload: upload, Result: result}, nil
+}
+
+// appendChunk stores a chunk as parts and a new tail, and updates the
+// upload to match. On error the upload is left as it was, except when
+// bytes that arrived before a dropped connection were kept.
+//
+// ctx must not be cancelled with the request content is read from (see
+// WriteChunk); the storage writes get chunkStoreTimeout once the content
+// has arrived.
+func (s *Service) appendChunk(ctx context.Context, upload *models.File, content io.Reader, checksum *ChunkChecksum) error {
+	state := upload.Resumable
+	var verify hash.Hash
+	if checksum != nil {
+		var err error
+		if verify, err = newChecksumHash(checksum.Algorithm); err != nil {
+			return err
+		}
+	}
+
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.HashState); err != nil {
+		return apperrors.Wrap(err, "failed to restore upload checksum")
+	}
+
+	// Step 1: spool the chunk, hashing it on the way
+	spool, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return apperrors.Wrap(err, "failed to buffer chunk")
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	sinks := []io.Writer{spool, hasher}
+	if verify != nil {
+		sinks = append(sinks, verify)
+	}
+	remaining := upload.FileSize - state.Offset
+	n, readErr := io.Copy(io.MultiWriter(sinks...), io.LimitReader(content, remaining+1))
+	switch {
+	case n > remaining:
+		return ErrUploadTooLong
+	case readErr != nil && (verify != nil || n == 0):
+		return apperrors.Wrap(readErr, "failed to receive chunk")
+	case verify != nil && subtle.ConstantTimeCompare(verify.Sum(nil), checksum.Sum) != 1:
+		return ErrChecksumMismatch
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, chunkStoreTimeout)
+	defer cancel()
+
+	// Step 2: cut tail + chunk into parts; what doesn't fill one is the new tail
+	tailSize := state.Offset - upload.UploadedBytes()
+	total := tailSize + n
+	final := state.Offset+n == upload.FileSize
+	partBytes := total - total%resumablePartSize
+	if final {
+		partBytes = total
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return apperrors.Wrap(err, "failed to read chunk")
+	}
+	var data io.Reader = spool
+	if tailSize > 0 {
+		tail, _, err := s.storage.Get(ctx, state.TailKey)
+		if err != nil {
+			return apperrors.Wrap(err, "failed to read upload tail")
+		}
+		defer tail.Close()
+		data = io.MultiReader(tail, spool)
+	}
+
+	var chunks []models.UploadChunk
+	for sent := int64(0); sent < partBytes; {
+		size := min(resumablePartSize, partBytes-sent)
+		number := len(upload.Chunks) + len(chunks) + 1
+		etag, err := s.storage.UploadPart(ctx, upload.S3Key, upload.UploadID, number, io.LimitReader(data, size), size)
+		if err != nil {
+			return apperrors.Wrap(err, "failed to store chunk")
+		}
+		chunks = append(chunks, models.UploadChunk{PartNumber: number, ETag: etag, UploadedAt: time.Now(), Size: size})
+		sent += size
+	}
+
+	newOffset := state.Offset + n
+	newTail := ""
+	if rest := total - partBytes; rest > 0 {
+		newTail = storage.UploadTailKey(upload.UserID, upload.ID, newOffset)
+		if _, err := s.storage.Put(ctx, newTail, data, rest, "application/octet-stream"); err != nil {
+			return apperrors.Wrap(err, "failed to store upload tail")
+		}
+	}
+
+	hashState, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// Step 3: only now does the upload move forward (see the notes above)
+	upload.Chunks = append(upload.Chunks, chunks...)
+	upload.UploadStatus = models.UploadInProgress
+	state.Offset = newOffset
+	state.TailKey = newTail
+	state.HashState = hashState
+	state.ExpiresAt = time.Now().Add(ResumableExpiry)
+
+	if readErr != nil {
+		return apperrors.Wrap(readErr, "chunk was cut short")
+	}
+	return nil
+}
+
+// completeUpload joins the parts of a fully received upload and places
+// the result at the upload's path.
+func (s *Service) completeUpload(ctx context.Context, actor *models.User, upload *models.File) (*UploadResult, error) {
+	parts := make([]storage.Part, len(upload.Chunks))
+	for i, chunk := range upload.Chunks {
+		parts[i] = storage.Part{Number: chunk.PartNumber, ETag: chunk.ETag}
+	}
+	if _, err := s.storage.CompleteMultipartUpload(ctx, upload.S3Key, upload.UploadID, parts); err != nil {
+		// A retry after a failure further down finds the parts joined already
+		info, statErr := s.storage.Stat(ctx, upload.S3Key)
+		if statErr != nil || info.Size != upload.FileSize {
+			return nil, apperrors.Wrap(err, "failed to complete upload")
+		}
+	}
+
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.Resumable.HashState); err != nil {
+		return nil, apperrors.Wrap(err, "failed to restore upload checksum")
+	}
+	return s.finishUpload(ctx, actor, upload, hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// finishUpload places joined content and forgets the upload.
+func (s *Service) finishUpload(ctx context.Context, actor *models.User, upload *models.File, checksum string) (*UploadResult, error) {
+	result, err := s.placeUpload(ctx, actor, upload, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.uploads.Delete(ctx, upload.ID); err != nil {
+		return nil, err
+	}
+	upload.UploadStatus = models.UploadCompleted
+	return result, nil
+}
+
+// placeUpload puts completed content at the upload's path, like Upload
+// does with content it is given.
+func (s *Service) placeUpload(ctx context.Context, actor *models.User, upload *models.File, checksum string) (*UploadResult, error) {
+	names, err := paths.Split(upload.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := s.paths.MkdirAll(ctx, actor.ID, paths.Join(names[:len(names)-1]...))
+	if err != nil {
+		return nil, err
+	}
+	parentPath := paths.Root
+	if parent != nil {
+		parentPath = parent.Path
+	}
+
+	policy := ConflictPolicy(upload.Resumable.Conflict)
+	target, err := s.resolveConflict(ctx, actor.ID, parentPath, names[len(names)-1], primitive.NilObjectID, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		_ = s.storage.Delete(ctx, upload.S3Key)
+		return &UploadResult{File: target.existing.File, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if target.existing.File == nil {
+			return nil, repository.ErrNameTaken
+		}
+		// The new version is stored under the existing file's key
+		content, _, err := s.storage.Get(ctx, upload.S3Key)
+		if err != nil {
+			return nil, apperrors.Wrap(err, "failed to read upload")
+		}
+		file, err := s.Overwrite(ctx, actor, target.existing.File.ID, content, upload.FileSize, upload.MimeType, "")
+		content.Close()
+		if err != nil {
+			return nil, err
+		}
+		_ = s.storage.Delete(ctx, upload.S3Key)
+		s.startPipeline(ctx, file)
+		return &UploadResult{File: file, Outcome: OutcomeOverwritten}, nil
+	}
+
+	if err := s.checkQuota(ctx, actor.ID, upload.FileSize); err != nil {
+		return nil, err
+	}
+
+	// The file takes over the upload's ID, key and chunk records
+	file := models.NewFile(actor.ID, target.name, upload.FileSize, upload.MimeType, upload.S3Key, s.bucket, s.region, checksum)
+	file.ID = upload.ID
+	file.UploadID = upload.UploadID
+	file.Chunks = upload.Chunks
+	file.PlaceIn(parent)
+
+	if err := s.insertPlaced(ctx, file, parentPath, policy); err != nil {
+		return nil, err
+	}
+	if err := s.users.AdjustStorageUsed(ctx, file.UserID, file.FileSize); err != nil {
+		return nil, err
+	}
+	s.startPipeline(ctx, file)
+
+	outcome := target.outcome
+	if file.FileName != target.name {
+		outcome = OutcomeRenamed
+	}
+	return &UploadResult{File: file, Outcome: outcome}, nil
+}
+
+// TerminateUpload abandons an unfinished upload and frees its storage.
+func (s *Service) TerminateUpload(ctx context.Context, actor *models.User, uploadID primitive.ObjectID) error {
+	upload, err := s.getUpload(ctx, actor, uploadID)
+	if err != nil {
+		return err
+	}
+	return s.discardUpload(ctx, upload)
+}
+
+// PurgeExpiredUploads discards uploads that expired without being
+// completed and returns how many there were. It is meant to run
+// periodically from a worker, like PurgeTrash.
+func (s *Service) PurgeExpiredUploads(ctx context.Context, limit int64) (int, error) {
+	if s.uploads == nil {
+		return 0, nil
+	}
+	expired, err := s.uploads.FindExpired(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range expired {
+		if err := s.discardUpload(ctx, upload); err == nil {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// discardUpload aborts the multipart upload, deletes the tail and then the
+// document, so a failure leaves the upload around for the next purge.
+//
+// Content that was joined but never placed (say, the quota ran out in
+// between) is deleted too - unless a file did take it over and only the
+// document's deletion failed.
+func (s *Service) discardUpload(ctx context.Context, upload *models.File) error {
+	if err := s.storage.AbortMultipartUpload(ctx, upload.S3Key, upload.UploadID); err != nil {
+		return apperrors.Wrap(err, "failed to abort upload")
+	}
+	if _, err := s.files.GetByID(ctx, upload.ID); apperrors.Is(err, apperrors.ErrNotFound) {
+		if err := s.storage.Delete(ctx, upload.S3Key); err != nil {
+			return apperrors.Wrap(err, "failed to delete upload content")
+		}
+	} else if err != nil {
+		return err
+	}
+	if upload.Resumable.TailKey != "" {
+		if err := s.storage.Delete(ctx, upload.Resumable.TailKey); err != nil {
+			return apperrors.Wrap(err, "failed to delete upload tail")
+		}
+	}
+	return s.uploads.Delete(ctx, upload.ID)
+}
+
+// newChecksumHash returns the hash for a chunk checksum algorithm.
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	default:
+		return nil, ErrInvalidChecksum
+	}
+}
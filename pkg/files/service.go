@@ -0,0 +1,290 @@
+// Package files implements the core file lifecycle: uploads, moves, trash,
+// purge, new versions, version pruning, sharing and quarantine.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. A service layer that coordinates repositories and object storage
+// 2. Dependency injection through a struct of dependencies
+// 3. Ordering side effects so failures leave consistent data behind
+//
+// SERVICE LAYER:
+// HTTP handlers should stay thin: parse the request, call a service method,
+// write the response. The rules ("can this user delete this file?", "is it
+// under retention?") live here so every entry point - REST, WebDAV, workers -
+// enforces them identically.
+package files
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/retention"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Deps bundles the collaborators a Service needs.
+//
+// WHY A STRUCT INSTEAD OF MANY PARAMETERS?
+// Services grow new dependencies over time. With a struct, adding a field
+// doesn't break every call to NewService, and call sites read like
+// configuration (Files: ..., Storage: ...).
+type Deps struct {
+	Files    repository.FileRepository
+	Folders  repository.FolderRepository
+	Versions repository.VersionRepository
+	Users    repository.UserRepository
+	Storage  storage.Backend
+	Guard    *retention.Guard
+
+	// Bucket and Region are recorded on uploaded files (config.S3)
+	Bucket string
+	Region string
+
+	// Notifications is optional; without it owners aren't told about
+	// quarantine decisions
+	Notifications repository.NotificationRepository
+
+	// Pipeline is optional; without it new content is stored but not
+	// processed (no scan, thumbnails or previews)
+	Pipeline Pipeline
+
+	// Queue and Jobs run and track background copies of large folders
+	Queue *jobs.Queue
+	Jobs  repository.JobRepository
+
+	// Uploads is optional; without it resumable uploads are unavailable
+	Uploads repository.UploadRepository
+
+	// Outbox is optional; without it no domain events are recorded
+	Outbox *events.Outbox
+}
+
+// Pipeline starts background processing of new content.
+// *processing.Processor implements it.
+type Pipeline interface {
+	StartPipeline(ctx context.Context, file *models.File) error
+}
+
+// Service implements file lifecycle operations.
+type Service struct {
+	files    repository.FileRepository
+	folders  repository.FolderRepository
+	versions repository.VersionRepository
+	users    repository.UserRepository
+	storage  storage.Backend
+	guard    *retention.Guard
+	paths    *paths.Resolver
+	bucket   string
+	region   string
+
+	notifications repository.NotificationRepository
+	pipeline      Pipeline
+	queue         *jobs.Queue
+	jobs          repository.JobRepository
+	uploads       repository.UploadRepository
+	outbox        *events.Outbox
+}
+
+// NewService creates a file Service.
+func NewService(deps Deps) *Service {
+	s := &Service{
+		files:    deps.Files,
+		folders:  deps.Folders,
+		versions: deps.Versions,
+		users:    deps.Users,
+		storage:  deps.Storage,
+		guard:    deps.Guard,
+		bucket:   deps.Bucket,
+		region:   deps.Region,
+
+		notifications: deps.Notifications,
+		pipeline:      deps.Pipeline,
+		queue:         deps.Queue,
+		jobs:          deps.Jobs,
+		uploads:       deps.Uploads,
+		outbox:        deps.Outbox,
+	}
+	// Folders the resolver creates on the way are announced like any other
+	s.paths = paths.NewResolver(deps.Files, announcedFolders{FolderRepository: deps.Folders, service: s})
+	return s
+}
+
+// startPipeline hands new content to the processing pipeline, if any.
+//
+// A failure doesn't fail the upload or copy: the content is safely stored,
+// and Enqueue records the job before publishing it, so Queue.Resume
+// delivers jobs that a broker outage held up.
+func (s *Service) startPipeline(ctx context.Context, file *models.File) {
+	if s.pipeline != nil {
+		_ = s.pipeline.StartPipeline(ctx, file)
+	}
+}
+
+// commit runs fn, which writes the document that completes an operation,
+// and records the events it describes in the outbox, atomically (see
+// pkg/events/outbox.go). Without an outbox it just runs fn.
+//
+// fn may run more than once and must only write to the database. Steps
+// that touch storage, or that undo themselves on failure, stay outside.
+func (s *Service) commit(ctx context.Context, userID primitive.ObjectID, fn func(ctx context.Context) ([]events.Payload, error)) error {
+	if s.outbox == nil {
+		_, err := fn(ctx)
+		return err
+	}
+	return s.outbox.Commit(ctx, func(ctx context.Context) ([]*events.Event, error) {
+		payloads, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]*events.Event, 0, len(payloads))
+		for _, payload := range payloads {
+			event, err := events.New(userID, payload)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, event)
+		}
+		return out, nil
+	})
+}
+
+// =============================================================================
+// CREATING FOLDERS
+// =============================================================================
+// Every folder the service creates goes through createFolder or
+// ensureFolder, so each comes with a folder.created event.
+
+// Mkdir returns the folder at a path in the owner's tree, creating it and
+// any missing parents (see paths.Resolver.MkdirAll).
+func (s *Service) Mkdir(ctx context.Context, ownerID primitive.ObjectID, path string) (*models.Folder, error) {
+	return s.paths.MkdirAll(ctx, ownerID, path)
+}
+
+// createFolder inserts a new folder. Like FolderRepository.Create it
+// reports a taken name as repository.ErrNameTaken, including a file at the
+// same path (see conflict.go).
+func (s *Service) createFolder(ctx context.Context, folder *models.Folder) error {
+	err := s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.folders.Create(ctx, folder); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FolderCreated{FolderID: folder.ID, Path: folder.Path}}, nil
+	})
+	if err == nil && s.fileAt(ctx, folder.UserID, folder.Path) && s.withdrawFolder(ctx, folder) {
+		return repository.ErrNameTaken
+	}
+	return err
+}
+
+// ensureFolder returns the active folder at folder's path, inserting
+// folder if there is none (see FolderRepository.Ensure). Only an insert
+// is announced. An inserted folder that a file beat to the path is taken
+// back, reported as paths.ErrNotAFolder like the resolver does.
+//
+// RACING CREATORS:
+// Ensure retries a lost insert to find the winner's folder, but inside a
+// transaction the lost insert has already aborted it. So when the commit
+// fails, the folder is looked up once more outside; if a concurrent
+// request created it, that folder is the answer and its event is theirs.
+func (s *Service) ensureFolder(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	var ensured *models.Folder
+	err := s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		var err error
+		if ensured, err = s.folders.Ensure(ctx, folder); err != nil {
+			return nil, err
+		}
+		if ensured.ID != folder.ID {
+			return nil, nil // it was already there
+		}
+		return []events.Payload{events.FolderCreated{FolderID: folder.ID, Path: folder.Path}}, nil
+	})
+	if err != nil {
+		if existing, getErr := s.folders.GetByPath(ctx, folder.UserID, folder.Path); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	if ensured.ID == folder.ID && s.fileAt(ctx, folder.UserID, folder.Path) && s.withdrawFolder(ctx, folder) {
+		return nil, paths.ErrNotAFolder
+	}
+	return ensured, nil
+}
+
+// announcedFolders is the FolderRepository given to the path resolver:
+// the folders it creates go through ensureFolder.
+type announcedFolders struct {
+	repository.FolderRepository
+	service *Service
+}
+
+func (f announcedFolders) Ensure(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	return f.service.ensureFolder(ctx, folder)
+}
+
+// checkQuota refuses a write of size bytes that doesn't fit in the user's
+// storage, and records the refusal as a quota.exceeded event.
+//
+// The event goes in with Outbox.Add: nothing else is written, so there
+// is no transaction to join. Failing to record it doesn't change the
+// answer, so that error is dropped.
+func (s *Service) checkQuota(ctx context.Context, userID primitive.ObjectID, size int64) error {
+	owner, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if owner.HasStorageSpace(size) {
+		return nil
+	}
+
+	if s.outbox != nil {
+		event, err := events.New(userID, events.QuotaExceeded{
+			Used:      owner.StorageUsed,
+			Quota:     owner.StorageQuota,
+			Requested: size,
+		})
+		if err == nil {
+			_ = s.outbox.Add(ctx, event)
+		}
+	}
+	return apperrors.ErrStorageQuotaExceeded
+}
+
+// =============================================================================
+// PERMISSIONS
+// =============================================================================
+
+// permissionRank orders permissions so "admin" implies "write" implies "read".
+var permissionRank = map[models.FilePermission]int{
+	models.PermissionRead:  1,
+	models.PermissionWrite: 2,
+	models.PermissionAdmin: 3,
+}
+
+// hasPermission returns true if the actor holds at least the required
+// permission on the file. System administrators may do anything.
+func hasPermission(actor *models.User, permission models.FilePermission, hasAccess bool, required models.FilePermission) bool {
+	if actor.IsAdmin() {
+		return true
+	}
+	return hasAccess && permissionRank[permission] >= permissionRank[required]
+}
+
+// canAccessFile checks a file permission for the actor.
+func canAccessFile(actor *models.User, file *models.File, required models.FilePermission) bool {
+	permission, ok := file.GetPermission(actor.ID)
+	return hasPermission(actor, permission, ok, required)
+}
+
+// canAccessFolder checks a folder permission for the actor.
+func canAccessFolder(actor *models.User, folder *models.Folder, required models.FilePermission) bool {
+	permission, ok := folder.GetPermission(actor.ID)
+	return hasPermission(actor, permission, ok, required)
+}
@@ -0,0 +1,233 @@
+// This file implements sharing files and folders with other users.
+//
+// LEARNING NOTES:
+// ===============
+// A SHARE IS A LIST ENTRY:
+// Sharing adds a SharedUser to the item's SharedWith list; there is no
+// separate collection. Sharing again with the same user replaces the
+// entry, which is how a permission is changed. A folder share reaches
+// everything below the folder (see library/shared.go), so sharing a
+// folder is usually what people mean.
+//
+// WHO MAY SHARE:
+// Only holders of admin permission - the owner, or someone the owner made
+// an admin. A write share doesn't let you hand out access to others.
+package files
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Sharing errors
+var (
+	ErrInvalidPermission = apperrors.New("INVALID_PERMISSION", "Permission must be one of read, write, admin", http.StatusBadRequest)
+	ErrShareWithOwner    = apperrors.New("SHARE_WITH_OWNER", "The owner already has full access", http.StatusBadRequest)
+)
+
+// ShareRequest describes a share: who gets access, and how much.
+type ShareRequest struct {
+	Email      string
+	Permission models.FilePermission
+}
+
+// ShareFile shares a file with a user, or changes their permission.
+func (s *Service) ShareFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID, req ShareRequest) (*models.File, error) {
+	file, err := s.shareableFile(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.newShare(ctx, actor, file.UserID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	file.SharedWith = withShare(file.SharedWith, share)
+	err = s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, file); err != nil {
+			return nil, err
+		}
+		return []events.Payload{shareCreated(models.ItemTypeFile, file.ID, file.FilePath, share)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// UnshareFile takes a user's access to a file away. Removing a share that
+// doesn't exist is not an error.
+func (s *Service) UnshareFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID, email string) (*models.File, error) {
+	file, err := s.administeredFile(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	file.SharedWith = withoutShare(file.SharedWith, user.ID)
+	err = s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, file); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.ShareRevoked{ItemType: models.ItemTypeFile, ItemID: file.ID, RecipientID: user.ID}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// ShareFolder shares a folder, with everything in it, with a user, or
+// changes their permission.
+func (s *Service) ShareFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID, req ShareRequest) (*models.Folder, error) {
+	folder, err := s.shareableFolder(ctx, actor, folderID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.newShare(ctx, actor, folder.UserID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.SharedWith = withShare(folder.SharedWith, share)
+	err = s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.folders.Update(ctx, folder); err != nil {
+			return nil, err
+		}
+		return []events.Payload{shareCreated(models.ItemTypeFolder, folder.ID, folder.Path, share)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// UnshareFolder takes a user's access to a folder away.
+func (s *Service) UnshareFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID, email string) (*models.Folder, error) {
+	folder, err := s.shareableFolder(ctx, actor, folderID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.SharedWith = withoutShare(folder.SharedWith, user.ID)
+	err = s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.folders.Update(ctx, folder); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.ShareRevoked{ItemType: models.ItemTypeFolder, ItemID: folder.ID, RecipientID: user.ID}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// =============================================================================
+// HELPERS
+// =============================================================================
+
+// shareableFile loads an active file the actor may share. A quarantined
+// file can't be shared: a share hands out its content as surely as a
+// download does. Taking shares away stays possible (see administeredFile).
+func (s *Service) shareableFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.administeredFile(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckDownloadable(file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// administeredFile loads an active file the actor holds admin permission on.
+func (s *Service) administeredFile(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFile(actor, file, models.PermissionAdmin) {
+		return nil, apperrors.ErrForbidden
+	}
+	return file, nil
+}
+
+// shareableFolder loads an active folder the actor may share.
+func (s *Service) shareableFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID) (*models.Folder, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFolder(actor, folder, models.PermissionAdmin) {
+		return nil, apperrors.ErrForbidden
+	}
+	return folder, nil
+}
+
+// newShare validates a share request for an item owned by ownerID.
+func (s *Service) newShare(ctx context.Context, actor *models.User, ownerID primitive.ObjectID, req ShareRequest) (models.SharedUser, error) {
+	if _, ok := permissionRank[req.Permission]; !ok {
+		return models.SharedUser{}, ErrInvalidPermission
+	}
+	user, err := s.users.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return models.SharedUser{}, err
+	}
+	if user.ID == ownerID {
+		return models.SharedUser{}, ErrShareWithOwner
+	}
+	return models.SharedUser{
+		UserID:     user.ID,
+		Permission: req.Permission,
+		SharedAt:   time.Now(),
+		SharedBy:   actor.ID,
+	}, nil
+}
+
+// withShare returns shares with share added, replacing the user's
+// existing entry if any.
+func withShare(shares []models.SharedUser, share models.SharedUser) []models.SharedUser {
+	return append(withoutShare(shares, share.UserID), share)
+}
+
+// withoutShare returns shares without the user's entry.
+func withoutShare(shares []models.SharedUser, userID primitive.ObjectID) []models.SharedUser {
+	kept := make([]models.SharedUser, 0, len(shares))
+	for _, shared := range shares {
+		if shared.UserID != userID {
+			kept = append(kept, shared)
+		}
+	}
+	return kept
+}
+
+// shareCreated describes a share that was just added to an item.
+func shareCreated(itemType models.ItemType, itemID primitive.ObjectID, path string, share models.SharedUser) events.ShareCreated {
+	return events.ShareCreated{
+		ItemType:    itemType,
+		ItemID:      itemID,
+		Path:        path,
+		RecipientID: share.UserID,
+		Permission:  share.Permission,
+	}
+}
@@ -0,0 +1,250 @@
+// This file implements soft delete (trash), restore and permanent purge.
+//
+// LEARNING NOTES:
+// ===============
+// TRASH LIFECYCLE:
+//
+//	active  --Delete-->  trashed (deleted_at set)  --Purge-->  gone
+//	            ^                |
+//	            +----Restore-----+
+//
+// Soft delete only sets DeletedAt, so mistakes are recoverable. Purge removes
+// the document, all versions and every stored object, and frees quota.
+// Retention locks and legal holds block both Delete and Purge.
+package files
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/retention"
+)
+
+// ErrNotInTrash indicates a purge or restore of a file that isn't trashed.
+var ErrNotInTrash = apperrors.New("NOT_IN_TRASH", "File is not in the trash", http.StatusConflict)
+
+// PurgeResult summarizes a batch purge of the trash.
+type PurgeResult struct {
+	Purged     int                  // Files permanently deleted
+	BytesFreed int64                // Storage released (current content + versions)
+	Locked     []primitive.ObjectID // Files skipped because of a retention lock or legal hold
+	Failed     []primitive.ObjectID // Files skipped because of an unexpected error
+}
+
+// =============================================================================
+// SOFT DELETE AND RESTORE
+// =============================================================================
+
+// Delete moves a file to the trash.
+func (s *Service) Delete(ctx context.Context, actor *models.User, fileID primitive.ObjectID) error {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if !file.IsActive() {
+		return apperrors.ErrNotFound
+	}
+	if !canAccessFile(actor, file, models.PermissionAdmin) {
+		return apperrors.ErrForbidden
+	}
+
+	if err := s.guard.CheckFile(ctx, file, retention.OpDelete); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	file.DeletedAt = &now
+	return s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, file); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FileDeleted{FileID: file.ID, Path: file.FilePath, Size: file.FileSize}}, nil
+	})
+}
+
+// Restore takes a file back out of the trash.
+func (s *Service) Restore(ctx context.Context, actor *models.User, fileID primitive.ObjectID) error {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if file.IsActive() {
+		return ErrNotInTrash
+	}
+	if !canAccessFile(actor, file, models.PermissionAdmin) {
+		return apperrors.ErrForbidden
+	}
+
+	file.DeletedAt = nil
+	return s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, file); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FileRestored{FileID: file.ID, Path: file.FilePath, Size: file.FileSize}}, nil
+	})
+}
+
+// DeleteFolder moves a folder, its subfolders and all contained files to the
+// trash. It fails as a whole if anything inside is locked; we never delete
+// half a folder.
+func (s *Service) DeleteFolder(ctx context.Context, actor *models.User, folderID primitive.ObjectID) error {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	if !folder.IsActive() {
+		return apperrors.ErrNotFound
+	}
+	if !canAccessFolder(actor, folder, models.PermissionAdmin) {
+		return apperrors.ErrForbidden
+	}
+
+	if err := s.guard.CheckFolder(ctx, folder, retention.OpDelete); err != nil {
+		return err
+	}
+
+	// Files first: if the folder update failed afterwards, the files would
+	// be trashed but still reachable through a live folder - harmless and
+	// fixed by retrying. The opposite order could hide live files.
+	now := time.Now()
+	if _, err := s.files.SoftDeleteUnderPath(ctx, folder.UserID, folder.Path, now); err != nil {
+		return err
+	}
+	return s.commit(ctx, folder.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if _, err := s.folders.SoftDeleteSubtree(ctx, folder, now); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FolderDeleted{FolderID: folder.ID, Path: folder.Path}}, nil
+	})
+}
+
+// =============================================================================
+// PURGE
+// =============================================================================
+
+// Purge permanently deletes a trashed file.
+func (s *Service) Purge(ctx context.Context, actor *models.User, fileID primitive.ObjectID) error {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if file.IsActive() {
+		return ErrNotInTrash
+	}
+	if !canAccessFile(actor, file, models.PermissionAdmin) {
+		return apperrors.ErrForbidden
+	}
+
+	if err := s.guard.CheckFile(ctx, file, retention.OpPurge); err != nil {
+		return err
+	}
+
+	_, err = s.purgeFile(ctx, file)
+	return err
+}
+
+// PurgeTrash permanently deletes files that have been in the trash longer
+// than olderThan. It is meant to run periodically from a worker.
+//
+// Locked files are skipped and reported rather than failing the batch: a
+// legal hold on one file must not stop the trash from being emptied.
+func (s *Service) PurgeTrash(ctx context.Context, olderThan time.Duration, limit int64) (*PurgeResult, error) {
+	trashed, err := s.files.FindTrashed(ctx, nil, time.Now().Add(-olderThan), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PurgeResult{}
+	for _, file := range trashed {
+		if err := s.guard.CheckFile(ctx, file, retention.OpPurge); err != nil {
+			if apperrors.Is(err, apperrors.ErrRetentionLocked) || apperrors.Is(err, apperrors.ErrLegalHold) {
+				result.Locked = append(result.Locked, file.ID)
+			} else {
+				result.Failed = append(result.Failed, file.ID)
+			}
+			continue
+		}
+
+		freed, err := s.purgeFile(ctx, file)
+		if err != nil {
+			result.Failed = append(result.Failed, file.ID)
+			continue
+		}
+		result.Purged++
+		result.BytesFreed += freed
+	}
+
+	return result, nil
+}
+
+// purgeFile removes every stored object and record of a file and returns
+// the number of bytes freed.
+//
+// ORDER MATTERS:
+// Objects are deleted before the documents that point to them. If we crash
+// halfway, the file is still listed in the trash and a retry finishes the
+// job (deleting a missing object is not an error). The reverse order could
+// leave unreachable objects that nobody pays quota for.
+func (s *Service) purgeFile(ctx context.Context, file *models.File) (int64, error) {
+	versions, err := s.versions.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	freed := file.FileSize
+	for _, version := range versions {
+		if err := s.storage.Delete(ctx, version.S3Key); err != nil {
+			return 0, apperrors.Wrap(err, "failed to delete version content")
+		}
+		freed += version.FileSize
+	}
+	for _, thumbnail := range file.Thumbnails {
+		if err := s.storage.Delete(ctx, thumbnail.S3Key); err != nil {
+			return 0, apperrors.Wrap(err, "failed to delete thumbnail")
+		}
+	}
+	for _, compressed := range file.CompressedCopies {
+		if err := s.storage.Delete(ctx, compressed.S3Key); err != nil {
+			return 0, apperrors.Wrap(err, "failed to delete compressed copy")
+		}
+	}
+	for _, rendition := range file.Renditions {
+		if err := s.storage.Delete(ctx, rendition.S3Key); err != nil {
+			return 0, apperrors.Wrap(err, "failed to delete video rendition")
+		}
+	}
+	if file.Preview != nil {
+		for _, page := range file.Preview.Pages {
+			if err := s.storage.Delete(ctx, page.S3Key); err != nil {
+				return 0, apperrors.Wrap(err, "failed to delete preview page")
+			}
+		}
+	}
+	if err := s.storage.Delete(ctx, file.S3Key); err != nil {
+		return 0, apperrors.Wrap(err, "failed to delete file content")
+	}
+
+	if err := s.versions.DeleteByFileID(ctx, file.ID); err != nil {
+		return 0, err
+	}
+	err = s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Delete(ctx, file.ID); err != nil {
+			return nil, err
+		}
+		return []events.Payload{events.FileDeleted{FileID: file.ID, Path: file.FilePath, Size: freed, Purged: true}}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.users.AdjustStorageUsed(ctx, file.UserID, -freed); err != nil {
+		return 0, err
+	}
+
+	return freed, nil
+}
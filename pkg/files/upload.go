@@ -0,0 +1,169 @@
+// This file implements uploading a file to a path.
+//
+// LEARNING NOTES:
+// ===============
+// ORDER OF SIDE EFFECTS:
+// 1. Create missing folders (mkdir -p; harmless if we fail later)
+// 2. Apply the conflict policy
+// 3. Store the content under a key derived from the new file's ID
+// 4. Insert the File document
+// 5. Count the bytes against the owner's quota
+//
+// Content is stored before the document exists, so nobody ever sees a
+// file whose bytes aren't there yet. If the insert fails, the object is
+// deleted again. The object key doesn't contain the name, so a rename
+// after losing a race (step 4) doesn't have to touch storage.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// UploadRequest describes new content for a path in the actor's tree.
+type UploadRequest struct {
+	Path     string         // e.g. "/Documents/Work/report.pdf"; missing folders are created
+	Content  io.Reader      // The bytes (streamed, never fully buffered)
+	Size     int64          // Length of Content in bytes
+	MimeType string         // Content type
+	Conflict ConflictPolicy // What to do if the name is taken
+}
+
+// UploadResult is the file an upload ended up in.
+type UploadResult struct {
+	// File is the new or overwritten file, or the existing one if the
+	// upload was skipped. It is nil if a folder with the name was skipped.
+	File    *models.File `json:"file,omitempty"`
+	Outcome Outcome      `json:"outcome"`
+}
+
+// Upload stores content as a file at a path, creating missing folders.
+// With ConflictOverwrite an existing file gets the content as a new
+// version (see Overwrite); a folder is never overwritten by a file.
+func (s *Service) Upload(ctx context.Context, actor *models.User, req UploadRequest) (*UploadResult, error) {
+	if req.Size < 0 {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	names, err := paths.Split(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, paths.ErrRootPath
+	}
+
+	parent, err := s.paths.MkdirAll(ctx, actor.ID, paths.Join(names[:len(names)-1]...))
+	if err != nil {
+		return nil, err
+	}
+	parentPath := paths.Root
+	if parent != nil {
+		parentPath = parent.Path
+	}
+
+	target, err := s.resolveConflict(ctx, actor.ID, parentPath, names[len(names)-1], primitive.NilObjectID, req.Conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target.outcome {
+	case OutcomeSkipped:
+		return &UploadResult{File: target.existing.File, Outcome: OutcomeSkipped}, nil
+
+	case OutcomeOverwritten:
+		if target.existing.File == nil {
+			return nil, repository.ErrNameTaken
+		}
+		file, err := s.Overwrite(ctx, actor, target.existing.File.ID, req.Content, req.Size, req.MimeType, "")
+		if err != nil {
+			return nil, err
+		}
+		s.startPipeline(ctx, file)
+		return &UploadResult{File: file, Outcome: OutcomeOverwritten}, nil
+	}
+
+	file, err := s.create(ctx, actor, parent, parentPath, target.name, req)
+	if err != nil {
+		return nil, err
+	}
+	s.startPipeline(ctx, file)
+
+	outcome := target.outcome
+	if file.FileName != target.name {
+		outcome = OutcomeRenamed // lost a race for the name, see insertPlaced
+	}
+	return &UploadResult{File: file, Outcome: outcome}, nil
+}
+
+// create stores the content of a new file and inserts its document.
+func (s *Service) create(ctx context.Context, actor *models.User, parent *models.Folder, parentPath, name string, req UploadRequest) (*models.File, error) {
+	if err := s.checkQuota(ctx, actor.ID, req.Size); err != nil {
+		return nil, err
+	}
+
+	file := models.NewFile(actor.ID, name, req.Size, req.MimeType, "", s.bucket, s.region, "")
+	file.S3Key = storage.FileKey(file.UserID, file.ID, file.FileName)
+	file.PlaceIn(parent)
+
+	hasher := sha256.New()
+	if _, err := s.storage.Put(ctx, file.S3Key, io.TeeReader(req.Content, hasher), req.Size, req.MimeType); err != nil {
+		return nil, apperrors.Wrap(err, "failed to store file")
+	}
+	file.Checksum = hex.EncodeToString(hasher.Sum(nil))
+
+	if err := s.insertPlaced(ctx, file, parentPath, req.Conflict); err != nil {
+		_ = s.storage.Delete(ctx, file.S3Key)
+		return nil, err
+	}
+
+	if err := s.users.AdjustStorageUsed(ctx, file.UserID, file.FileSize); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// insertPlaced inserts a placed file, announcing it as file.uploaded. If
+// another request took the name in the meantime, ConflictRename picks the
+// next free name and tries again; the other policies report the conflict,
+// because the content has already been consumed and can't be replayed
+// into Overwrite.
+//
+// Every attempt is a commit of its own: a duplicate key aborts the
+// transaction it happens in, so the next name can't be tried inside it.
+// A folder that took the path meanwhile counts as a taken name too (see
+// conflict.go).
+func (s *Service) insertPlaced(ctx context.Context, file *models.File, parentPath string, policy ConflictPolicy) error {
+	for race := 0; ; race++ {
+		err := s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+			if err := s.files.Create(ctx, file); err != nil {
+				return nil, err
+			}
+			return []events.Payload{events.NewFileUploaded(file)}, nil
+		})
+		if err == nil && s.folderAt(ctx, file.UserID, file.FilePath) && s.withdrawFile(ctx, file) {
+			err = repository.ErrNameTaken
+		}
+		if !apperrors.Is(err, repository.ErrNameTaken) || policy != ConflictRename || race == maxNameRaces {
+			return err
+		}
+
+		name, err := s.paths.FreeName(ctx, file.UserID, parentPath, file.FileName)
+		if err != nil {
+			return err
+		}
+		file.FileName = name
+		file.FilePath = joinName(parentPath, name)
+	}
+}
@@ -0,0 +1,283 @@
+// This file implements uploading new versions, listing and restoring
+// them, and pruning old ones.
+//
+// LEARNING NOTES:
+// ===============
+// COPY-ON-WRITE VERSIONING (see models/version.go):
+// 1. Copy the current object to users/{uid}/versions/{file_id}_v{n}.{ext}
+// 2. Record a FileVersion pointing at that copy
+// 3. Write the new content over the current key
+// 4. Bump File.Version
+//
+// The current version therefore always lives at the same S3 key, which keeps
+// downloads simple and fast.
+//
+// RESTORING IS MOVING FORWARD:
+// Restoring version 3 of a file at version 5 doesn't rewind history. The
+// content of v3 is written as a new version (v6) through Overwrite, so v5
+// is archived like any other overwrite and the restore itself can be
+// undone. The v3 record only gets RestoredAt set.
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/events"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/retention"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Overwrite stores new content for an existing file and keeps the previous
+// content as a version.
+//
+// PARAMETERS:
+// content:  The new bytes (streamed, never fully buffered)
+// size:     Length of content in bytes
+// mimeType: Content type of the new content
+// changes:  Optional description stored with the version record
+func (s *Service) Overwrite(ctx context.Context, actor *models.User, fileID primitive.ObjectID, content io.Reader, size int64, mimeType, changes string) (*models.File, error) {
+	return s.overwrite(ctx, actor, fileID, content, size, mimeType, changes, 0)
+}
+
+// overwrite implements Overwrite. A restoredFrom other than 0 names the
+// version whose content this is, and adds a version.restored event.
+func (s *Service) overwrite(ctx context.Context, actor *models.User, fileID primitive.ObjectID, content io.Reader, size int64, mimeType, changes string, restoredFrom int) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFile(actor, file, models.PermissionWrite) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	if err := s.guard.CheckFile(ctx, file, retention.OpOverwrite); err != nil {
+		return nil, err
+	}
+
+	// The old content stays (as a version), so the new content is pure growth.
+	if err := s.checkQuota(ctx, file.UserID, size); err != nil {
+		return nil, err
+	}
+
+	// Step 1 + 2: archive the current content as a version
+	versionKey := storage.VersionKey(file.UserID, file.ID, file.Version, file.FileName)
+	if err := s.storage.Copy(ctx, file.S3Key, versionKey); err != nil {
+		return nil, apperrors.Wrap(err, "failed to archive current version")
+	}
+
+	version := models.NewFileVersion(
+		file.ID,
+		file.Version,
+		versionKey,
+		file.S3Bucket,
+		file.S3Region,
+		file.FileSize,
+		file.Checksum,
+		changes,
+		actor.ID,
+	)
+	if err := s.versions.Create(ctx, version); err != nil {
+		_ = s.storage.Delete(ctx, versionKey)
+		return nil, err
+	}
+
+	// Step 3: write the new content, hashing it on the way through
+	//
+	// io.TeeReader copies everything read from content into the hasher,
+	// so we compute the SHA-256 checksum without a second pass.
+	hasher := sha256.New()
+	if _, err := s.storage.Put(ctx, file.S3Key, io.TeeReader(content, hasher), size, mimeType); err != nil {
+		// Roll back the archive; the current object was not replaced
+		_ = s.versions.Delete(ctx, version.ID)
+		_ = s.storage.Delete(ctx, versionKey)
+		return nil, apperrors.Wrap(err, "failed to store new version")
+	}
+
+	// Step 4: point the file at the new content. The upload may have taken
+	// minutes, so start from the stored file: Update refuses a copy that
+	// workers or other users wrote to meanwhile, and a lock placed during
+	// the upload must still stop it.
+	archived, key := file.Version, file.S3Key
+	current, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Version != archived {
+		// Another overwrite stored its content at the same key meanwhile;
+		// whichever Put came last is there now, so leave it all alone
+		return nil, repository.ErrEditConflict
+	}
+	if err := s.guard.CheckFile(ctx, current, retention.OpOverwrite); err != nil {
+		s.unarchive(ctx, version, key)
+		return nil, err
+	}
+	file = current
+
+	file.Version++
+	file.FileSize = size
+	file.MimeType = mimeType
+	file.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	file.ContentUpdatedAt = time.Now()
+	file.ProcessingStatus = models.ProcessingPending // derived data is stale now
+
+	recorded := false
+	err = s.commit(ctx, file.UserID, func(ctx context.Context) ([]events.Payload, error) {
+		if err := s.files.Update(ctx, file); err != nil {
+			return nil, err
+		}
+		recorded = true
+		payloads := []events.Payload{events.NewFileUploaded(file)}
+		if restoredFrom != 0 {
+			payloads = append(payloads, events.VersionRestored{
+				FileID:      file.ID,
+				Path:        file.FilePath,
+				FromVersion: restoredFrom,
+				NewVersion:  file.Version,
+			})
+		}
+		return payloads, nil
+	})
+	if err != nil {
+		if !recorded {
+			s.unarchive(ctx, version, key)
+		}
+		return nil, err
+	}
+	if err := s.users.AdjustStorageUsed(ctx, file.UserID, size); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// unarchive undoes steps 1 to 3 of an overwrite that could not be
+// recorded: the archived content goes back to the current key, and the
+// version record and its copy are removed. Best effort, like the other
+// rollbacks; a failure leaves an orphaned version copy at worst.
+func (s *Service) unarchive(ctx context.Context, version *models.FileVersion, key string) {
+	if err := s.storage.Copy(ctx, version.S3Key, key); err != nil {
+		return // Keep the version: it is the only copy of that content now
+	}
+	_ = s.versions.Delete(ctx, version.ID)
+	_ = s.storage.Delete(ctx, version.S3Key)
+}
+
+// ListVersions returns the earlier versions of a file, newest first. The
+// current content is the file itself and not in the list.
+func (s *Service) ListVersions(ctx context.Context, actor *models.User, fileID primitive.ObjectID) ([]*models.FileVersion, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsActive() || !canAccessFile(actor, file, models.PermissionRead) {
+		return nil, apperrors.ErrNotFound
+	}
+	return s.versions.ListByFileID(ctx, file.ID)
+}
+
+// RestoreVersion makes the content of an earlier version current again,
+// as a new version (see RESTORING IS MOVING FORWARD above).
+func (s *Service) RestoreVersion(ctx context.Context, actor *models.User, fileID primitive.ObjectID, versionNumber int) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsActive() {
+		return nil, apperrors.ErrNotFound
+	}
+	if !canAccessFile(actor, file, models.PermissionWrite) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	versions, err := s.versions.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return nil, err
+	}
+	var version *models.FileVersion
+	for _, v := range versions {
+		if v.VersionNumber == versionNumber {
+			version = v
+			break
+		}
+	}
+	if version == nil {
+		return nil, apperrors.ErrNotFound
+	}
+
+	content, _, err := s.storage.Get(ctx, version.S3Key)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to read version")
+	}
+	defer content.Close()
+
+	// Versions don't record a MIME type; renames keep the extension's type
+	// anyway, so the current one is the best guess
+	restored, err := s.overwrite(ctx, actor, file.ID, content, version.FileSize, file.MimeType,
+		fmt.Sprintf("Restored version %d", version.VersionNumber), version.VersionNumber)
+	if err != nil {
+		return nil, err
+	}
+	s.startPipeline(ctx, restored)
+
+	// The content is restored; a missing mark only loses a detail of history
+	_ = s.versions.MarkRestored(ctx, version.ID, time.Now())
+	return restored, nil
+}
+
+// PruneVersions deletes all but the newest keep versions of a file and
+// returns how many were removed. It is used by version retention policies
+// (e.g. "free users keep 10 versions").
+//
+// A file under retention or legal hold keeps its entire history.
+func (s *Service) PruneVersions(ctx context.Context, fileID primitive.ObjectID, keep int) (int, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.guard.CheckFile(ctx, file, retention.OpPruneVersions); err != nil {
+		return 0, err
+	}
+
+	// ListByFileID returns newest first, so everything after index keep is old
+	versions, err := s.versions.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) <= keep {
+		return 0, nil
+	}
+
+	var freed int64
+	pruned := 0
+	for _, version := range versions[keep:] {
+		if err := s.storage.Delete(ctx, version.S3Key); err != nil {
+			break // keep the record so a later run retries this version
+		}
+		if err := s.versions.Delete(ctx, version.ID); err != nil {
+			break
+		}
+		freed += version.FileSize
+		pruned++
+	}
+
+	if freed > 0 {
+		if err := s.users.AdjustStorageUsed(ctx, file.UserID, -freed); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
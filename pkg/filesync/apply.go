@@ -0,0 +1,363 @@
+// This file carries out the actions of a pass.
+//
+// LEARNING NOTES:
+// ===============
+// ORDER MATTERS:
+// Actions run in phases, so each finds what it needs in place:
+//
+//  1. folders are created, parents first
+//  2. moves, whose targets may be in those folders
+//  3. uploads, downloads and conflicts
+//  4. file deletes
+//  5. folder deletes, deepest first, once the folders are empty
+//
+// TRUST, BUT CHECK:
+// The plan is made from a scan, and the user may keep working while the
+// pass runs. Before a local file is replaced or removed it is checked to
+// still be what the scan saw; if it isn't, the action fails and the next
+// pass plans again with the new state. Downloads are written to a
+// temporary file and only renamed into place once their checksum
+// matches, so a half-written file never appears under the real name.
+package filesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+)
+
+// errChangedLocally means a local file changed after the scan.
+var errChangedLocally = errors.New("changed locally during the sync; it is synced next time")
+
+// apply carries out p.actions, recording successes in p.done and state
+// updates in p.updates. It stops early only if ctx is cancelled.
+func (p *pass) apply(ctx context.Context) error {
+	sort.SliceStable(p.actions, func(i, j int) bool {
+		a, b := p.actions[i], p.actions[j]
+		if phase(a) != phase(b) {
+			return phase(a) < phase(b)
+		}
+		if phase(a) == phaseFolderDeletes {
+			return a.Path > b.Path // Deepest first
+		}
+		return false
+	})
+
+	for _, a := range p.actions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.run(ctx, a); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.fail(a, err.Error())
+			a.Error = err.Error()
+		} else {
+			p.done = append(p.done, a)
+		}
+		p.progress(a)
+	}
+	return nil
+}
+
+// Phases of a pass, in order
+const (
+	phaseMkdirs = iota
+	phaseMoves
+	phaseTransfers
+	phaseFileDeletes
+	phaseFolderDeletes
+)
+
+func phase(a Action) int {
+	switch a.Kind {
+	case ActionMkdirRemote, ActionMkdirLocal:
+		return phaseMkdirs
+	case ActionMoveRemote, ActionMoveLocal:
+		return phaseMoves
+	case ActionDeleteRemote, ActionDeleteLocal:
+		if a.Dir {
+			return phaseFolderDeletes
+		}
+		return phaseFileDeletes
+	default:
+		return phaseTransfers
+	}
+}
+
+// run carries out one action.
+func (p *pass) run(ctx context.Context, a Action) error {
+	switch a.Kind {
+	case ActionMkdirRemote:
+		return p.mkdirRemote(ctx, a.Path)
+	case ActionMkdirLocal:
+		return p.mkdirLocal(a.Path)
+	case ActionMoveRemote:
+		return p.moveRemote(ctx, a.From, a.Path)
+	case ActionMoveLocal:
+		return p.moveLocal(a.From, a.Path)
+	case ActionUpload:
+		return p.upload(ctx, a.Path)
+	case ActionDownload:
+		return p.download(ctx, a.Path)
+	case ActionConflict:
+		return p.keepBoth(ctx, a.Path, a.ConflictCopy)
+	case ActionDeleteRemote:
+		return p.deleteRemote(ctx, a.Path, a.Dir)
+	case ActionDeleteLocal:
+		return p.deleteLocal(a.Path, a.Dir)
+	default:
+		return fmt.Errorf("unknown action %q", a.Kind)
+	}
+}
+
+// =============================================================================
+// FOLDERS AND MOVES
+// =============================================================================
+
+func (p *pass) mkdirRemote(ctx context.Context, rel string) error {
+	folder, err := p.client.Mkdir(ctx, p.remotePath(rel))
+	if err != nil {
+		return err
+	}
+	p.updates[rel] = &record{Dir: true, RemoteID: folder.ID}
+	return nil
+}
+
+func (p *pass) mkdirLocal(rel string) error {
+	if err := os.MkdirAll(p.localPath(rel), 0o755); err != nil {
+		return err
+	}
+	p.updates[rel] = &record{Dir: true, RemoteID: p.remote[rel].Folder.ID}
+	return nil
+}
+
+// moveRemote repeats a local rename on the server. The file keeps its ID
+// and content, so its record moves along unchanged.
+func (p *pass) moveRemote(ctx context.Context, from, to string) error {
+	target := client.Target{To: path.Dir(p.remotePath(to)), Name: path.Base(to), Conflict: "fail"}
+	if _, err := p.client.Move(ctx, p.remote[from].entry(), target); err != nil {
+		return err
+	}
+	p.moveRecord(from, to)
+	return nil
+}
+
+// moveLocal repeats a remote rename locally. The record keeps the old
+// version, so a change that came with the move is still seen as one.
+func (p *pass) moveLocal(from, to string) error {
+	if err := p.checkUnchanged(from); err != nil {
+		return err
+	}
+	target := p.localPath(to)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); !errors.Is(err, fs.ErrNotExist) {
+		return errChangedLocally
+	}
+	if err := os.Rename(p.localPath(from), target); err != nil {
+		return err
+	}
+	p.local[to] = p.local[from]
+	delete(p.local, from)
+	p.moveRecord(from, to)
+	return nil
+}
+
+func (p *pass) moveRecord(from, to string) {
+	moved := *p.base[from]
+	p.updates[from], p.updates[to] = nil, &moved
+}
+
+// =============================================================================
+// TRANSFERS
+// =============================================================================
+
+// upload sends a local file to the same path on the server, as a new
+// version if the server has a file there.
+func (p *pass) upload(ctx context.Context, rel string) error {
+	conflict := "fail"
+	if p.remoteFile(rel) != nil {
+		conflict = "overwrite"
+	}
+	return p.send(ctx, rel, conflict)
+}
+
+// send uploads the local file at rel and records it.
+func (p *pass) send(ctx context.Context, rel, conflict string) error {
+	f, err := os.Open(p.localPath(rel))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := p.checkUnchanged(rel); err != nil {
+		return err
+	}
+	sum, err := p.localHash(rel)
+	if err != nil {
+		return err
+	}
+
+	l := p.local[rel]
+	result, err := p.client.Upload(ctx, f, l.Size, client.UploadOptions{
+		Path:     p.remotePath(rel),
+		MimeType: mime.TypeByExtension(path.Ext(rel)),
+		Conflict: conflict,
+	})
+	if err != nil {
+		return err
+	}
+	if result.FileID.IsZero() {
+		return fmt.Errorf("upload %s", result.Outcome)
+	}
+	// The new version number isn't known; the checksum stands in for it
+	p.updates[rel] = &record{Size: l.Size, ModTime: l.ModTime, Checksum: sum, RemoteID: result.FileID}
+	return nil
+}
+
+// download fetches a remote file to the same local path.
+func (p *pass) download(ctx context.Context, rel string) error {
+	file := p.remoteFile(rel)
+	target := p.localPath(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), internalPrefix+"*"+partSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // A no-op once renamed
+	defer tmp.Close()
+
+	dl, err := p.client.Download(ctx, file.ID, 0, "")
+	if err != nil {
+		return err
+	}
+	defer dl.Body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), dl.Body); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if file.Checksum != "" && sum != file.Checksum {
+		return errors.New("downloaded content doesn't match the file's checksum")
+	}
+
+	// Replace only what the scan saw: nothing, or the unchanged file
+	if err := p.checkUnchanged(rel); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), file.UpdatedAt, file.UpdatedAt); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	p.updates[rel] = &record{
+		Size: info.Size(), ModTime: info.ModTime().UnixNano(), Checksum: sum,
+		RemoteID: file.ID, Version: file.Version,
+	}
+	return nil
+}
+
+// keepBoth resolves a conflict: the local version moves to conflictCopy
+// and is uploaded there, and the remote version is downloaded to rel.
+func (p *pass) keepBoth(ctx context.Context, rel, conflictCopy string) error {
+	if err := p.checkUnchanged(rel); err != nil {
+		return err
+	}
+	copyPath := p.localPath(conflictCopy)
+	if _, err := os.Lstat(copyPath); !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s already exists", conflictCopy)
+	}
+	if err := os.Rename(p.localPath(rel), copyPath); err != nil {
+		return err
+	}
+	p.local[conflictCopy] = p.local[rel]
+	p.hashes[conflictCopy] = p.hashes[rel]
+	delete(p.local, rel)
+
+	if err := p.send(ctx, conflictCopy, "fail"); err != nil {
+		return err
+	}
+	return p.download(ctx, rel)
+}
+
+// =============================================================================
+// DELETES
+// =============================================================================
+
+// deleteRemote moves a remote file or folder to the trash.
+func (p *pass) deleteRemote(ctx context.Context, rel string, dir bool) error {
+	if err := p.client.Delete(ctx, p.remote[rel].entry()); err != nil {
+		return err
+	}
+	p.updates[rel] = nil
+	if dir {
+		prefix := rel + "/"
+		for known := range p.base {
+			if strings.HasPrefix(known, prefix) {
+				p.updates[known] = nil
+			}
+		}
+	}
+	return nil
+}
+
+// deleteLocal removes a local file that is still as synced, or a local
+// folder that is empty.
+func (p *pass) deleteLocal(rel string, dir bool) error {
+	if !dir {
+		if err := p.checkUnchanged(rel); err != nil {
+			return err
+		}
+	}
+	// os.Remove refuses a folder that isn't empty
+	if err := os.Remove(p.localPath(rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	p.updates[rel] = nil
+	return nil
+}
+
+// checkUnchanged makes sure a local path is as the scan found it: a file
+// of the same size and modification time, or nothing if it wasn't there.
+func (p *pass) checkUnchanged(rel string) error {
+	info, err := os.Lstat(p.localPath(rel))
+	l := p.local[rel]
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && l == nil:
+		return nil
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	case err != nil || l == nil || l.Dir || !info.Mode().IsRegular():
+		return errChangedLocally
+	case info.Size() != l.Size || info.ModTime().UnixNano() != l.ModTime:
+		return errChangedLocally
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+// Package filesync keeps a local directory and a remote folder in sync,
+// in both directions. `fsctl sync` is built on it.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Three-way change detection against a saved base (plan.go)
+// 2. Embedded, transactional state with bbolt (state.go)
+// 3. Applying a plan step by step, so one failure doesn't stop the rest (apply.go)
+//
+// A SYNC PASS:
+//
+//	scan local  ─┐
+//	             ├─> plan (compare with the base) ─> apply ─> save the new base
+//	scan remote ─┘
+//
+// A pass is safe to interrupt at any point: whatever was done is recorded,
+// whatever wasn't is found again by the next pass. Nothing is deleted for
+// good - remote deletes go to the trash, and a local file is only removed
+// if it is exactly what was synced.
+//
+// USAGE:
+//
+//	engine, err := filesync.Open(filesync.Options{
+//	    Client:     c,
+//	    LocalRoot:  "/home/alice/Reports",
+//	    RemoteRoot: "/Reports",
+//	})
+//	if err != nil { ... }
+//	defer engine.Close()
+//	report, err := engine.Sync(ctx)
+package filesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+)
+
+// stateFile is the default name of the state database in the local root.
+const stateFile = internalPrefix + "sync.db"
+
+// ErrSideEmpty means one side was found empty although it had files at
+// the last sync. That is more often an unmounted disk or a wrong folder
+// than a deliberate wipe, and syncing it would delete everything on the
+// other side, so the engine refuses.
+var ErrSideEmpty = errors.New("filesync: one side is empty but wasn't at the last sync; refusing to delete everything on the other")
+
+// Options configure an Engine.
+type Options struct {
+	Client     *client.Client
+	LocalRoot  string // Local directory, e.g. "/home/alice/Reports"
+	RemoteRoot string // Remote folder, e.g. "/Reports"; created if missing
+
+	// StatePath defaults to .fsctl-sync.db in LocalRoot
+	StatePath string
+
+	// DryRun plans a pass without changing anything
+	DryRun bool
+
+	// Progress is called after each action, with Error set if it failed
+	Progress func(Action)
+}
+
+// Engine syncs one local directory with one remote folder. Sync must not
+// be called concurrently.
+type Engine struct {
+	client     *client.Client
+	localRoot  string
+	remoteRoot string
+	dryRun     bool
+	progress   func(Action)
+	state      *state
+}
+
+// Report is the outcome of a pass: the actions carried out (or, in a dry
+// run, planned) and those that failed. Failed actions are tried again by
+// the next pass.
+type Report struct {
+	Actions []Action `json:"actions"`
+	Failed  []Action `json:"failed"`
+}
+
+// Open prepares a sync of opts.LocalRoot with opts.RemoteRoot. It fails
+// with ErrStateInUse while another sync of the same directory runs.
+func Open(opts Options) (*Engine, error) {
+	if opts.Client == nil {
+		return nil, errors.New("filesync: a client is required")
+	}
+	localRoot, err := filepath.Abs(opts.LocalRoot)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(localRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("filesync: %s is not a directory", localRoot)
+	}
+	remoteRoot := path.Clean("/" + opts.RemoteRoot)
+
+	statePath := opts.StatePath
+	if statePath == "" {
+		statePath = filepath.Join(localRoot, stateFile)
+	}
+	st, err := openState(statePath, pair{LocalRoot: localRoot, RemoteRoot: remoteRoot})
+	if err != nil {
+		return nil, err
+	}
+
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(Action) {}
+	}
+	return &Engine{
+		client:     opts.Client,
+		localRoot:  localRoot,
+		remoteRoot: remoteRoot,
+		dryRun:     opts.DryRun,
+		progress:   progress,
+		state:      st,
+	}, nil
+}
+
+// Close releases the state database.
+func (e *Engine) Close() error {
+	return e.state.close()
+}
+
+// Sync runs one pass. An error means the pass couldn't run (or was
+// cancelled); single actions that fail are listed in the report instead.
+func (e *Engine) Sync(ctx context.Context) (*Report, error) {
+	p, err := e.newPass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.plan()
+	if e.dryRun {
+		return &Report{Actions: p.actions, Failed: p.failed}, nil
+	}
+
+	applyErr := p.apply(ctx)
+	// Saved even after an error: what was done must not be done again
+	if err := e.state.save(p.updates); err != nil {
+		return nil, fmt.Errorf("filesync: saving state: %w", err)
+	}
+	if applyErr != nil {
+		return nil, applyErr
+	}
+	return &Report{Actions: p.done, Failed: p.failed}, nil
+}
+
+// =============================================================================
+// PASS
+// =============================================================================
+
+// pass is the working state of one Sync.
+type pass struct {
+	*Engine
+
+	base   map[string]*record
+	local  map[string]*localEntry
+	remote map[string]*remoteEntry
+
+	handled map[string]bool    // Paths taken care of by a move
+	updates map[string]*record // New records; nil deletes one
+	hashes  map[string]string  // Local checksums computed so far
+
+	actions []Action // Planned
+	done    []Action // Carried out
+	failed  []Action
+
+	started time.Time
+}
+
+// newPass loads the base and scans both sides.
+func (e *Engine) newPass(ctx context.Context) (*pass, error) {
+	rootID, exists, err := e.remoteRootID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("filesync: remote folder %s: %w", e.remoteRoot, err)
+	}
+
+	base, err := e.state.load()
+	if err != nil {
+		return nil, err
+	}
+	local, err := scanLocal(e.localRoot)
+	if err != nil {
+		return nil, fmt.Errorf("filesync: scanning %s: %w", e.localRoot, err)
+	}
+	remote := make(map[string]*remoteEntry)
+	if exists {
+		if remote, err = scanRemote(ctx, e.client, rootID); err != nil {
+			return nil, fmt.Errorf("filesync: scanning %s: %w", e.remoteRoot, err)
+		}
+	}
+	if len(base) > 0 && (len(local) == 0 || len(remote) == 0) {
+		return nil, ErrSideEmpty
+	}
+
+	return &pass{
+		Engine:  e,
+		base:    base,
+		local:   local,
+		remote:  remote,
+		handled: make(map[string]bool),
+		updates: make(map[string]*record),
+		hashes:  make(map[string]string),
+		started: time.Now(),
+	}, nil
+}
+
+// remoteRootID finds the remote folder (nil for the root), creating it
+// unless this is a dry run; exists is false if a dry run didn't find it.
+func (e *Engine) remoteRootID(ctx context.Context) (id *primitive.ObjectID, exists bool, err error) {
+	if e.remoteRoot == "/" {
+		return nil, true, nil
+	}
+	if !e.dryRun {
+		folder, err := e.client.Mkdir(ctx, e.remoteRoot)
+		if err != nil {
+			return nil, false, err
+		}
+		return &folder.ID, true, nil
+	}
+
+	entry, err := e.client.Resolve(ctx, e.remoteRoot)
+	switch {
+	case client.IsNotFound(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	case entry.Folder == nil:
+		return nil, false, errors.New("not a folder")
+	}
+	return &entry.Folder.ID, true, nil
+}
+
+// localHash returns the checksum of a local file, hashing it only once
+// per pass.
+func (p *pass) localHash(rel string) (string, error) {
+	if sum, ok := p.hashes[rel]; ok {
+		return sum, nil
+	}
+	sum, err := hashFile(p.localPath(rel))
+	if err != nil {
+		return "", err
+	}
+	p.hashes[rel] = sum
+	return sum, nil
+}
+
+// localPath turns a relative path into a local file name.
+func (p *pass) localPath(rel string) string {
+	return filepath.Join(p.localRoot, filepath.FromSlash(rel))
+}
+
+// remotePath turns a relative path into a remote path.
+func (p *pass) remotePath(rel string) string {
+	return path.Join(p.remoteRoot, rel)
+}
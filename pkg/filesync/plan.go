@@ -0,0 +1,469 @@
+// This file decides what a sync pass does.
+//
+// LEARNING NOTES:
+// ===============
+// THREE-WAY COMPARISON:
+// Comparing the two sides with each other can't tell "created here" from
+// "deleted there". Comparing each side with the record of the last sync
+// (the base) can: each side is then absent, unchanged, added, modified or
+// deleted, and the pair decides:
+//
+//	local \ remote   unchanged       added/modified       deleted
+//	unchanged        -               download             delete locally
+//	added/modified   upload          conflict (*)         upload
+//	deleted          delete remotely download             forget
+//
+// (*) unless both sides ended up with the same content. A real conflict
+// keeps both versions: the local file is renamed to
+// "name (conflict 2024-05-01 153000).ext" and uploaded, and the remote
+// version is downloaded under the original name. An edit always wins over
+// a delete, so no change is ever lost.
+//
+// RENAMES:
+// A rename looks like a delete plus an add. Before the table above runs,
+// such pairs are matched up and turned into moves, so content isn't
+// transferred again:
+//   - remote: a file keeps its ID when moved, so an unknown path holding a
+//     known ID is that file's new home
+//   - local: files have no IDs, so a new file with the checksum of a
+//     vanished one is taken to be it
+//
+// A renamed folder becomes moves of its files, a new folder and the
+// removal of the old one.
+//
+// DELETING FOLDERS:
+// A folder is only deleted when nothing is left in it: not the things
+// that arrive in this pass, nor things added since the last one. Remote
+// folders are deleted as a whole (one request puts the subtree in the
+// trash); local folders only once they are empty, because the local side
+// has no trash to undo a mistake with.
+package filesync
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// ActionKind names what an action does.
+type ActionKind string
+
+// Action kinds
+const (
+	ActionUpload       ActionKind = "upload"        // New or changed local file to the server
+	ActionDownload     ActionKind = "download"      // New or changed remote file to the local directory
+	ActionMkdirRemote  ActionKind = "mkdir_remote"  // Local folder created on the server
+	ActionMkdirLocal   ActionKind = "mkdir_local"   // Remote folder created locally
+	ActionMoveRemote   ActionKind = "move_remote"   // Local rename repeated on the server
+	ActionMoveLocal    ActionKind = "move_local"    // Remote rename repeated locally
+	ActionDeleteRemote ActionKind = "delete_remote" // Local delete repeated on the server (to the trash)
+	ActionDeleteLocal  ActionKind = "delete_local"  // Remote delete repeated locally
+	ActionConflict     ActionKind = "conflict"      // Both sides changed; both versions kept
+)
+
+// Action is one step of a sync pass.
+type Action struct {
+	Kind ActionKind `json:"kind"`
+	Path string     `json:"path"`          // Relative path, e.g. "Photos/beach.jpg"
+	Dir  bool       `json:"dir,omitempty"` // The path is a folder
+
+	From         string `json:"from,omitempty"`          // Moves: the old path
+	ConflictCopy string `json:"conflict_copy,omitempty"` // Conflicts: where the local version goes
+
+	Error string `json:"error,omitempty"` // Set in Report.Failed
+}
+
+// change is how one side differs from the base.
+type change int
+
+const (
+	absent    change = iota // Not there now, and not in the base
+	unchanged               // Same as the base
+	added                   // There now, not in the base
+	modified                // Different content (or type) than the base
+	deleted                 // In the base, not there now
+	unknown                 // Couldn't be determined (an unreadable file)
+)
+
+// errTypeMismatch describes a path that is a file on one side and a
+// folder on the other, which needs a person to sort out.
+const errTypeMismatch = "a file on one side is a folder on the other"
+
+// plan works out the actions of a pass, filling p.actions, p.failed and
+// the state updates that need no action (e.g. identical changes).
+func (p *pass) plan() {
+	p.detectRemoteMoves()
+	p.detectLocalMoves()
+
+	for _, rel := range p.allPaths() {
+		if p.handled[rel] {
+			continue
+		}
+		lc := p.localChange(rel)
+		if lc == unknown {
+			continue
+		}
+		p.decide(rel, lc, p.remoteChange(rel))
+	}
+
+	p.pruneFolderDeletes()
+}
+
+// decide applies the table at the top of the file to one path.
+func (p *pass) decide(rel string, lc, rc change) {
+	l, r := p.local[rel], p.remote[rel]
+	if l != nil && r != nil && l.Dir != r.isDir() {
+		p.fail(Action{Path: rel}, errTypeMismatch)
+		return
+	}
+
+	localChanged := lc == added || lc == modified
+	remoteChanged := rc == added || rc == modified
+	switch {
+	case localChanged && remoteChanged:
+		p.decideBothChanged(rel)
+
+	case localChanged:
+		if l.Dir {
+			p.add(Action{Kind: ActionMkdirRemote, Path: rel, Dir: true})
+		} else {
+			p.add(Action{Kind: ActionUpload, Path: rel})
+		}
+
+	case remoteChanged:
+		if r.isDir() {
+			p.add(Action{Kind: ActionMkdirLocal, Path: rel, Dir: true})
+		} else {
+			p.add(Action{Kind: ActionDownload, Path: rel})
+		}
+
+	case lc == deleted && rc == unchanged:
+		p.add(Action{Kind: ActionDeleteRemote, Path: rel, Dir: r.isDir()})
+
+	case lc == unchanged && rc == deleted:
+		p.add(Action{Kind: ActionDeleteLocal, Path: rel, Dir: l.Dir})
+
+	case lc == deleted && rc == deleted:
+		p.updates[rel] = nil
+	}
+}
+
+// decideBothChanged handles a path changed on both sides.
+func (p *pass) decideBothChanged(rel string) {
+	l, r := p.local[rel], p.remote[rel]
+	if l.Dir {
+		p.updates[rel] = &record{Dir: true, RemoteID: r.Folder.ID}
+		return
+	}
+
+	sum, err := p.localHash(rel)
+	if err != nil {
+		p.fail(Action{Kind: ActionUpload, Path: rel}, err.Error())
+		return
+	}
+	if sum == r.File.Checksum {
+		// The same edit on both sides (or the first sync of a copy)
+		p.updates[rel] = &record{
+			Size: l.Size, ModTime: l.ModTime, Checksum: sum,
+			RemoteID: r.File.ID, Version: r.File.Version,
+		}
+		return
+	}
+	p.add(Action{Kind: ActionConflict, Path: rel, ConflictCopy: conflictName(rel, p.started)})
+}
+
+// =============================================================================
+// CHANGES
+// =============================================================================
+
+// localChange compares the local side of a path with the base.
+func (p *pass) localChange(rel string) change {
+	b, l := p.base[rel], p.local[rel]
+	switch {
+	case b == nil && l == nil:
+		return absent
+	case b == nil:
+		return added
+	case l == nil:
+		return deleted
+	case b.Dir != l.Dir:
+		return modified
+	case l.Dir:
+		return unchanged
+	case l.Size == b.Size && l.ModTime == b.ModTime:
+		return unchanged
+	}
+
+	sum, err := p.localHash(rel)
+	if err != nil {
+		p.fail(Action{Kind: ActionUpload, Path: rel}, err.Error())
+		p.handled[rel] = true
+		return unknown
+	}
+	if sum != b.Checksum {
+		return modified
+	}
+	// Touched, not changed: remember the new time so it isn't hashed again
+	p.touch(rel, func(rec *record) { rec.Size, rec.ModTime = l.Size, l.ModTime })
+	return unchanged
+}
+
+// remoteChange compares the remote side of a path with the base.
+func (p *pass) remoteChange(rel string) change {
+	b, r := p.base[rel], p.remote[rel]
+	switch {
+	case b == nil && r == nil:
+		return absent
+	case b == nil:
+		return added
+	case r == nil:
+		return deleted
+	case b.Dir != r.isDir():
+		return modified
+	case r.isDir():
+		return unchanged
+	case r.File.ID == b.RemoteID && r.File.Version == b.Version:
+		return unchanged
+	case r.File.Checksum != "" && r.File.Checksum == b.Checksum:
+		// A new version with the same content, or our own upload (whose
+		// version wasn't known): just remember the version
+		p.touch(rel, func(rec *record) { rec.RemoteID, rec.Version = r.File.ID, r.File.Version })
+		return unchanged
+	default:
+		return modified
+	}
+}
+
+// touch updates a path's record without an action.
+func (p *pass) touch(rel string, update func(*record)) {
+	rec, ok := p.updates[rel]
+	if !ok || rec == nil {
+		copied := *p.base[rel]
+		rec = &copied
+	}
+	update(rec)
+	p.updates[rel] = rec
+}
+
+// =============================================================================
+// RENAMES
+// =============================================================================
+
+// detectRemoteMoves finds files moved on the server: a known file ID at a
+// path that is new on both sides.
+func (p *pass) detectRemoteMoves() {
+	byID := make(map[string]string) // Remote file ID -> path in the base
+	for rel, rec := range p.base {
+		if !rec.Dir {
+			byID[rec.RemoteID.Hex()] = rel
+		}
+	}
+
+	for _, rel := range sortedKeys(p.remote) {
+		r := p.remote[rel]
+		if r.isDir() || p.base[rel] != nil || p.local[rel] != nil {
+			continue
+		}
+		from, ok := byID[r.File.ID.Hex()]
+		if !ok || p.remote[from] != nil || p.handled[from] || p.local[from] == nil || p.local[from].Dir {
+			continue
+		}
+		if p.localChange(from) != unchanged {
+			continue // Edited locally: handled as a delete and an add, which conflict
+		}
+
+		p.handled[from], p.handled[rel] = true, true
+		p.add(Action{Kind: ActionMoveLocal, Path: rel, From: from})
+
+		// Moved and changed: the new content follows the move
+		if b := p.base[from]; r.File.Version != b.Version && r.File.Checksum != b.Checksum {
+			p.add(Action{Kind: ActionDownload, Path: rel})
+		}
+	}
+}
+
+// detectLocalMoves finds files moved locally: a new file with the
+// checksum of one that vanished (and is unchanged on the server).
+func (p *pass) detectLocalMoves() {
+	vanished := make(map[string][]string) // Checksum -> paths in the base
+	for _, rel := range sortedKeys(p.base) {
+		rec := p.base[rel]
+		if rec.Dir || rec.Checksum == "" || p.local[rel] != nil || p.handled[rel] {
+			continue
+		}
+		if p.remoteChange(rel) != unchanged || p.remote[rel].isDir() {
+			continue
+		}
+		vanished[rec.Checksum] = append(vanished[rec.Checksum], rel)
+	}
+	if len(vanished) == 0 {
+		return
+	}
+
+	for _, rel := range sortedKeys(p.local) {
+		l := p.local[rel]
+		if l.Dir || p.base[rel] != nil || p.remote[rel] != nil || p.handled[rel] {
+			continue
+		}
+		sum, err := p.localHash(rel)
+		if err != nil || len(vanished[sum]) == 0 {
+			continue // A hashing error is reported when the file is planned
+		}
+		from := vanished[sum][0]
+		vanished[sum] = vanished[sum][1:]
+
+		p.handled[from], p.handled[rel] = true, true
+		p.add(Action{Kind: ActionMoveRemote, Path: rel, From: from})
+	}
+}
+
+// =============================================================================
+// FOLDER DELETES
+// =============================================================================
+
+// pruneFolderDeletes drops folder deletes that would take something still
+// wanted with them (see DELETING FOLDERS above), and the deletes of remote
+// items inside a remote folder that is deleted as a whole.
+func (p *pass) pruneFolderDeletes() {
+	// What leaves and what arrives on each side in this pass
+	leavingRemote, leavingLocal := make(map[string]bool), make(map[string]bool)
+	var arrivingRemote, arrivingLocal []string
+	for _, a := range p.actions {
+		switch a.Kind {
+		case ActionDeleteRemote:
+			leavingRemote[a.Path] = true
+		case ActionDeleteLocal:
+			leavingLocal[a.Path] = true
+		case ActionMoveRemote:
+			leavingRemote[a.From] = true
+			arrivingRemote = append(arrivingRemote, a.Path)
+		case ActionMoveLocal:
+			leavingLocal[a.From] = true
+			arrivingLocal = append(arrivingLocal, a.Path)
+		case ActionUpload, ActionMkdirRemote:
+			arrivingRemote = append(arrivingRemote, a.Path)
+		case ActionDownload, ActionMkdirLocal:
+			arrivingLocal = append(arrivingLocal, a.Path)
+		case ActionConflict:
+			arrivingRemote = append(arrivingRemote, a.ConflictCopy)
+			arrivingLocal = append(arrivingLocal, a.Path)
+		}
+	}
+
+	// A folder stays if anything below it stays or arrives
+	keepRemote, keepLocal := make(map[string]bool), make(map[string]bool)
+	for rel := range p.remote {
+		if !leavingRemote[rel] {
+			markParents(keepRemote, rel)
+		}
+	}
+	for _, rel := range arrivingRemote {
+		markParents(keepRemote, rel)
+	}
+	for rel := range p.local {
+		if !leavingLocal[rel] {
+			markParents(keepLocal, rel)
+		}
+	}
+	for _, rel := range arrivingLocal {
+		markParents(keepLocal, rel)
+	}
+
+	// Remote folders that go as a whole take their contents with them
+	var deletedRemoteFolders []string
+	for _, a := range p.actions {
+		if a.Kind == ActionDeleteRemote && a.Dir && !keepRemote[a.Path] {
+			deletedRemoteFolders = append(deletedRemoteFolders, a.Path+"/")
+		}
+	}
+	insideDeleted := func(rel string) bool {
+		for _, prefix := range deletedRemoteFolders {
+			if strings.HasPrefix(rel, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	kept := p.actions[:0]
+	for _, a := range p.actions {
+		switch {
+		case a.Kind == ActionDeleteRemote && a.Dir && keepRemote[a.Path]:
+		case a.Kind == ActionDeleteLocal && a.Dir && keepLocal[a.Path]:
+		case a.Kind == ActionDeleteRemote && insideDeleted(a.Path):
+			p.updates[a.Path] = nil // Goes with its folder
+		default:
+			kept = append(kept, a)
+		}
+	}
+	p.actions = kept
+}
+
+// markParents marks every folder above rel.
+func markParents(marks map[string]bool, rel string) {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if marks[dir] {
+			return // And so are its parents
+		}
+		marks[dir] = true
+	}
+}
+
+// =============================================================================
+// HELPERS
+// =============================================================================
+
+// add records a planned action.
+func (p *pass) add(a Action) {
+	p.actions = append(p.actions, a)
+}
+
+// fail records an action that can't be carried out.
+func (p *pass) fail(a Action, reason string) {
+	a.Error = reason
+	p.failed = append(p.failed, a)
+}
+
+// allPaths returns every path known to the base or either side, sorted,
+// so parents come before their contents.
+func (p *pass) allPaths() []string {
+	seen := make(map[string]bool)
+	for rel := range p.base {
+		seen[rel] = true
+	}
+	for rel := range p.local {
+		seen[rel] = true
+	}
+	for rel := range p.remote {
+		seen[rel] = true
+	}
+	return sortedKeys(seen)
+}
+
+// sortedKeys returns a map's keys in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// conflictName is where the local version of a conflicting file goes:
+// "Docs/plan.txt" -> "Docs/plan (conflict 2024-05-01 153000).txt".
+func conflictName(rel string, at time.Time) string {
+	ext := path.Ext(rel)
+	return strings.TrimSuffix(rel, ext) + " (conflict " + at.Format("2006-01-02 150405") + ")" + ext
+}
+
+// remoteFile returns the remote file at a path, or nil.
+func (p *pass) remoteFile(rel string) *models.File {
+	if r := p.remote[rel]; r != nil {
+		return r.File
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// This file takes stock of both sides: the local directory and the
+// remote folder.
+//
+// LEARNING NOTES:
+// ===============
+// HASHING ONLY WHAT MIGHT HAVE CHANGED:
+// Reading every file on every sync would be slow, so a local file whose
+// size and modification time match the record is taken as unchanged.
+// Only the others are hashed, and a file that was merely touched (same
+// checksum) is not uploaded; its record gets the new time instead.
+//
+// Remote files carry the same SHA-256 checksum (File.Checksum) and a
+// Version that grows with every change, so the remote side never needs
+// hashing at all.
+package filesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/client"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// internalPrefix and partSuffix mark files of our own (the state
+// database, downloads in progress), which are never synced.
+const (
+	internalPrefix = ".fsctl-"
+	partSuffix     = ".fsctl-part"
+)
+
+// isInternal reports whether a file name belongs to fsctl.
+func isInternal(name string) bool {
+	return strings.HasPrefix(name, internalPrefix) || strings.HasSuffix(name, partSuffix)
+}
+
+// =============================================================================
+// LOCAL
+// =============================================================================
+
+// localEntry is a file or directory below the local root.
+type localEntry struct {
+	Dir     bool
+	Size    int64
+	ModTime int64 // UnixNano
+}
+
+// scanLocal lists everything below root by slash-separated relative path.
+// Symbolic links and other special files are left out: what they point to
+// may be outside the directory, or not a file at all.
+func scanLocal(root string) (map[string]*localEntry, error) {
+	entries := make(map[string]*localEntry)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if isInternal(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entry := &localEntry{Dir: d.IsDir()}
+		if !entry.Dir {
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime().UnixNano()
+		}
+		entries[filepath.ToSlash(rel)] = entry
+		return nil
+	})
+	return entries, err
+}
+
+// hashFile returns the hex SHA-256 of a file's content, the same form as
+// File.Checksum.
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// =============================================================================
+// REMOTE
+// =============================================================================
+
+// remoteEntry is a file or folder below the remote root. Exactly one of
+// File and Folder is set.
+type remoteEntry struct {
+	File   *models.File
+	Folder *models.Folder
+}
+
+func (r *remoteEntry) isDir() bool { return r.Folder != nil }
+
+func (r *remoteEntry) id() primitive.ObjectID {
+	if r.Folder != nil {
+		return r.Folder.ID
+	}
+	return r.File.ID
+}
+
+// entry returns the remote entry as a client.Entry, for moves and deletes.
+func (r *remoteEntry) entry() *client.Entry {
+	return &client.Entry{File: r.File, Folder: r.Folder}
+}
+
+// scanRemote lists everything below a remote folder (nil for the root) by
+// relative path, one folder listing at a time.
+func scanRemote(ctx context.Context, c *client.Client, rootID *primitive.ObjectID) (map[string]*remoteEntry, error) {
+	type folder struct {
+		rel string
+		id  *primitive.ObjectID
+	}
+
+	entries := make(map[string]*remoteEntry)
+	queue := []folder{{rel: "", id: rootID}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		items, err := c.List(ctx, current.id)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			switch {
+			case item.Folder != nil:
+				if isInternal(item.Folder.Name) {
+					continue
+				}
+				rel := path.Join(current.rel, item.Folder.Name)
+				entries[rel] = &remoteEntry{Folder: item.Folder}
+				queue = append(queue, folder{rel: rel, id: &item.Folder.ID})
+			case item.File != nil:
+				if isInternal(item.File.FileName) {
+					continue
+				}
+				entries[path.Join(current.rel, item.File.FileName)] = &remoteEntry{File: item.File}
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,158 @@
+// This file keeps the sync state in a local bbolt database.
+//
+// LEARNING NOTES:
+// ===============
+// WHY A DATABASE:
+// To tell "deleted here" from "added there" the engine must remember what
+// both sides looked like after the last sync. That memory must survive
+// crashes half-way through a sync, so it lives in bbolt: a single-file,
+// embedded key/value store with ACID transactions (the storage engine of
+// etcd). No server, no schema - buckets of byte keys and values.
+//
+// LAYOUT:
+//
+//	entries/<relative path>  -> JSON record, e.g. "Photos/beach.jpg"
+//	meta/pair                -> which local directory and remote folder this state belongs to
+//
+// bbolt locks the file while it is open, so two syncs of the same
+// directory can't run at once; the second one fails to open the state.
+package filesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	bucketEntries = []byte("entries")
+	bucketMeta    = []byte("meta")
+	keyPair       = []byte("pair")
+)
+
+// ErrStateInUse means another sync of the same state is running.
+var ErrStateInUse = errors.New("filesync: the sync state is in use by another sync")
+
+// record is the last synced state of one path: what both sides agreed on.
+type record struct {
+	Dir bool `json:"dir,omitempty"`
+
+	// Local side when synced; a different size or modification time
+	// means the file must be hashed to see whether it changed
+	Size    int64 `json:"size,omitempty"`
+	ModTime int64 `json:"mtime,omitempty"` // UnixNano
+
+	// Checksum is the SHA-256 of the content both sides had
+	Checksum string `json:"sha256,omitempty"`
+
+	// Remote side when synced. Version is 0 when unknown (after an
+	// upload); the checksum decides then.
+	RemoteID primitive.ObjectID `json:"remote_id"`
+	Version  int                `json:"version,omitempty"`
+}
+
+// pair identifies what a state belongs to.
+type pair struct {
+	LocalRoot  string `json:"local_root"`
+	RemoteRoot string `json:"remote_root"`
+}
+
+// state is the sync database.
+type state struct {
+	db *bbolt.DB
+}
+
+// openState opens (or creates) the state database for a pair. A state
+// made for a different pair is refused: its records describe other files,
+// and trusting them would delete things.
+func openState(path string, p pair) (*state, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, ErrStateInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filesync: opening state: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketEntries); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		stored := meta.Get(keyPair)
+		if stored == nil {
+			return meta.Put(keyPair, encoded)
+		}
+		var existing pair
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return err
+		}
+		if existing != p {
+			return fmt.Errorf("filesync: state %s belongs to %s <-> %s", path, existing.LocalRoot, existing.RemoteRoot)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &state{db: db}, nil
+}
+
+// load returns all records by relative path.
+func (s *state) load() (map[string]*record, error) {
+	records := make(map[string]*record)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketEntries).ForEach(func(key, value []byte) error {
+			rec := &record{}
+			if err := json.Unmarshal(value, rec); err != nil {
+				return fmt.Errorf("filesync: corrupt record %q: %w", key, err)
+			}
+			records[string(key)] = rec
+			return nil
+		})
+	})
+	return records, err
+}
+
+// save applies updates in one transaction. A nil record deletes the path.
+func (s *state) save(updates map[string]*record) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(bucketEntries)
+		for path, rec := range updates {
+			if rec == nil {
+				if err := entries.Delete([]byte(path)); err != nil {
+					return err
+				}
+				continue
+			}
+			encoded, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := entries.Put([]byte(path), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *state) close() error {
+	return s.db.Close()
+}
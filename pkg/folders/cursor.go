@@ -0,0 +1,84 @@
+// This file implements listing cursors.
+//
+// OPAQUE CURSORS:
+// The client gets a string like "YgAAAAJzAAkAAABtb2Rp..." and sends it
+// back for the next page. It is base64-encoded BSON, but clients must not
+// rely on that: we can change the format without breaking anyone, and the
+// cursor remembers the sort it was made for, so it can't be replayed
+// against a different sort or folder by accident.
+package folders
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were made
+// for a different listing.
+var ErrInvalidCursor = apperrors.New("INVALID_CURSOR", "The cursor is invalid or belongs to a different listing", http.StatusBadRequest)
+
+// cursor is the decoded paging state.
+//
+// BSON, NOT JSON:
+// After holds strings, numbers, timestamps and ObjectIDs. JSON would turn
+// the timestamps into strings and the ObjectIDs into hex; BSON round-trips
+// each value with its type, so it can go straight back into a query.
+type cursor struct {
+	Sort   string             `bson:"s"`
+	Desc   bool               `bson:"d"`
+	Folder primitive.ObjectID `bson:"f"` // NilObjectID for the top level
+
+	// InFiles is set once all folders have been listed
+	InFiles bool `bson:"p"`
+
+	// After holds the sort values and _id of the last item returned. It is
+	// empty when InFiles was just reached and no file was returned yet.
+	After []interface{} `bson:"a"`
+}
+
+// encode returns the opaque string form of the cursor.
+func (c *cursor) encode() (string, error) {
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", apperrors.Wrap(err, "failed to encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a cursor string and checks that it belongs to the
+// requested listing.
+func decodeCursor(raw string, sort string, desc bool, folder primitive.ObjectID) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := bson.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Desc != desc || c.Folder != folder {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// scalar reports whether a decoded cursor value is one we put there: a
+// string, number, timestamp or ObjectID.
+//
+// OPERATOR INJECTION:
+// After values go straight into query predicates. A crafted cursor holding
+// an embedded document like {"$ne": null} would turn an equality into an
+// operator, so anything else is refused.
+func scalar(value interface{}) bool {
+	switch value.(type) {
+	case string, int32, int64, float64, primitive.DateTime, primitive.ObjectID:
+		return true
+	}
+	return false
+}
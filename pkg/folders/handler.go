@@ -0,0 +1,167 @@
+// This file exposes folder operations over HTTP.
+package folders
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+)
+
+// rootID is the :id that stands for the top level, which has no folder
+// document of its own.
+const rootID = "root"
+
+// Handler serves the folder endpoints.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a folder Handler.
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the folder routes on a router group.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.POST("/folders", h.Mkdir)
+	r.GET("/folders/:id/items", h.List)
+	r.GET("/resolve", h.Resolve)
+}
+
+// mkdirRequest is the body of POST /folders.
+type mkdirRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// Mkdir creates a folder, including missing parents (like mkdir -p).
+// Like mkdir -p, asking for a folder that exists is not an error: it is
+// returned as it is, so clients can call this before every upload.
+//
+// POST /folders {"path": "/Documents/Work/2024"}
+func (h *Handler) Mkdir(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var req mkdirRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	folder, err := h.service.Mkdir(c.Request.Context(), user, req.Path)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// Resolve returns the folder or file at a path in the current user's tree.
+//
+// GET /resolve?path=/Documents/Work/report.pdf
+func (h *Handler) Resolve(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	entry, err := h.service.Resolve(c.Request.Context(), user, c.Query("path"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// List returns one page of a folder's contents, folders first.
+//
+// GET /folders/root/items
+// GET /folders/:id/items?sort=modified&order=desc&limit=50&cursor=...
+//
+// Parameters (all optional):
+//
+//	sort        name (default, natural order), size, modified, type
+//	order       asc (default) or desc
+//	limit       items per page (default 50, at most 200)
+//	cursor      next_cursor from the previous page
+//	tag         tag ID; only items carrying it
+//	aggregate   "true" adds recursive size and counts to each folder
+func (h *Handler) List(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	var folderID *primitive.ObjectID
+	if raw := c.Param("id"); raw != rootID {
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			_ = c.Error(apperrors.ErrBadRequest)
+			return
+		}
+		folderID = &id
+	}
+
+	opts, err := parseListOptions(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	listing, err := h.service.List(c.Request.Context(), user, folderID, opts)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+// parseListOptions reads ListOptions from the URL parameters.
+func parseListOptions(c *gin.Context) (ListOptions, error) {
+	opts := ListOptions{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, apperrors.ErrBadRequest
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return opts, apperrors.ErrBadRequest
+		}
+		opts.Limit = limit
+	}
+	if raw := c.Query("tag"); raw != "" {
+		tagID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return opts, apperrors.ErrBadRequest
+		}
+		opts.TagID = &tagID
+	}
+	if raw := c.Query("aggregate"); raw != "" {
+		aggregate, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, apperrors.ErrBadRequest
+		}
+		opts.Aggregate = aggregate
+	}
+	return opts, nil
+}
@@ -0,0 +1,267 @@
+// This file implements folder listings.
+package folders
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Sort orders
+const (
+	SortName     = "name"
+	SortSize     = "size"
+	SortModified = "modified"
+	SortType     = "type"
+)
+
+// Page sizes
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidSort is returned for unknown sort orders.
+var ErrInvalidSort = apperrors.New("INVALID_SORT", "Sort must be one of name, size, modified, type", http.StatusBadRequest)
+
+// sortSpec says how one sort order applies to folders and to files.
+//
+// Folders have no size or type, so those orders list folders by name and
+// only change the order of the files. Type sorts files by MIME type and
+// then by name, so all PDFs are together and alphabetical.
+type sortSpec struct {
+	folderFields []string
+	fileFields   []string
+	folderValues func(*models.Folder) []interface{}
+	fileValues   func(*models.File) []interface{}
+}
+
+// byFolderName is the folder half of the size and type orders.
+var byFolderName = []string{"name"}
+
+// folderName returns the sort values of byFolderName.
+func folderName(f *models.Folder) []interface{} { return []interface{}{f.Name} }
+
+// sorts maps each sort order to its fields. The value functions must
+// return the values of the fields in the same order.
+var sorts = map[string]sortSpec{
+	SortName: {
+		folderFields: byFolderName,
+		fileFields:   []string{"file_name"},
+		folderValues: folderName,
+		fileValues:   func(f *models.File) []interface{} { return []interface{}{f.FileName} },
+	},
+	SortSize: {
+		folderFields: byFolderName,
+		fileFields:   []string{"file_size"},
+		folderValues: folderName,
+		fileValues:   func(f *models.File) []interface{} { return []interface{}{f.FileSize} },
+	},
+	SortModified: {
+		folderFields: []string{"updated_at"},
+		fileFields:   []string{"updated_at"},
+		folderValues: func(f *models.Folder) []interface{} { return []interface{}{f.UpdatedAt} },
+		fileValues:   func(f *models.File) []interface{} { return []interface{}{f.UpdatedAt} },
+	},
+	SortType: {
+		folderFields: byFolderName,
+		fileFields:   []string{"mime_type", "file_name"},
+		folderValues: folderName,
+		fileValues:   func(f *models.File) []interface{} { return []interface{}{f.MimeType, f.FileName} },
+	},
+}
+
+// ListOptions controls a listing. The zero value lists the first page by
+// name, ascending.
+type ListOptions struct {
+	Sort       string // One of the Sort constants ("" = SortName)
+	Descending bool
+	Cursor     string // NextCursor of the previous page ("" = first page)
+	Limit      int    // Items per page (DefaultLimit if 0, at most MaxLimit)
+
+	// TagID lists only items carrying this tag
+	TagID *primitive.ObjectID
+
+	// Aggregate adds recursive size and item counts to every folder
+	Aggregate bool
+}
+
+// Item is one entry of a listing. Exactly one of Folder and File is set.
+type Item struct {
+	Type   models.ItemType `json:"type"`
+	Folder *models.Folder  `json:"folder,omitempty"`
+	File   *models.File    `json:"file,omitempty"`
+
+	// Stats is set for folders when ListOptions.Aggregate is true
+	Stats *FolderStats `json:"stats,omitempty"`
+}
+
+// FolderStats summarizes everything below a folder, at any depth.
+type FolderStats struct {
+	Size    int64 `json:"size"`    // Bytes in all files
+	Files   int64 `json:"files"`   // Number of files
+	Folders int64 `json:"folders"` // Number of subfolders
+}
+
+// Listing is one page of a folder's contents.
+type Listing struct {
+	// Folder is the listed folder (nil for the top level)
+	Folder *models.Folder `json:"folder,omitempty"`
+	Items  []Item         `json:"items"`
+
+	// NextCursor fetches the next page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// List returns one page of a folder's child folders and files, folders
+// first. A nil folderID lists the actor's top level.
+//
+// Listing a folder shared with the actor shows its contents, which belong
+// to the folder's owner.
+func (s *Service) List(ctx context.Context, actor *models.User, folderID *primitive.ObjectID, opts ListOptions) (*Listing, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortName
+	}
+	spec, ok := sorts[opts.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	listing := &Listing{Items: []Item{}}
+	ownerID := actor.ID
+	if folderID != nil {
+		folder, err := s.access.GetFolder(ctx, actor, *folderID)
+		if err != nil {
+			return nil, err
+		}
+		listing.Folder = folder
+		ownerID = folder.UserID
+	}
+
+	next := &cursor{Sort: opts.Sort, Desc: opts.Descending}
+	if folderID != nil {
+		next.Folder = *folderID
+	}
+	var after []interface{}
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor, next.Sort, next.Desc, next.Folder)
+		if err != nil {
+			return nil, err
+		}
+		if !validAfter(c, spec) {
+			return nil, ErrInvalidCursor
+		}
+		next.InFiles, after = c.InFiles, c.After
+	}
+
+	// Phase 1: folders. One extra row tells us whether more follow.
+	if !next.InFiles {
+		page := repository.Page{SortFields: spec.folderFields, Descending: opts.Descending, After: after, Limit: int64(limit + 1)}
+		children, err := s.folders.ListChildren(ctx, ownerID, folderID, opts.TagID, page)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) > limit {
+			children = children[:limit]
+			last := children[limit-1]
+			next.After = append(spec.folderValues(last), last.ID)
+			if listing.NextCursor, err = next.encode(); err != nil {
+				return nil, err
+			}
+		}
+		for _, folder := range children {
+			listing.Items = append(listing.Items, Item{Type: models.ItemTypeFolder, Folder: folder})
+		}
+		if listing.NextCursor == "" {
+			// Folders are exhausted: continue with files from the start
+			next.InFiles, after = true, nil
+		}
+	}
+
+	// Phase 2: files, filling the rest of the page
+	if remaining := limit - len(listing.Items); next.InFiles && listing.NextCursor == "" {
+		page := repository.Page{SortFields: spec.fileFields, Descending: opts.Descending, After: after, Limit: int64(remaining + 1)}
+		children, err := s.files.ListInFolder(ctx, ownerID, folderID, opts.TagID, page)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) > remaining {
+			children = children[:remaining]
+			next.After = nil // The page filled up right at the switch to files
+			if remaining > 0 {
+				last := children[remaining-1]
+				next.After = append(spec.fileValues(last), last.ID)
+			}
+			if listing.NextCursor, err = next.encode(); err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range children {
+			listing.Items = append(listing.Items, Item{Type: models.ItemTypeFile, File: file})
+		}
+	}
+
+	if opts.Aggregate {
+		if err := s.aggregate(ctx, listing.Items); err != nil {
+			return nil, err
+		}
+	}
+	return listing, nil
+}
+
+// validAfter checks that a decoded cursor holds one scalar value per sort
+// field plus the _id - or nothing, right after switching to files.
+func validAfter(c *cursor, spec sortSpec) bool {
+	fields := spec.folderFields
+	if c.InFiles {
+		if len(c.After) == 0 {
+			return true
+		}
+		fields = spec.fileFields
+	}
+	if len(c.After) != len(fields)+1 {
+		return false
+	}
+	for _, value := range c.After {
+		if !scalar(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregate fills in FolderStats for the folders of a page.
+//
+// COST:
+// Each folder takes two queries over everything below it, which is why
+// aggregation is opt-in. The path prefix queries use the user_id + path
+// indexes, so this stays fast for typical trees.
+func (s *Service) aggregate(ctx context.Context, items []Item) error {
+	for n := range items {
+		folder := items[n].Folder
+		if folder == nil {
+			continue
+		}
+
+		fileCount, size, err := s.files.SumUnderPath(ctx, folder.UserID, folder.Path)
+		if err != nil {
+			return err
+		}
+		folderCount, err := s.folders.CountUnderPath(ctx, folder.UserID, folder.Path)
+		if err != nil {
+			return err
+		}
+		items[n].Stats = &FolderStats{Size: size, Files: fileCount, Folders: folderCount}
+	}
+	return nil
+}
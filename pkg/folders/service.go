@@ -0,0 +1,124 @@
+// Package folders implements browsing the folder tree.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Keyset pagination across two collections (folders, then files)
+// 2. Opaque cursors: encoding paging state so clients can't depend on it
+// 3. Table-driven configuration (one map entry per sort order)
+//
+// FOLDERS AND FILES LIVE IN DIFFERENT COLLECTIONS:
+// A listing shows both, folders first. Each page is filled from the
+// folders collection until it runs out, then from the files collection.
+// The cursor records which of the two we were in and where we stopped.
+//
+// WIRING:
+//
+//	service := folders.NewService(folders.Deps{Files: fileRepo, Folders: folderRepo, Access: fileService})
+//	folders.NewHandler(service).RegisterRoutes(api)
+package folders
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Deps bundles the collaborators a Service needs.
+type Deps struct {
+	Files   repository.FileRepository
+	Folders repository.FolderRepository
+
+	// Access decides who may open a folder, including inherited shares,
+	// and creates folders so they are announced like every other change
+	Access *files.Service
+}
+
+// Service implements folder operations.
+type Service struct {
+	files    repository.FileRepository
+	folders  repository.FolderRepository
+	access   *files.Service
+	resolver *paths.Resolver
+}
+
+// NewService creates a folder Service.
+func NewService(deps Deps) *Service {
+	return &Service{
+		files:    deps.Files,
+		folders:  deps.Folders,
+		access:   deps.Access,
+		resolver: paths.NewResolver(deps.Files, deps.Folders),
+	}
+}
+
+// Mkdir creates a folder and any missing parents in the actor's tree and
+// returns it. Existing folders are returned as they are.
+func (s *Service) Mkdir(ctx context.Context, actor *models.User, path string) (*models.Folder, error) {
+	folder, err := s.access.Mkdir(ctx, actor.ID, path)
+	if err != nil {
+		return nil, err
+	}
+	if folder == nil {
+		return nil, paths.ErrRootPath
+	}
+	return folder, nil
+}
+
+// Resolve returns what is at a path in the actor's tree.
+func (s *Service) Resolve(ctx context.Context, actor *models.User, path string) (*paths.Entry, error) {
+	return s.resolver.Resolve(ctx, actor.ID, path)
+}
+
+// Contents returns the folders and files below a folder of the actor's own
+// tree: only the direct children, or with recursive everything at any
+// depth. A path that isn't a folder has no contents.
+func (s *Service) Contents(ctx context.Context, actor *models.User, path string, recursive bool) ([]*models.Folder, []*models.File, error) {
+	entry, err := s.resolver.Resolve(ctx, actor.ID, path)
+	if apperrors.Is(err, apperrors.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry.File != nil {
+		return nil, nil, nil
+	}
+
+	if recursive {
+		prefix := "" // underPath("") matches everything
+		if entry.Folder != nil {
+			prefix = entry.Folder.Path
+		}
+		folders, err := s.folders.FindUnderPath(ctx, actor.ID, prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		files, err := s.files.FindUnderPath(ctx, actor.ID, prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		return folders, files, nil
+	}
+
+	var folderID *primitive.ObjectID
+	if entry.Folder != nil {
+		folderID = &entry.Folder.ID
+	}
+	// A Page without Limit returns everything
+	folders, err := s.folders.ListChildren(ctx, actor.ID, folderID, nil, repository.Page{SortFields: []string{"name"}})
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := s.files.ListInFolder(ctx, actor.ID, folderID, nil, repository.Page{SortFields: []string{"file_name"}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return folders, files, nil
+}
@@ -0,0 +1,97 @@
+// Package jobs runs background processing jobs (thumbnails, scans, ...).
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Producer/consumer with a message broker
+// 2. A worker pool built from goroutines, channels and sync.WaitGroup
+// 3. Retries with exponential backoff and a dead-letter queue
+// 4. Recovering from panics so one bad job can't kill a worker
+//
+// ARCHITECTURE:
+//
+//	API / service                      Worker process
+//	-------------                      --------------
+//	Queue.Enqueue ----> processing_jobs (MongoDB, source of truth)
+//	      |
+//	      +--------> Broker (RabbitMQ) ----> Pool ----> Handler
+//	                     ^                    |
+//	                     +---- retry (delay) -+
+//	                                          +----> dead-letter queue
+//
+// The broker message only carries the job ID. Workers claim the job
+// document before running it (see Pool.handle), so a duplicate or stale
+// message is harmless: a job that is already running or completed can't
+// be claimed, and the message is acknowledged and skipped.
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// =============================================================================
+// MESSAGES
+// =============================================================================
+
+// Message is what travels through the broker.
+type Message struct {
+	JobID string         `json:"job_id"` // Hex ObjectID of the ProcessingJob
+	Type  models.JobType `json:"type"`   // Used as the routing key suffix
+
+	// Deferrals counts how often workers put the message back because the
+	// database was unavailable, to back off further each time
+	Deferrals int `json:"deferrals,omitempty"`
+}
+
+// Delivery is a received message plus the means to acknowledge it.
+//
+// ACK / NACK:
+// A broker keeps a message until the consumer acknowledges it. If a worker
+// crashes before calling Ack, the broker redelivers the message to another
+// worker. Nack(true) hands it back immediately; Nack(false) drops it.
+type Delivery struct {
+	Message Message
+
+	ack  func() error
+	nack func(requeue bool) error
+}
+
+// Ack confirms the message was handled.
+func (d Delivery) Ack() error {
+	return d.ack()
+}
+
+// Nack rejects the message, optionally asking the broker to redeliver it.
+func (d Delivery) Nack(requeue bool) error {
+	return d.nack(requeue)
+}
+
+// =============================================================================
+// BROKER INTERFACE
+// =============================================================================
+
+// Broker moves job messages from producers to workers.
+//
+// Two implementations exist:
+// - RabbitMQBroker for production
+// - MemoryBroker for tests and single-process development
+type Broker interface {
+	// Publish sends a message for immediate processing.
+	Publish(ctx context.Context, msg Message) error
+
+	// PublishDelayed sends a message that becomes visible after delay.
+	PublishDelayed(ctx context.Context, msg Message, delay time.Duration) error
+
+	// DeadLetter parks a message that failed too often, for manual inspection.
+	DeadLetter(ctx context.Context, msg Message, reason string) error
+
+	// Consume returns a channel of deliveries. The channel is closed when
+	// ctx is cancelled or the broker is closed.
+	Consume(ctx context.Context) (<-chan Delivery, error)
+
+	// Close releases the broker's resources.
+	Close() error
+}
@@ -0,0 +1,151 @@
+// This file implements Broker in memory, inside a single process.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Buffered channels as a simple queue
+// 2. time.AfterFunc for delayed delivery
+// 3. A "done" channel to signal shutdown to many goroutines at once
+//
+// USE CASES:
+// - Tests that exercise the worker pool without RabbitMQ
+// - Running the API and workers in one process during development
+//
+// Messages are lost when the process exits; never use this in production.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBrokerClosed is returned when publishing to a closed broker.
+var ErrBrokerClosed = errors.New("jobs: broker closed")
+
+// memoryQueueSize bounds the number of undelivered messages.
+// Publish blocks (until ctx is done) when the queue is full.
+const memoryQueueSize = 1024
+
+// DeadLetter is a message that was parked after exhausting its retries.
+type DeadLetter struct {
+	Message Message
+	Reason  string
+	At      time.Time
+}
+
+// MemoryBroker is an in-process Broker.
+type MemoryBroker struct {
+	queue chan Message
+	done  chan struct{}
+	once  sync.Once
+
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+// NewMemoryBroker creates an empty in-memory broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queue: make(chan Message, memoryQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Publish enqueues a message.
+func (b *MemoryBroker) Publish(ctx context.Context, msg Message) error {
+	// SELECT WITH MULTIPLE CASES:
+	// Whichever case is ready first wins. This lets a full queue block
+	// without ignoring cancellation or shutdown.
+	select {
+	case <-b.done:
+		return ErrBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case b.queue <- msg:
+		return nil
+	}
+}
+
+// PublishDelayed enqueues a message after delay.
+//
+// The timer runs on its own goroutine, so the caller returns immediately.
+// We use a background context there because the caller's ctx may well be
+// cancelled long before the delay elapses.
+func (b *MemoryBroker) PublishDelayed(ctx context.Context, msg Message, delay time.Duration) error {
+	select {
+	case <-b.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	time.AfterFunc(delay, func() {
+		_ = b.Publish(context.Background(), msg)
+	})
+	return nil
+}
+
+// DeadLetter records a message as permanently failed.
+func (b *MemoryBroker) DeadLetter(ctx context.Context, msg Message, reason string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadLetters = append(b.deadLetters, DeadLetter{Message: msg, Reason: reason, At: time.Now()})
+	return nil
+}
+
+// DeadLetters returns a copy of all dead-lettered messages.
+func (b *MemoryBroker) DeadLetters() []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]DeadLetter, len(b.deadLetters))
+	copy(out, b.deadLetters)
+	return out
+}
+
+// Consume returns a channel of deliveries. Several consumers may call
+// Consume; each message goes to exactly one of them (competing consumers).
+func (b *MemoryBroker) Consume(ctx context.Context) (<-chan Delivery, error) {
+	out := make(chan Delivery)
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			case msg := <-b.queue:
+				delivery := Delivery{
+					Message: msg,
+					ack:     func() error { return nil },
+					nack: func(requeue bool) error {
+						if requeue {
+							return b.Publish(context.Background(), msg)
+						}
+						return nil
+					},
+				}
+
+				select {
+				case out <- delivery:
+				case <-ctx.Done():
+					// Nobody will process it; put it back for other consumers
+					_ = b.Publish(context.Background(), msg)
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Close stops all consumers. It is safe to call more than once.
+func (b *MemoryBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
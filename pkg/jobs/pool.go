@@ -0,0 +1,396 @@
+// This file implements the consumer side: a pool of workers running jobs.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Fan-out: N goroutines reading from one channel
+// 2. Graceful shutdown with context cancellation and sync.WaitGroup
+// 3. recover() to turn a panic into an ordinary job failure
+// 4. Exponential backoff
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/logger"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Handler executes one job. Returning an error schedules a retry (or a
+// dead-letter once the attempts are used up).
+type Handler func(ctx context.Context, job *models.ProcessingJob) error
+
+// =============================================================================
+// PERMANENT ERRORS
+// =============================================================================
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the pool dead-letters the job immediately instead
+// of retrying. Use it for things like "unsupported image format".
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// =============================================================================
+// POOL
+// =============================================================================
+
+// Pool runs registered handlers for jobs received from a Broker.
+type Pool struct {
+	cfg    config.WorkerConfig
+	broker Broker
+	jobs   repository.JobRepository
+	files  repository.FileRepository
+	log    *logger.Logger
+
+	// handlers is written by Register before Run and only read afterwards,
+	// so it needs no lock.
+	handlers map[models.JobType]Handler
+}
+
+// NewPool creates a worker pool. Register handlers before calling Run.
+func NewPool(cfg config.WorkerConfig, broker Broker, jobs repository.JobRepository, files repository.FileRepository, log *logger.Logger) *Pool {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = time.Second
+	}
+	if cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		cfg.RetryMaxDelay = cfg.RetryBaseDelay
+	}
+	if cfg.JobLease <= 0 {
+		cfg.JobLease = 2 * time.Minute
+	}
+
+	return &Pool{
+		cfg:      cfg,
+		broker:   broker,
+		jobs:     jobs,
+		files:    files,
+		log:      log,
+		handlers: make(map[models.JobType]Handler),
+	}
+}
+
+// Register sets the handler for a job type.
+func (p *Pool) Register(jobType models.JobType, handler Handler) {
+	p.handlers[jobType] = handler
+}
+
+// Run starts cfg.Concurrency workers and blocks until ctx is cancelled.
+// In-flight jobs are allowed to finish before Run returns.
+func (p *Pool) Run(ctx context.Context) error {
+	deliveries, err := p.broker.Consume(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.log.Info().Int("concurrency", p.cfg.Concurrency).Msg("Worker pool started")
+
+	// WAITGROUP:
+	// wg.Add(n) before starting goroutines, wg.Done() when each exits,
+	// wg.Wait() blocks until all of them have called Done.
+	var wg sync.WaitGroup
+	wg.Add(p.cfg.Concurrency)
+	for i := 0; i < p.cfg.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveries {
+				p.handle(delivery)
+			}
+		}()
+	}
+
+	wg.Wait()
+	p.log.Info().Msg("Worker pool stopped")
+	return nil
+}
+
+// handle processes one delivery and always acknowledges it exactly once.
+//
+// WHY context.Background()?
+// When Run's ctx is cancelled for shutdown, we still want the job that is
+// already running to finish and record its result.
+func (p *Pool) handle(delivery Delivery) {
+	ctx := context.Background()
+	msg := delivery.Message
+
+	id, err := primitive.ObjectIDFromHex(msg.JobID)
+	if err != nil {
+		p.log.Error().Str("job_id", msg.JobID).Msg("Dropping message with invalid job ID")
+		_ = delivery.Ack()
+		return
+	}
+
+	// CLAIMING:
+	// The same job can be delivered more than once: the broker redelivers
+	// a message whose ack got lost, and Resume republishes queued jobs.
+	// Claim lets exactly one delivery run the job; the others find it
+	// running or finished.
+	job, err := p.jobs.Claim(ctx, id, time.Now().Add(p.cfg.JobLease))
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			p.skip(ctx, delivery, id)
+			return
+		}
+		p.log.Error().Err(err).Str("job_id", msg.JobID).Msg("Failed to claim job")
+		p.retryLater(ctx, delivery)
+		return
+	}
+
+	if err := p.run(ctx, job); err != nil {
+		p.log.Error().Err(err).Str("job_id", msg.JobID).Msg("Failed to record job result")
+		p.retryLater(ctx, delivery)
+		return
+	}
+	_ = delivery.Ack()
+}
+
+// retryLater puts a delivery back after a backoff when the database
+// failed us.
+//
+// WHY NOT Nack(true)?
+// A requeued message is redelivered at once. During a MongoDB outage every
+// worker would spin through the same messages as fast as the broker can
+// hand them out, hammering a database that is trying to recover. If even
+// the delayed publish fails, the message is dropped: the job document is
+// still queued (or running with a lease that runs out), and Queue.Resume
+// publishes it again.
+func (p *Pool) retryLater(ctx context.Context, delivery Delivery) {
+	msg := delivery.Message
+	msg.Deferrals++
+	if err := p.broker.PublishDelayed(ctx, msg, p.backoff(msg.Deferrals)); err != nil {
+		p.log.Error().Err(err).Str("job_id", msg.JobID).Msg("Failed to defer job message; leaving it to Resume")
+		_ = delivery.Nack(false)
+		return
+	}
+	_ = delivery.Ack()
+}
+
+// skip drops a delivery whose job couldn't be claimed. A job that is
+// finished or deleted needs nothing more. A job running elsewhere may
+// belong to a worker that crashed, and this message may be its only one:
+// it is checked again once the lease has run out, and claimed then
+// unless the worker renewed it.
+func (p *Pool) skip(ctx context.Context, delivery Delivery, id primitive.ObjectID) {
+	job, err := p.jobs.GetByID(ctx, id)
+	if err == nil && job.Status == models.JobRunning && job.LeaseUntil != nil {
+		delay := time.Until(*job.LeaseUntil)
+		if delay <= 0 {
+			delay = p.cfg.RetryBaseDelay
+		}
+		if err := p.broker.PublishDelayed(ctx, delivery.Message, delay); err != nil {
+			_ = delivery.Nack(true)
+			return
+		}
+	}
+	_ = delivery.Ack()
+}
+
+// run executes a job and records the outcome. The returned error is only
+// about bookkeeping; handler failures are recorded on the job itself.
+//
+// The job was claimed already: it is running, with the attempt counted.
+func (p *Pool) run(ctx context.Context, job *models.ProcessingJob) error {
+	p.refreshFileStatus(ctx, job)
+
+	stop := p.keepLease(job.ID)
+	handlerErr := p.execute(ctx, job)
+	stop()
+
+	now := time.Now()
+	job.UpdatedAt = now
+	job.LeaseUntil = nil
+
+	switch {
+	case handlerErr == nil:
+		job.Status = models.JobCompleted
+		job.CompletedAt = &now
+		job.LastError = ""
+		if err := p.jobs.Update(ctx, job); err != nil {
+			return err
+		}
+		p.refreshFileStatus(ctx, job)
+		return nil
+
+	case IsPermanent(handlerErr) || !job.HasAttemptsLeft():
+		job.Status = models.JobDead
+		job.CompletedAt = &now
+		job.LastError = handlerErr.Error()
+		if err := p.jobs.Update(ctx, job); err != nil {
+			return err
+		}
+		p.refreshFileStatus(ctx, job)
+		p.log.Warn().Str("job_id", job.ID.Hex()).Str("type", string(job.Type)).
+			Int("attempts", job.Attempts).Str("error", job.LastError).Msg("Job dead-lettered")
+		return p.broker.DeadLetter(ctx, messageFor(job), job.LastError)
+
+	default:
+		delay := p.backoff(job.Attempts)
+		next := now.Add(delay)
+		job.Status = models.JobQueued
+		job.NextRunAt = &next
+		job.LastError = handlerErr.Error()
+		if err := p.jobs.Update(ctx, job); err != nil {
+			return err
+		}
+		p.refreshFileStatus(ctx, job)
+		return p.broker.PublishDelayed(ctx, messageFor(job), delay)
+	}
+}
+
+// keepLease renews a running job's lease until the returned function is
+// called, so a long job (a video rendition) isn't mistaken for one whose
+// worker crashed. Renewing at a third of the lease leaves room for two
+// failed renewals in a row.
+func (p *Pool) keepLease(id primitive.ObjectID) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(p.cfg.JobLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := p.jobs.RenewLease(context.Background(), id, time.Now().Add(p.cfg.JobLease)); err != nil {
+					p.log.Warn().Err(err).Str("job_id", id.Hex()).Msg("Failed to renew job lease")
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// execute calls the handler, converting a panic into an error.
+//
+// RECOVER:
+// A panic unwinds the stack until something calls recover() in a deferred
+// function. Without this, one nil-pointer bug in a handler would crash the
+// whole worker process and every job it was running.
+func (p *Pool) execute(ctx context.Context, job *models.ProcessingJob) (err error) {
+	handler, ok := p.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler registered for job type %q", job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			p.log.Error().Str("job_id", job.ID.Hex()).Str("stack", string(debug.Stack())).Msg("Job handler panicked")
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before retry number attempt.
+//
+// EXPONENTIAL BACKOFF:
+// attempt 1 -> base, 2 -> 2*base, 3 -> 4*base, ... capped at RetryMaxDelay.
+// Waiting longer after each failure gives a struggling dependency (S3, an
+// external scanner) room to recover instead of hammering it.
+func (p *Pool) backoff(attempt int) time.Duration {
+	delay := p.cfg.RetryBaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= p.cfg.RetryMaxDelay {
+			return p.cfg.RetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// refreshFileStatus derives the file's processing status from the jobs of
+// its version and stores it. Failures are logged rather than returned: the
+// job result matters more than the status badge.
+//
+// WHY DERIVE IT?
+// A file version has several jobs finishing in any order, so no single
+// job knows the file's status: a scan that just completed has enqueued
+// follow-ups that are still waiting, and a compression that succeeded
+// says nothing about a thumbnail job that failed for good. The status is
+// computed from all of the version's jobs, where only the newest job of
+// each type counts (a rerun replaces an old failure):
+//
+//	any running -> processing
+//	any queued  -> pending
+//	any dead    -> failed
+//	otherwise   -> completed
+//
+// Jobs for an old version leave the file alone: UpdateProcessingStatus
+// only writes while the file is still at the job's version. Tasks (see
+// Queue.EnqueueTask) have no file to update.
+func (p *Pool) refreshFileStatus(ctx context.Context, job *models.ProcessingJob) {
+	if job.FileID.IsZero() || job.FileVersion == 0 {
+		return
+	}
+
+	jobs, err := p.jobs.ListByFileVersion(ctx, job.FileID, job.FileVersion)
+	if err != nil {
+		p.log.Warn().Err(err).Str("file_id", job.FileID.Hex()).Msg("Failed to load jobs for file processing status")
+		return
+	}
+
+	err = p.files.UpdateProcessingStatus(ctx, job.FileID, job.FileVersion, fileStatus(jobs))
+	if err != nil && !apperrors.Is(err, apperrors.ErrNotFound) {
+		p.log.Warn().Err(err).Str("file_id", job.FileID.Hex()).Msg("Failed to update file processing status")
+	}
+}
+
+// fileStatus combines the states of a file version's jobs, given newest
+// first, into one processing status.
+func fileStatus(jobs []*models.ProcessingJob) models.ProcessingStatus {
+	seen := make(map[models.JobType]bool, len(jobs))
+	running, queued, dead := false, false, false
+	for _, job := range jobs {
+		if seen[job.Type] {
+			continue // Superseded by a newer job of the same type
+		}
+		seen[job.Type] = true
+
+		switch job.Status {
+		case models.JobRunning:
+			running = true
+		case models.JobQueued:
+			queued = true
+		case models.JobDead:
+			dead = true
+		}
+	}
+
+	switch {
+	case running:
+		return models.ProcessingInProgress
+	case queued:
+		return models.ProcessingPending
+	case dead:
+		return models.ProcessingFailed
+	default:
+		return models.ProcessingCompleted
+	}
+}
@@ -0,0 +1,417 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/logger"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// memoryJobs is a JobRepository in a map. Jobs are copied in and out, like
+// documents, so the pool can't change a stored job behind our back.
+// Embedding the interface satisfies it; methods not overridden here panic.
+type memoryJobs struct {
+	repository.JobRepository
+
+	mu   sync.Mutex
+	jobs map[primitive.ObjectID]models.ProcessingJob
+
+	// down makes Claim fail this many more times, like a database outage
+	down   int
+	claims int
+}
+
+func newMemoryJobs() *memoryJobs {
+	return &memoryJobs{jobs: make(map[primitive.ObjectID]models.ProcessingJob)}
+}
+
+func (r *memoryJobs) Create(ctx context.Context, job *models.ProcessingJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *memoryJobs) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ProcessingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+	return &job, nil
+}
+
+func (r *memoryJobs) Update(ctx context.Context, job *models.ProcessingJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *memoryJobs) Claim(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) (*models.ProcessingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claims++
+	if r.down > 0 {
+		r.down--
+		return nil, errors.New("server selection timeout")
+	}
+	job, ok := r.jobs[id]
+	now := time.Now()
+	expired := job.Status == models.JobRunning && (job.LeaseUntil == nil || job.LeaseUntil.Before(now))
+	if !ok || (job.Status != models.JobQueued && !expired) {
+		return nil, apperrors.ErrNotFound
+	}
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.StartedAt = &now
+	job.LeaseUntil = &leaseUntil
+	job.NextRunAt = nil
+	r.jobs[id] = job
+	return &job, nil
+}
+
+func (r *memoryJobs) RenewLease(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.Status != models.JobRunning {
+		return apperrors.ErrNotFound
+	}
+	job.LeaseUntil = &leaseUntil
+	r.jobs[id] = job
+	return nil
+}
+
+func (r *memoryJobs) FindByStatus(ctx context.Context, status models.JobStatus, limit int64) ([]*models.ProcessingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*models.ProcessingJob
+	for _, job := range r.jobs {
+		if job.Status == status {
+			out = append(out, &job)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryJobs) ListByFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) ([]*models.ProcessingJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*models.ProcessingJob
+	for _, job := range r.jobs {
+		if job.FileID == fileID && job.FileVersion == version {
+			out = append(out, &job)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].QueuedAt.After(out[j].QueuedAt) })
+	return out, nil
+}
+
+// memoryFiles records the processing status of one file version.
+type memoryFiles struct {
+	repository.FileRepository
+
+	mu      sync.Mutex
+	version int
+	status  models.ProcessingStatus
+}
+
+func (r *memoryFiles) UpdateProcessingStatus(ctx context.Context, id primitive.ObjectID, version int, status models.ProcessingStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version != r.version {
+		return apperrors.ErrNotFound
+	}
+	r.status = status
+	return nil
+}
+
+func (r *memoryFiles) current() models.ProcessingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+type poolFixture struct {
+	broker *MemoryBroker
+	jobs   *memoryJobs
+	files  *memoryFiles
+	queue  *Queue
+	pool   *Pool
+}
+
+// startPool runs a pool with fast retries and the given handlers until the
+// test ends.
+func startPool(t *testing.T, maxAttempts int, handlers map[models.JobType]Handler) *poolFixture {
+	t.Helper()
+	f := &poolFixture{
+		broker: NewMemoryBroker(),
+		jobs:   newMemoryJobs(),
+		files:  &memoryFiles{version: 1},
+	}
+	f.queue = NewQueue(f.broker, f.jobs, f.files, maxAttempts)
+	cfg := config.WorkerConfig{Concurrency: 2, RetryBaseDelay: 5 * time.Millisecond, RetryMaxDelay: 20 * time.Millisecond}
+	f.pool = NewPool(cfg, f.broker, f.jobs, f.files, logger.New("test", "test", "disabled"))
+	for jobType, handler := range handlers {
+		f.pool.Register(jobType, handler)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		f.broker.Close()
+	})
+	go func() {
+		defer close(done)
+		_ = f.pool.Run(ctx)
+	}()
+	return f
+}
+
+// enqueue creates a job for version 1 of a file.
+func (f *poolFixture) enqueue(t *testing.T, jobType models.JobType) *models.ProcessingJob {
+	t.Helper()
+	file := &models.File{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Version: 1}
+	job, err := f.queue.Enqueue(context.Background(), jobType, file, nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return job
+}
+
+// waitFinished polls until the job is completed or dead.
+func (f *poolFixture) waitFinished(t *testing.T, id primitive.ObjectID) *models.ProcessingJob {
+	t.Helper()
+	var job *models.ProcessingJob
+	eventually(t, "the job finished", func() bool {
+		var err error
+		if job, err = f.jobs.GetByID(context.Background(), id); err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		return job.IsFinished()
+	})
+	return job
+}
+
+// waitFileStatus polls until the file has the status. The pool records it
+// right after the job's final state, so it may lag behind for a moment.
+func (f *poolFixture) waitFileStatus(t *testing.T, want models.ProcessingStatus) {
+	t.Helper()
+	eventually(t, "file status "+string(want), func() bool { return f.files.current() == want })
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for: %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestPoolRetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	f := startPool(t, 5, map[models.JobType]Handler{"flaky": func(ctx context.Context, job *models.ProcessingJob) error {
+		if calls.Add(1) < 3 {
+			return errors.New("temporarily unavailable")
+		}
+		return nil
+	}})
+
+	job := f.waitFinished(t, f.enqueue(t, "flaky").ID)
+	if job.Status != models.JobCompleted || job.Attempts != 3 {
+		t.Fatalf("status %s after %d attempts, want completed after 3", job.Status, job.Attempts)
+	}
+	if job.LastError != "" {
+		t.Fatalf("LastError = %q after success", job.LastError)
+	}
+	f.waitFileStatus(t, models.ProcessingCompleted)
+	if dead := f.broker.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("dead letters = %v", dead)
+	}
+}
+
+func TestPoolDeadLettersAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	f := startPool(t, 3, map[models.JobType]Handler{"broken": func(ctx context.Context, job *models.ProcessingJob) error {
+		calls.Add(1)
+		return errors.New("still broken")
+	}})
+
+	job := f.waitFinished(t, f.enqueue(t, "broken").ID)
+	if job.Status != models.JobDead || job.Attempts != 3 || calls.Load() != 3 {
+		t.Fatalf("status %s after %d attempts (%d calls), want dead after 3", job.Status, job.Attempts, calls.Load())
+	}
+	if job.LastError != "still broken" {
+		t.Fatalf("LastError = %q", job.LastError)
+	}
+	f.waitFileStatus(t, models.ProcessingFailed)
+
+	// The dead letter is parked after the job's state is stored
+	eventually(t, "a dead letter", func() bool { return len(f.broker.DeadLetters()) > 0 })
+	dead := f.broker.DeadLetters()
+	if len(dead) != 1 || dead[0].Message.JobID != job.ID.Hex() {
+		t.Fatalf("dead letters = %v, want the job", dead)
+	}
+}
+
+func TestPoolDeadLettersPermanentErrorsAtOnce(t *testing.T) {
+	f := startPool(t, 5, map[models.JobType]Handler{"unsupported": func(ctx context.Context, job *models.ProcessingJob) error {
+		return Permanent(errors.New("unsupported format"))
+	}})
+
+	job := f.waitFinished(t, f.enqueue(t, "unsupported").ID)
+	if job.Status != models.JobDead || job.Attempts != 1 {
+		t.Fatalf("status %s after %d attempts, want dead after 1", job.Status, job.Attempts)
+	}
+	eventually(t, "a dead letter", func() bool { return len(f.broker.DeadLetters()) == 1 })
+}
+
+func TestPoolRetriesPanics(t *testing.T) {
+	var calls atomic.Int32
+	f := startPool(t, 5, map[models.JobType]Handler{"panicky": func(ctx context.Context, job *models.ProcessingJob) error {
+		if calls.Add(1) == 1 {
+			panic("nil map")
+		}
+		return nil
+	}})
+
+	job := f.waitFinished(t, f.enqueue(t, "panicky").ID)
+	if job.Status != models.JobCompleted || job.Attempts != 2 {
+		t.Fatalf("status %s after %d attempts, want completed after 2", job.Status, job.Attempts)
+	}
+}
+
+func TestPoolDeadLettersUnknownTypes(t *testing.T) {
+	f := startPool(t, 5, nil)
+
+	job := f.waitFinished(t, f.enqueue(t, "nobody_handles_this").ID)
+	if job.Status != models.JobDead || job.Attempts != 1 {
+		t.Fatalf("status %s after %d attempts, want dead after 1", job.Status, job.Attempts)
+	}
+}
+
+func TestPoolRunsDuplicateDeliveriesOnce(t *testing.T) {
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	f := startPool(t, 5, map[models.JobType]Handler{"slow": func(ctx context.Context, job *models.ProcessingJob) error {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return nil
+	}})
+
+	job := f.enqueue(t, "slow")
+	<-started
+	// A redelivery arrives while the first worker still runs the job
+	if err := f.broker.Publish(context.Background(), messageFor(job)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	job = f.waitFinished(t, job.ID)
+	if job.Status != models.JobCompleted || job.Attempts != 1 || calls.Load() != 1 {
+		t.Fatalf("status %s after %d attempts (%d calls), want completed after 1", job.Status, job.Attempts, calls.Load())
+	}
+}
+
+func TestPoolBacksOffWhileTheDatabaseIsDown(t *testing.T) {
+	f := startPool(t, 5, map[models.JobType]Handler{"ok": func(ctx context.Context, job *models.ProcessingJob) error {
+		return nil
+	}})
+	f.jobs.mu.Lock()
+	f.jobs.down = 3
+	f.jobs.mu.Unlock()
+
+	job := f.waitFinished(t, f.enqueue(t, "ok").ID)
+	if job.Status != models.JobCompleted || job.Attempts != 1 {
+		t.Fatalf("status %s after %d attempts, want completed after 1", job.Status, job.Attempts)
+	}
+	f.jobs.mu.Lock()
+	defer f.jobs.mu.Unlock()
+	if f.jobs.claims != 4 {
+		t.Fatalf("claims = %d, want 4: one per backoff, not a redelivery loop", f.jobs.claims)
+	}
+}
+
+func TestResumeSkipsWaitingRetries(t *testing.T) {
+	broker := NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+	jobs := newMemoryJobs()
+	queue := NewQueue(broker, jobs, &memoryFiles{version: 1}, 0)
+
+	later := time.Now().Add(time.Hour)
+	ready := models.NewProcessingJob("a", primitive.NewObjectID(), primitive.NewObjectID(), nil)
+	waiting := models.NewProcessingJob("b", primitive.NewObjectID(), primitive.NewObjectID(), nil)
+	waiting.NextRunAt = &later
+	jobs.Create(context.Background(), ready)
+	jobs.Create(context.Background(), waiting)
+
+	published, err := queue.Resume(context.Background(), 0)
+	if err != nil || published != 1 {
+		t.Fatalf("Resume = %d, %v; want only the job that isn't waiting for a retry", published, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := NewPool(config.WorkerConfig{RetryBaseDelay: time.Second, RetryMaxDelay: 10 * time.Second}, nil, nil, nil, nil)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestFileStatus(t *testing.T) {
+	job := func(jobType models.JobType, status models.JobStatus) *models.ProcessingJob {
+		return &models.ProcessingJob{Type: jobType, Status: status}
+	}
+	tests := []struct {
+		name string
+		jobs []*models.ProcessingJob // Newest first
+		want models.ProcessingStatus
+	}{
+		{"all done", []*models.ProcessingJob{job("a", models.JobCompleted), job("b", models.JobCompleted)}, models.ProcessingCompleted},
+		{"one running", []*models.ProcessingJob{job("a", models.JobCompleted), job("b", models.JobRunning)}, models.ProcessingInProgress},
+		{"one waiting", []*models.ProcessingJob{job("a", models.JobCompleted), job("b", models.JobQueued)}, models.ProcessingPending},
+		{"one dead", []*models.ProcessingJob{job("a", models.JobCompleted), job("b", models.JobDead)}, models.ProcessingFailed},
+		{"running beats dead", []*models.ProcessingJob{job("a", models.JobDead), job("b", models.JobRunning)}, models.ProcessingInProgress},
+		{"rerun replaces a failure", []*models.ProcessingJob{job("a", models.JobCompleted), job("a", models.JobDead)}, models.ProcessingCompleted},
+		{"old success doesn't hide a new failure", []*models.ProcessingJob{job("a", models.JobDead), job("a", models.JobCompleted)}, models.ProcessingFailed},
+	}
+	for _, tt := range tests {
+		if got := fileStatus(tt.jobs); got != tt.want {
+			t.Errorf("%s: fileStatus = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
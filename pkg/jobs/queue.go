@@ -0,0 +1,136 @@
+// This file implements the producer side: creating and publishing jobs.
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Queue creates jobs and hands them to the broker.
+type Queue struct {
+	broker      Broker
+	jobs        repository.JobRepository
+	files       repository.FileRepository
+	maxAttempts int
+}
+
+// NewQueue creates a Queue. maxAttempts <= 0 uses models.DefaultJobMaxAttempts.
+func NewQueue(broker Broker, jobs repository.JobRepository, files repository.FileRepository, maxAttempts int) *Queue {
+	if maxAttempts <= 0 {
+		maxAttempts = models.DefaultJobMaxAttempts
+	}
+	return &Queue{broker: broker, jobs: jobs, files: files, maxAttempts: maxAttempts}
+}
+
+// EnqueueOption customizes a job before it is stored.
+//
+// FUNCTIONAL OPTIONS PATTERN:
+// Instead of a constructor with many rarely-used parameters, callers pass
+// small functions that tweak the value:
+//
+//	queue.Enqueue(ctx, "thumbnail", file, payload, jobs.WithPriority(models.JobPriorityHigh))
+type EnqueueOption func(*models.ProcessingJob)
+
+// WithPriority sets the job priority.
+func WithPriority(priority int) EnqueueOption {
+	return func(j *models.ProcessingJob) { j.Priority = priority }
+}
+
+// WithMaxAttempts overrides the retry limit for one job.
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(j *models.ProcessingJob) { j.MaxAttempts = n }
+}
+
+// Enqueue stores a new job for a file and publishes it.
+//
+// ORDER: DATABASE FIRST, THEN BROKER
+// If publishing fails, the job still exists with status "queued" and
+// Resume will publish it later. The reverse order could deliver a message
+// for a job that doesn't exist yet.
+func (q *Queue) Enqueue(ctx context.Context, jobType models.JobType, file *models.File, payload map[string]interface{}, opts ...EnqueueOption) (*models.ProcessingJob, error) {
+	job := models.NewProcessingJob(jobType, file.ID, file.UserID, payload)
+	job.FileVersion = file.Version
+	job.MaxAttempts = q.maxAttempts
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	// ErrNotFound: the file has a newer version already, whose own jobs
+	// set its status
+	err := q.files.UpdateProcessingStatus(ctx, file.ID, file.Version, models.ProcessingPending)
+	if err != nil && !apperrors.Is(err, apperrors.ErrNotFound) {
+		return nil, err
+	}
+	if err := q.broker.Publish(ctx, messageFor(job)); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// EnqueueTask stores and publishes a job that isn't about a single file,
+// such as copying a folder tree. Its parameters go in payload.
+func (q *Queue) EnqueueTask(ctx context.Context, jobType models.JobType, userID primitive.ObjectID, payload map[string]interface{}, opts ...EnqueueOption) (*models.ProcessingJob, error) {
+	job := models.NewProcessingJob(jobType, primitive.NilObjectID, userID, payload)
+	job.MaxAttempts = q.maxAttempts
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := q.broker.Publish(ctx, messageFor(job)); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// Resume re-publishes queued jobs, e.g. at startup after a broker outage,
+// and running jobs whose lease ran out because their worker died.
+// Jobs still waiting out a retry delay are skipped: their delayed message
+// is parked in the broker, and publishing another would run them early.
+func (q *Queue) Resume(ctx context.Context, limit int64) (int, error) {
+	queued, err := q.jobs.FindByStatus(ctx, models.JobQueued, limit)
+	if err != nil {
+		return 0, err
+	}
+	running, err := q.jobs.FindByStatus(ctx, models.JobRunning, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	published := 0
+	for _, job := range append(queued, running...) {
+		if job.NextRunAt != nil && job.NextRunAt.After(now) {
+			continue
+		}
+		if job.LeaseUntil != nil && job.LeaseUntil.After(now) {
+			continue
+		}
+		if err := q.broker.Publish(ctx, messageFor(job)); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// Get returns a job by ID (for status endpoints).
+func (q *Queue) Get(ctx context.Context, id primitive.ObjectID) (*models.ProcessingJob, error) {
+	return q.jobs.GetByID(ctx, id)
+}
+
+// messageFor builds the broker message for a job.
+func messageFor(job *models.ProcessingJob) Message {
+	return Message{JobID: job.ID.Hex(), Type: job.Type}
+}
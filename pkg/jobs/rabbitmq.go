@@ -0,0 +1,365 @@
+// This file implements Broker on top of RabbitMQ.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. AMQP topology: exchanges, queues and bindings
+// 2. Delayed retries without plugins (queue TTL + dead-letter exchange)
+// 3. Publisher confirms for reliable publishing
+// 4. Reconnecting after the connection drops
+//
+// TOPOLOGY:
+//
+//	                        routing key "jobs.<type>"
+//	Publish ----> [exchange: file-storage-exchange (topic)] ----> file-processing
+//	                        ^                                     (bound to "jobs.*")
+//	                        | dead-lettered on expiry as "jobs.retry"
+//	PublishDelayed ----> file-processing.retry.<n>s (no consumers, TTL n seconds)
+//
+//	DeadLetter ----> file-processing.dead (inspected by humans)
+//
+// HOW THE DELAY WORKS:
+// A retry message is published straight to a retry queue. Nobody consumes
+// that queue, so the message sits there until its TTL runs out. RabbitMQ
+// then "dead-letters" it to our exchange, which routes it back to the
+// main queue.
+//
+// ONE QUEUE PER DELAY:
+// RabbitMQ only expires messages at the head of a queue. With per-message
+// TTLs in one shared queue, a 2s retry queued behind a 10m retry would
+// wait the full 10 minutes. Each retry queue here has a single TTL for all
+// of its messages (x-message-ttl), so its head always expires first. A
+// delay is rounded up to the next step of retryDelays.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+)
+
+// Queue names
+const (
+	QueueProcessing = "file-processing"       // Jobs ready to run
+	QueueRetry      = "file-processing.retry" // Prefix of the queues for jobs waiting for their backoff
+	QueueDead       = "file-processing.dead"  // Jobs that exhausted their attempts
+
+	routingKeyPrefix = "jobs."
+	routingKeyRetry  = routingKeyPrefix + "retry"
+)
+
+// retryDelays are the TTLs of the retry queues, shortest first. Delays
+// past the last step wait for the last step.
+var retryDelays = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 30 * time.Minute,
+	time.Hour,
+}
+
+// retryQueue returns the name of the retry queue with the given TTL.
+func retryQueue(ttl time.Duration) string {
+	return fmt.Sprintf("%s.%ds", QueueRetry, int64(ttl/time.Second))
+}
+
+// retryStep picks the shortest retry queue TTL of at least delay.
+func retryStep(delay time.Duration) time.Duration {
+	for _, step := range retryDelays {
+		if step >= delay {
+			return step
+		}
+	}
+	return retryDelays[len(retryDelays)-1]
+}
+
+// RabbitMQBroker is a Broker backed by a RabbitMQ server.
+type RabbitMQBroker struct {
+	cfg config.RabbitMQConfig
+
+	// mu guards conn and publishCh.
+	// AMQP channels are not safe for concurrent publishing, so every
+	// publish takes the lock.
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	publishCh *amqp.Channel
+	closed    bool
+}
+
+// NewRabbitMQBroker connects to RabbitMQ and declares the topology.
+func NewRabbitMQBroker(cfg config.RabbitMQConfig) (*RabbitMQBroker, error) {
+	b := &RabbitMQBroker{cfg: cfg}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.connectLocked(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// connectLocked (re)dials the server. The caller must hold b.mu.
+func (b *RabbitMQBroker) connectLocked() error {
+	conn, err := amqp.Dial(b.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+
+	if err := declareTopology(ch, b.cfg.Exchange); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// PUBLISHER CONFIRMS:
+	// Without confirms, Publish returns as soon as the bytes are written to
+	// the socket - the server may still drop them. With confirms, the server
+	// acknowledges each message once it has been safely queued.
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	b.conn = conn
+	b.publishCh = ch
+	return nil
+}
+
+// declareTopology creates the exchange and queues if they don't exist yet.
+// Declarations are idempotent, so every process can safely run them.
+func declareTopology(ch *amqp.Channel, exchange string) error {
+	// durable=true: survive broker restarts
+	if err := ch.ExchangeDeclare(exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	if _, err := ch.QueueDeclare(QueueProcessing, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", QueueProcessing, err)
+	}
+	if err := ch.QueueBind(QueueProcessing, routingKeyPrefix+"*", exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s: %w", QueueProcessing, err)
+	}
+
+	for _, ttl := range retryDelays {
+		retryArgs := amqp.Table{
+			"x-dead-letter-exchange":    exchange,
+			"x-dead-letter-routing-key": routingKeyRetry,
+			"x-message-ttl":             ttl.Milliseconds(),
+		}
+		if _, err := ch.QueueDeclare(retryQueue(ttl), true, false, false, false, retryArgs); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", retryQueue(ttl), err)
+		}
+	}
+
+	if _, err := ch.QueueDeclare(QueueDead, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", QueueDead, err)
+	}
+	return nil
+}
+
+// =============================================================================
+// PUBLISHING
+// =============================================================================
+
+// Publish sends a message to the main queue through the exchange.
+func (b *RabbitMQBroker) Publish(ctx context.Context, msg Message) error {
+	return b.publish(ctx, b.cfg.Exchange, routingKeyPrefix+string(msg.Type), msg, amqp.Table{})
+}
+
+// PublishDelayed parks a message in the retry queue whose TTL is the
+// smallest step of at least delay.
+//
+// The empty exchange name "" is RabbitMQ's default exchange, which routes a
+// message directly to the queue named by the routing key.
+func (b *RabbitMQBroker) PublishDelayed(ctx context.Context, msg Message, delay time.Duration) error {
+	return b.publish(ctx, "", retryQueue(retryStep(delay)), msg, amqp.Table{})
+}
+
+// DeadLetter parks a message in the dead-letter queue with the failure reason.
+func (b *RabbitMQBroker) DeadLetter(ctx context.Context, msg Message, reason string) error {
+	headers := amqp.Table{"x-failure-reason": reason}
+	return b.publish(ctx, "", QueueDead, msg, headers)
+}
+
+func (b *RabbitMQBroker) publish(ctx context.Context, exchange, key string, msg Message, headers amqp.Table) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode job message: %w", err)
+	}
+
+	publishing := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent, // written to disk by the broker
+		Timestamp:    time.Now(),
+		Headers:      headers,
+		Body:         body,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.publishCh == nil || b.publishCh.IsClosed() {
+		if err := b.connectLocked(); err != nil {
+			return err
+		}
+	}
+
+	confirm, err := b.publishCh.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, publishing)
+	if err != nil {
+		return fmt.Errorf("failed to publish job message: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("jobs: broker rejected message")
+	}
+	return nil
+}
+
+// =============================================================================
+// CONSUMING
+// =============================================================================
+
+// Consume starts consuming the main queue. If the connection drops, it
+// reconnects after ReconnectDelay and keeps feeding the same channel.
+func (b *RabbitMQBroker) Consume(ctx context.Context) (<-chan Delivery, error) {
+	deliveries, err := b.openConsumer()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for {
+			b.forward(ctx, deliveries, out)
+
+			// forward returned: either we're shutting down or the
+			// connection dropped. Only the latter warrants a reconnect.
+			for {
+				if ctx.Err() != nil || b.isClosed() {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(b.cfg.ReconnectDelay):
+				}
+				if deliveries, err = b.openConsumer(); err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// openConsumer opens a dedicated channel for consuming.
+//
+// PREFETCH (QoS):
+// PrefetchCount limits how many unacknowledged messages RabbitMQ pushes to
+// this consumer. Without it, one worker could hoard thousands of messages
+// while the others sit idle.
+func (b *RabbitMQBroker) openConsumer() (<-chan amqp.Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	if b.conn == nil || b.conn.IsClosed() {
+		if err := b.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RabbitMQ channel: %w", err)
+	}
+	if err := ch.Qos(b.cfg.PrefetchCount, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	// autoAck=false: we acknowledge manually once a job is handled
+	deliveries, err := ch.Consume(QueueProcessing, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to consume %s: %w", QueueProcessing, err)
+	}
+	return deliveries, nil
+}
+
+// forward converts AMQP deliveries until the source closes or ctx ends.
+func (b *RabbitMQBroker) forward(ctx context.Context, deliveries <-chan amqp.Delivery, out chan<- Delivery) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				return
+			}
+
+			var msg Message
+			if err := json.Unmarshal(d.Body, &msg); err != nil {
+				// A message we can't decode will never succeed; drop it
+				_ = d.Nack(false, false)
+				continue
+			}
+
+			delivery := Delivery{
+				Message: msg,
+				ack:     func() error { return d.Ack(false) },
+				nack:    func(requeue bool) error { return d.Nack(false, requeue) },
+			}
+
+			select {
+			case out <- delivery:
+			case <-ctx.Done():
+				_ = d.Nack(false, true)
+				return
+			}
+		}
+	}
+}
+
+func (b *RabbitMQBroker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close closes the connection; active consumers stop.
+func (b *RabbitMQBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.conn != nil && !b.conn.IsClosed() {
+		return b.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryStep(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  time.Duration
+	}{
+		{0, time.Second},
+		{time.Second, time.Second},
+		{1500 * time.Millisecond, 2 * time.Second},
+		{40 * time.Second, time.Minute},
+		{10 * time.Minute, 10 * time.Minute},
+		{3 * time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryStep(tt.delay); got != tt.want {
+			t.Errorf("retryStep(%s) = %s, want %s", tt.delay, got, tt.want)
+		}
+	}
+	if got := retryQueue(time.Minute); got != "file-processing.retry.60s" {
+		t.Errorf("retryQueue(1m) = %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+// This file exposes the library views over HTTP.
+package library
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Handler serves the library endpoints.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a library Handler.
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the library routes on a router group.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/starred", h.Starred)
+	r.PUT("/starred/:type/:id", h.Star)
+	r.DELETE("/starred/:type/:id", h.Unstar)
+	r.GET("/recent", h.Recent)
+	r.GET("/shared-with-me", h.SharedWithMe)
+}
+
+// itemTypes maps the :type URL segment to an item type.
+var itemTypes = map[string]models.ItemType{
+	"files":   models.ItemTypeFile,
+	"folders": models.ItemTypeFolder,
+}
+
+// Starred lists the current user's starred files and folders.
+//
+// GET /starred?limit=50
+func (h *Handler) Starred(c *gin.Context) {
+	user, limit, ok := userAndLimit(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.service.Starred(c.Request.Context(), user, limit)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// Star stars a file or folder. PUT because starring twice is the same as
+// starring once.
+//
+// PUT /starred/files/:id
+// PUT /starred/folders/:id
+func (h *Handler) Star(c *gin.Context) {
+	user, itemType, itemID, ok := userAndItem(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Star(c.Request.Context(), user, itemType, itemID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Unstar removes a star.
+//
+// DELETE /starred/files/:id
+// DELETE /starred/folders/:id
+func (h *Handler) Unstar(c *gin.Context) {
+	user, itemType, itemID, ok := userAndItem(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Unstar(c.Request.Context(), user, itemType, itemID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Recent lists recently opened files.
+//
+// GET /recent?limit=50
+func (h *Handler) Recent(c *gin.Context) {
+	user, limit, ok := userAndLimit(c)
+	if !ok {
+		return
+	}
+
+	recent, err := h.service.Recent(c.Request.Context(), user, limit)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"files": recent})
+}
+
+// SharedWithMe lists files and folders other users shared with the
+// current user, directly or through a shared folder.
+//
+// GET /shared-with-me?limit=50
+func (h *Handler) SharedWithMe(c *gin.Context) {
+	user, limit, ok := userAndLimit(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.service.SharedWithMe(c.Request.Context(), user, limit)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// userAndLimit reads the current user and the optional ?limit parameter,
+// recording an error if either is missing or malformed.
+func userAndLimit(c *gin.Context) (*models.User, int, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return nil, 0, false
+	}
+
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+			_ = c.Error(apperrors.ErrBadRequest)
+			return nil, 0, false
+		}
+	}
+	return user, limit, true
+}
+
+// userAndItem reads the current user and the :type and :id parameters.
+func userAndItem(c *gin.Context) (*models.User, models.ItemType, primitive.ObjectID, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return nil, "", primitive.NilObjectID, false
+	}
+
+	itemType, ok := itemTypes[c.Param("type")]
+	if !ok {
+		_ = c.Error(apperrors.ErrNotFound)
+		return nil, "", primitive.NilObjectID, false
+	}
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return nil, "", primitive.NilObjectID, false
+	}
+	return user, itemType, itemID, true
+}
@@ -0,0 +1,139 @@
+// This file implements the recent-files feed and the access tracking that
+// drives it.
+//
+// BATCHED ACCESS TIMES:
+// Recording "last opened" with an UPDATE on every download would turn each
+// read into a write. Instead, the AccessTracker remembers accesses in a
+// map and writes them all every few seconds in one bulk write:
+//
+//	download --Record(id)--> pending[id] = now
+//	every interval:          pending --TouchAccessed--> MongoDB
+//
+// A file downloaded 500 times between flushes costs one update. The price
+// is that the feed lags by up to one interval, and accesses still in
+// memory are lost if the process crashes (a clean shutdown flushes them).
+package library
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/logger"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// defaultFlushInterval is used when NewAccessTracker gets no interval.
+const defaultFlushInterval = 30 * time.Second
+
+// shutdownFlushTimeout bounds the final flush when Run stops.
+const shutdownFlushTimeout = 10 * time.Second
+
+// AccessTracker collects file accesses and writes them to
+// File.LastAccessedAt in batches. It is safe for concurrent use.
+type AccessTracker struct {
+	files    repository.FileRepository
+	interval time.Duration
+	log      *logger.Logger
+
+	mu      sync.Mutex
+	pending map[primitive.ObjectID]time.Time
+}
+
+// NewAccessTracker creates an AccessTracker that flushes every interval
+// (defaultFlushInterval if zero). Start it with Run.
+func NewAccessTracker(files repository.FileRepository, interval time.Duration, log *logger.Logger) *AccessTracker {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return &AccessTracker{
+		files:    files,
+		interval: interval,
+		log:      log,
+		pending:  make(map[primitive.ObjectID]time.Time),
+	}
+}
+
+// Record notes that a file was read just now. It never blocks on the
+// database.
+func (t *AccessTracker) Record(fileID primitive.ObjectID) {
+	now := time.Now()
+
+	t.mu.Lock()
+	t.pending[fileID] = now
+	t.mu.Unlock()
+}
+
+// Run flushes periodically until ctx is cancelled, then flushes once more.
+func (t *AccessTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is already cancelled, so the last flush needs its own
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			t.flushAndLog(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			t.flushAndLog(ctx)
+		}
+	}
+}
+
+// Flush writes the pending accesses now.
+//
+// SWAP, THEN WRITE:
+// The map is swapped for an empty one while holding the lock, and the
+// slow database write happens after unlocking, so Record never waits for
+// MongoDB. If the write fails, the batch is merged back for the next try.
+func (t *AccessTracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = make(map[primitive.ObjectID]time.Time)
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := t.files.TouchAccessed(ctx, batch); err != nil {
+		t.mu.Lock()
+		for id, at := range batch {
+			if newer, ok := t.pending[id]; !ok || at.After(newer) {
+				t.pending[id] = at
+			}
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// flushAndLog runs Flush and logs a failure; Run has no caller to return
+// the error to.
+func (t *AccessTracker) flushAndLog(ctx context.Context) {
+	if err := t.Flush(ctx); err != nil {
+		t.log.Error().Err(err).Msg("Failed to record file access times")
+	}
+}
+
+// Recent returns the files the actor owns or that were shared with them
+// directly, most recently accessed first.
+//
+// Access times are per file, not per user: a file you own moves up when a
+// collaborator opens it too. Files reachable only through a shared folder
+// are not included; open the folder from "Shared with me" instead.
+func (s *Service) Recent(ctx context.Context, actor *models.User, limit int) ([]*models.File, error) {
+	recent, err := s.files.FindRecent(ctx, actor.ID, int64(clampLimit(limit)))
+	if err != nil {
+		return nil, err
+	}
+	if recent == nil {
+		recent = []*models.File{}
+	}
+	return recent, nil
+}
@@ -0,0 +1,134 @@
+// This file implements the "shared with me" view.
+//
+// DIRECT AND INHERITED SHARES:
+// A file can reach you two ways: its owner shared the file itself, or
+// shared a folder above it. The view combines both:
+//
+//	folders shared with you               -> one entry each
+//	files shared with you                 -> one entry each
+//	files below a folder shared with you  -> one entry each, with via_folder_id
+//
+// A file that arrives both ways is listed once, as a direct share. When
+// shared folders are nested, an inherited file names the nearest one.
+package library
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// maxSharedFiles caps how many files are loaded per source (direct shares,
+// shared folders) for one listing. A shared folder can hold far more files
+// than fit on a page.
+const maxSharedFiles = 1000
+
+// SharedItem is one entry of the "shared with me" list. Exactly one of
+// File and Folder is set, according to Type.
+type SharedItem struct {
+	Type   models.ItemType `json:"type"`
+	File   *models.File    `json:"file,omitempty"`
+	Folder *models.Folder  `json:"folder,omitempty"`
+
+	Permission models.FilePermission `json:"permission"`
+	SharedBy   primitive.ObjectID    `json:"shared_by"`
+	SharedAt   time.Time             `json:"shared_at"`
+
+	// ViaFolderID is the shared folder an inherited file was found in
+	// (nil for direct shares)
+	ViaFolderID *primitive.ObjectID `json:"via_folder_id,omitempty"`
+}
+
+// SharedWithMe lists what other users shared with the actor, most
+// recently shared first.
+func (s *Service) SharedWithMe(ctx context.Context, actor *models.User, limit int) ([]SharedItem, error) {
+	folders, err := s.access.SharedFolders(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	direct, err := s.files.FindSharedWith(ctx, actor.ID, maxSharedFiles)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := s.files.FindUnderFolders(ctx, folders, maxSharedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []SharedItem{}
+	for _, folder := range folders {
+		if share := shareFor(folder.SharedWith, actor.ID); share != nil {
+			items = append(items, sharedItem(models.ItemTypeFolder, share, nil, folder, nil))
+		}
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(direct))
+	for _, file := range direct {
+		if share := shareFor(file.SharedWith, actor.ID); share != nil {
+			items = append(items, sharedItem(models.ItemTypeFile, share, file, nil, nil))
+			seen[file.ID] = true
+		}
+	}
+	for _, file := range inherited {
+		if seen[file.ID] {
+			continue
+		}
+		folder := nearestFolder(folders, file)
+		if folder == nil {
+			continue
+		}
+		if share := shareFor(folder.SharedWith, actor.ID); share != nil {
+			items = append(items, sharedItem(models.ItemTypeFile, share, file, nil, &folder.ID))
+		}
+	}
+
+	sort.SliceStable(items, func(a, b int) bool {
+		return items[a].SharedAt.After(items[b].SharedAt)
+	})
+	if limit = clampLimit(limit); len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// sharedItem builds a SharedItem from the share entry that grants access.
+func sharedItem(itemType models.ItemType, share *models.SharedUser, file *models.File, folder *models.Folder, via *primitive.ObjectID) SharedItem {
+	return SharedItem{
+		Type:        itemType,
+		File:        file,
+		Folder:      folder,
+		Permission:  share.Permission,
+		SharedBy:    share.SharedBy,
+		SharedAt:    share.SharedAt,
+		ViaFolderID: via,
+	}
+}
+
+// shareFor finds a user's entry in a share list.
+func shareFor(shares []models.SharedUser, userID primitive.ObjectID) *models.SharedUser {
+	for n := range shares {
+		if shares[n].UserID == userID {
+			return &shares[n]
+		}
+	}
+	return nil
+}
+
+// nearestFolder returns the deepest of the folders that contains the file.
+func nearestFolder(folders []*models.Folder, file *models.File) *models.Folder {
+	var nearest *models.Folder
+	for _, folder := range folders {
+		if folder.UserID != file.UserID || !strings.HasPrefix(file.FilePath, folder.Path+"/") {
+			continue
+		}
+		if nearest == nil || len(folder.Path) > len(nearest.Path) {
+			nearest = folder
+		}
+	}
+	return nearest
+}
@@ -21,13 +21,11 @@
 package logger
 
 import (
-	"fmt"      // For formatting strings
 	"os"       // For accessing stdout/stderr
 	"time"     // For timestamps
 
 	"github.com/gin-gonic/gin"       // Gin web framework
 	"github.com/rs/zerolog"          // Zerolog is a fast, structured logging library
-	"github.com/rs/zerolog/log"      // Global logger instance
 )
 
 // =============================================================================
@@ -0,0 +1,239 @@
+// This file implements FFmpeg by running the ffmpeg and ffprobe binaries.
+//
+// LEARNING NOTES:
+// ===============
+// THE COMMANDS WE RUN:
+//
+//	ffprobe -protocol_whitelist file -v error -print_format json -show_format -show_streams in.mp4
+//	ffmpeg -ss 1.5 -protocol_whitelist file -f mov -i in.mp4 -frames:v 1 out.png
+//	ffmpeg -protocol_whitelist file -f mov -i in.mp4 -vf scale=... -c:v libx264 ... -movflags +faststart out.mp4
+//
+// UNTRUSTED INPUT:
+// The input is whatever a user uploaded. Left to autodetect, ffmpeg
+// happily treats a text file as an HLS playlist or a concat list and
+// opens every URL or path in it - a request to an internal service, or a
+// local file such as /etc/passwd copied into the "rendition". So:
+//
+//   - "-protocol_whitelist file" stops any input from reaching the network
+//   - Probe refuses the demuxers that open other inputs (unsafeContainers)
+//   - ffmpeg gets "-f <demuxer>" as probed, so it can't detect differently
+//
+// "-ss" before "-i" seeks in the input, which jumps straight to the nearest
+// keyframe instead of decoding everything up to that point.
+//
+// "+faststart" moves the MP4 index to the beginning of the file, so browsers
+// can start playing before the whole rendition has downloaded.
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLI runs ffmpeg and ffprobe as external processes.
+type CLI struct {
+	ffmpegPath  string
+	ffprobePath string
+}
+
+// NewCLI creates an FFmpeg backed by the given binaries. Plain names such
+// as "ffmpeg" are looked up in $PATH when a command runs.
+func NewCLI(ffmpegPath, ffprobePath string) *CLI {
+	return &CLI{ffmpegPath: ffmpegPath, ffprobePath: ffprobePath}
+}
+
+// unsafeContainers are demuxers that read other files or URLs named in
+// the input. Only the first name of ffprobe's format_name is compared
+// ("mov,mp4,m4a,..." -> "mov"), which is also the name "-f" takes.
+var unsafeContainers = map[string]bool{
+	"hls":        true, // .m3u8 playlists
+	"applehttp":  true, // hls in old ffmpeg versions
+	"dash":       true, // MPEG-DASH manifests
+	"concat":     true, // "file '...'" lists
+	"sdp":        true, // RTP session descriptions
+	"rtsp":       true,
+	"image2":     true, // numbered image sequences next to the input
+	"image2pipe": true,
+}
+
+// Probe runs ffprobe and extracts the fields we care about.
+func (c *CLI) Probe(ctx context.Context, inputPath string) (*VideoInfo, error) {
+	out, err := run(ctx, c.ffprobePath,
+		"-protocol_whitelist", "file",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbe(out)
+}
+
+// ExtractFrame grabs a single frame as PNG.
+func (c *CLI) ExtractFrame(ctx context.Context, inputPath string, at time.Duration, outputPath string) error {
+	container, err := c.container(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = run(ctx, c.ffmpegPath,
+		"-v", "error",
+		"-y", // overwrite the (empty) temp file we were given
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-protocol_whitelist", "file",
+		"-f", container,
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "png",
+		outputPath,
+	)
+	return err
+}
+
+// Transcode writes an H.264/AAC MP4.
+func (c *CLI) Transcode(ctx context.Context, inputPath, outputPath string, opts RenditionOptions) error {
+	// SCALE FILTER:
+	// "-2" keeps the aspect ratio and rounds the width to an even number
+	// (H.264 requires even dimensions). min(H,ih) prevents upscaling.
+	scale := fmt.Sprintf("scale=-2:'min(%d,ih)'", opts.MaxHeight)
+
+	container, err := c.container(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = run(ctx, c.ffmpegPath,
+		"-v", "error",
+		"-y",
+		"-protocol_whitelist", "file",
+		"-f", container,
+		"-i", inputPath,
+		"-vf", scale,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-b:v", fmt.Sprintf("%dk", opts.VideoKbps),
+		"-maxrate", fmt.Sprintf("%dk", opts.VideoKbps),
+		"-bufsize", fmt.Sprintf("%dk", 2*opts.VideoKbps),
+		"-pix_fmt", "yuv420p", // the only pixel format every browser decodes
+		"-c:a", "aac",
+		"-b:a", fmt.Sprintf("%dk", opts.AudioKbps),
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		outputPath,
+	)
+	return err
+}
+
+// container probes the input and returns the demuxer to pin ffmpeg to.
+//
+// WHY PROBE AGAIN?
+// ExtractFrame and Transcode only get a path, and the interface promises
+// they are safe on their own. Reading the format is cheap next to
+// decoding video.
+func (c *CLI) container(ctx context.Context, inputPath string) (string, error) {
+	info, err := c.Probe(ctx, inputPath)
+	if err != nil {
+		return "", err
+	}
+	return info.Container, nil
+}
+
+// =============================================================================
+// FFPROBE OUTPUT
+// =============================================================================
+
+// probeOutput mirrors the parts of ffprobe's JSON we read.
+//
+// NUMBERS AS STRINGS:
+// ffprobe prints duration and bit_rate as strings ("12.345000"), so those
+// fields are strings here and converted afterwards.
+type probeOutput struct {
+	Streams []struct {
+		CodecType string            `json:"codec_type"` // "video", "audio", "subtitle", ...
+		CodecName string            `json:"codec_name"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		Tags      map[string]string `json:"tags"`
+		SideData  []sideData        `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"` // "mov,mp4,m4a,3gp,3g2,mj2"
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// sideData is an entry of a stream's side_data_list.
+type sideData struct {
+	Rotation float64 `json:"rotation"`
+}
+
+// parseProbe converts ffprobe's JSON into VideoInfo.
+func parseProbe(data []byte) (*VideoInfo, error) {
+	var out probeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	container, _, _ := strings.Cut(out.Format.FormatName, ",")
+	if container == "" || unsafeContainers[container] {
+		return nil, fmt.Errorf("%w: %q", ErrUnsafeContainer, out.Format.FormatName)
+	}
+
+	info := &VideoInfo{Container: container}
+	if seconds, err := strconv.ParseFloat(out.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	if bitrate, err := strconv.ParseInt(out.Format.BitRate, 10, 64); err == nil {
+		info.Bitrate = bitrate
+	}
+
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "video":
+			if info.VideoCodec != "" {
+				continue // first video stream wins (others are often cover art)
+			}
+			info.VideoCodec = stream.CodecName
+			info.Width, info.Height = stream.Width, stream.Height
+
+			// Phones record portrait video as landscape plus a rotation
+			// flag; report the size the viewer actually sees
+			if isQuarterTurn(stream.Tags["rotate"], stream.SideData) {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		case "audio":
+			if info.AudioCodec == "" {
+				info.AudioCodec = stream.CodecName
+			}
+		}
+	}
+
+	if info.VideoCodec == "" {
+		return nil, ErrNoVideoStream
+	}
+	return info, nil
+}
+
+// isQuarterTurn reports whether the rotation metadata is ±90 or ±270 degrees.
+// Older ffprobe versions use a "rotate" tag, newer ones a display matrix.
+func isQuarterTurn(rotateTag string, entries []sideData) bool {
+	degrees := 0
+	if rotateTag != "" {
+		degrees, _ = strconv.Atoi(rotateTag)
+	}
+	for _, sd := range entries {
+		if sd.Rotation != 0 {
+			degrees = int(sd.Rotation)
+		}
+	}
+	return degrees%180 != 0
+}
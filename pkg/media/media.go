@@ -0,0 +1,130 @@
+// Package media wraps external media tools: ffmpeg/ffprobe for video,
+// poppler (pdftoppm/pdfinfo) for PDFs and LibreOffice for office documents.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Running external programs with os/exec
+// 2. exec.CommandContext, which kills the process when the context ends
+// 3. Decoding a program's JSON output into Go structs
+// 4. Hiding a binary behind an interface so callers can use a stub
+//
+// WHY SHELL OUT INSTEAD OF A GO LIBRARY?
+// Decoding video means supporting hundreds of codecs and containers, and
+// rendering a Word document means reimplementing Word. These tools already
+// do that, are installed everywhere, and are far faster than anything we
+// could write. The price is a process per operation and
+// having to parse its output - both fine for background jobs.
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// stderrLimit caps how much of a tool's stderr we keep for error messages
+const stderrLimit = 2048
+
+// ErrNoVideoStream means the input has no video track (e.g. an audio-only
+// file with a video/* MIME type). Retrying won't change that.
+var ErrNoVideoStream = errors.New("media: no video stream found")
+
+// ErrUnsafeContainer means ffprobe detected a format that makes ffmpeg
+// open other files or URLs named inside the input, such as an HLS
+// playlist or a concat list. Retrying won't change that either.
+var ErrUnsafeContainer = errors.New("media: input refers to other files or URLs")
+
+// VideoInfo is what we learn about a video by probing it.
+type VideoInfo struct {
+	Duration   time.Duration // Playback length
+	Width      int           // Display width in pixels (after rotation)
+	Height     int           // Display height in pixels (after rotation)
+	VideoCodec string        // e.g. "h264", "hevc", "vp9"
+	AudioCodec string        // e.g. "aac", "opus" ("" if there's no audio)
+	Bitrate    int64         // Overall bitrate in bits per second (0 if unknown)
+	Container  string        // Demuxer ffprobe detected, e.g. "mov", "matroska"
+}
+
+// RenditionOptions describes a transcoded copy.
+type RenditionOptions struct {
+	MaxHeight int // Scale down to at most this height (never up)
+	VideoKbps int // Target video bitrate in kilobits per second
+	AudioKbps int // Target audio bitrate in kilobits per second
+}
+
+// FFmpeg is the subset of ffmpeg/ffprobe functionality we use.
+//
+// All methods work on local file paths: video containers such as MP4 may
+// keep their index at the end of the file, so ffmpeg needs to seek.
+type FFmpeg interface {
+	// Probe reads duration, resolution and codecs.
+	Probe(ctx context.Context, inputPath string) (*VideoInfo, error)
+
+	// ExtractFrame writes the frame at the given offset as a PNG image.
+	ExtractFrame(ctx context.Context, inputPath string, at time.Duration, outputPath string) error
+
+	// Transcode writes a web-friendly H.264/AAC MP4 rendition.
+	Transcode(ctx context.Context, inputPath, outputPath string, opts RenditionOptions) error
+}
+
+// PDFInfo is the document information of a PDF.
+type PDFInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Creator  string // Application that created the original document
+	Producer string // Library that wrote the PDF
+	Pages    int
+}
+
+// PDFRenderer reads and renders PDF documents.
+type PDFRenderer interface {
+	// Info returns the page count and document information.
+	Info(ctx context.Context, inputPath string) (*PDFInfo, error)
+
+	// RenderPage writes one page (1-based) as a PNG scaled to the given
+	// width, keeping the aspect ratio.
+	RenderPage(ctx context.Context, inputPath string, page, width int, outputPath string) error
+
+	// ExtractText returns the plain text of the first maxPages pages.
+	ExtractText(ctx context.Context, inputPath string, maxPages int) (string, error)
+}
+
+// DocumentConverter converts office documents (Word, Excel, PowerPoint,
+// OpenDocument) to PDF, so they can be previewed like any other PDF.
+type DocumentConverter interface {
+	// ConvertToPDF writes a PDF into outputDir and returns its path.
+	ConvertToPDF(ctx context.Context, inputPath, outputDir string) (string, error)
+}
+
+// run executes a binary and returns its stdout.
+//
+// EXEC SAFETY:
+// exec.Command passes each argument directly to the program - there is no
+// shell in between - so file names with spaces or quotes can't inject
+// extra commands.
+func run(ctx context.Context, binary string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, binary, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// The context error is more useful than "signal: killed"
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: %w", binary, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > stderrLimit {
+			msg = msg[:stderrLimit]
+		}
+		return nil, fmt.Errorf("%s failed: %w: %s", binary, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+// This file implements DocumentConverter with LibreOffice.
+//
+// LEARNING NOTES:
+// ===============
+// LibreOffice can run without a window ("headless") and convert documents
+// from the command line:
+//
+//	soffice --headless --convert-to pdf --outdir /tmp/out report.docx
+//
+// It writes /tmp/out/report.pdf - same base name, new extension.
+//
+// ONE PROFILE PER RUN:
+// LibreOffice keeps a user profile and refuses to start a second instance
+// on the same profile. Workers convert in parallel, so every run gets its
+// own throwaway profile directory.
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LibreOffice converts documents with the soffice binary.
+type LibreOffice struct {
+	sofficePath string
+}
+
+// NewLibreOffice creates a DocumentConverter backed by soffice.
+func NewLibreOffice(sofficePath string) *LibreOffice {
+	return &LibreOffice{sofficePath: sofficePath}
+}
+
+// ConvertToPDF converts inputPath and returns the path of the PDF.
+func (l *LibreOffice) ConvertToPDF(ctx context.Context, inputPath, outputDir string) (string, error) {
+	profile, err := os.MkdirTemp("", "soffice-profile-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(profile)
+
+	_, err = run(ctx, l.sofficePath,
+		"-env:UserInstallation=file://"+filepath.ToSlash(profile),
+		"--headless",
+		"--norestore",
+		"--convert-to", "pdf",
+		"--outdir", outputDir,
+		inputPath,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	output := filepath.Join(outputDir, base+".pdf")
+
+	// soffice exits with 0 even when it couldn't read the input
+	if _, err := os.Stat(output); err != nil {
+		return "", fmt.Errorf("soffice produced no PDF for %s", filepath.Base(inputPath))
+	}
+	return output, nil
+}
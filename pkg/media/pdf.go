@@ -0,0 +1,125 @@
+// This file implements PDFRenderer with poppler's command-line tools.
+//
+// LEARNING NOTES:
+// ===============
+// THE COMMANDS WE RUN:
+//
+//	pdfinfo -enc UTF-8 in.pdf
+//	pdftoppm -png -f 2 -l 2 -scale-to-x 1024 -scale-to-y -1 -singlefile in.pdf out
+//	pdftotext -enc UTF-8 -l 50 in.pdf -
+//
+// -f/-l select the first and last page, so one call renders one page.
+// -singlefile makes pdftoppm write exactly "out.png" instead of adding a
+// page number suffix whose zero-padding depends on the page count.
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Poppler renders PDFs with pdftoppm, reads page counts with pdfinfo and
+// extracts text with pdftotext.
+type Poppler struct {
+	pdftoppmPath  string
+	pdfinfoPath   string
+	pdftotextPath string
+}
+
+// NewPoppler creates a PDFRenderer backed by the given binaries.
+func NewPoppler(pdftoppmPath, pdfinfoPath, pdftotextPath string) *Poppler {
+	return &Poppler{pdftoppmPath: pdftoppmPath, pdfinfoPath: pdfinfoPath, pdftotextPath: pdftotextPath}
+}
+
+// Info parses pdfinfo's "Key: value" lines.
+//
+//	Title:          Quarterly Report
+//	Author:         Jane Doe
+//	Pages:          12
+func (p *Poppler) Info(ctx context.Context, inputPath string) (*PDFInfo, error) {
+	// -enc UTF-8: titles with accents or CJK characters come out intact
+	out, err := run(ctx, p.pdfinfoPath, "-enc", "UTF-8", inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return parsePDFInfo(out)
+}
+
+// parsePDFInfo extracts the fields we use from pdfinfo output.
+func parsePDFInfo(out []byte) (*PDFInfo, error) {
+	info := &PDFInfo{}
+	foundPages := false
+
+	lines := bufio.NewScanner(bytes.NewReader(out))
+	for lines.Scan() {
+		key, value, found := strings.Cut(lines.Text(), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Title":
+			info.Title = value
+		case "Author":
+			info.Author = value
+		case "Subject":
+			info.Subject = value
+		case "Creator":
+			info.Creator = value
+		case "Producer":
+			info.Producer = value
+		case "Pages":
+			pages, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid page count %q", value)
+			}
+			info.Pages, foundPages = pages, true
+		}
+	}
+
+	if !foundPages {
+		return nil, fmt.Errorf("pdfinfo output has no page count")
+	}
+	return info, nil
+}
+
+// RenderPage renders a single page to PNG.
+func (p *Poppler) RenderPage(ctx context.Context, inputPath string, page, width int, outputPath string) error {
+	// pdftoppm appends ".png" to the output root itself
+	root := strings.TrimSuffix(outputPath, ".png")
+	pageArg := strconv.Itoa(page)
+
+	_, err := run(ctx, p.pdftoppmPath,
+		"-png",
+		"-f", pageArg,
+		"-l", pageArg,
+		"-scale-to-x", strconv.Itoa(width),
+		"-scale-to-y", "-1", // -1 = keep the aspect ratio
+		"-singlefile",
+		inputPath,
+		root,
+	)
+	return err
+}
+
+// ExtractText runs pdftotext and returns what it printed.
+//
+// The output file "-" means stdout, so no temp file is needed. Scanned PDFs
+// (pages that are just images) have no text layer and yield "".
+func (p *Poppler) ExtractText(ctx context.Context, inputPath string, maxPages int) (string, error) {
+	out, err := run(ctx, p.pdftotextPath,
+		"-enc", "UTF-8",
+		"-l", strconv.Itoa(maxPages),
+		inputPath,
+		"-",
+	)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
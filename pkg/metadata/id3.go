@@ -0,0 +1,309 @@
+// This file parses ID3 tags (title, artist, album...) of MP3 files.
+//
+// LEARNING NOTES:
+// ===============
+// ID3 comes in two unrelated versions:
+//
+// ID3v1: the last 128 bytes of the file, fixed-width fields.
+//
+//	"TAG" | title(30) | artist(30) | album(30) | year(4) | comment(30) | genre(1)
+//
+// ID3v2: a block at the start of the file made of "frames":
+//
+//	header:  "ID3" | major | revision | flags | size(4, syncsafe)
+//	frame:   id(4) e.g. "TIT2" | size(4) | flags(2) | data
+//
+// SYNCSAFE INTEGERS:
+// MP3 players look for the byte 0xFF to find audio frames. To never emit it
+// by accident, ID3v2 stores sizes in 4 bytes using only the low 7 bits of
+// each byte: 0x00 0x00 0x02 0x01 means (2 << 7) | 1 = 257.
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// ID3v1Size is the size of an ID3v1 tag at the end of a file.
+const ID3v1Size = 128
+
+// maxID3v2Size caps how much of an ID3v2 tag we read into memory.
+// Tags with embedded cover art can be several megabytes.
+const maxID3v2Size = 16 << 20
+
+// ErrNoID3 means there is no (supported) ID3 tag.
+var ErrNoID3 = errors.New("metadata: no ID3 tag")
+
+// textFrames maps ID3v2 frame IDs to what they contain.
+var textFrames = map[string]string{
+	"TIT2": "title",
+	"TPE1": "artist",
+	"TALB": "album",
+	"TCON": "genre",
+	"TRCK": "track",
+	"TYER": "year", // ID3v2.3
+	"TDRC": "year", // ID3v2.4 (recording time, "2019-05-01")
+}
+
+// ReadID3v2 reads an ID3v2.3 or v2.4 tag from the start of r. It consumes
+// exactly the tag, so r is positioned at the audio data afterwards.
+func ReadID3v2(r io.Reader) (*models.AudioMetadata, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrNoID3
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, ErrNoID3
+	}
+	major, flags := header[3], header[5]
+	if major != 3 && major != 4 {
+		return nil, ErrNoID3 // v2.2 uses 3-letter frame IDs; too old to bother
+	}
+
+	size := syncsafe(header[6:10])
+	body := make([]byte, min(size, maxID3v2Size))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if size > maxID3v2Size {
+		// Skip the part we didn't keep so the caller is past the tag
+		if _, err := io.CopyN(io.Discard, r, int64(size-maxID3v2Size)); err != nil {
+			return nil, err
+		}
+	}
+
+	// UNSYNCHRONISATION (flag 0x80) inserts 0x00 after every 0xFF. Old
+	// writers set it on the whole tag; undoing it is enough for text frames.
+	if flags&0x80 != 0 {
+		body = bytes.ReplaceAll(body, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+
+	// EXTENDED HEADER (flag 0x40): skip it. Its size field excludes itself
+	// in v2.3 but includes itself in v2.4.
+	if flags&0x40 != 0 && len(body) >= 4 {
+		skip := int(binary.BigEndian.Uint32(body[:4])) + 4
+		if major == 4 {
+			skip = syncsafe(body[:4])
+		}
+		if skip > len(body) {
+			return nil, ErrNoID3
+		}
+		body = body[skip:]
+	}
+
+	values := make(map[string]string)
+	for len(body) >= 10 {
+		id := string(body[:4])
+		if body[0] == 0 {
+			break // padding
+		}
+
+		frameSize := int(binary.BigEndian.Uint32(body[4:8]))
+		if major == 4 {
+			frameSize = syncsafe(body[4:8])
+		}
+		frameFlags := binary.BigEndian.Uint16(body[8:10])
+		if frameSize < 0 || 10+frameSize > len(body) {
+			break // truncated or corrupt; keep what we have
+		}
+		data := body[10 : 10+frameSize]
+		body = body[10+frameSize:]
+
+		field, wanted := textFrames[id]
+		if !wanted || values[field] != "" || frameIsUnreadable(major, frameFlags) {
+			continue
+		}
+		if major == 4 && frameFlags&0x0001 != 0 && len(data) >= 4 {
+			data = data[4:] // data length indicator
+		}
+		values[field] = decodeText(data)
+	}
+
+	if len(values) == 0 {
+		return nil, ErrNoID3
+	}
+	return audioMetadata(values), nil
+}
+
+// ParseID3v1 parses the 128-byte ID3v1 tag from the end of a file.
+func ParseID3v1(tail []byte) (*models.AudioMetadata, error) {
+	if len(tail) < ID3v1Size {
+		return nil, ErrNoID3
+	}
+	tag := tail[len(tail)-ID3v1Size:]
+	if string(tag[:3]) != "TAG" {
+		return nil, ErrNoID3
+	}
+
+	values := map[string]string{
+		"title":  latin1(tag[3:33]),
+		"artist": latin1(tag[33:63]),
+		"album":  latin1(tag[63:93]),
+		"year":   latin1(tag[93:97]),
+	}
+	// ID3v1.1 steals the last comment byte for the track number,
+	// marked by a zero byte right before it
+	if comment := tag[97:127]; comment[28] == 0 && comment[29] != 0 {
+		values["track"] = strconv.Itoa(int(comment[29]))
+	}
+	return audioMetadata(values), nil
+}
+
+// MergeAudio fills empty fields of primary from fallback. ID3v2 wins; ID3v1
+// only fills gaps.
+func MergeAudio(primary, fallback *models.AudioMetadata) *models.AudioMetadata {
+	switch {
+	case primary == nil:
+		return fallback
+	case fallback == nil:
+		return primary
+	}
+
+	merged := *primary
+	if merged.Title == "" {
+		merged.Title = fallback.Title
+	}
+	if merged.Artist == "" {
+		merged.Artist = fallback.Artist
+	}
+	if merged.Album == "" {
+		merged.Album = fallback.Album
+	}
+	if merged.Genre == "" {
+		merged.Genre = fallback.Genre
+	}
+	if merged.Year == 0 {
+		merged.Year = fallback.Year
+	}
+	if merged.Track == 0 {
+		merged.Track = fallback.Track
+	}
+	return &merged
+}
+
+// audioMetadata converts raw text values into the typed struct.
+func audioMetadata(values map[string]string) *models.AudioMetadata {
+	meta := &models.AudioMetadata{
+		Title:  values["title"],
+		Artist: values["artist"],
+		Album:  values["album"],
+		Genre:  values["genre"],
+	}
+
+	// "2019-05-01" (v2.4) or "2019" -> 2019
+	if year := values["year"]; len(year) >= 4 {
+		meta.Year, _ = strconv.Atoi(year[:4])
+	}
+	// "3/12" (track 3 of 12) -> 3
+	if track, _, _ := strings.Cut(values["track"], "/"); track != "" {
+		meta.Track, _ = strconv.Atoi(strings.TrimSpace(track))
+	}
+	return meta
+}
+
+// frameIsUnreadable reports compressed or encrypted frames.
+func frameIsUnreadable(major byte, flags uint16) bool {
+	if major == 3 {
+		return flags&0x00C0 != 0 // compression, encryption
+	}
+	return flags&0x000C != 0 // v2.4: compression, encryption
+}
+
+// decodeText decodes a text frame: one encoding byte, then the text.
+//
+//	0 = ISO-8859-1   1 = UTF-16 with BOM   2 = UTF-16BE   3 = UTF-8
+//
+// v2.4 may hold several NUL-separated values; we keep the first.
+func decodeText(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	var text string
+	switch data[0] {
+	case 0:
+		text = latin1(data[1:])
+	case 1:
+		text = utf16String(data[1:], true)
+	case 2:
+		text = utf16String(data[1:], false)
+	default:
+		text = string(data[1:])
+	}
+
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
+
+// latin1 converts ISO-8859-1 bytes to a Go (UTF-8) string. Each byte is
+// exactly the Unicode code point with the same number.
+func latin1(data []byte) string {
+	data, _, _ = bytes.Cut(data, []byte{0})
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// utf16String decodes UTF-16, optionally reading the byte order from a BOM
+// (0xFF 0xFE = little endian, 0xFE 0xFF = big endian).
+func utf16String(data []byte, hasBOM bool) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if hasBOM && len(data) >= 2 {
+		if data[0] == 0xFF && data[1] == 0xFE {
+			order = binary.LittleEndian
+		}
+		data = data[2:]
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// syncsafe decodes a 4-byte syncsafe integer.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// TailBuffer is an io.Writer that remembers only the last n bytes written.
+// Copying a file into it reads the ID3v1 tag without holding the file in
+// memory.
+type TailBuffer struct {
+	buf []byte
+	n   int
+}
+
+// NewTailBuffer creates a TailBuffer keeping the last n bytes.
+func NewTailBuffer(n int) *TailBuffer {
+	return &TailBuffer{buf: make([]byte, 0, 2*n), n: n}
+}
+
+// Write appends p, discarding everything but the last n bytes.
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	if len(p) >= t.n {
+		t.buf = append(t.buf[:0], p[len(p)-t.n:]...)
+		return len(p), nil
+	}
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.n {
+		// Shift the kept bytes to the front; buf never grows past 2n
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.n:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns the remembered tail.
+func (t *TailBuffer) Bytes() []byte {
+	return t.buf
+}
@@ -0,0 +1,300 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+func TestReadID3v2(t *testing.T) {
+	longTitle := strings.Repeat("x", 200) // frame size >= 128 is syncsafe in v2.4
+
+	tests := []struct {
+		name    string
+		tag     []byte
+		want    *models.AudioMetadata
+		wantErr error
+	}{
+		{
+			name: "v2.3 latin-1",
+			tag: id3Tag(3, 0,
+				frame3("TIT2", latin1Text("Caf\xe9")),
+				frame3("TPE1", latin1Text("Artist")),
+				frame3("TALB", latin1Text("Album")),
+				frame3("TCON", latin1Text("Jazz")),
+				frame3("TYER", latin1Text("1999")),
+				frame3("TRCK", latin1Text("3/12")),
+			),
+			want: &models.AudioMetadata{Title: "Café", Artist: "Artist", Album: "Album", Genre: "Jazz", Year: 1999, Track: 3},
+		},
+		{
+			name: "v2.3 UTF-16 with little endian BOM",
+			tag:  id3Tag(3, 0, frame3("TIT2", utf16Text("Ünïcode"))),
+			want: &models.AudioMetadata{Title: "Ünïcode"},
+		},
+		{
+			name: "v2.4 UTF-8 with recording time and syncsafe frame size",
+			tag: id3Tag(4, 0,
+				frame4("TIT2", 0, utf8Text(longTitle)),
+				frame4("TDRC", 0, utf8Text("2019-05-01")),
+			),
+			want: &models.AudioMetadata{Title: longTitle, Year: 2019},
+		},
+		{
+			name: "v2.4 keeps the first of several values",
+			tag:  id3Tag(4, 0, frame4("TPE1", 0, utf8Text("One\x00Two"))),
+			want: &models.AudioMetadata{Artist: "One"},
+		},
+		{
+			name: "v2.4 data length indicator",
+			tag:  id3Tag(4, 0, frame4("TIT2", 0x0001, append([]byte{0, 0, 0, 6}, utf8Text("Title")...))),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name: "unsynchronised tag",
+			tag:  unsynchronise(id3Tag(3, 0, frame3("TIT2", latin1Text("a\xffb")))),
+			want: &models.AudioMetadata{Title: "aÿb"},
+		},
+		{
+			name: "v2.3 extended header excludes its own size",
+			tag:  id3Tag(3, 0x40, []byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0}, frame3("TIT2", latin1Text("Title"))),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name: "v2.4 extended header includes its own size",
+			tag:  id3Tag(4, 0x40, []byte{0, 0, 0, 6, 1, 0}, frame4("TIT2", 0, utf8Text("Title"))),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name:    "extended header larger than the tag",
+			tag:     id3Tag(3, 0x40, []byte{0, 0, 0x10, 0}),
+			wantErr: ErrNoID3,
+		},
+		{
+			name: "truncated frame keeps what came before",
+			tag: id3Tag(3, 0,
+				frame3("TIT2", latin1Text("Title")),
+				frame3("TPE1", latin1Text("Artist"))[:14],
+			),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name: "padding ends the frames",
+			tag:  id3Tag(3, 0, frame3("TIT2", latin1Text("Title")), make([]byte, 32)),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name: "compressed and encrypted frames are skipped",
+			tag: id3Tag(3, 0,
+				frame3Flags("TIT2", 0x0080, latin1Text("Compressed")),
+				frame3Flags("TPE1", 0x0040, latin1Text("Encrypted")),
+				frame3("TALB", latin1Text("Album")),
+			),
+			want: &models.AudioMetadata{Album: "Album"},
+		},
+		{
+			name:    "no wanted frames",
+			tag:     id3Tag(3, 0, frame3("COMM", latin1Text("comment"))),
+			wantErr: ErrNoID3,
+		},
+		{
+			name:    "v2.2",
+			tag:     id3Tag(2, 0, []byte("TT2\x00\x00\x06\x00Title")),
+			wantErr: ErrNoID3,
+		},
+		{
+			name:    "not a tag",
+			tag:     []byte("\xff\xfb\x90\x00 plain MPEG audio"),
+			wantErr: ErrNoID3,
+		},
+		{
+			name:    "shorter than a header",
+			tag:     []byte("ID3"),
+			wantErr: ErrNoID3,
+		},
+		{
+			name:    "body shorter than the header says",
+			tag:     id3Tag(3, 0, frame3("TIT2", latin1Text("Title")))[:15],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := []byte("audio")
+			r := bytes.NewReader(append(append([]byte{}, tt.tag...), audio...))
+
+			got, err := ReadID3v2(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadID3v2() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadID3v2() error = %v", err)
+			}
+			if *got != *tt.want {
+				t.Fatalf("ReadID3v2() = %+v, want %+v", *got, *tt.want)
+			}
+
+			rest, _ := io.ReadAll(r)
+			if !bytes.Equal(rest, audio) {
+				t.Fatalf("reader left at %q, want the audio right after the tag", rest)
+			}
+		})
+	}
+}
+
+func TestParseID3v1(t *testing.T) {
+	tests := []struct {
+		name    string
+		tail    []byte
+		want    *models.AudioMetadata
+		wantErr error
+	}{
+		{
+			name: "v1.1 with track number",
+			tail: id3v1("Title", "Artist", "Album", "2001", "comment", 7),
+			want: &models.AudioMetadata{Title: "Title", Artist: "Artist", Album: "Album", Year: 2001, Track: 7},
+		},
+		{
+			name: "v1.0 comment fills the track byte",
+			tail: id3v1("Title", "", "", "", strings.Repeat("c", 30), 0),
+			want: &models.AudioMetadata{Title: "Title"},
+		},
+		{
+			name: "latin-1 and padding",
+			tail: id3v1("Gar\xe7on  ", "", "", "", "", 0),
+			want: &models.AudioMetadata{Title: "Garçon"},
+		},
+		{
+			name: "tag at the end of more data",
+			tail: append([]byte("audio"), id3v1("Title", "", "", "", "", 1)...),
+			want: &models.AudioMetadata{Title: "Title", Track: 1},
+		},
+		{
+			name:    "no TAG marker",
+			tail:    make([]byte, ID3v1Size),
+			wantErr: ErrNoID3,
+		},
+		{
+			name:    "too short",
+			tail:    []byte("TAG"),
+			wantErr: ErrNoID3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseID3v1(tt.tail)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseID3v1() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseID3v1() error = %v", err)
+			}
+			if *got != *tt.want {
+				t.Fatalf("ParseID3v1() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+// FuzzReadID3v2 feeds arbitrary bytes to both parsers. Uploads are
+// untrusted, so whatever they contain must not panic.
+func FuzzReadID3v2(f *testing.F) {
+	f.Add(id3Tag(3, 0, frame3("TIT2", latin1Text("Title")), frame3("TRCK", latin1Text("3/12"))))
+	f.Add(id3Tag(4, 0x40, []byte{0, 0, 0, 6, 1, 0}, frame4("TIT2", 0x0001, append([]byte{0, 0, 0, 6}, utf8Text("Title")...))))
+	f.Add(unsynchronise(id3Tag(3, 0, frame3("TIT2", utf16Text("ÿÿ")))))
+	f.Add(id3Tag(3, 0x40, []byte{0xff, 0xff, 0xff, 0xff}))
+	f.Add(id3v1("Title", "Artist", "Album", "2001", "", 7))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = ReadID3v2(bytes.NewReader(data))
+		_, _ = ParseID3v1(data)
+	})
+}
+
+// =============================================================================
+// TAG BUILDERS
+// =============================================================================
+
+// id3Tag builds an ID3v2 tag around the given extended header and frames.
+func id3Tag(major, flags byte, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	header := append([]byte{'I', 'D', '3', major, 0, flags}, syncsafeBytes(len(body))...)
+	return append(header, body...)
+}
+
+// frame3 builds a v2.3 frame, whose size is a plain big endian integer.
+func frame3(id string, data []byte) []byte {
+	return frame3Flags(id, 0, data)
+}
+
+func frame3Flags(id string, flags uint16, data []byte) []byte {
+	header := make([]byte, 10)
+	copy(header, id)
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(data)))
+	binary.BigEndian.PutUint16(header[8:10], flags)
+	return append(header, data...)
+}
+
+// frame4 builds a v2.4 frame, whose size is syncsafe.
+func frame4(id string, flags uint16, data []byte) []byte {
+	header := make([]byte, 10)
+	copy(header, id)
+	copy(header[4:8], syncsafeBytes(len(data)))
+	binary.BigEndian.PutUint16(header[8:10], flags)
+	return append(header, data...)
+}
+
+// syncsafeBytes encodes n as a 4-byte syncsafe integer.
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// unsynchronise applies tag-wide unsynchronisation to a built tag: it sets
+// the flag, puts a 0x00 after every 0xFF of the body and fixes the size.
+func unsynchronise(tag []byte) []byte {
+	body := bytes.ReplaceAll(tag[10:], []byte{0xFF}, []byte{0xFF, 0x00})
+	return id3Tag(tag[3], tag[5]|0x80, body)
+}
+
+// latin1Text, utf16Text and utf8Text encode a text frame's content.
+func latin1Text(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+func utf16Text(s string) []byte {
+	data := []byte{1, 0xFF, 0xFE}
+	for _, r := range s {
+		data = binary.LittleEndian.AppendUint16(data, uint16(r))
+	}
+	return data
+}
+
+func utf8Text(s string) []byte {
+	return append([]byte{3}, s...)
+}
+
+// id3v1 builds a 128-byte ID3v1 tag; a non-zero track makes it v1.1.
+func id3v1(title, artist, album, year, comment string, track byte) []byte {
+	tag := make([]byte, ID3v1Size)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	copy(tag[97:127], comment)
+	if track != 0 {
+		tag[125], tag[126] = 0, track
+	}
+	return tag
+}
@@ -0,0 +1,100 @@
+// This file reads image dimensions and EXIF camera data.
+//
+// LEARNING NOTES:
+// ===============
+// image.DecodeConfig reads only the header of an image - enough for width,
+// height and format - without decoding any pixels. It's cheap even for
+// huge images.
+//
+// EXIF is a block of tagged values that cameras embed in JPEG (and some
+// HEIC/WebP) files: camera make and model, capture time, GPS position and
+// dozens more. We use github.com/rwcarlsen/goexif to parse it.
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+
+	// Register decoders with image.DecodeConfig (see pkg/processing/image.go)
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// ErrNoExif means the image carries no EXIF block.
+var ErrNoExif = errors.New("metadata: no EXIF data")
+
+// ReadImage returns the dimensions and format of an image.
+func ReadImage(data []byte) (*models.ImageMetadata, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &models.ImageMetadata{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+}
+
+// ReadExif extracts camera information from an image's EXIF block.
+//
+// EXIF tags are all optional, so every field is read independently: a
+// missing lens model must not lose us the capture time.
+func ReadExif(data []byte) (*models.ExifMetadata, error) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNoExif
+	}
+
+	meta := &models.ExifMetadata{
+		CameraMake:  exifString(x, exif.Make),
+		CameraModel: exifString(x, exif.Model),
+		LensModel:   exifString(x, exif.LensModel),
+	}
+
+	// DateTime prefers DateTimeOriginal (shutter press) over DateTime
+	// (last edit). EXIF has no time zone; goexif assumes local time.
+	if takenAt, err := x.DateTime(); err == nil && !takenAt.IsZero() {
+		meta.TakenAt = &takenAt
+	}
+
+	if lat, lon, err := x.LatLong(); err == nil && validCoordinates(lat, lon) {
+		meta.Location = &models.GeoPoint{Latitude: lat, Longitude: lon}
+	}
+
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if value, err := tag.Int(0); err == nil && value >= 1 && value <= 8 {
+			meta.Orientation = value
+		}
+	}
+
+	return meta, nil
+}
+
+// exifString returns a string tag, trimmed, or "" if absent.
+// Cameras often pad values with spaces or NUL bytes.
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(strings.TrimSpace(value), "\x00")
+}
+
+// validCoordinates rejects out-of-range positions and the (0, 0) that some
+// cameras write when they had no GPS fix.
+func validCoordinates(lat, lon float64) bool {
+	if lat == 0 && lon == 0 {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
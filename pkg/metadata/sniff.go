@@ -0,0 +1,147 @@
+// Package metadata extracts descriptive information from file content:
+// the real MIME type, image dimensions, EXIF and ID3 tags.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Content sniffing with http.DetectContentType
+// 2. Parsing binary formats with encoding/binary
+// 3. Pure functions over io.Reader / []byte that are easy to test
+//
+// NO STORAGE, NO DATABASE:
+// Everything here works on bytes handed in by the caller. The processing
+// job (pkg/processing) decides what to read from storage and where to save
+// the results; this package only knows file formats.
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SniffLength is how many leading bytes DetectMimeType looks at.
+const SniffLength = 512
+
+// DetectMimeType guesses the MIME type from the first bytes of a file.
+//
+// HOW SNIFFING WORKS:
+// Most formats start with a fixed signature ("magic number"): PNG files
+// begin with "\x89PNG", PDFs with "%PDF-", ZIPs with "PK\x03\x04".
+// http.DetectContentType implements the WHATWG sniffing algorithm that
+// browsers use, so we classify files the way a browser would.
+func DetectMimeType(head []byte) string {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	if isWindowsExecutable(head) {
+		return "application/vnd.microsoft.portable-executable"
+	}
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return sig.mimeType
+		}
+	}
+	return baseType(http.DetectContentType(head))
+}
+
+// isWindowsExecutable checks for a PE file (.exe, .dll).
+//
+// "MZ" alone is too weak - a text file may start with those letters - so we
+// also follow the pointer at offset 0x3C to the "PE\0\0" signature.
+func isWindowsExecutable(head []byte) bool {
+	if len(head) < 0x40 || !bytes.HasPrefix(head, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(head[0x3C:]))
+	return offset >= 0x40 && offset+4 <= len(head) && string(head[offset:offset+4]) == "PE\x00\x00"
+}
+
+// executableSignatures are checked before the browser algorithm, which
+// deliberately doesn't recognize programs (browsers never run them). For us
+// they are exactly the files that must not pose as documents or images.
+var executableSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},           // Linux
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"}, // macOS (64-bit)
+}
+
+// zipContainers are formats that are ZIP files on the inside. Sniffing can
+// only tell "application/zip", which is correct for all of them.
+var zipContainers = map[string]bool{
+	"application/zip": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/epub+zip":     true,
+	"application/java-archive": true,
+}
+
+// aliases maps non-standard MIME types clients send to the standard ones.
+var aliases = map[string]string{
+	"image/jpg":         "image/jpeg",
+	"image/pjpeg":       "image/jpeg",
+	"audio/mp3":         "audio/mpeg",
+	"audio/x-wav":       "audio/wave",
+	"audio/wav":         "audio/wave",
+	"application/x-pdf": "application/pdf",
+}
+
+// IsMimeMismatch reports whether the declared MIME type contradicts the
+// detected one.
+//
+// Sniffing knows fewer formats than clients declare, so only real
+// contradictions count: "we couldn't tell" or "it's a ZIP, and a .docx is a
+// ZIP" are not mismatches; "the .png is actually a Windows executable" is.
+func IsMimeMismatch(declared, detected string) bool {
+	declared, detected = normalize(declared), normalize(detected)
+
+	switch {
+	case detected == "" || detected == "application/octet-stream":
+		return false // unknown content, nothing to contradict
+	case declared == detected:
+		return false
+	case detected == "application/zip" && zipContainers[declared]:
+		return false
+	case detected == "text/plain" && isTextual(declared):
+		return false // CSV, JSON, Markdown... all sniff as plain text
+	case detected == "text/xml" && (declared == "application/xml" || strings.HasSuffix(declared, "+xml")):
+		return false
+	default:
+		return true
+	}
+}
+
+// isTextual returns true for declared types whose content is plain text.
+func isTextual(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") ||
+		mimeType == "application/json" ||
+		mimeType == "application/xml" ||
+		mimeType == "application/javascript" ||
+		strings.HasSuffix(mimeType, "+json") ||
+		strings.HasSuffix(mimeType, "+xml")
+}
+
+// normalize lowercases, strips parameters and resolves aliases.
+func normalize(mimeType string) string {
+	base := baseType(mimeType)
+	if alias, ok := aliases[base]; ok {
+		return alias
+	}
+	return base
+}
+
+// baseType strips parameters: "text/plain; charset=utf-8" -> "text/plain".
+func baseType(mimeType string) string {
+	if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return base
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
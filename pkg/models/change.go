@@ -0,0 +1,86 @@
+// This file defines the Change model (one entry of a user's change feed).
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. An append-only journal: entries are written once and never updated
+// 2. A per-user sequence number as a resumable position ("cursor")
+//
+// WHY A SEQUENCE NUMBER AND NOT A TIMESTAMP?
+// Two changes can share a timestamp, and clocks of different servers
+// disagree. A counter that grows by exactly one per change gives every
+// change a unique place, and "everything after 41" can't skip or repeat
+// one - even a gap is detectable (see pkg/changes).
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChangeType says what happened to an item.
+type ChangeType string
+
+// Change type constants
+const (
+	ChangeCreated  ChangeType = "created"  // New item (upload, copy, new folder)
+	ChangeUpdated  ChangeType = "updated"  // New content (a new version)
+	ChangeMoved    ChangeType = "moved"    // New path (moved or renamed, also by moving a parent)
+	ChangeDeleted  ChangeType = "deleted"  // Moved to the trash or purged
+	ChangeRestored ChangeType = "restored" // Taken back out of the trash
+	ChangeShared   ChangeType = "shared"   // Sharing changed; for a new recipient, the item appeared
+	ChangeUnshared ChangeType = "unshared" // No longer shared with the journal's user
+)
+
+// Change is one entry of a user's change journal.
+//
+// MONGODB COLLECTION: changes
+// Unique index on { user_id, seq }; entries expire after 30 days (see
+// scripts/init-mongo.js).
+type Change struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID primitive.ObjectID `bson:"user_id" json:"-"`
+
+	// Seq is the change's position in the user's journal: 1, 2, 3, ...
+	Seq int64 `bson:"seq" json:"seq"`
+
+	Type     ChangeType         `bson:"type" json:"type"`
+	ItemType ItemType           `bson:"item_type" json:"item_type"`
+	ItemID   primitive.ObjectID `bson:"item_id" json:"item_id"`
+
+	// Path is where the item is after the change; OldPath where it was
+	// before a move
+	Path    string `bson:"path" json:"path"`
+	OldPath string `bson:"old_path,omitempty" json:"old_path,omitempty"`
+
+	// Files only: the content after the change
+	Version  int    `bson:"version,omitempty" json:"version,omitempty"`
+	Checksum string `bson:"checksum,omitempty" json:"checksum,omitempty"`
+	Size     int64  `bson:"size,omitempty" json:"size,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// NewFileChange creates a change about a file, not yet in any journal.
+func NewFileChange(changeType ChangeType, file *File) *Change {
+	return &Change{
+		Type:     changeType,
+		ItemType: ItemTypeFile,
+		ItemID:   file.ID,
+		Path:     file.FilePath,
+		Version:  file.Version,
+		Checksum: file.Checksum,
+		Size:     file.FileSize,
+	}
+}
+
+// NewFolderChange creates a change about a folder, not yet in any journal.
+func NewFolderChange(changeType ChangeType, folder *Folder) *Change {
+	return &Change{
+		Type:     changeType,
+		ItemType: ItemTypeFolder,
+		ItemID:   folder.ID,
+		Path:     folder.Path,
+	}
+}
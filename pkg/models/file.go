@@ -63,6 +63,74 @@ const (
 	UploadAborted    UploadStatus = "aborted"     // Upload cancelled
 )
 
+// Thumbnail describes one generated preview image of a file.
+//
+// Size is the configured width (e.g. 300 from THUMBNAIL_SIZES). Width and
+// Height are the real pixel dimensions: a 200px-wide original gets a 200px
+// "300" thumbnail, because we never upscale.
+type Thumbnail struct {
+	Size        int    `bson:"size" json:"size"`                 // Requested width
+	Width       int    `bson:"width" json:"width"`               // Actual width in pixels
+	Height      int    `bson:"height" json:"height"`             // Actual height in pixels
+	S3Key       string `bson:"s3_key" json:"-"`                  // Storage key (internal)
+	ContentType string `bson:"content_type" json:"content_type"` // image/jpeg or image/png
+	FileSize    int64  `bson:"file_size" json:"file_size"`       // Size in bytes
+}
+
+// CompressedCopy is a pre-compressed copy of a file's content.
+//
+// CONTENT-ENCODING:
+// When a client sends "Accept-Encoding: zstd, gzip", we can send these bytes
+// as-is with "Content-Encoding: zstd" and the client decompresses them
+// transparently. The user always sees the original file.
+//
+// Version ties the copy to the file version it was made from. A copy whose
+// version doesn't match File.Version is stale and must not be served.
+type CompressedCopy struct {
+	Encoding string `bson:"encoding"`  // "gzip" or "zstd"
+	S3Key    string `bson:"s3_key"`    // Storage key of the compressed bytes
+	FileSize int64  `bson:"file_size"` // Compressed size in bytes
+	Version  int    `bson:"version"`   // File version it was made from
+}
+
+// Rendition is a transcoded copy of a video for playback in browsers.
+//
+// Originals come in every codec and bitrate imaginable (HEVC from phones,
+// 100 Mbit/s from cameras). A rendition is H.264/AAC in MP4 at a modest
+// bitrate, which every browser can play while it streams.
+type Rendition struct {
+	Name        string `bson:"name" json:"name"`                 // e.g. "720p"
+	Width       int    `bson:"width" json:"width"`               // Pixel width
+	Height      int    `bson:"height" json:"height"`             // Pixel height
+	S3Key       string `bson:"s3_key" json:"-"`                  // Storage key (internal)
+	ContentType string `bson:"content_type" json:"content_type"` // Always video/mp4 for now
+	FileSize    int64  `bson:"file_size" json:"file_size"`       // Size in bytes
+	Version     int    `bson:"version" json:"version"`           // File version it was made from
+}
+
+// DocumentPreview lets users look at a document without downloading it.
+//
+// PDFs and office documents get images of their first pages; text files
+// get a snippet of their first lines. Version ties the preview to the file
+// version it was made from (see CompressedCopy).
+type DocumentPreview struct {
+	Pages     []PreviewPage `bson:"pages,omitempty" json:"pages,omitempty"`           // Rendered pages, in order
+	PageCount int           `bson:"page_count,omitempty" json:"page_count,omitempty"` // Total pages in the document
+	Snippet   string        `bson:"snippet,omitempty" json:"snippet,omitempty"`       // Start of a text file
+	Truncated bool          `bson:"truncated,omitempty" json:"truncated,omitempty"`   // Snippet is not the whole text
+	Version   int           `bson:"version" json:"version"`                           // File version it was made from
+}
+
+// PreviewPage is one rendered page of a document.
+type PreviewPage struct {
+	Page        int    `bson:"page" json:"page"`                 // 1-based page number
+	Width       int    `bson:"width" json:"width"`               // Pixel width
+	Height      int    `bson:"height" json:"height"`             // Pixel height
+	S3Key       string `bson:"s3_key" json:"-"`                  // Storage key (internal)
+	ContentType string `bson:"content_type" json:"content_type"` // image/jpeg
+	FileSize    int64  `bson:"file_size" json:"file_size"`       // Size in bytes
+}
+
 // FilePermission represents sharing permissions.
 type FilePermission string
 
@@ -182,18 +250,37 @@ type File struct {
 
 	// ThumbnailURL is the URL of the generated thumbnail (for images/videos)
 	// nil if no thumbnail exists
+	//
+	// Deprecated: a single URL can't describe several sizes; use Thumbnails.
 	ThumbnailURL *string `bson:"thumbnail_url,omitempty" json:"thumbnail_url,omitempty"`
 
+	// Thumbnails lists every generated thumbnail, smallest first
+	// Empty until the thumbnail job has run
+	Thumbnails []Thumbnail `bson:"thumbnails,omitempty" json:"thumbnails,omitempty"`
+
 	// CompressedURL is the URL of the compressed version
 	// nil if not compressed or compression not applicable
+	//
+	// Deprecated: use CompressedCopies; downloads pick a copy automatically.
 	CompressedURL *string `bson:"compressed_url,omitempty" json:"compressed_url,omitempty"`
 
+	// CompressedCopies are pre-compressed copies of the content (gzip, zstd)
+	// Only copies that actually save space are kept
+	CompressedCopies []CompressedCopy `bson:"compressed_copies,omitempty" json:"-"`
+
+	// Renditions are web-friendly transcodes of a video (see Rendition)
+	Renditions []Rendition `bson:"renditions,omitempty" json:"renditions,omitempty"`
+
+	// Preview holds rendered pages or a text snippet of a document
+	Preview *DocumentPreview `bson:"preview,omitempty" json:"preview,omitempty"`
+
 	// Metadata stores file-specific metadata
 	// For images: width, height, format
 	// For videos: duration, codec, resolution
 	// For documents: page count, author
 	// This is a flexible map that can store any key-value pairs
 	// interface{} means "any type"
+	// Keys are namespaces with a fixed schema; see metadata.go
 	Metadata map[string]interface{} `bson:"metadata,omitempty" json:"metadata,omitempty"`
 
 	// -------------------------------------------------------------------------
@@ -215,6 +302,10 @@ type File struct {
 	// See UploadStatus constants above
 	UploadStatus UploadStatus `bson:"upload_status" json:"upload_status"`
 
+	// Resumable holds the state of an unfinished resumable (tus) upload
+	// nil once the upload is complete
+	Resumable *ResumableUpload `bson:"resumable,omitempty" json:"-"`
+
 	// -------------------------------------------------------------------------
 	// SHARING AND PERMISSIONS
 	// -------------------------------------------------------------------------
@@ -236,6 +327,39 @@ type File struct {
 	// nil if file is not public
 	PublicURL *string `bson:"public_url,omitempty" json:"public_url,omitempty"`
 
+	// TagIDs are the user-defined tags on this file (see tag.go)
+	// They mix the tags of everyone who can read the file, so they are
+	// never serialized; each user gets their own via GET /files/:id/tags
+	TagIDs []primitive.ObjectID `bson:"tag_ids,omitempty" json:"-"`
+
+	// -------------------------------------------------------------------------
+	// RETENTION AND LEGAL HOLD
+	// -------------------------------------------------------------------------
+	// See retention.go. Folders can carry the same settings; a lock on a
+	// folder protects every file beneath it.
+
+	// Retention makes the file immutable until a date
+	// nil means no retention lock was ever set
+	Retention *RetentionLock `bson:"retention,omitempty" json:"retention,omitempty"`
+
+	// LegalHold freezes the file until the hold is released
+	// nil means no legal hold
+	LegalHold *LegalHold `bson:"legal_hold,omitempty" json:"legal_hold,omitempty"`
+
+	// -------------------------------------------------------------------------
+	// VIRUS SCANNING
+	// -------------------------------------------------------------------------
+	// See scan.go. Scanning runs before any other processing.
+
+	// Scan is the result of the latest virus scan (nil if never scanned)
+	Scan *ScanResult `bson:"scan,omitempty" json:"scan,omitempty"`
+
+	// Quarantine is set while the file is blocked because of a detection
+	Quarantine *Quarantine `bson:"quarantine,omitempty" json:"quarantine,omitempty"`
+
+	// QuarantineRelease records who released the file from quarantine, if anyone
+	QuarantineRelease *QuarantineRelease `bson:"quarantine_release,omitempty" json:"quarantine_release,omitempty"`
+
 	// -------------------------------------------------------------------------
 	// TIMESTAMPS
 	// -------------------------------------------------------------------------
@@ -243,6 +367,11 @@ type File struct {
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 
+	// ContentUpdatedAt is when the current version's content was stored.
+	// Unlike UpdatedAt it doesn't move when workers add thumbnails or
+	// metadata, or the file is renamed or shared (see LastModified)
+	ContentUpdatedAt time.Time `bson:"content_updated_at,omitempty" json:"content_updated_at"`
+
 	// DeletedAt is for soft delete (nil = not deleted)
 	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 
@@ -287,6 +416,46 @@ type UploadChunk struct {
 	Size int64 `bson:"size" json:"size"`
 }
 
+// ResumableUpload is the state of an unfinished resumable upload, kept
+// between the requests that send its content.
+//
+// WHY A TAIL?
+// Clients send chunks of any size, but S3 parts must be at least 5 MiB
+// (except the last). Bytes that don't fill a part yet are parked as a
+// separate object (TailKey) and sent with the next chunk.
+type ResumableUpload struct {
+	// Offset is how many bytes have been received: the uploaded chunks
+	// plus the tail
+	Offset int64 `bson:"offset"`
+
+	// TailKey is the object holding received bytes not yet in a part
+	// ("" if there are none)
+	TailKey string `bson:"tail_key,omitempty"`
+
+	// HashState is the serialized SHA-256 state over the first Offset
+	// bytes, so File.Checksum is known when the last byte arrives
+	HashState []byte `bson:"hash_state"`
+
+	// Conflict is the conflict policy to apply when the upload completes
+	Conflict string `bson:"conflict,omitempty"`
+
+	// ExpiresAt is when an unfinished upload is given up and cleaned up
+	ExpiresAt time.Time `bson:"expires_at"`
+
+	// LockedUntil is set while a request is writing a chunk, so two
+	// requests can't append at the same offset
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+}
+
+// UploadedBytes returns the size of the chunks uploaded so far.
+func (f *File) UploadedBytes() int64 {
+	var total int64
+	for _, chunk := range f.Chunks {
+		total += chunk.Size
+	}
+	return total
+}
+
 // SharedUser represents a user with whom a file is shared.
 //
 // SHARING MODEL:
@@ -376,6 +545,32 @@ func (f *File) CanCompress() bool {
 	return f.IsDocument() || f.MimeType == "text/plain" || f.MimeType == "application/json"
 }
 
+// PreviewPageFor returns the rendered page with the given number if it
+// belongs to the current version, or nil.
+func (f *File) PreviewPageFor(page int) *PreviewPage {
+	if f.Preview == nil || f.Preview.Version != f.Version {
+		return nil
+	}
+	for i := range f.Preview.Pages {
+		if f.Preview.Pages[i].Page == page {
+			return &f.Preview.Pages[i]
+		}
+	}
+	return nil
+}
+
+// CompressedCopyFor returns the up-to-date compressed copy with the given
+// encoding, or nil if there is none.
+func (f *File) CompressedCopyFor(encoding string) *CompressedCopy {
+	for i := range f.CompressedCopies {
+		c := &f.CompressedCopies[i]
+		if c.Encoding == encoding && c.Version == f.Version {
+			return c
+		}
+	}
+	return nil
+}
+
 // IsSharedWith checks if the file is shared with a specific user.
 //
 // PARAMETERS:
@@ -420,6 +615,44 @@ func (f *File) GetPermission(userID primitive.ObjectID) (FilePermission, bool) {
 	return "", false
 }
 
+// IsLocked returns true if the file's own retention lock or legal hold
+// currently prevents it from being deleted or overwritten.
+//
+// NOTE: This only looks at the file itself. Locks inherited from parent
+// folders are resolved by the retention package, which can load folders.
+func (f *File) IsLocked(now time.Time) bool {
+	return f.Retention.IsActive(now) || f.LegalHold != nil
+}
+
+// LastModified returns when the file's content last changed, for the
+// Last-Modified header. Files stored before ContentUpdatedAt existed fall
+// back to UpdatedAt, which is never earlier than the content.
+func (f *File) LastModified() time.Time {
+	if f.ContentUpdatedAt.IsZero() {
+		return f.UpdatedAt
+	}
+	return f.ContentUpdatedAt
+}
+
+// IsQuarantined returns true if the file's content must not be served.
+func (f *File) IsQuarantined() bool {
+	return f.Quarantine != nil
+}
+
+// PlaceIn puts the file into a folder (nil = top level), updating FolderID
+// and FilePath to match. It doesn't save anything; see pkg/paths for
+// resolving and creating folders from a path.
+func (f *File) PlaceIn(folder *Folder) {
+	if folder == nil {
+		f.FolderID = nil
+		f.FilePath = "/" + f.FileName
+		return
+	}
+	folderID := folder.ID
+	f.FolderID = &folderID
+	f.FilePath = folder.Path + "/" + f.FileName
+}
+
 // AddChunk adds an uploaded chunk to the tracking list.
 //
 // USAGE:
@@ -490,6 +723,7 @@ func NewFile(userID primitive.ObjectID, fileName string, fileSize int64, mimeTyp
 		PublicURL:        nil,
 		CreatedAt:        now,
 		UpdatedAt:        now,
+		ContentUpdatedAt: now,
 		DeletedAt:        nil,
 		LastAccessedAt:   nil,
 	}
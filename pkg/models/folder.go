@@ -76,10 +76,21 @@ type Folder struct {
 	// Example: "folder-documents", "folder-photos", "folder-work"
 	Icon string `bson:"icon,omitempty" json:"icon,omitempty"`
 
+	// TagIDs are the user-defined tags on this folder (see tag.go)
+	// Never serialized, like File.TagIDs
+	TagIDs []primitive.ObjectID `bson:"tag_ids,omitempty" json:"-"`
+
 	// SharedWith is a list of users this folder is shared with
 	// Sharing a folder shares all files and subfolders within it
 	SharedWith []SharedUser `bson:"shared_with,omitempty" json:"shared_with,omitempty"`
 
+	// Retention locks every file and subfolder in this folder until a date
+	// See retention.go for governance vs compliance mode
+	Retention *RetentionLock `bson:"retention,omitempty" json:"retention,omitempty"`
+
+	// LegalHold freezes every file and subfolder in this folder
+	LegalHold *LegalHold `bson:"legal_hold,omitempty" json:"legal_hold,omitempty"`
+
 	// Timestamps
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
@@ -157,6 +168,12 @@ func (f *Folder) GetParentPath() string {
 	return f.Path[:lastSlash]
 }
 
+// IsLocked returns true if the folder's retention lock or legal hold is in
+// effect. A locked folder protects everything beneath it.
+func (f *Folder) IsLocked(now time.Time) bool {
+	return f.Retention.IsActive(now) || f.LegalHold != nil
+}
+
 // IsSharedWith checks if the folder is shared with a specific user.
 func (f *Folder) IsSharedWith(userID primitive.ObjectID) bool {
 	for _, shared := range f.SharedWith {
@@ -0,0 +1,179 @@
+// This file defines the ProcessingJob model for background file processing.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. A state machine stored in the database
+// 2. Retry bookkeeping (attempt counters, next run time)
+// 3. Flexible payloads with map[string]interface{}
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =============================================================================
+// JOB TYPES AND STATES
+// =============================================================================
+
+// JobType identifies what a job does (e.g. "thumbnail", "virus_scan").
+// Each job type has exactly one handler registered with the worker pool.
+type JobType string
+
+// JobStatus represents where a job is in its lifecycle.
+//
+// STATE MACHINE:
+//
+//	queued --> running --> completed
+//	   ^          |
+//	   +--retry---+
+//	              |
+//	              +--> dead (max attempts reached)
+type JobStatus string
+
+// Job status constants
+const (
+	JobQueued    JobStatus = "queued"    // Waiting for a worker (first try or retry)
+	JobRunning   JobStatus = "running"   // A worker is executing it
+	JobCompleted JobStatus = "completed" // Finished successfully
+	JobDead      JobStatus = "dead"      // Failed too many times, moved to dead-letter
+)
+
+// Job priority constants
+//
+// Higher numbers run first when jobs are picked from the database
+// (see the job_status_priority_idx index in init-mongo.js).
+const (
+	JobPriorityLow    = 0
+	JobPriorityNormal = 5
+	JobPriorityHigh   = 10
+)
+
+// DefaultJobMaxAttempts is used when a job is created without an explicit limit
+const DefaultJobMaxAttempts = 5
+
+// =============================================================================
+// PROCESSING JOB MODEL
+// =============================================================================
+
+// JobProgress reports how far a long-running job has got, for jobs that
+// work through many items (e.g. copying a folder tree).
+type JobProgress struct {
+	Total  int64 `bson:"total" json:"total"`   // Items to process
+	Done   int64 `bson:"done" json:"done"`     // Items processed so far
+	Failed int64 `bson:"failed" json:"failed"` // Items skipped because of an error
+	Bytes  int64 `bson:"bytes" json:"bytes"`   // Bytes processed so far
+}
+
+// ProcessingJob represents one unit of background work on a file.
+//
+// Some jobs work on more than one file (copying a folder tree). They have
+// no FileID and keep their parameters in Payload instead.
+//
+// WHY STORE JOBS IN MONGODB IF WE HAVE RABBITMQ?
+// RabbitMQ is great at delivering messages, but it's a poor place to answer
+// questions like "what happened to the thumbnail for this file?" or "how many
+// jobs failed today?". The message only carries the job ID; the document in
+// processing_jobs is the source of truth for status, attempts and errors.
+type ProcessingJob struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// Type selects the handler that runs this job
+	Type JobType `bson:"type" json:"type"`
+
+	// FileID is the file being processed
+	// NilObjectID for jobs that aren't about a single file
+	FileID primitive.ObjectID `bson:"file_id" json:"file_id"`
+
+	// FileVersion is the version of the file the job was enqueued for.
+	// The file's processing status is derived from the jobs of its
+	// current version only (see jobs.Pool).
+	FileVersion int `bson:"file_version,omitempty" json:"file_version,omitempty"`
+
+	// UserID is the owner of the file (for notifications and auditing)
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+
+	// Status is the current state (see the state machine above)
+	Status JobStatus `bson:"status" json:"status"`
+
+	// Priority orders jobs; higher runs first
+	Priority int `bson:"priority" json:"priority"`
+
+	// Payload holds job-specific parameters
+	// Example for a thumbnail job: {"sizes": [128, 512]}
+	Payload map[string]interface{} `bson:"payload,omitempty" json:"payload,omitempty"`
+
+	// Progress is reported by handlers of long-running jobs (nil otherwise)
+	Progress *JobProgress `bson:"progress,omitempty" json:"progress,omitempty"`
+
+	// Result holds what a finished job produced, for jobs that produce
+	// something other than changes to a file (e.g. a built archive)
+	Result map[string]interface{} `bson:"result,omitempty" json:"result,omitempty"`
+
+	// =========================================================================
+	// RETRY BOOKKEEPING
+	// =========================================================================
+
+	// Attempts counts how many times a worker has started this job
+	Attempts int `bson:"attempts" json:"attempts"`
+
+	// MaxAttempts is the limit after which the job is dead-lettered
+	MaxAttempts int `bson:"max_attempts" json:"max_attempts"`
+
+	// LastError is the error message of the most recent failed attempt
+	LastError string `bson:"last_error,omitempty" json:"last_error,omitempty"`
+
+	// NextRunAt is when a retried job becomes eligible again (nil if not retrying)
+	NextRunAt *time.Time `bson:"next_run_at,omitempty" json:"next_run_at,omitempty"`
+
+	// LeaseUntil is when a running job's claim expires unless its worker
+	// renews it. A running job past its lease was abandoned by a crashed
+	// worker and may be claimed again.
+	LeaseUntil *time.Time `bson:"lease_until,omitempty" json:"-"`
+
+	// =========================================================================
+	// TIMESTAMPS
+	// =========================================================================
+
+	QueuedAt    time.Time  `bson:"queued_at" json:"queued_at"`
+	StartedAt   *time.Time `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	UpdatedAt   time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// =============================================================================
+// METHODS
+// =============================================================================
+
+// IsFinished returns true if the job will never run again.
+func (j *ProcessingJob) IsFinished() bool {
+	return j.Status == JobCompleted || j.Status == JobDead
+}
+
+// HasAttemptsLeft returns true if a failed job may be retried.
+func (j *ProcessingJob) HasAttemptsLeft() bool {
+	return j.Attempts < j.MaxAttempts
+}
+
+// =============================================================================
+// CONSTRUCTOR
+// =============================================================================
+
+// NewProcessingJob creates a queued job for a file.
+func NewProcessingJob(jobType JobType, fileID, userID primitive.ObjectID, payload map[string]interface{}) *ProcessingJob {
+	now := time.Now()
+	return &ProcessingJob{
+		ID:          primitive.NewObjectID(),
+		Type:        jobType,
+		FileID:      fileID,
+		UserID:      userID,
+		Status:      JobQueued,
+		Priority:    JobPriorityNormal,
+		Payload:     payload,
+		MaxAttempts: DefaultJobMaxAttempts,
+		QueuedAt:    now,
+		UpdatedAt:   now,
+	}
+}
@@ -0,0 +1,122 @@
+// This file defines the schema of File.Metadata.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Giving a free-form map a documented structure
+// 2. Round-tripping between typed structs and BSON documents
+//
+// NAMESPACES:
+// File.Metadata is a map so that new kinds of metadata don't need a schema
+// migration. To keep it predictable, every top-level key is a namespace
+// owned by one extractor, and each namespace holds one of the structs below:
+//
+//	metadata.content  ContentMetadata  (every file)
+//	metadata.image    ImageMetadata    (images)
+//	metadata.exif     ExifMetadata     (photos with EXIF)
+//	metadata.audio    AudioMetadata    (MP3s with ID3 tags)
+//	metadata.pdf      PDFMetadata      (PDFs)
+//	metadata.video    VideoMetadata    (videos)
+//
+// In MongoDB that becomes nested documents, so a query can target
+// "metadata.exif.camera_model" or "metadata.pdf.author" directly.
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Metadata namespaces (top-level keys of File.Metadata)
+const (
+	MetadataContent = "content"
+	MetadataImage   = "image"
+	MetadataExif    = "exif"
+	MetadataAudio   = "audio"
+	MetadataPDF     = "pdf"
+	MetadataVideo   = "video"
+)
+
+// ContentMetadata describes what the bytes really are.
+//
+// MIME MISMATCH:
+// MimeType comes from the client, which may be wrong or lying (an .exe
+// uploaded as image/png). DetectedMimeType is sniffed from the content.
+// MimeMismatch flags files where the two disagree, for review or filtering.
+type ContentMetadata struct {
+	DetectedMimeType string `bson:"detected_mime_type" json:"detected_mime_type"`
+	MimeMismatch     bool   `bson:"mime_mismatch" json:"mime_mismatch"`
+}
+
+// ImageMetadata holds the basic properties of an image.
+type ImageMetadata struct {
+	Width  int    `bson:"width" json:"width"`
+	Height int    `bson:"height" json:"height"`
+	Format string `bson:"format" json:"format"` // "jpeg", "png", "gif", "webp"
+}
+
+// GeoPoint is a position in decimal degrees (WGS 84, like GPS).
+type GeoPoint struct {
+	Latitude  float64 `bson:"latitude" json:"latitude"`
+	Longitude float64 `bson:"longitude" json:"longitude"`
+}
+
+// ExifMetadata holds camera information from a photo's EXIF block.
+type ExifMetadata struct {
+	CameraMake  string     `bson:"camera_make,omitempty" json:"camera_make,omitempty"`
+	CameraModel string     `bson:"camera_model,omitempty" json:"camera_model,omitempty"`
+	LensModel   string     `bson:"lens_model,omitempty" json:"lens_model,omitempty"`
+	TakenAt     *time.Time `bson:"taken_at,omitempty" json:"taken_at,omitempty"` // When the photo was captured
+	Location    *GeoPoint  `bson:"location,omitempty" json:"location,omitempty"` // Where (if GPS was on)
+	Orientation int        `bson:"orientation,omitempty" json:"orientation,omitempty"`
+}
+
+// AudioMetadata holds ID3 tags of an audio file.
+type AudioMetadata struct {
+	Title  string `bson:"title,omitempty" json:"title,omitempty"`
+	Artist string `bson:"artist,omitempty" json:"artist,omitempty"`
+	Album  string `bson:"album,omitempty" json:"album,omitempty"`
+	Genre  string `bson:"genre,omitempty" json:"genre,omitempty"`
+	Year   int    `bson:"year,omitempty" json:"year,omitempty"`
+	Track  int    `bson:"track,omitempty" json:"track,omitempty"`
+}
+
+// PDFMetadata holds the document information dictionary of a PDF.
+type PDFMetadata struct {
+	Title     string `bson:"title,omitempty" json:"title,omitempty"`
+	Author    string `bson:"author,omitempty" json:"author,omitempty"`
+	Subject   string `bson:"subject,omitempty" json:"subject,omitempty"`
+	Creator   string `bson:"creator,omitempty" json:"creator,omitempty"`   // Authoring application
+	Producer  string `bson:"producer,omitempty" json:"producer,omitempty"` // PDF library
+	PageCount int    `bson:"page_count" json:"page_count"`
+}
+
+// VideoMetadata holds the properties ffprobe reports for a video.
+type VideoMetadata struct {
+	DurationSeconds float64 `bson:"duration_seconds" json:"duration_seconds"`
+	Width           int     `bson:"width" json:"width"`
+	Height          int     `bson:"height" json:"height"`
+	VideoCodec      string  `bson:"video_codec" json:"video_codec"`
+	AudioCodec      string  `bson:"audio_codec,omitempty" json:"audio_codec,omitempty"`
+	Bitrate         int64   `bson:"bitrate,omitempty" json:"bitrate,omitempty"`
+}
+
+// DecodeMetadata decodes one metadata namespace into out (a pointer to one
+// of the structs above). It returns false if the namespace isn't set.
+//
+// WHY MARSHAL AND UNMARSHAL?
+// Freshly extracted values are structs, but values loaded from MongoDB are
+// generic documents (primitive.M). Encoding to BSON and decoding into the
+// struct handles both the same way.
+func (f *File) DecodeMetadata(namespace string, out interface{}) (bool, error) {
+	value, ok := f.Metadata[namespace]
+	if !ok || value == nil {
+		return false, nil
+	}
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	return true, bson.Unmarshal(data, out)
+}
@@ -0,0 +1,58 @@
+// This file defines the Notification model (messages shown to a user).
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. A simple "inbox" document with a read flag
+// 2. Optional references to other documents via pointer ObjectIDs
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationType categorizes notifications so clients can pick an icon
+// or decide whether to also send an email.
+type NotificationType string
+
+// Notification type constants
+const (
+	NotificationFileQuarantined NotificationType = "file_quarantined" // Virus scanner flagged a file
+	NotificationFileReleased    NotificationType = "file_released"    // Admin released a quarantined file
+	NotificationFilePurged      NotificationType = "file_purged"      // Admin permanently deleted a quarantined file
+)
+
+// Notification is a message for one user.
+//
+// MONGODB COLLECTION: notifications
+// Indexed by { user_id, read, created_at } (see scripts/init-mongo.js).
+type Notification struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+
+	Type    NotificationType `bson:"type" json:"type"`
+	Title   string           `bson:"title" json:"title"`
+	Message string           `bson:"message" json:"message"`
+
+	// FileID links the notification to a file, if it is about one
+	FileID *primitive.ObjectID `bson:"file_id,omitempty" json:"file_id,omitempty"`
+
+	Read      bool      `bson:"read" json:"read"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// NewFileNotification creates an unread notification about a file.
+func NewFileNotification(notificationType NotificationType, file *File, title, message string) *Notification {
+	fileID := file.ID
+	return &Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    file.UserID,
+		Type:      notificationType,
+		Title:     title,
+		Message:   message,
+		FileID:    &fileID,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,73 @@
+// This file defines the OutboxEntry model (a domain event waiting to be
+// published).
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. The transactional outbox: events stored next to the data they describe
+// 2. Leases: claiming a document for a while instead of locking it
+//
+// WHY NOT PUBLISH STRAIGHT TO RABBITMQ?
+// "Write to MongoDB, then publish" loses the event when the broker is down
+// or the process dies in between. "Publish, then write" announces changes
+// that may never happen. Writing the event into MongoDB - in the same
+// transaction as the change - makes both happen or neither. A relay
+// publishes outbox entries afterwards, retrying until the broker takes them
+// (see pkg/events/outbox.go).
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxStatus is where an entry is on its way to the broker.
+type OutboxStatus string
+
+// Outbox status constants
+const (
+	OutboxPending   OutboxStatus = "pending"   // Not published yet (or a publish failed)
+	OutboxPublished OutboxStatus = "published" // The broker confirmed it
+	OutboxFailed    OutboxStatus = "failed"    // Can't be decoded; kept for inspection, never retried
+)
+
+// OutboxEntry is one event in the outbox.
+//
+// MONGODB COLLECTION: events_outbox
+// Published entries expire after 7 days (see scripts/init-mongo.js).
+type OutboxEntry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+
+	// EventID and EventType are copied out of Body for inspection in the
+	// shell; the relay only needs Body
+	EventID   string `bson:"event_id" json:"event_id"`
+	EventType string `bson:"event_type" json:"event_type"`
+	Body      string `bson:"body" json:"body"` // The event as JSON
+
+	Status OutboxStatus `bson:"status" json:"status"`
+
+	// AvailableAt is when a relay may (again) claim the entry. Claiming
+	// moves it into the future, so a relay that dies mid-publish only
+	// delays the entry instead of blocking it.
+	AvailableAt time.Time `bson:"available_at" json:"available_at"`
+	Attempts    int       `bson:"attempts" json:"attempts"`
+	LastError   string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	PublishedAt *time.Time `bson:"published_at,omitempty" json:"published_at,omitempty"`
+}
+
+// NewOutboxEntry creates a pending entry for an encoded event.
+func NewOutboxEntry(eventID, eventType, body string) *OutboxEntry {
+	now := time.Now()
+	return &OutboxEntry{
+		ID:          primitive.NewObjectID(),
+		EventID:     eventID,
+		EventType:   eventType,
+		Body:        body,
+		Status:      OutboxPending,
+		AvailableAt: now,
+		CreatedAt:   now,
+	}
+}
@@ -0,0 +1,145 @@
+// This file defines retention locks and legal holds (object lock) for files
+// and folders.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Compliance-driven immutability (WORM: write once, read many)
+// 2. Optional nested structs using pointers (nil = "not set")
+// 3. Time comparisons with time.Time
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =============================================================================
+// RETENTION MODES
+// =============================================================================
+// A retention lock makes an item immutable until a given date. Nothing can
+// delete it, overwrite it, prune its versions or purge it from the trash while
+// the lock is active.
+//
+// There are two modes, modelled after S3 Object Lock:
+//
+//   GOVERNANCE: Protects against accidental deletion by regular users.
+//               An administrator can still lift or shorten the lock.
+//
+//   COMPLIANCE: Nobody - not even an administrator - can lift or shorten
+//               the lock. It can only be extended. It expires on its own.
+// =============================================================================
+
+// RetentionMode is the strictness of a retention lock.
+type RetentionMode string
+
+// Retention mode constants
+const (
+	RetentionGovernance RetentionMode = "governance" // Admins may lift early
+	RetentionCompliance RetentionMode = "compliance" // Nobody may lift early
+)
+
+// IsValid returns true if the mode is one of the known retention modes.
+func (m RetentionMode) IsValid() bool {
+	return m == RetentionGovernance || m == RetentionCompliance
+}
+
+// RetentionLock prevents an item from being deleted or overwritten until
+// RetainUntil has passed.
+//
+// WHY A POINTER ON THE PARENT STRUCT?
+// File.Retention is *RetentionLock. A nil pointer means "no lock was ever
+// set", which keeps the document small (omitempty) and makes the check cheap.
+type RetentionLock struct {
+	// Mode is governance or compliance (see constants above)
+	Mode RetentionMode `bson:"mode" json:"mode"`
+
+	// RetainUntil is when the lock expires
+	// After this moment the item behaves like any other item again
+	RetainUntil time.Time `bson:"retain_until" json:"retain_until"`
+
+	// SetBy is who placed (or last extended) the lock
+	SetBy primitive.ObjectID `bson:"set_by" json:"set_by"`
+
+	// SetAt is when the lock was placed (or last extended)
+	SetAt time.Time `bson:"set_at" json:"set_at"`
+}
+
+// IsActive returns true if the lock has not expired yet.
+//
+// NIL RECEIVER:
+// Methods with pointer receivers can be called on a nil pointer.
+// This lets callers write file.Retention.IsActive(now) without a nil check.
+func (r *RetentionLock) IsActive(now time.Time) bool {
+	return r != nil && now.Before(r.RetainUntil)
+}
+
+// IsCompliance returns true if the lock is in compliance mode.
+func (r *RetentionLock) IsCompliance() bool {
+	return r != nil && r.Mode == RetentionCompliance
+}
+
+// LegalHold freezes an item indefinitely, independent of any retention date.
+//
+// LEGAL HOLD vs RETENTION:
+// - Retention has an end date, legal hold does not
+// - A legal hold stays until it is explicitly released
+// - Both can be set on the same item; either one blocks deletion
+type LegalHold struct {
+	// Reason is a free-form note, e.g. a case or ticket reference
+	Reason string `bson:"reason,omitempty" json:"reason,omitempty"`
+
+	// SetBy is who placed the hold
+	SetBy primitive.ObjectID `bson:"set_by" json:"set_by"`
+
+	// SetAt is when the hold was placed
+	SetAt time.Time `bson:"set_at" json:"set_at"`
+}
+
+// NewRetentionLock creates a retention lock placed by the given user.
+func NewRetentionLock(mode RetentionMode, retainUntil time.Time, setBy primitive.ObjectID) *RetentionLock {
+	return &RetentionLock{
+		Mode:        mode,
+		RetainUntil: retainUntil,
+		SetBy:       setBy,
+		SetAt:       time.Now(),
+	}
+}
+
+// NewLegalHold creates a legal hold placed by the given user.
+func NewLegalHold(reason string, setBy primitive.ObjectID) *LegalHold {
+	return &LegalHold{
+		Reason: reason,
+		SetBy:  setBy,
+		SetAt:  time.Now(),
+	}
+}
+
+// =============================================================================
+// USAGE EXAMPLES
+// =============================================================================
+//
+// Locking a file for 7 years in compliance mode:
+//
+//     until := time.Now().AddDate(7, 0, 0)
+//     file.Retention = models.NewRetentionLock(models.RetentionCompliance, until, adminID)
+//
+// Placing a legal hold:
+//
+//     file.LegalHold = models.NewLegalHold("Case #2024-118", adminID)
+//
+// Checking before a delete:
+//
+//     if file.IsLocked(time.Now()) {
+//         return errors.ErrRetentionLocked
+//     }
+//
+// Finding locked files (MongoDB query):
+//
+//     filter := bson.M{"$or": bson.A{
+//         bson.M{"retention.retain_until": bson.M{"$gt": time.Now()}},
+//         bson.M{"legal_hold": bson.M{"$exists": true}},
+//     }}
+//
+// =============================================================================
@@ -0,0 +1,58 @@
+// This file defines virus scan results and quarantine state for files.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Recording the outcome of an external check on a document
+// 2. Keeping an audit trail when an administrator overrides a decision
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// =============================================================================
+// SCAN RESULT
+// =============================================================================
+
+// ScanStatus is the verdict of a virus scan.
+type ScanStatus string
+
+// Scan status constants
+const (
+	ScanClean    ScanStatus = "clean"    // No threat found
+	ScanInfected ScanStatus = "infected" // A signature matched
+)
+
+// ScanResult records the most recent virus scan of a file.
+type ScanResult struct {
+	Status    ScanStatus `bson:"status" json:"status"`
+	Signature string     `bson:"signature,omitempty" json:"signature,omitempty"` // e.g. "Eicar-Test-Signature"
+	Version   int        `bson:"version" json:"version"`                         // File version that was scanned
+	ScannedAt time.Time  `bson:"scanned_at" json:"scanned_at"`
+}
+
+// =============================================================================
+// QUARANTINE
+// =============================================================================
+
+// Quarantine marks a file that must not be served to anyone.
+//
+// WHAT QUARANTINE MEANS:
+// The file stays in storage (so an administrator can inspect it or decide
+// it's a false positive), but downloads and share links refuse it and no
+// further processing (thumbnails, compression) runs on it.
+type Quarantine struct {
+	Signature     string    `bson:"signature" json:"signature"`           // Why it was quarantined
+	QuarantinedAt time.Time `bson:"quarantined_at" json:"quarantined_at"` // When
+}
+
+// QuarantineRelease is the audit record left when an administrator
+// releases a quarantined file (e.g. a false positive).
+type QuarantineRelease struct {
+	Signature  string             `bson:"signature" json:"signature"`     // What had been detected
+	ReleasedBy primitive.ObjectID `bson:"released_by" json:"released_by"` // Administrator
+	ReleasedAt time.Time          `bson:"released_at" json:"released_at"`
+}
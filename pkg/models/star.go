@@ -0,0 +1,53 @@
+// This file defines the Star model (a user's favorite files and folders).
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. A "join" collection linking users to items they care about
+// 2. Making a write idempotent with a unique index and an upsert
+//
+// WHY NOT A FIELD ON THE FILE?
+// Tags live on the item (tag_ids) because they are mostly read while
+// looking at the item. Stars are mostly read the other way round - "show
+// me everything I starred" - so they get their own small collection,
+// indexed by user and sorted by when the star was added.
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ItemType tells files and folders apart where either can be referenced.
+type ItemType string
+
+const (
+	ItemTypeFile   ItemType = "file"
+	ItemTypeFolder ItemType = "folder"
+)
+
+// Star marks a file or folder as a favorite of one user.
+//
+// MONGODB COLLECTION: stars
+// Unique index on { user_id, item_type, item_id } (see scripts/init-mongo.js),
+// so starring twice is a no-op.
+type Star struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID   primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ItemType ItemType           `bson:"item_type" json:"item_type"`
+	ItemID   primitive.ObjectID `bson:"item_id" json:"item_id"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// NewStar creates a star.
+func NewStar(userID primitive.ObjectID, itemType ItemType, itemID primitive.ObjectID) *Star {
+	return &Star{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		ItemType:  itemType,
+		ItemID:    itemID,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,79 @@
+// This file defines the Tag model (user-defined labels for files and folders).
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Referencing documents by ID instead of copying their data
+// 2. Case-insensitive uniqueness with a normalized key
+//
+// WHY STORE TAG IDS, NOT NAMES?
+// Files and folders carry TagIDs. Renaming a tag then touches one tags
+// document instead of every tagged item, and two tags can't get mixed up
+// because they happen to share a name at some point.
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxTagNameLength limits tag names (in characters).
+const MaxTagNameLength = 64
+
+// Tag is a label a user attaches to files and folders.
+//
+// Tags are personal: each user has their own set, and tagging a file that
+// was shared with you doesn't show your tag to its owner.
+//
+// MONGODB COLLECTION: tags
+// Unique index on { user_id, key } (see scripts/init-mongo.js).
+type Tag struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+
+	// Name is shown to the user as typed ("Tax 2024")
+	Name string `bson:"name" json:"name"`
+
+	// Key is the normalized name ("tax 2024") used for uniqueness, so
+	// "Work" and "work" can't both exist
+	Key string `bson:"key" json:"-"`
+
+	// Color is an optional display color, e.g. "#ff8800"
+	Color string `bson:"color,omitempty" json:"color,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// NewTag creates a tag for a user.
+func NewTag(userID primitive.ObjectID, name, color string) *Tag {
+	now := time.Now()
+	name = strings.TrimSpace(name)
+	return &Tag{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Key:       TagKey(name),
+		Color:     color,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// TagKey normalizes a tag name for comparison: trimmed, lowercase, and
+// runs of whitespace collapsed to one space.
+func TagKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// HasTag reports whether an item carries a tag.
+func HasTag(tagIDs []primitive.ObjectID, tagID primitive.ObjectID) bool {
+	for _, id := range tagIDs {
+		if id == tagID {
+			return true
+		}
+	}
+	return false
+}
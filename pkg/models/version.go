@@ -227,7 +227,6 @@ func NewFileVersion(
 //     currentFile.Version++  // Increment version
 //     currentFile.Checksum = newChecksum
 //     currentFile.FileSize = newFileSize
-//     currentFile.UpdatedAt = time.Now()
 //     fileRepo.Update(currentFile)
 //
 // Listing version history:
@@ -270,7 +269,6 @@ func NewFileVersion(
 //     currentFile.Version++
 //     currentFile.Checksum = version.Checksum
 //     currentFile.FileSize = version.FileSize
-//     currentFile.UpdatedAt = time.Now()
 //     fileRepo.Update(currentFile)
 //
 //     // Mark version as restored
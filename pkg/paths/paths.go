@@ -0,0 +1,142 @@
+// Package paths turns user-supplied paths like "/Documents/Work/report.pdf"
+// into folder and file records, creating missing folders on the way.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Validating untrusted input once, at the boundary
+// 2. Unicode normalization (golang.org/x/text/unicode/norm)
+// 3. Idempotent creation that is safe under concurrency (mkdir -p)
+//
+// WHY NORMALIZE UNICODE?
+// "é" can be written as one code point (U+00E9) or as "e" followed by a
+// combining accent (U+0065 U+0301). They look identical, and macOS sends
+// the second form while Windows and Linux usually send the first. Without
+// normalization a user could end up with two "Résumé.pdf" files that
+// differ only in invisible bytes. We convert every name to NFC (the
+// composed form) before storing or looking it up.
+//
+// WHY SO STRICT ABOUT CHARACTERS?
+// Files leave this service: through ZIP downloads, WebDAV and sync
+// clients onto Windows, macOS and Linux disks. A name that is legal here
+// but not there ("CON", "a:b", "name.") breaks those clients, so we only
+// accept names that work everywhere.
+package paths
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+)
+
+// Limits
+const (
+	MaxNameLength = 255  // Bytes of UTF-8 per name, the common filesystem limit
+	MaxPathLength = 4096 // Bytes for a whole path
+	MaxDepth      = 64   // Folders deep
+)
+
+// Root is the path of the top level.
+const Root = "/"
+
+// forbiddenChars can't appear in names: "/" separates components, the rest
+// are reserved on Windows.
+const forbiddenChars = `/\:*?"<>|`
+
+// reservedNames are device names on Windows. They are reserved with any
+// extension too ("con.txt"), in any case.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// invalid builds an INVALID_PATH error with a specific message.
+func invalid(format string, args ...interface{}) error {
+	return apperrors.New("INVALID_PATH", fmt.Sprintf(format, args...), http.StatusBadRequest)
+}
+
+// CleanName normalizes a single file or folder name to NFC and checks it.
+func CleanName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", invalid("Names must be valid UTF-8")
+	}
+	name = norm.NFC.String(name)
+
+	switch {
+	case name == "":
+		return "", invalid("Names can't be empty")
+	case name == "." || name == "..":
+		return "", invalid("%q is not a valid name", name)
+	case len(name) > MaxNameLength:
+		return "", invalid("Names can be at most %d bytes long", MaxNameLength)
+	case strings.HasSuffix(name, " ") || strings.HasSuffix(name, "."):
+		return "", invalid("%q can't end with a space or a period", name)
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", invalid("Names can't contain control characters")
+		}
+		if strings.ContainsRune(forbiddenChars, r) {
+			return "", invalid("Names can't contain %q", r)
+		}
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		return "", invalid("%q is a reserved name", name)
+	}
+	return name, nil
+}
+
+// Split checks a path and returns its normalized components. The leading
+// slash is optional and repeated slashes are ignored, so "Docs//Work/"
+// and "/Docs/Work" both give ["Docs", "Work"]. The root gives none.
+//
+// "." and ".." are rejected rather than resolved: a client sending them is
+// either confused or probing for a way out of its own tree.
+func Split(path string) ([]string, error) {
+	if len(path) > MaxPathLength {
+		return nil, invalid("Paths can be at most %d bytes long", MaxPathLength)
+	}
+
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		name, err := CleanName(part)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if len(names) > MaxDepth {
+		return nil, invalid("Paths can be at most %d levels deep", MaxDepth)
+	}
+	return names, nil
+}
+
+// Clean returns the normalized form of a path: "/Docs/Work", or Root.
+func Clean(path string) (string, error) {
+	names, err := Split(path)
+	if err != nil {
+		return "", err
+	}
+	return Join(names...), nil
+}
+
+// Join builds a path from already cleaned names.
+func Join(names ...string) string {
+	return Root + strings.Join(names, "/")
+}
@@ -0,0 +1,112 @@
+// This file picks free names for the "rename" conflict policy.
+//
+// NUMBERED COPIES:
+// Like desktop file managers, we keep the extension and count up before it:
+//
+//	report.pdf     -> report (1).pdf, report (2).pdf, ...
+//	report (1).pdf -> report (2).pdf  (not "report (1) (1).pdf")
+//	archive.tar.gz -> archive (1).tar.gz
+//	.bashrc        -> .bashrc (1)
+package paths
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// MaxRenameAttempts is how many numbered names FreeName tries before
+// giving up with repository.ErrNameTaken.
+const MaxRenameAttempts = 100
+
+// doubleExtensions stay together when a number is inserted.
+var doubleExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst"}
+
+// numberSuffix matches a " (n)" that an earlier rename added.
+var numberSuffix = regexp.MustCompile(` \((\d+)\)$`)
+
+// Numbered returns name with " (n)" inserted before its extension. A
+// number that is already there is replaced, not added to.
+func Numbered(name string, n int) string {
+	stem, ext := splitExt(name)
+	stem = numberSuffix.ReplaceAllString(stem, "")
+	return fmt.Sprintf("%s (%d)%s", stem, n, ext)
+}
+
+// splitExt splits a name into stem and extension. A leading dot starts a
+// hidden name, not an extension.
+func splitExt(name string) (string, string) {
+	lower := strings.ToLower(name)
+	for _, ext := range doubleExtensions {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)], name[len(name)-len(ext):]
+		}
+	}
+
+	dot := strings.LastIndex(name, ".")
+	if dot <= 0 {
+		return name, ""
+	}
+	return name[:dot], name[dot:]
+}
+
+// FreeName returns a name for a new item in the folder at parentPath
+// (Root or "" for the top level) that no file or folder there has yet:
+// name itself if possible, otherwise the first free numbered variant.
+//
+// The answer can be outdated by the time the caller writes, if another
+// request takes the same name. The unique path indexes catch that with
+// repository.ErrNameTaken, and the caller can simply ask again.
+func (r *Resolver) FreeName(ctx context.Context, ownerID primitive.ObjectID, parentPath, name string) (string, error) {
+	if parentPath == Root {
+		parentPath = ""
+	}
+
+	start := 1
+	if match := numberSuffix.FindStringSubmatch(stemOf(name)); match != nil {
+		// "report (3).pdf" is taken: go on with 4, not 1
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			start = n + 1
+		}
+	}
+
+	candidate := name
+	for attempt := 0; attempt <= MaxRenameAttempts; attempt++ {
+		if attempt > 0 {
+			candidate = Numbered(name, start+attempt-1)
+		}
+		taken, err := r.taken(ctx, ownerID, parentPath+"/"+candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", repository.ErrNameTaken
+}
+
+// stemOf returns a name without its extension.
+func stemOf(name string) string {
+	stem, _ := splitExt(name)
+	return stem
+}
+
+// taken reports whether a file or folder has the path.
+func (r *Resolver) taken(ctx context.Context, ownerID primitive.ObjectID, path string) (bool, error) {
+	_, err := r.Resolve(ctx, ownerID, path)
+	if err == nil {
+		return true, nil
+	}
+	if apperrors.Is(err, apperrors.ErrNotFound) {
+		return false, nil
+	}
+	return false, err
+}
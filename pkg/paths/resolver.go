@@ -0,0 +1,160 @@
+// This file maps paths to folder and file records.
+//
+// MKDIR -P:
+// MkdirAll walks the path one level at a time. Each level is "find the
+// folder, or create it" in a single upsert (FolderRepository.Ensure), and
+// a unique index makes concurrent creators agree on one folder:
+//
+//	request A: ensure /Docs      -> creates it
+//	request B: ensure /Docs      -> finds A's folder
+//	request A: ensure /Docs/Work -> creates it, parent = /Docs
+//	request B: ensure /Docs/Work -> finds it
+//
+// There is no multi-document transaction: if we crash halfway, the
+// folders created so far stay, which is exactly what a retry needs.
+package paths
+
+import (
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// ErrNotAFolder is returned when a path runs through a file, e.g. creating
+// "/notes.txt/draft" while "/notes.txt" is a file.
+var ErrNotAFolder = apperrors.New("NOT_A_FOLDER", "A file is in the way of this path", http.StatusConflict)
+
+// ErrRootPath is returned where a folder or file path is required but the
+// root was given.
+var ErrRootPath = apperrors.New("INVALID_PATH", "The root folder can't be used here", http.StatusBadRequest)
+
+// Entry is what a path refers to: a folder, a file, or (both nil) the root.
+type Entry struct {
+	Path   string         `json:"path"`
+	Folder *models.Folder `json:"folder,omitempty"`
+	File   *models.File   `json:"file,omitempty"`
+}
+
+// IsRoot reports whether the entry is the top level.
+func (e *Entry) IsRoot() bool {
+	return e.Folder == nil && e.File == nil
+}
+
+// ID returns the ID of the folder or file, or NilObjectID for the root.
+func (e *Entry) ID() primitive.ObjectID {
+	switch {
+	case e.Folder != nil:
+		return e.Folder.ID
+	case e.File != nil:
+		return e.File.ID
+	default:
+		return primitive.NilObjectID
+	}
+}
+
+// Resolver resolves and creates paths within one user's tree.
+type Resolver struct {
+	files   repository.FileRepository
+	folders repository.FolderRepository
+}
+
+// NewResolver creates a Resolver.
+func NewResolver(files repository.FileRepository, folders repository.FolderRepository) *Resolver {
+	return &Resolver{files: files, folders: folders}
+}
+
+// Resolve returns what is at a path in the owner's tree. Names are matched
+// case-insensitively; Entry.Path is the path as stored. Returns
+// ErrNotFound if nothing is there.
+func (r *Resolver) Resolve(ctx context.Context, ownerID primitive.ObjectID, path string) (*Entry, error) {
+	clean, err := Clean(path)
+	if err != nil {
+		return nil, err
+	}
+	if clean == Root {
+		return &Entry{Path: Root}, nil
+	}
+
+	folder, err := r.folders.GetByPath(ctx, ownerID, clean)
+	if err == nil {
+		return &Entry{Path: folder.Path, Folder: folder}, nil
+	}
+	if !apperrors.Is(err, apperrors.ErrNotFound) {
+		return nil, err
+	}
+
+	file, err := r.files.GetByPath(ctx, ownerID, clean)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Path: file.FilePath, File: file}, nil
+}
+
+// MkdirAll returns the folder at a path, creating it and any missing
+// parents. It returns nil for the root.
+//
+// Existing folders keep their spelling: MkdirAll("/docs/new") under an
+// existing "/Docs" creates "/Docs/new".
+func (r *Resolver) MkdirAll(ctx context.Context, ownerID primitive.ObjectID, path string) (*models.Folder, error) {
+	names, err := Split(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *models.Folder
+	for _, name := range names {
+		parentPath := ""
+		var parentID *primitive.ObjectID
+		if parent != nil {
+			parentPath, parentID = parent.Path, &parent.ID
+		}
+
+		folder, err := r.folders.GetByPath(ctx, ownerID, parentPath+"/"+name)
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			folder, err = r.create(ctx, models.NewFolder(ownerID, name, parentID, parentPath))
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent = folder
+	}
+	return parent, nil
+}
+
+// Place prepares a new file for a path: it creates the parent folders and
+// sets the file's name, FolderID and FilePath. The file itself is not
+// saved, and an existing file at the path is not checked for.
+func (r *Resolver) Place(ctx context.Context, file *models.File, path string) error {
+	names, err := Split(path)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return ErrRootPath
+	}
+
+	folder, err := r.MkdirAll(ctx, file.UserID, Join(names[:len(names)-1]...))
+	if err != nil {
+		return err
+	}
+	file.FileName = names[len(names)-1]
+	file.PlaceIn(folder)
+	return nil
+}
+
+// create inserts a missing folder unless a file already has its path.
+func (r *Resolver) create(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	_, err := r.files.GetByPath(ctx, folder.UserID, folder.Path)
+	if err == nil {
+		return nil, ErrNotAFolder
+	}
+	if !apperrors.Is(err, apperrors.ErrNotFound) {
+		return nil, err
+	}
+	return r.folders.Ensure(ctx, folder)
+}
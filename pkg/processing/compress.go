@@ -0,0 +1,178 @@
+// This file implements the compression job.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Streaming compression with io.Copy into a compressing writer
+// 2. Temporary files for data too large to keep in memory
+// 3. Measuring before committing (keep the copy only if it helps)
+//
+// GZIP VS ZSTD:
+// gzip is understood by every HTTP client ever written. zstd compresses
+// better and decompresses several times faster, and modern browsers accept
+// it. We store both so each client gets the best encoding it supports.
+package processing
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Content encodings we produce (values of the Content-Encoding header)
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// minCompressionSavings is the fraction of the original size a compressed
+// copy must save to be kept. Below that, the extra object and the client's
+// decompression work aren't worth a few bytes.
+const minCompressionSavings = 0.05
+
+// encoder describes one supported content encoding.
+type encoder struct {
+	encoding  string
+	extension string
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// encoders lists the encodings we produce, best first.
+var encoders = []encoder{
+	{
+		encoding:  EncodingZstd,
+		extension: ".zst",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		},
+	},
+	{
+		encoding:  EncodingGzip,
+		extension: ".gz",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestCompression)
+		},
+	},
+}
+
+// HandleCompress stores compressed copies of a compressible file.
+func (p *Processor) HandleCompress(ctx context.Context, job *models.ProcessingJob) error {
+	if !p.cfg.CompressionEnabled {
+		return nil
+	}
+
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !file.IsActive() || file.IsQuarantined() || !file.CanCompress() {
+		return nil
+	}
+
+	var copies []models.CompressedCopy
+	for _, enc := range encoders {
+		c, err := p.compress(ctx, file, enc)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			copies = append(copies, *c)
+		}
+	}
+
+	// Record the copies only if the file wasn't overwritten meanwhile
+	if err := p.files.SetCompressedCopies(ctx, file.ID, file.Version, copies); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			// A newer version has its own compress job; our copies are
+			// of content nobody serves any more
+			for _, c := range copies {
+				_ = p.storage.Delete(ctx, c.S3Key)
+			}
+			return nil
+		}
+		return err
+	}
+
+	// Copies of the previous version are garbage now (a rerun for the same
+	// version reuses its keys, which must stay)
+	kept := make(map[string]bool, len(copies))
+	for _, c := range copies {
+		kept[c.S3Key] = true
+	}
+	for _, old := range file.CompressedCopies {
+		if !kept[old.S3Key] {
+			_ = p.storage.Delete(ctx, old.S3Key)
+		}
+	}
+	return nil
+}
+
+// compress produces one compressed copy. It returns nil (and no error) when
+// the result doesn't save enough space to be worth keeping.
+//
+// WHY A TEMP FILE?
+// We only know the compressed size after compressing everything. Writing to
+// a temp file first means we upload only copies we keep, and never hold a
+// multi-gigabyte file in memory.
+func (p *Processor) compress(ctx context.Context, file *models.File, enc encoder) (*models.CompressedCopy, error) {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "compress-*"+enc.extension)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w, err := enc.newWriter(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return nil, fmt.Errorf("failed to %s-compress file: %w", enc.encoding, err)
+	}
+	// Close flushes the final compressed block; skipping it truncates output
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if float64(size) > float64(file.FileSize)*(1-minCompressionSavings) {
+		return nil, nil
+	}
+
+	// Rewind the temp file and upload it
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	key := storage.CompressedKey(file.UserID, file.ID, file.Version, enc.extension)
+	if _, err := p.storage.Put(ctx, key, tmp, size, file.MimeType); err != nil {
+		return nil, err
+	}
+
+	return &models.CompressedCopy{
+		Encoding: enc.encoding,
+		S3Key:    key,
+		FileSize: size,
+		Version:  file.Version,
+	}, nil
+}
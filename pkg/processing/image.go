@@ -0,0 +1,162 @@
+// This file decodes images safely and applies EXIF orientation.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. image.Decode and format registration via blank imports
+// 2. Guarding against "decompression bombs"
+// 3. Pixel-level transforms on *image.NRGBA
+//
+// EXIF ORIENTATION:
+// Phone cameras store pixels in sensor order and write an "Orientation" tag
+// telling viewers how to rotate them. If we ignore the tag, portrait photos
+// come out sideways in thumbnails.
+//
+//	1 = normal            2 = mirrored
+//	3 = rotated 180       4 = mirrored vertically
+//	5 = transposed        6 = rotated 90 clockwise
+//	7 = transversed       8 = rotated 90 counter-clockwise
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	// BLANK IMPORTS:
+	// These packages register their decoders with image.Decode in their
+	// init() functions. We never call them directly, hence the "_".
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Limits that protect workers from hostile or absurd images
+const (
+	// maxImageBytes is the largest encoded image we read into memory
+	maxImageBytes = 100 << 20 // 100 MB
+
+	// maxImagePixels bounds the decoded size. A tiny PNG can claim to be
+	// 100000x100000 pixels and would need 40 GB of RAM once decoded.
+	maxImagePixels = 100_000_000 // 100 megapixels
+)
+
+// ErrImageTooLarge indicates an image exceeding the decode limits.
+var ErrImageTooLarge = errors.New("processing: image too large")
+
+// decodeImage reads, decodes and orients an image.
+// It returns the decoded image and its format name ("jpeg", "png", ...).
+func decodeImage(r io.Reader) (*image.NRGBA, string, error) {
+	// We need the bytes twice (EXIF, then pixels), so buffer them.
+	// LimitReader reads one byte past the limit so we can detect overflow.
+	data, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxImageBytes {
+		return nil, "", ErrImageTooLarge
+	}
+
+	// DecodeConfig only parses the header: cheap, and tells us the size
+	// before we commit memory to the pixels.
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return orient(toNRGBA(img), readOrientation(data)), format, nil
+}
+
+// readOrientation returns the EXIF orientation (1-8), or 1 if absent.
+// Only JPEG (and some WebP) files carry EXIF; failures simply mean "normal".
+func readOrientation(data []byte) int {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	value, err := tag.Int(0)
+	if err != nil || value < 1 || value > 8 {
+		return 1
+	}
+	return value
+}
+
+// toNRGBA converts any image to *image.NRGBA with bounds starting at (0,0).
+//
+// WHY NRGBA?
+// Decoders return many concrete types (YCbCr for JPEG, Paletted for GIF...).
+// Converting once gives us a single, simple pixel layout: 4 bytes per pixel,
+// non-premultiplied alpha, which is also what the encoders want.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// orient returns img transformed according to an EXIF orientation value.
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 {
+		return img
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Find the source pixel that lands on (x, y)
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+
+			// Pix is a flat byte slice: 4 bytes (R,G,B,A) per pixel, row by row
+			si := sy*img.Stride + sx*4
+			di := y*dst.Stride + x*4
+			copy(dst.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return dst
+}
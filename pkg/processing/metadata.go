@@ -0,0 +1,175 @@
+// This file implements the metadata extraction job.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. bufio.Reader.Peek to look at the start of a stream without consuming it
+// 2. Choosing extractors based on sniffed (not declared) content type
+// 3. Replacing a whole set of metadata namespaces atomically
+//
+// WHAT GETS READ:
+// Every extractor reads as little as possible. Sniffing needs 512 bytes,
+// EXIF and image headers sit at the start of an image, ID3v2 at the start
+// of an MP3 and ID3v1 in its last 128 bytes. Only PDFs are copied to a temp
+// file, because pdfinfo needs a path.
+package processing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/metadata"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// maxMetadataHead caps how much of an image we read for its header and
+// EXIF block. Both live at the start; 8 MB covers even large maker notes.
+const maxMetadataHead = 8 << 20
+
+// contentNamespaces are the namespaces owned by this job. Video metadata is
+// owned by the video job and left alone.
+var contentNamespaces = []string{
+	models.MetadataContent,
+	models.MetadataImage,
+	models.MetadataExif,
+	models.MetadataAudio,
+	models.MetadataPDF,
+}
+
+// HandleMetadata sniffs the real content type and extracts metadata.
+func (p *Processor) HandleMetadata(ctx context.Context, job *models.ProcessingJob) error {
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !file.IsActive() || file.IsQuarantined() {
+		return nil
+	}
+
+	extracted, err := p.extractMetadata(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	// Start from "remove every namespace we own" and overwrite the ones we
+	// found, so metadata of a previous version (e.g. EXIF of a photo that
+	// was replaced by a PNG) doesn't linger.
+	fields := make(map[string]interface{}, len(contentNamespaces))
+	for _, namespace := range contentNamespaces {
+		fields[namespace] = nil
+	}
+	for namespace, value := range extracted {
+		fields[namespace] = value
+	}
+	return p.files.SetMetadata(ctx, file.ID, fields)
+}
+
+// extractMetadata runs every extractor that applies to the file.
+func (p *Processor) extractMetadata(ctx context.Context, file *models.File) (map[string]interface{}, error) {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// PEEK:
+	// Peek returns the next n bytes without advancing the reader, so the
+	// extractors below still see the file from its first byte.
+	br := bufio.NewReaderSize(reader, metadata.SniffLength)
+	head, err := br.Peek(metadata.SniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	detected := metadata.DetectMimeType(head)
+	extracted := map[string]interface{}{
+		models.MetadataContent: models.ContentMetadata{
+			DetectedMimeType: detected,
+			MimeMismatch:     metadata.IsMimeMismatch(file.MimeType, detected),
+		},
+	}
+
+	switch {
+	case strings.HasPrefix(detected, "image/"):
+		data, err := io.ReadAll(io.LimitReader(br, maxMetadataHead))
+		if err != nil {
+			return nil, err
+		}
+		if img, err := metadata.ReadImage(data); err == nil {
+			extracted[models.MetadataImage] = *img
+		}
+		if exif, err := metadata.ReadExif(data); err == nil {
+			extracted[models.MetadataExif] = *exif
+		}
+
+	case detected == "audio/mpeg":
+		audio, err := readAudio(br)
+		if err != nil {
+			return nil, err
+		}
+		if audio != nil {
+			extracted[models.MetadataAudio] = *audio
+		}
+
+	case detected == "application/pdf" && p.pdf != nil:
+		pdf, err := p.readPDF(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		extracted[models.MetadataPDF] = *pdf
+	}
+
+	return extracted, nil
+}
+
+// readAudio reads ID3v2 from the start and ID3v1 from the end of an MP3.
+// It returns nil if the file has neither.
+func readAudio(r io.Reader) (*models.AudioMetadata, error) {
+	v2, err := metadata.ReadID3v2(r)
+	if err != nil && !errors.Is(err, metadata.ErrNoID3) {
+		return nil, err
+	}
+
+	// Stream the rest of the file, remembering only the last 128 bytes.
+	// If there was no ID3v2 tag, ReadID3v2 consumed 10 bytes of audio,
+	// which doesn't matter for a tag at the very end.
+	tail := metadata.NewTailBuffer(metadata.ID3v1Size)
+	if _, err := io.Copy(tail, r); err != nil {
+		return nil, err
+	}
+	v1, _ := metadata.ParseID3v1(tail.Bytes())
+
+	return metadata.MergeAudio(v2, v1), nil
+}
+
+// readPDF reads the document information with pdfinfo.
+func (p *Processor) readPDF(ctx context.Context, file *models.File) (*models.PDFMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.previewTimeout())
+	defer cancel()
+
+	input, cleanup, err := p.stageLocally(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	info, err := p.pdf.Info(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PDFMetadata{
+		Title:     info.Title,
+		Author:    info.Author,
+		Subject:   info.Subject,
+		Creator:   info.Creator,
+		Producer:  info.Producer,
+		PageCount: info.Pages,
+	}, nil
+}
@@ -0,0 +1,293 @@
+// This file implements the document preview job.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Normalizing many input formats into one (office -> PDF -> images)
+// 2. Reading only the beginning of a large object with io.LimitReader
+// 3. Cutting UTF-8 text safely at a byte limit
+//
+// THREE KINDS OF PREVIEW:
+//
+//	PDF          -> render the first pages with poppler
+//	Word, Excel  -> convert to PDF with LibreOffice, then as above
+//	plain text   -> keep the first few kilobytes as a snippet
+package processing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Defaults used when the corresponding settings are not configured
+const (
+	defaultPreviewPages   = 3
+	defaultPreviewWidth   = 1024
+	defaultPreviewTimeout = 5 * time.Minute
+)
+
+// maxSnippetBytes is how much of a text file goes into its preview
+const maxSnippetBytes = 4 << 10 // 4 KB
+
+// officeTypes are the MIME types LibreOffice converts for us.
+var officeTypes = map[string]bool{
+	"application/msword": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.ms-excel": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.ms-powerpoint":                                             true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.presentation":                           true,
+	"application/rtf": true,
+}
+
+// previewKind says how a file is previewed.
+type previewKind int
+
+const (
+	previewNone   previewKind = iota // Not previewable (or the tool is missing)
+	previewPDF                       // Render pages directly
+	previewOffice                    // Convert to PDF first
+	previewText                      // Keep a snippet
+)
+
+// HandlePreview renders a document preview.
+func (p *Processor) HandlePreview(ctx context.Context, job *models.ProcessingJob) error {
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !file.IsActive() || file.IsQuarantined() {
+		return nil
+	}
+
+	kind := p.previewKind(file)
+	if kind == previewNone {
+		return jobs.Permanent(fmt.Errorf("no previewer for %s", file.MimeType))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.previewTimeout())
+	defer cancel()
+
+	preview := &models.DocumentPreview{Version: file.Version}
+	if kind == previewText {
+		err = p.textPreview(ctx, file, preview)
+	} else {
+		err = p.renderPreview(ctx, file, kind, preview)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.files.SetPreview(ctx, file.ID, preview); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			// A newer version has its own preview job
+			for _, page := range preview.Pages {
+				_ = p.storage.Delete(ctx, page.S3Key)
+			}
+			return nil
+		}
+		return err
+	}
+
+	// The previous version's page images are garbage now
+	if file.Preview != nil {
+		kept := make(map[string]bool, len(preview.Pages))
+		for _, page := range preview.Pages {
+			kept[page.S3Key] = true
+		}
+		for _, old := range file.Preview.Pages {
+			if !kept[old.S3Key] {
+				_ = p.storage.Delete(ctx, old.S3Key)
+			}
+		}
+	}
+	return nil
+}
+
+// previewKind decides how to preview a file with the tools we have.
+func (p *Processor) previewKind(file *models.File) previewKind {
+	switch {
+	case file.MimeType == "application/pdf" && p.pdf != nil:
+		return previewPDF
+	case officeTypes[file.MimeType] && p.office != nil && p.pdf != nil:
+		return previewOffice
+	case isText(file.MimeType):
+		return previewText
+	default:
+		return previewNone
+	}
+}
+
+// renderPreview renders the first pages of a PDF or office document.
+func (p *Processor) renderPreview(ctx context.Context, file *models.File, kind previewKind, preview *models.DocumentPreview) error {
+	input, cleanup, err := p.stageLocally(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	workDir, err := os.MkdirTemp("", "preview-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	pdfPath := input
+	if kind == previewOffice {
+		if pdfPath, err = p.office.ConvertToPDF(ctx, input, workDir); err != nil {
+			return err
+		}
+	}
+
+	info, err := p.pdf.Info(ctx, pdfPath)
+	if err != nil {
+		return err
+	}
+	pageCount := info.Pages
+	preview.PageCount = pageCount
+
+	for page := 1; page <= pageCount && page <= p.previewPages(); page++ {
+		rendered, err := p.renderPage(ctx, file, pdfPath, page, workDir)
+		if err != nil {
+			return err
+		}
+		preview.Pages = append(preview.Pages, *rendered)
+	}
+	return nil
+}
+
+// renderPage renders one page, re-encodes it as JPEG and stores it.
+//
+// WHY RE-ENCODE?
+// pdftoppm writes PNG, which is lossless and therefore large for pages with
+// photos or gradients. JPEG at thumbnail quality is a fraction of the size.
+func (p *Processor) renderPage(ctx context.Context, file *models.File, pdfPath string, page int, workDir string) (*models.PreviewPage, error) {
+	pngPath := filepath.Join(workDir, fmt.Sprintf("page-%d.png", page))
+	if err := p.pdf.RenderPage(ctx, pdfPath, page, p.previewWidth(), pngPath); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(pngPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := decodeImage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.quality()}); err != nil {
+		return nil, fmt.Errorf("failed to encode page %d: %w", page, err)
+	}
+
+	key := storage.PreviewKey(file.UserID, file.ID, file.Version, page, ".jpg")
+	size := int64(buf.Len())
+	if _, err := p.storage.Put(ctx, key, &buf, size, "image/jpeg"); err != nil {
+		return nil, fmt.Errorf("failed to store page %d: %w", page, err)
+	}
+
+	return &models.PreviewPage{
+		Page:        page,
+		Width:       img.Rect.Dx(),
+		Height:      img.Rect.Dy(),
+		S3Key:       key,
+		ContentType: "image/jpeg",
+		FileSize:    size,
+	}, nil
+}
+
+// textPreview stores the beginning of a text file as a snippet.
+func (p *Processor) textPreview(ctx context.Context, file *models.File, preview *models.DocumentPreview) error {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Read one byte more than we keep, to know whether there is more
+	data, err := io.ReadAll(io.LimitReader(reader, maxSnippetBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxSnippetBytes {
+		data = trimPartialRune(data[:maxSnippetBytes])
+		preview.Truncated = true
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return jobs.Permanent(errors.New("file looks binary, not text"))
+	}
+
+	// Replace invalid sequences (e.g. Latin-1 bytes) so the snippet is
+	// always valid UTF-8 and safe to put into JSON
+	preview.Snippet = strings.ToValidUTF8(string(data), "\uFFFD")
+	return nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of data.
+//
+// UTF-8 encodes a character in 1-4 bytes. Cutting at a byte limit can split
+// the last one; utf8.DecodeLastRune reports RuneError for the broken tail.
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+		r, size := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError || size > 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// isText returns true for MIME types whose content is readable text.
+func isText(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") ||
+		mimeType == "application/json" ||
+		mimeType == "application/xml"
+}
+
+// previewPages returns the configured page count, falling back to the default.
+func (p *Processor) previewPages() int {
+	if p.cfg.PreviewPages > 0 {
+		return p.cfg.PreviewPages
+	}
+	return defaultPreviewPages
+}
+
+// previewWidth returns the configured width, falling back to the default.
+func (p *Processor) previewWidth() int {
+	if p.cfg.PreviewWidth > 0 {
+		return p.cfg.PreviewWidth
+	}
+	return defaultPreviewWidth
+}
+
+// previewTimeout returns the configured timeout, falling back to the default.
+func (p *Processor) previewTimeout() time.Duration {
+	if p.cfg.PreviewTimeout > 0 {
+		return p.cfg.PreviewTimeout
+	}
+	return defaultPreviewTimeout
+}
@@ -0,0 +1,209 @@
+// Package processing contains the background jobs that derive data from
+// uploaded files (thumbnails, compressed copies, video renditions, document previews
+// and friends).
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Decoding and encoding images with the standard library
+// 2. Registering extra image formats through blank imports
+// 3. Plugging handlers into the generic worker pool from pkg/jobs
+// 4. Delegating video work to ffmpeg through pkg/media
+//
+// HOW A FILE GETS PROCESSED:
+//  1. An upload finishes and the file service calls StartPipeline
+//  2. If virus scanning is enabled, a scan job runs first. Infected files are
+//     quarantined and processing stops there
+//  3. Clean files get their follow-up jobs (thumbnails, compression,
+//     metadata, video poster frames and renditions, document previews
+//     and document text for search)
+//  4. Each handler reads the original from storage, writes the derived
+//     objects back to storage and records them on the File document
+package processing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/media"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/scanner"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Job types handled by this package
+const (
+	JobScan      models.JobType = "virus_scan" // Scan for malware (runs first)
+	JobThumbnail models.JobType = "thumbnail"  // Generate image thumbnails
+	JobCompress  models.JobType = "compress"   // Store gzip/zstd copies
+	JobVideo     models.JobType = "video"      // Poster frame and video metadata
+	JobTranscode models.JobType = "transcode"  // Web-friendly video rendition
+	JobPreview   models.JobType = "preview"    // Document page images or text snippet
+	JobMetadata  models.JobType = "metadata"   // Sniffed MIME type, EXIF, ID3, PDF info
+	JobText      models.JobType = "text"       // Document text for the search index
+)
+
+// TextIndex receives text extracted from documents (see pkg/search).
+type TextIndex interface {
+	// SetContent records the text of one file version.
+	SetContent(fileID primitive.ObjectID, version int, text string)
+
+	// ContentLimit is how many bytes of text are worth extracting.
+	ContentLimit() int
+}
+
+// Deps bundles the collaborators a Processor needs.
+type Deps struct {
+	Files         repository.FileRepository
+	Notifications repository.NotificationRepository
+	Storage       storage.Backend
+	Queue         *jobs.Queue     // For enqueueing follow-up jobs
+	Scanner       scanner.Scanner // May be nil when scanning is disabled
+	FFmpeg        media.FFmpeg    // May be nil; videos are then left alone
+
+	// Document previews. Without PDF, only text files get previews;
+	// without Office, office documents are skipped.
+	PDF    media.PDFRenderer
+	Office media.DocumentConverter
+
+	// Search receives document text. May be nil when search is disabled.
+	Search TextIndex
+}
+
+// Processor runs processing jobs.
+type Processor struct {
+	cfg           config.ProcessingConfig
+	files         repository.FileRepository
+	notifications repository.NotificationRepository
+	storage       storage.Backend
+	queue         *jobs.Queue
+	scanner       scanner.Scanner
+	ffmpeg        media.FFmpeg
+	pdf           media.PDFRenderer
+	office        media.DocumentConverter
+	search        TextIndex
+}
+
+// NewProcessor creates a Processor.
+func NewProcessor(cfg config.ProcessingConfig, deps Deps) *Processor {
+	return &Processor{
+		cfg:           cfg,
+		files:         deps.Files,
+		notifications: deps.Notifications,
+		storage:       deps.Storage,
+		queue:         deps.Queue,
+		scanner:       deps.Scanner,
+		ffmpeg:        deps.FFmpeg,
+		pdf:           deps.PDF,
+		office:        deps.Office,
+		search:        deps.Search,
+	}
+}
+
+// Register adds every handler of this package to the worker pool.
+func (p *Processor) Register(pool *jobs.Pool) {
+	pool.Register(JobScan, p.HandleScan)
+	pool.Register(JobThumbnail, p.HandleThumbnail)
+	pool.Register(JobCompress, p.HandleCompress)
+	pool.Register(JobVideo, p.HandleVideo)
+	pool.Register(JobTranscode, p.HandleTranscode)
+	pool.Register(JobPreview, p.HandlePreview)
+	pool.Register(JobMetadata, p.HandleMetadata)
+	pool.Register(JobText, p.HandleText)
+}
+
+// StartPipeline enqueues the first processing step for a new or
+// overwritten file.
+func (p *Processor) StartPipeline(ctx context.Context, file *models.File) error {
+	if p.scanEnabled() {
+		// Scans jump the queue: nothing else may touch the file until it's clean
+		_, err := p.queue.Enqueue(ctx, JobScan, file, nil, jobs.WithPriority(models.JobPriorityHigh))
+		return err
+	}
+	return p.EnqueueFollowUps(ctx, file)
+}
+
+// EnqueueFollowUps enqueues the jobs that derive data from a file known to
+// be safe: after a clean scan, or after an administrator released it from
+// quarantine.
+func (p *Processor) EnqueueFollowUps(ctx context.Context, file *models.File) error {
+	// Every file gets metadata, if only its sniffed content type
+	if _, err := p.queue.Enqueue(ctx, JobMetadata, file, nil); err != nil {
+		return err
+	}
+	if file.IsImage() && len(p.sizes()) > 0 {
+		if _, err := p.queue.Enqueue(ctx, JobThumbnail, file, nil); err != nil {
+			return err
+		}
+	}
+	if file.IsVideo() && p.ffmpeg != nil {
+		if _, err := p.queue.Enqueue(ctx, JobVideo, file, nil); err != nil {
+			return err
+		}
+		if p.cfg.VideoRenditionEnabled {
+			if _, err := p.queue.Enqueue(ctx, JobTranscode, file, nil, jobs.WithPriority(models.JobPriorityLow)); err != nil {
+				return err
+			}
+		}
+	}
+	if p.previewKind(file) != previewNone {
+		if _, err := p.queue.Enqueue(ctx, JobPreview, file, nil); err != nil {
+			return err
+		}
+	}
+	if p.search != nil && p.previewKind(file) != previewNone {
+		if _, err := p.queue.Enqueue(ctx, JobText, file, nil, jobs.WithPriority(models.JobPriorityLow)); err != nil {
+			return err
+		}
+	}
+	if p.cfg.CompressionEnabled && file.CanCompress() {
+		if _, err := p.queue.Enqueue(ctx, JobCompress, file, nil, jobs.WithPriority(models.JobPriorityLow)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanEnabled reports whether uploads go through the virus scanner.
+func (p *Processor) scanEnabled() bool {
+	return p.cfg.VirusScanEnabled && p.scanner != nil
+}
+
+// stageLocally copies a file's content into a temp file for external tools
+// that need a path, and returns the path and a cleanup function.
+//
+// CLEANUP FUNCTIONS:
+// Returning a func() lets the caller "defer cleanup()" without knowing
+// what needs cleaning up. The temp file is removed even if the job fails.
+func (p *Processor) stageLocally(ctx context.Context, file *models.File) (string, func(), error) {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	// Keep the extension: some tools (LibreOffice) use it to pick a format
+	tmp, err := os.CreateTemp("", "stage-*"+filepath.Ext(file.FileName))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to stage file locally: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
@@ -0,0 +1,148 @@
+// This file implements the virus scan job.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Gating a pipeline on the result of its first stage
+// 2. context.WithTimeout to bound a call to an external daemon
+// 3. Idempotent side effects when a job is retried
+//
+// RETRIES WITHOUT RESCANNING:
+// The verdict is stored on the file before the side effects (notifying the
+// owner, enqueueing follow-ups). If a side effect fails, the retry finds a
+// verdict for the current version and only repeats the side effects, so a
+// 2 GB file is never streamed to clamd twice.
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/scanner"
+)
+
+// defaultScanTimeout is used when VIRUS_SCAN_TIMEOUT is not set
+const defaultScanTimeout = 2 * time.Minute
+
+// errStaleScan means the file changed while it was being scanned
+var errStaleScan = errors.New("file changed during scan")
+
+// HandleScan scans a file and quarantines it if a threat is found.
+func (p *Processor) HandleScan(ctx context.Context, job *models.ProcessingJob) error {
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !file.IsActive() {
+		return nil
+	}
+
+	// Scanning was switched off after this job was queued
+	if !p.scanEnabled() {
+		return p.EnqueueFollowUps(ctx, file)
+	}
+
+	if file.Scan == nil || file.Scan.Version != file.Version {
+		if err := p.scan(ctx, file); err != nil {
+			if errors.Is(err, errStaleScan) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	switch {
+	case file.IsQuarantined() && file.Scan.Status == models.ScanInfected:
+		return p.notifyQuarantined(ctx, file)
+	case file.IsQuarantined():
+		// Clean new content doesn't lift an earlier quarantine by itself;
+		// only an administrator can release a file
+		return nil
+	case file.Scan.Status == models.ScanInfected:
+		// Released by an administrator before this retry ran; the release
+		// already took care of the follow-up jobs
+		return nil
+	default:
+		return p.EnqueueFollowUps(ctx, file)
+	}
+}
+
+// scan streams the file to the scanner and stores the verdict on the file
+// (and on the in-memory copy, so the caller can act on it).
+func (p *Processor) scan(ctx context.Context, file *models.File) error {
+	ctx, cancel := context.WithTimeout(ctx, p.scanTimeout())
+	defer cancel()
+
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	verdict, err := p.scanner.Scan(ctx, reader)
+	if err != nil {
+		// The daemon won't accept a bigger stream on the next attempt either.
+		// The file stays unscanned and unprocessed; raising clamd's
+		// StreamMaxLength and re-running the job fixes it.
+		if errors.Is(err, scanner.ErrStreamTooLarge) {
+			return jobs.Permanent(fmt.Errorf("file %s is too large to scan: %w", file.ID.Hex(), err))
+		}
+		return err
+	}
+
+	now := time.Now()
+	result := &models.ScanResult{Status: models.ScanClean, Version: file.Version, ScannedAt: now}
+	var quarantine *models.Quarantine
+	if verdict.Infected {
+		result.Status = models.ScanInfected
+		result.Signature = verdict.Signature
+		quarantine = &models.Quarantine{Signature: verdict.Signature, QuarantinedAt: now}
+	}
+
+	if err := p.files.SetScanResult(ctx, file.ID, file.Version, result, quarantine); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			// A new version was uploaded while we scanned. Its own scan job
+			// decides what happens; this verdict is about stale content.
+			return errStaleScan
+		}
+		return err
+	}
+
+	file.Scan = result
+	if quarantine != nil {
+		file.Quarantine = quarantine
+	}
+	return nil
+}
+
+// notifyQuarantined tells the owner that their file was quarantined.
+func (p *Processor) notifyQuarantined(ctx context.Context, file *models.File) error {
+	if p.notifications == nil {
+		return nil
+	}
+
+	notification := models.NewFileNotification(
+		models.NotificationFileQuarantined,
+		file,
+		"File quarantined",
+		fmt.Sprintf("%q was quarantined because a virus was detected (%s). It can't be downloaded or shared until an administrator reviews it.",
+			file.FileName, file.Scan.Signature),
+	)
+	return p.notifications.Create(ctx, notification)
+}
+
+// scanTimeout returns the configured timeout, falling back to the default.
+func (p *Processor) scanTimeout() time.Duration {
+	if p.cfg.ScanTimeout > 0 {
+		return p.cfg.ScanTimeout
+	}
+	return defaultScanTimeout
+}
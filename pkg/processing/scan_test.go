@@ -0,0 +1,275 @@
+package processing
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/scanner"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// fakeFiles holds one file. Embedding the interface satisfies it; a call
+// to any method not overridden here panics, which flags an unexpected use.
+type fakeFiles struct {
+	repository.FileRepository
+
+	mu   sync.Mutex
+	file models.File
+}
+
+func (f *fakeFiles) GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id != f.file.ID {
+		return nil, apperrors.ErrNotFound
+	}
+	file := f.file
+	return &file, nil
+}
+
+func (f *fakeFiles) SetScanResult(ctx context.Context, id primitive.ObjectID, version int, scan *models.ScanResult, quarantine *models.Quarantine) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id != f.file.ID || version != f.file.Version {
+		return apperrors.ErrNotFound
+	}
+	f.file.Scan = scan
+	if quarantine != nil {
+		f.file.Quarantine = quarantine
+	}
+	return nil
+}
+
+func (f *fakeFiles) UpdateProcessingStatus(ctx context.Context, id primitive.ObjectID, version int, status models.ProcessingStatus) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id != f.file.ID || version != f.file.Version {
+		return apperrors.ErrNotFound
+	}
+	f.file.ProcessingStatus = status
+	return nil
+}
+
+// bump stands in for an upload of a new version.
+func (f *fakeFiles) bump() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Version++
+}
+
+func (f *fakeFiles) current() models.File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file
+}
+
+// fakeJobs records the jobs enqueued.
+type fakeJobs struct {
+	repository.JobRepository
+
+	mu      sync.Mutex
+	created []*models.ProcessingJob
+}
+
+func (j *fakeJobs) Create(ctx context.Context, job *models.ProcessingJob) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.created = append(j.created, job)
+	return nil
+}
+
+func (j *fakeJobs) types() []models.JobType {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []models.JobType
+	for _, job := range j.created {
+		out = append(out, job.Type)
+	}
+	return out
+}
+
+// fakeNotifications records the notifications sent.
+type fakeNotifications struct {
+	repository.NotificationRepository
+
+	mu   sync.Mutex
+	sent []*models.Notification
+}
+
+func (n *fakeNotifications) Create(ctx context.Context, notification *models.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func (n *fakeNotifications) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sent)
+}
+
+// blockingScanner holds a scan until release is closed, so a test can
+// change the file while the scan runs.
+type blockingScanner struct {
+	scanner.Scanner
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingScanner) Scan(ctx context.Context, r io.Reader) (*scanner.Result, error) {
+	close(s.started)
+	<-s.release
+	return s.Scanner.Scan(ctx, r)
+}
+
+type scanFixture struct {
+	processor     *Processor
+	files         *fakeFiles
+	jobs          *fakeJobs
+	notifications *fakeNotifications
+	job           *models.ProcessingJob
+}
+
+// newScanFixture stores content as version 1 of a file and wires a
+// Processor to the fake clamd.
+func newScanFixture(t *testing.T, content string, wrap func(scanner.Scanner) scanner.Scanner) *scanFixture {
+	t.Helper()
+	ctx := context.Background()
+
+	clamd, err := scanner.NewFakeClamd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clamd.Close() })
+	var client scanner.Scanner
+	if client, err = scanner.NewClamAV("tcp://"+clamd.Addr(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		client = wrap(client)
+	}
+
+	file := models.NewFile(primitive.NewObjectID(), "data.bin", int64(len(content)), "application/octet-stream", "", "bucket", "region", "")
+	file.S3Key = storage.FileKey(file.UserID, file.ID, file.FileName)
+	backend := storage.NewMemoryBackend()
+	if _, err := backend.Put(ctx, file.S3Key, strings.NewReader(content), file.FileSize, file.MimeType); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &scanFixture{
+		files:         &fakeFiles{file: *file},
+		jobs:          &fakeJobs{},
+		notifications: &fakeNotifications{},
+	}
+	broker := jobs.NewMemoryBroker()
+	t.Cleanup(func() { broker.Close() })
+
+	f.processor = NewProcessor(config.ProcessingConfig{VirusScanEnabled: true}, Deps{
+		Files:         f.files,
+		Notifications: f.notifications,
+		Storage:       backend,
+		Queue:         jobs.NewQueue(broker, f.jobs, f.files, 0),
+		Scanner:       client,
+	})
+	f.job = models.NewProcessingJob(JobScan, file.ID, file.UserID, nil)
+	f.job.FileVersion = file.Version
+	return f
+}
+
+func TestHandleScanClean(t *testing.T) {
+	f := newScanFixture(t, "just some bytes", nil)
+
+	if err := f.processor.HandleScan(context.Background(), f.job); err != nil {
+		t.Fatalf("HandleScan: %v", err)
+	}
+
+	file := f.files.current()
+	if file.Scan == nil || file.Scan.Status != models.ScanClean || file.Scan.Version != file.Version {
+		t.Fatalf("scan = %+v, want clean for version %d", file.Scan, file.Version)
+	}
+	if file.IsQuarantined() {
+		t.Fatal("a clean file was quarantined")
+	}
+	if got := f.jobs.types(); len(got) == 0 || got[0] != JobMetadata {
+		t.Fatalf("follow-up jobs = %v, want %s first", got, JobMetadata)
+	}
+	if f.notifications.count() != 0 {
+		t.Fatal("the owner was notified about a clean file")
+	}
+}
+
+func TestHandleScanInfected(t *testing.T) {
+	f := newScanFixture(t, "prefix "+scanner.EICAR+" suffix", nil)
+
+	if err := f.processor.HandleScan(context.Background(), f.job); err != nil {
+		t.Fatalf("HandleScan: %v", err)
+	}
+
+	file := f.files.current()
+	if file.Scan == nil || file.Scan.Status != models.ScanInfected || file.Scan.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("scan = %+v, want infected with Eicar-Test-Signature", file.Scan)
+	}
+	if !file.IsQuarantined() {
+		t.Fatal("an infected file was not quarantined")
+	}
+	if got := f.jobs.types(); len(got) != 0 {
+		t.Fatalf("follow-up jobs = %v for an infected file", got)
+	}
+	if f.notifications.count() != 1 {
+		t.Fatalf("notifications = %d, want 1", f.notifications.count())
+	}
+
+	// A retry after the verdict was stored only repeats the side effects
+	// (see RETRIES WITHOUT RESCANNING)
+	if err := f.processor.HandleScan(context.Background(), f.job); err != nil {
+		t.Fatalf("HandleScan retry: %v", err)
+	}
+	if got := f.jobs.types(); len(got) != 0 {
+		t.Fatalf("follow-up jobs = %v after a retry", got)
+	}
+	if f.notifications.count() != 2 {
+		t.Fatalf("notifications = %d after a retry, want 2", f.notifications.count())
+	}
+}
+
+func TestHandleScanStaleVersion(t *testing.T) {
+	var blocker *blockingScanner
+	f := newScanFixture(t, scanner.EICAR, func(s scanner.Scanner) scanner.Scanner {
+		blocker = &blockingScanner{Scanner: s, started: make(chan struct{}), release: make(chan struct{})}
+		return blocker
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- f.processor.HandleScan(context.Background(), f.job) }()
+
+	// A new version arrives while version 1 is being scanned
+	<-blocker.started
+	f.files.bump()
+	close(blocker.release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("HandleScan: %v", err)
+	}
+	file := f.files.current()
+	if file.Scan != nil || file.IsQuarantined() {
+		t.Fatalf("the stale verdict was stored: scan %+v, quarantine %+v", file.Scan, file.Quarantine)
+	}
+	if got := f.jobs.types(); len(got) != 0 {
+		t.Fatalf("follow-up jobs = %v for stale content", got)
+	}
+	if f.notifications.count() != 0 {
+		t.Fatal("the owner was notified about stale content")
+	}
+}
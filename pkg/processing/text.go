@@ -0,0 +1,106 @@
+// This file implements the text extraction job that feeds the search index.
+//
+// LEARNING NOTES:
+// ===============
+// Text comes from the same places as previews:
+//
+//	plain text   -> the first bytes of the file
+//	PDF          -> pdftotext
+//	Word, Excel  -> LibreOffice to PDF, then pdftotext
+//
+// The text is handed to the search index only - it is not stored on the
+// File document, where it would bloat every query that loads files.
+package processing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// maxTextPages bounds pdftotext on very long documents. The index keeps
+// only ContentLimit bytes anyway, which a few dozen pages easily fill.
+const maxTextPages = 50
+
+// HandleText extracts the text of a document for search.
+func (p *Processor) HandleText(ctx context.Context, job *models.ProcessingJob) error {
+	if p.search == nil {
+		return nil
+	}
+
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !file.IsActive() || file.IsQuarantined() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.previewTimeout())
+	defer cancel()
+
+	var text string
+	switch kind := p.previewKind(file); kind {
+	case previewText:
+		text, err = p.readText(ctx, file)
+	case previewPDF, previewOffice:
+		text, err = p.documentText(ctx, file, kind)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	p.search.SetContent(file.ID, file.Version, text)
+	return nil
+}
+
+// readText reads the beginning of a text file.
+func (p *Processor) readText(ctx context.Context, file *models.File) (string, error) {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, int64(p.search.ContentLimit())))
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", nil // Binary despite its MIME type; nothing to index
+	}
+	return strings.ToValidUTF8(string(trimPartialRune(data)), " "), nil
+}
+
+// documentText extracts the text of a PDF or office document.
+func (p *Processor) documentText(ctx context.Context, file *models.File, kind previewKind) (string, error) {
+	input, cleanup, err := p.stageLocally(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	pdfPath := input
+	if kind == previewOffice {
+		workDir, err := os.MkdirTemp("", "text-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(workDir)
+
+		if pdfPath, err = p.office.ConvertToPDF(ctx, input, workDir); err != nil {
+			return "", err
+		}
+	}
+	return p.pdf.ExtractText(ctx, pdfPath, maxTextPages)
+}
@@ -0,0 +1,188 @@
+// This file implements the thumbnail job.
+package processing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/draw"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// defaultThumbnailQuality is used when THUMBNAIL_QUALITY is not set
+const defaultThumbnailQuality = 85
+
+// HandleThumbnail generates every configured thumbnail size for a file.
+func (p *Processor) HandleThumbnail(ctx context.Context, job *models.ProcessingJob) error {
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil // purged while queued; nothing to do
+		}
+		return err
+	}
+	if !file.IsActive() || file.IsQuarantined() {
+		return nil
+	}
+	if !file.IsImage() {
+		return jobs.Permanent(fmt.Errorf("file %s is %s, not an image", file.ID.Hex(), file.MimeType))
+	}
+
+	thumbnails, err := p.generateThumbnails(ctx, file)
+	if err != nil {
+		return err
+	}
+	return p.storeThumbnails(ctx, file, thumbnails)
+}
+
+// storeThumbnails records the new thumbnails on the file and deletes
+// leftovers from the previous set.
+func (p *Processor) storeThumbnails(ctx context.Context, file *models.File, thumbnails []models.Thumbnail) error {
+	if err := p.files.SetThumbnails(ctx, file.ID, file.Version, thumbnails); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			// Overwritten meanwhile: a newer version has its own job, and
+			// what we just wrote belongs to nobody
+			for _, t := range thumbnails {
+				_ = p.storage.Delete(ctx, t.S3Key)
+			}
+			return nil
+		}
+		return err
+	}
+
+	// Remove the previous set, unless a rerun for the same version reused
+	// its keys
+	kept := make(map[string]bool, len(thumbnails))
+	for _, t := range thumbnails {
+		kept[t.S3Key] = true
+	}
+	for _, old := range file.Thumbnails {
+		if !kept[old.S3Key] {
+			_ = p.storage.Delete(ctx, old.S3Key)
+		}
+	}
+	return nil
+}
+
+// generateThumbnails decodes the original once and writes one thumbnail
+// per configured size.
+func (p *Processor) generateThumbnails(ctx context.Context, file *models.File) ([]models.Thumbnail, error) {
+	reader, _, err := p.storage.Get(ctx, file.S3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	src, _, err := decodeImage(reader)
+	if err != nil {
+		// Corrupt or unsupported images won't decode on a retry either
+		if errors.Is(err, image.ErrFormat) || errors.Is(err, ErrImageTooLarge) {
+			return nil, jobs.Permanent(err)
+		}
+		return nil, err
+	}
+	return p.writeThumbnails(ctx, file, src)
+}
+
+// writeThumbnails scales src to every configured size and stores the results.
+func (p *Processor) writeThumbnails(ctx context.Context, file *models.File, src *image.NRGBA) ([]models.Thumbnail, error) {
+	// FORMAT CHOICE:
+	// JPEG is much smaller for photos but has no transparency. Images with
+	// any transparent pixel (logos, screenshots with alpha) become PNG.
+	contentType, ext := "image/jpeg", ".jpg"
+	if !src.Opaque() {
+		contentType, ext = "image/png", ".png"
+	}
+
+	var thumbnails []models.Thumbnail
+	for _, size := range p.sizes() {
+		thumb := resize(src, size)
+
+		var buf bytes.Buffer
+		var err error
+		if contentType == "image/png" {
+			err = png.Encode(&buf, thumb)
+		} else {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: p.quality()})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %dpx thumbnail: %w", size, err)
+		}
+
+		key := storage.ThumbnailKey(file.UserID, file.ID, file.Version, size, ext)
+		fileSize := int64(buf.Len())
+		if _, err := p.storage.Put(ctx, key, &buf, fileSize, contentType); err != nil {
+			return nil, fmt.Errorf("failed to store %dpx thumbnail: %w", size, err)
+		}
+
+		thumbnails = append(thumbnails, models.Thumbnail{
+			Size:        size,
+			Width:       thumb.Rect.Dx(),
+			Height:      thumb.Rect.Dy(),
+			S3Key:       key,
+			ContentType: contentType,
+			FileSize:    fileSize,
+		})
+	}
+
+	return thumbnails, nil
+}
+
+// resize scales src to the given width, keeping the aspect ratio.
+// Images already narrower than width are returned unchanged (no upscaling).
+//
+// SCALING QUALITY:
+// draw.CatmullRom is a high-quality (but slower) resampling kernel.
+// For thumbnails the quality difference over bilinear is clearly visible,
+// and the cost is paid once per upload, not per view.
+func resize(src *image.NRGBA, width int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w <= width {
+		return src
+	}
+
+	height := h * width / w
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Rect, src, src.Rect, draw.Src, nil)
+	return dst
+}
+
+// sizes returns the configured sizes, sorted and without duplicates.
+func (p *Processor) sizes() []int {
+	seen := make(map[int]bool)
+	var sizes []int
+	for _, size := range p.cfg.ThumbnailSizes {
+		if size > 0 && !seen[size] {
+			seen[size] = true
+			sizes = append(sizes, size)
+		}
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// quality returns the configured JPEG quality, clamped to 1-100.
+func (p *Processor) quality() int {
+	q := p.cfg.ThumbnailQuality
+	if q <= 0 {
+		return defaultThumbnailQuality
+	}
+	if q > 100 {
+		return 100
+	}
+	return q
+}
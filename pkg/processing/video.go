@@ -0,0 +1,279 @@
+// This file implements the video jobs: poster frame + metadata, and the
+// optional web rendition.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Driving an external tool through an interface (media.FFmpeg)
+// 2. Splitting cheap and expensive work into separate jobs
+//
+// TWO JOBS, NOT ONE:
+// Probing and grabbing one frame takes a second. Transcoding can take as
+// long as the video itself. As separate jobs, the poster appears right away
+// and a slow transcode (low priority) never delays other files' thumbnails.
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/jobs"
+	"github.com/emaad/file-storage-service/pkg/media"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// Defaults used when the corresponding settings are not configured
+const (
+	defaultVideoTimeout    = 30 * time.Minute
+	defaultRenditionHeight = 720
+	defaultRenditionKbps   = 1500
+	renditionAudioKbps     = 128
+)
+
+// maxPosterOffset caps how far into a video the poster frame is taken.
+// The very first frame is often black (fade-in), so we skip ahead a little.
+const maxPosterOffset = 5 * time.Second
+
+// HandleVideo reads a video's properties into File.Metadata and stores a
+// poster frame as the file's thumbnails.
+func (p *Processor) HandleVideo(ctx context.Context, job *models.ProcessingJob) error {
+	file, err := p.videoFile(ctx, job)
+	if err != nil || file == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.videoTimeout())
+	defer cancel()
+
+	input, cleanup, err := p.stageLocally(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := p.ffmpeg.Probe(ctx, input)
+	if err != nil {
+		return permanentIfBadInput(err)
+	}
+
+	if err := p.files.SetMetadata(ctx, file.ID, videoMetadata(info)); err != nil {
+		return err
+	}
+
+	poster, err := p.extractPoster(ctx, input, info.Duration)
+	if err != nil {
+		return err
+	}
+	thumbnails, err := p.writeThumbnails(ctx, file, poster)
+	if err != nil {
+		return err
+	}
+	return p.storeThumbnails(ctx, file, thumbnails)
+}
+
+// HandleTranscode stores a low-bitrate H.264 MP4 of a video.
+func (p *Processor) HandleTranscode(ctx context.Context, job *models.ProcessingJob) error {
+	if !p.cfg.VideoRenditionEnabled {
+		return nil
+	}
+
+	file, err := p.videoFile(ctx, job)
+	if err != nil || file == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.videoTimeout())
+	defer cancel()
+
+	input, cleanup, err := p.stageLocally(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	rendition, err := p.transcode(ctx, file, input)
+	if err != nil {
+		return permanentIfBadInput(err)
+	}
+
+	renditions := []models.Rendition{*rendition}
+	if err := p.files.SetRenditions(ctx, file.ID, file.Version, renditions); err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			// A newer version has its own transcode job
+			_ = p.storage.Delete(ctx, rendition.S3Key)
+			return nil
+		}
+		return err
+	}
+
+	// The previous version's rendition, or one of another
+	// VIDEO_RENDITION_HEIGHT, is left behind
+	for _, old := range file.Renditions {
+		if old.S3Key != rendition.S3Key {
+			_ = p.storage.Delete(ctx, old.S3Key)
+		}
+	}
+	return nil
+}
+
+// videoFile loads the job's file and checks it is a video we may process.
+// A nil file with a nil error means "nothing to do".
+func (p *Processor) videoFile(ctx context.Context, job *models.ProcessingJob) (*models.File, error) {
+	if p.ffmpeg == nil {
+		return nil, jobs.Permanent(errors.New("video processing is not configured"))
+	}
+
+	file, err := p.files.GetByID(ctx, job.FileID)
+	if err != nil {
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !file.IsActive() || file.IsQuarantined() {
+		return nil, nil
+	}
+	if !file.IsVideo() {
+		return nil, jobs.Permanent(fmt.Errorf("file %s is %s, not a video", file.ID.Hex(), file.MimeType))
+	}
+	return file, nil
+}
+
+// permanentIfBadInput marks errors about the input itself as permanent: no
+// video track, or a container that would make ffmpeg open other inputs.
+func permanentIfBadInput(err error) error {
+	if errors.Is(err, media.ErrNoVideoStream) || errors.Is(err, media.ErrUnsafeContainer) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// extractPoster grabs a frame and decodes it for thumbnailing.
+func (p *Processor) extractPoster(ctx context.Context, input string, duration time.Duration) (*image.NRGBA, error) {
+	frame, err := os.CreateTemp("", "poster-*.png")
+	if err != nil {
+		return nil, err
+	}
+	frame.Close()
+	defer os.Remove(frame.Name())
+
+	if err := p.ffmpeg.ExtractFrame(ctx, input, posterOffset(duration), frame.Name()); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(frame.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	poster, _, err := decodeImage(f)
+	return poster, err
+}
+
+// transcode produces the rendition and uploads it.
+func (p *Processor) transcode(ctx context.Context, file *models.File, input string) (*models.Rendition, error) {
+	output, err := os.CreateTemp("", "rendition-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	height := p.renditionHeight()
+	opts := media.RenditionOptions{
+		MaxHeight: height,
+		VideoKbps: p.renditionKbps(),
+		AudioKbps: renditionAudioKbps,
+	}
+	if err := p.ffmpeg.Transcode(ctx, input, output.Name(), opts); err != nil {
+		return nil, err
+	}
+
+	// Probe the result: the real size depends on the source's aspect
+	// ratio, and smaller sources are not scaled up
+	info, err := p.ffmpeg.Probe(ctx, output.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(output.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%dp", height)
+	key := storage.RenditionKey(file.UserID, file.ID, file.Version, name, ".mp4")
+	if _, err := p.storage.Put(ctx, key, f, stat.Size(), "video/mp4"); err != nil {
+		return nil, fmt.Errorf("failed to store %s rendition: %w", name, err)
+	}
+
+	return &models.Rendition{
+		Name:        name,
+		Width:       info.Width,
+		Height:      info.Height,
+		S3Key:       key,
+		ContentType: "video/mp4",
+		FileSize:    stat.Size(),
+		Version:     file.Version,
+	}, nil
+}
+
+// videoMetadata converts probe results into the "video" metadata namespace.
+func videoMetadata(info *media.VideoInfo) map[string]interface{} {
+	return map[string]interface{}{
+		models.MetadataVideo: models.VideoMetadata{
+			DurationSeconds: info.Duration.Seconds(),
+			Width:           info.Width,
+			Height:          info.Height,
+			VideoCodec:      info.VideoCodec,
+			AudioCodec:      info.AudioCodec,
+			Bitrate:         info.Bitrate,
+		},
+	}
+}
+
+// posterOffset picks the poster frame position: 10% into the video, but
+// no later than maxPosterOffset.
+func posterOffset(duration time.Duration) time.Duration {
+	offset := duration / 10
+	if offset > maxPosterOffset {
+		offset = maxPosterOffset
+	}
+	return offset
+}
+
+// videoTimeout returns the configured timeout, falling back to the default.
+func (p *Processor) videoTimeout() time.Duration {
+	if p.cfg.VideoTimeout > 0 {
+		return p.cfg.VideoTimeout
+	}
+	return defaultVideoTimeout
+}
+
+// renditionHeight returns the configured height, falling back to the default.
+func (p *Processor) renditionHeight() int {
+	if p.cfg.VideoRenditionHeight > 0 {
+		return p.cfg.VideoRenditionHeight
+	}
+	return defaultRenditionHeight
+}
+
+// renditionKbps returns the configured bitrate, falling back to the default.
+func (p *Processor) renditionKbps() int {
+	if p.cfg.VideoRenditionKbps > 0 {
+		return p.cfg.VideoRenditionKbps
+	}
+	return defaultRenditionKbps
+}
@@ -0,0 +1,120 @@
+// This file implements data access for the change journal.
+//
+// LEARNING NOTES:
+// ===============
+// A COUNTER DOCUMENT PER USER:
+// MongoDB has no auto-increment. Sequence numbers come from a separate
+// change_counters collection with one document per user:
+//
+//	{ _id: <user id>, seq: 41 }
+//
+// FindOneAndUpdate with $inc and upsert bumps the counter and returns the
+// new value in one atomic step, so two concurrent appends can never get
+// the same number. The change itself is inserted afterwards - which
+// means a reader can briefly see change 43 before 42 has been written.
+// pkg/changes deals with such gaps.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// ChangeRepository stores users' change journals.
+type ChangeRepository interface {
+	// Append adds a change to change.UserID's journal, setting its ID,
+	// Seq and CreatedAt.
+	Append(ctx context.Context, change *models.Change) error
+
+	// ListSince returns a user's changes with a Seq above after, in order.
+	ListSince(ctx context.Context, userID primitive.ObjectID, after int64, limit int64) ([]*models.Change, error)
+
+	// Bounds returns the lowest Seq still in a user's journal (0 if it is
+	// empty) and the highest Seq handed out so far (0 if none).
+	Bounds(ctx context.Context, userID primitive.ObjectID) (oldest, latest int64, err error)
+}
+
+type mongoChangeRepository struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+// NewChangeRepository creates a ChangeRepository backed by MongoDB.
+func NewChangeRepository(db *mongo.Database) ChangeRepository {
+	return &mongoChangeRepository{
+		collection: db.Collection(CollectionChanges),
+		counters:   db.Collection(CollectionChangeCounters),
+	}
+}
+
+func (r *mongoChangeRepository) Append(ctx context.Context, change *models.Change) error {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.counters.FindOneAndUpdate(ctx, bson.M{"_id": change.UserID}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to allocate change sequence number")
+	}
+
+	change.ID = primitive.NewObjectID()
+	change.Seq = counter.Seq
+	change.CreatedAt = time.Now()
+	if _, err := r.collection.InsertOne(ctx, change); err != nil {
+		return apperrors.Wrap(err, "failed to record change")
+	}
+	return nil
+}
+
+func (r *mongoChangeRepository) ListSince(ctx context.Context, userID primitive.ObjectID, after int64, limit int64) ([]*models.Change, error) {
+	// Uses user_change_seq_unique_idx: { user_id: 1, seq: 1 }
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID, "seq": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query changes")
+	}
+
+	var changes []*models.Change
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode changes: %w", err)
+	}
+	return changes, nil
+}
+
+func (r *mongoChangeRepository) Bounds(ctx context.Context, userID primitive.ObjectID) (oldest, latest int64, err error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = r.counters.FindOne(ctx, bson.M{"_id": userID}).Decode(&counter)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return 0, 0, nil // No change ever
+	case err != nil:
+		return 0, 0, apperrors.Wrap(err, "failed to read change counter")
+	}
+
+	var first models.Change
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: 1}}).SetProjection(bson.M{"seq": 1})
+	err = r.collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&first)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return 0, counter.Seq, nil // All expired
+	case err != nil:
+		return 0, 0, apperrors.Wrap(err, "failed to query changes")
+	}
+	return first.Seq, counter.Seq, nil
+}
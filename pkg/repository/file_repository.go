@@ -0,0 +1,635 @@
+// This file implements data access for the files collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// FileRepository stores and queries File documents.
+type FileRepository interface {
+	// Create inserts a new file document.
+	Create(ctx context.Context, file *models.File) error
+
+	// GetByID returns a file, including soft-deleted ones.
+	// Callers check file.IsActive() when trashed files must be excluded.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error)
+
+	// Update replaces the whole document with the given file, but only if
+	// it is unchanged since it was read: the stored updated_at must still
+	// equal file.UpdatedAt. It stamps file.UpdatedAt itself, so callers
+	// leave it alone. Returns ErrEditConflict if the file changed meanwhile.
+	Update(ctx context.Context, file *models.File) error
+
+	// Delete permanently removes a file document.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// UpdateProcessingStatus sets only the processing_status field, and
+	// only if the file is still at the given version.
+	// Workers use it instead of Update so they never overwrite concurrent
+	// changes (a rename, a new share) made while the job was running.
+	UpdateProcessingStatus(ctx context.Context, id primitive.ObjectID, version int, status models.ProcessingStatus) error
+
+	// SetThumbnails replaces the list of generated thumbnails, but only if
+	// the file is still at the given version (see SetCompressedCopies).
+	SetThumbnails(ctx context.Context, id primitive.ObjectID, version int, thumbnails []models.Thumbnail) error
+
+	// SetCompressedCopies replaces the compressed copies, but only if the
+	// file is still at the given version. It returns ErrNotFound otherwise,
+	// so a job that compressed outdated content can't record it.
+	SetCompressedCopies(ctx context.Context, id primitive.ObjectID, version int, copies []models.CompressedCopy) error
+
+	// SetMetadata sets the given namespaces of File.Metadata (see
+	// models/metadata.go), leaving other namespaces untouched. A nil value
+	// removes the namespace.
+	SetMetadata(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error
+
+	// SetRenditions replaces the video renditions, but only if the file is
+	// still at the given version (see SetCompressedCopies).
+	SetRenditions(ctx context.Context, id primitive.ObjectID, version int, renditions []models.Rendition) error
+
+	// SetPreview replaces the document preview, but only if the file is
+	// still at the preview's version (see SetCompressedCopies).
+	SetPreview(ctx context.Context, id primitive.ObjectID, preview *models.DocumentPreview) error
+
+	// SetScanResult records a virus scan verdict for the given file version
+	// and, when quarantine is non-nil, quarantines the file in the same
+	// update. Returns ErrNotFound if the file has moved on to a newer version.
+	SetScanResult(ctx context.Context, id primitive.ObjectID, version int, scan *models.ScanResult, quarantine *models.Quarantine) error
+
+	// SetRetention replaces the retention lock (nil removes it), but only
+	// if the stored lock is still previous, the one the caller checked the
+	// change against. Returns ErrEditConflict otherwise.
+	SetRetention(ctx context.Context, id primitive.ObjectID, previous, lock *models.RetentionLock) error
+
+	// SetLegalHold places a legal hold, or releases it when hold is nil.
+	SetLegalHold(ctx context.Context, id primitive.ObjectID, hold *models.LegalHold) error
+
+	// ReleaseQuarantine lifts the quarantine and records who released it.
+	// Returns ErrNotFound if the file isn't quarantined.
+	ReleaseQuarantine(ctx context.Context, id primitive.ObjectID, release *models.QuarantineRelease) error
+
+	// FindQuarantined returns quarantined files, oldest detection first.
+	FindQuarantined(ctx context.Context, limit int64) ([]*models.File, error)
+
+	// FindUnderPath returns the active files stored below a folder path.
+	FindUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) ([]*models.File, error)
+
+	// SoftDeleteUnderPath marks every active file below a folder path as deleted.
+	SoftDeleteUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, deletedAt time.Time) (int64, error)
+
+	// FindTrashed returns soft-deleted files deleted before the cutoff.
+	// A nil userID searches across all users (used by the purge worker).
+	FindTrashed(ctx context.Context, userID *primitive.ObjectID, deletedBefore time.Time, limit int64) ([]*models.File, error)
+
+	// CountLockedUnderPath counts files below a folder path that carry an
+	// active retention lock or a legal hold.
+	CountLockedUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, now time.Time) (int64, error)
+
+	// AddTag adds a tag to the given files and returns how many changed.
+	AddTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error)
+
+	// RemoveTag removes a tag from the given files, or from all files
+	// when ids is nil, and returns how many changed.
+	RemoveTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error)
+
+	// ReplaceTag moves every file tagged "from" to the tag "to".
+	ReplaceTag(ctx context.Context, from, to primitive.ObjectID) error
+
+	// FindByTag returns the active files carrying a tag, newest first.
+	FindByTag(ctx context.Context, tagID primitive.ObjectID, limit int64) ([]*models.File, error)
+
+	// GetByPath returns the owner's active file at a path, compared
+	// case-insensitively.
+	GetByPath(ctx context.Context, ownerID primitive.ObjectID, filePath string) (*models.File, error)
+
+	// FindByIDs returns the active files among the given IDs, in no
+	// particular order. Missing and trashed files are left out.
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.File, error)
+
+	// TouchAccessed records when files were last read. Each entry only
+	// moves last_accessed_at forward, so an older batch arriving late
+	// can't undo a newer one.
+	TouchAccessed(ctx context.Context, accessed map[primitive.ObjectID]time.Time) error
+
+	// FindRecent returns the active files a user owns or that were shared
+	// with them directly, most recently accessed first. Files never
+	// accessed are left out.
+	FindRecent(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.File, error)
+
+	// FindSharedWith returns the active files other users shared with a
+	// user directly (not through a folder).
+	FindSharedWith(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.File, error)
+
+	// FindUnderFolders returns the active files below any of the given
+	// folders, each folder's path being matched within its owner's files.
+	FindUnderFolders(ctx context.Context, folders []*models.Folder, limit int64) ([]*models.File, error)
+
+	// ListInFolder returns one page of the active files directly inside a
+	// folder of the owner (nil folderID = top level), optionally only those
+	// carrying a tag. See Page for sorting and cursors.
+	ListInFolder(ctx context.Context, ownerID primitive.ObjectID, folderID, tagID *primitive.ObjectID, page Page) ([]*models.File, error)
+
+	// SumUnderPath counts the active files below a folder path, at any
+	// depth, and adds up their sizes.
+	SumUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) (count, size int64, err error)
+
+	// MoveUnderPath rewrites the paths of the active files below from so
+	// they are below to instead ("/A/x.txt" -> "/B/x.txt"). Used when a
+	// folder is moved or renamed; FolderID links don't change.
+	MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error)
+
+	// Walk calls fn for every file document, trashed ones included, without
+	// loading them all into memory. It stops at the first error fn returns.
+	Walk(ctx context.Context, fn func(*models.File) error) error
+}
+
+// mongoFileRepository is the MongoDB implementation of FileRepository.
+//
+// UNEXPORTED TYPE, EXPORTED CONSTRUCTOR:
+// The struct name starts with a lowercase letter, so other packages can't
+// create it directly. They must use NewFileRepository, which returns the
+// interface type. This keeps callers independent of the implementation.
+type mongoFileRepository struct {
+	collection *mongo.Collection
+}
+
+// NewFileRepository creates a FileRepository backed by MongoDB.
+func NewFileRepository(db *mongo.Database) FileRepository {
+	return &mongoFileRepository{collection: db.Collection(CollectionFiles)}
+}
+
+func (r *mongoFileRepository) Create(ctx context.Context, file *models.File) error {
+	if _, err := r.collection.InsertOne(ctx, file); err != nil {
+		return translateWriteError(err, "failed to create file")
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error) {
+	var file models.File
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&file); err != nil {
+		return nil, translateError(err)
+	}
+	return &file, nil
+}
+
+func (r *mongoFileRepository) Update(ctx context.Context, file *models.File) error {
+	// OPTIMISTIC CONCURRENCY:
+	// The caller read the file, changed it, and now writes all of it back.
+	// Anything stored in between (a retention lock, a quarantine, another
+	// user's share) would be silently undone. Every write bumps updated_at,
+	// so matching the value that was read refuses the replace instead.
+	readAt := file.UpdatedAt
+	file.UpdatedAt = time.Now()
+
+	res, err := r.collection.ReplaceOne(ctx, bson.M{"_id": file.ID, "updated_at": readAt}, file)
+	if err != nil {
+		file.UpdatedAt = readAt
+		return translateWriteError(err, "failed to update file")
+	}
+	if res.MatchedCount == 0 {
+		file.UpdatedAt = readAt
+		return missingOrChanged(ctx, r.collection, file.ID)
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return apperrors.Wrap(err, "failed to delete file")
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) UpdateProcessingStatus(ctx context.Context, id primitive.ObjectID, version int, status models.ProcessingStatus) error {
+	return r.setAtVersion(ctx, id, version, bson.M{"processing_status": status}, "failed to update processing status")
+}
+
+func (r *mongoFileRepository) SetThumbnails(ctx context.Context, id primitive.ObjectID, version int, thumbnails []models.Thumbnail) error {
+	return r.setAtVersion(ctx, id, version, bson.M{"thumbnails": thumbnails}, "failed to store thumbnails")
+}
+
+func (r *mongoFileRepository) SetCompressedCopies(ctx context.Context, id primitive.ObjectID, version int, copies []models.CompressedCopy) error {
+	update := bson.M{"$set": bson.M{"compressed_copies": copies, "updated_at": time.Now()}}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "version": version}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to store compressed copies")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) SetMetadata(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	// DOT NOTATION:
+	// {"$set": {"metadata.exif": {...}}} replaces one key inside the
+	// embedded document; {"$set": {"metadata": {...}}} would replace it all.
+	set := bson.M{"updated_at": time.Now()}
+	unset := bson.M{}
+	for key, value := range fields {
+		if value == nil {
+			unset["metadata."+key] = ""
+		} else {
+			set["metadata."+key] = value
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to update metadata")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) SetRenditions(ctx context.Context, id primitive.ObjectID, version int, renditions []models.Rendition) error {
+	update := bson.M{"$set": bson.M{"renditions": renditions, "updated_at": time.Now()}}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "version": version}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to store renditions")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) SetPreview(ctx context.Context, id primitive.ObjectID, preview *models.DocumentPreview) error {
+	update := bson.M{"$set": bson.M{"preview": preview, "updated_at": time.Now()}}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "version": preview.Version}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to store preview")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) SetScanResult(ctx context.Context, id primitive.ObjectID, version int, scan *models.ScanResult, quarantine *models.Quarantine) error {
+	fields := bson.M{"scan": scan, "updated_at": time.Now()}
+	if quarantine != nil {
+		fields["quarantine"] = quarantine
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "version": version}, bson.M{"$set": fields})
+	if err != nil {
+		return apperrors.Wrap(err, "failed to store scan result")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) SetRetention(ctx context.Context, id primitive.ObjectID, previous, lock *models.RetentionLock) error {
+	return setRetention(ctx, r.collection, id, previous, lock, "failed to update file retention")
+}
+
+func (r *mongoFileRepository) SetLegalHold(ctx context.Context, id primitive.ObjectID, hold *models.LegalHold) error {
+	return setLegalHold(ctx, r.collection, id, hold, "failed to update file legal hold")
+}
+
+func (r *mongoFileRepository) ReleaseQuarantine(ctx context.Context, id primitive.ObjectID, release *models.QuarantineRelease) error {
+	// Filtering on "quarantine exists" makes a second release a no-op that
+	// reports ErrNotFound instead of overwriting the first audit record
+	filter := bson.M{"_id": id, "quarantine": bson.M{"$exists": true}}
+	update := bson.M{
+		"$set":   bson.M{"quarantine_release": release, "updated_at": time.Now()},
+		"$unset": bson.M{"quarantine": ""},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to release quarantine")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) FindQuarantined(ctx context.Context, limit int64) ([]*models.File, error) {
+	// Uses file_quarantine_idx (partial index on quarantine)
+	filter := bson.M{"quarantine": bson.M{"$exists": true}}
+
+	opts := options.Find().SetSort(bson.D{{Key: "quarantine.quarantined_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFileRepository) FindUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) ([]*models.File, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"file_path":  underPath(folderPath),
+		"deleted_at": bson.M{"$exists": false},
+	}
+	return r.find(ctx, filter, options.Find())
+}
+
+func (r *mongoFileRepository) SoftDeleteUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, deletedAt time.Time) (int64, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"file_path":  underPath(folderPath),
+		"deleted_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"deleted_at": deletedAt, "updated_at": deletedAt}}
+
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to delete files in folder")
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *mongoFileRepository) FindTrashed(ctx context.Context, userID *primitive.ObjectID, deletedBefore time.Time, limit int64) ([]*models.File, error) {
+	filter := bson.M{"deleted_at": bson.M{"$lte": deletedBefore}}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFileRepository) CountLockedUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, now time.Time) (int64, error) {
+	filter := bson.M{
+		"user_id":   userID,
+		"file_path": underPath(folderPath),
+		"$or": bson.A{
+			bson.M{"retention.retain_until": bson.M{"$gt": now}},
+			bson.M{"legal_hold": bson.M{"$exists": true}},
+		},
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to count locked files")
+	}
+	return count, nil
+}
+
+func (r *mongoFileRepository) AddTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	return addTag(ctx, r.collection, ids, tagID)
+}
+
+func (r *mongoFileRepository) RemoveTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	return removeTag(ctx, r.collection, ids, tagID)
+}
+
+func (r *mongoFileRepository) ReplaceTag(ctx context.Context, from, to primitive.ObjectID) error {
+	return replaceTag(ctx, r.collection, from, to)
+}
+
+func (r *mongoFileRepository) FindByTag(ctx context.Context, tagID primitive.ObjectID, limit int64) ([]*models.File, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, taggedFilter(tagID), opts)
+}
+
+func (r *mongoFileRepository) GetByPath(ctx context.Context, ownerID primitive.ObjectID, filePath string) (*models.File, error) {
+	filter := bson.M{"user_id": ownerID, "file_path": filePath, "deleted_at": bson.M{"$exists": false}}
+	opts := options.FindOne().SetCollation(caseInsensitive)
+
+	var file models.File
+	if err := r.collection.FindOne(ctx, filter, opts).Decode(&file); err != nil {
+		return nil, translateError(err)
+	}
+	return &file, nil
+}
+
+func (r *mongoFileRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.File, error) {
+	filter := bson.M{"_id": bson.M{"$in": ids}, "deleted_at": bson.M{"$exists": false}}
+	return r.find(ctx, filter, options.Find())
+}
+
+func (r *mongoFileRepository) TouchAccessed(ctx context.Context, accessed map[primitive.ObjectID]time.Time) error {
+	if len(accessed) == 0 {
+		return nil
+	}
+
+	// BULK WRITE:
+	// One round trip carries every update. Unordered means MongoDB may
+	// apply them in parallel and doesn't stop at the first failure.
+	writes := make([]mongo.WriteModel, 0, len(accessed))
+	for id, at := range accessed {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$max": bson.M{"last_accessed_at": at}}))
+	}
+
+	if _, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return apperrors.Wrap(err, "failed to record file access")
+	}
+	return nil
+}
+
+func (r *mongoFileRepository) FindRecent(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.File, error) {
+	// Uses user_recent_files_idx and shared_recent_files_idx
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"user_id": userID},
+			bson.M{"shared_with.user_id": userID},
+		},
+		"last_accessed_at": bson.M{"$exists": true},
+		"deleted_at":       bson.M{"$exists": false},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_accessed_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFileRepository) FindSharedWith(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.File, error) {
+	// Uses shared_files_idx
+	filter := bson.M{
+		"shared_with.user_id": userID,
+		"user_id":             bson.M{"$ne": userID},
+		"deleted_at":          bson.M{"$exists": false},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFileRepository) FindUnderFolders(ctx context.Context, folders []*models.Folder, limit int64) ([]*models.File, error) {
+	if len(folders) == 0 {
+		return nil, nil
+	}
+
+	branches := make(bson.A, 0, len(folders))
+	for _, folder := range folders {
+		branches = append(branches, bson.M{"user_id": folder.UserID, "file_path": underPath(folder.Path)})
+	}
+	filter := bson.M{"$or": branches, "deleted_at": bson.M{"$exists": false}}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFileRepository) ListInFolder(ctx context.Context, ownerID primitive.ObjectID, folderID, tagID *primitive.ObjectID, page Page) ([]*models.File, error) {
+	// Uses folder_listing_idx (created with the listing collation)
+	filter := bson.M{
+		"user_id":    ownerID,
+		"folder_id":  folderID, // nil matches top-level files, where the field is absent
+		"deleted_at": bson.M{"$exists": false},
+	}
+	if tagID != nil {
+		filter["tag_ids"] = *tagID
+	}
+	page.apply(filter)
+	return r.find(ctx, filter, page.options())
+}
+
+func (r *mongoFileRepository) SumUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) (int64, int64, error) {
+	// AGGREGATION PIPELINE:
+	// $match selects the files, $group with a constant _id folds them all
+	// into one result document holding the count and the total size.
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id":    userID,
+			"file_path":  underPath(folderPath),
+			"deleted_at": bson.M{"$exists": false},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"count": bson.M{"$sum": 1},
+			"size":  bson.M{"$sum": "$file_size"},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, 0, apperrors.Wrap(err, "failed to sum folder contents")
+	}
+
+	var totals []struct {
+		Count int64 `bson:"count"`
+		Size  int64 `bson:"size"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode folder totals: %w", err)
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil // No files: $group produces no document at all
+	}
+	return totals[0].Count, totals[0].Size, nil
+}
+
+func (r *mongoFileRepository) MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"file_path":  underPath(from),
+		"deleted_at": bson.M{"$exists": false},
+	}
+
+	res, err := r.collection.UpdateMany(ctx, filter, replacePrefix("file_path", from, to))
+	if err != nil {
+		return 0, translateWriteError(err, "failed to move files")
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *mongoFileRepository) Walk(ctx context.Context, fn func(*models.File) error) error {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return apperrors.Wrap(err, "failed to query files")
+	}
+	defer cursor.Close(ctx)
+
+	// cursor.Next fetches batches lazily, so only one batch is in memory
+	for cursor.Next(ctx) {
+		var file models.File
+		if err := cursor.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode file: %w", err)
+		}
+		if err := fn(&file); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// set updates only the given fields (plus updated_at) of one file.
+//
+// $set VS REPLACE:
+// Update replaces the whole document, which is fine when the caller just
+// loaded it. Background workers hold a copy for a long time, so they must
+// only touch the fields they own, or they'd undo concurrent edits.
+func (r *mongoFileRepository) set(ctx context.Context, id primitive.ObjectID, fields bson.M, failMsg string) error {
+	return r.update(ctx, bson.M{"_id": id}, fields, failMsg)
+}
+
+// setAtVersion is set for derived data: it only updates the file while it
+// is still at version, so a slow job for an old version can't overwrite
+// what a newer version's job stored. A stale write reports ErrNotFound.
+func (r *mongoFileRepository) setAtVersion(ctx context.Context, id primitive.ObjectID, version int, fields bson.M, failMsg string) error {
+	return r.update(ctx, bson.M{"_id": id, "version": version}, fields, failMsg)
+}
+
+func (r *mongoFileRepository) update(ctx context.Context, filter bson.M, fields bson.M, failMsg string) error {
+	fields["updated_at"] = time.Now()
+
+	res, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return apperrors.Wrap(err, failMsg)
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+// find runs a query and decodes every result.
+//
+// CURSORS:
+// Find returns a cursor that streams documents from the server in batches.
+// cursor.All reads the remaining batches and decodes them into the slice.
+func (r *mongoFileRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*models.File, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query files")
+	}
+
+	var files []*models.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+	return files, nil
+}
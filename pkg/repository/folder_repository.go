@@ -0,0 +1,371 @@
+// This file implements data access for the folders collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// maxFolderDepth guards GetAncestors against cycles in corrupted data.
+const maxFolderDepth = 256
+
+// FolderRepository stores and queries Folder documents.
+type FolderRepository interface {
+	// Create inserts a new folder document.
+	Create(ctx context.Context, folder *models.Folder) error
+
+	// GetByID returns a folder, including soft-deleted ones.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Folder, error)
+
+	// Update replaces the whole document with the given folder if it is
+	// unchanged since it was read (see FileRepository.Update).
+	Update(ctx context.Context, folder *models.Folder) error
+
+	// SetRetention and SetLegalHold work like their FileRepository
+	// counterparts.
+	SetRetention(ctx context.Context, id primitive.ObjectID, previous, lock *models.RetentionLock) error
+	SetLegalHold(ctx context.Context, id primitive.ObjectID, hold *models.LegalHold) error
+
+	// GetByPath returns the owner's active folder at a path, compared
+	// case-insensitively.
+	GetByPath(ctx context.Context, ownerID primitive.ObjectID, folderPath string) (*models.Folder, error)
+
+	// Ensure returns the owner's active folder at folder.Path, inserting
+	// the given folder if there is none. Safe to call concurrently for the
+	// same path: exactly one folder is created and all callers get it.
+	Ensure(ctx context.Context, folder *models.Folder) (*models.Folder, error)
+
+	// GetAncestors returns the parents of a folder, nearest first,
+	// ending with the root-level folder. The folder itself is not included.
+	GetAncestors(ctx context.Context, folder *models.Folder) ([]*models.Folder, error)
+
+	// SoftDeleteSubtree marks a folder and all of its descendants as deleted.
+	SoftDeleteSubtree(ctx context.Context, folder *models.Folder, deletedAt time.Time) (int64, error)
+
+	// Delete removes a single folder document, for taking back one that
+	// was just created. Folders are trashed with SoftDeleteSubtree.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// CountLockedUnderPath counts folders below a path that carry an active
+	// retention lock or a legal hold.
+	CountLockedUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, now time.Time) (int64, error)
+
+	// AddTag, RemoveTag and ReplaceTag work like their FileRepository
+	// counterparts.
+	AddTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error)
+	RemoveTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error)
+	ReplaceTag(ctx context.Context, from, to primitive.ObjectID) error
+
+	// FindByTag returns the active folders carrying a tag, sorted by path.
+	FindByTag(ctx context.Context, tagID primitive.ObjectID, limit int64) ([]*models.Folder, error)
+
+	// FindByIDs returns the active folders among the given IDs, in no
+	// particular order.
+	FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.Folder, error)
+
+	// FindSharedWith returns the active folders other users shared with a
+	// user directly.
+	FindSharedWith(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.Folder, error)
+
+	// ListChildren returns one page of the active folders directly inside a
+	// folder of the owner (nil parentID = top level), optionally only those
+	// carrying a tag. See Page for sorting and cursors.
+	ListChildren(ctx context.Context, ownerID primitive.ObjectID, parentID, tagID *primitive.ObjectID, page Page) ([]*models.Folder, error)
+
+	// CountUnderPath counts the active folders below a path, at any depth.
+	CountUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) (int64, error)
+
+	// FindUnderPath returns the active folders below a path, at any depth,
+	// sorted by path so every folder comes after its parent.
+	FindUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) ([]*models.Folder, error)
+
+	// MoveUnderPath rewrites the paths of the active folders below from so
+	// they are below to instead. The folder at from itself is not touched.
+	MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error)
+}
+
+type mongoFolderRepository struct {
+	collection *mongo.Collection
+}
+
+// NewFolderRepository creates a FolderRepository backed by MongoDB.
+func NewFolderRepository(db *mongo.Database) FolderRepository {
+	return &mongoFolderRepository{collection: db.Collection(CollectionFolders)}
+}
+
+func (r *mongoFolderRepository) Create(ctx context.Context, folder *models.Folder) error {
+	if _, err := r.collection.InsertOne(ctx, folder); err != nil {
+		return translateWriteError(err, "failed to create folder")
+	}
+	return nil
+}
+
+func (r *mongoFolderRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Folder, error) {
+	var folder models.Folder
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&folder); err != nil {
+		return nil, translateError(err)
+	}
+	return &folder, nil
+}
+
+func (r *mongoFolderRepository) Update(ctx context.Context, folder *models.Folder) error {
+	// Conditional on updated_at, see mongoFileRepository.Update
+	readAt := folder.UpdatedAt
+	folder.UpdatedAt = time.Now()
+
+	res, err := r.collection.ReplaceOne(ctx, bson.M{"_id": folder.ID, "updated_at": readAt}, folder)
+	if err != nil {
+		folder.UpdatedAt = readAt
+		return translateWriteError(err, "failed to update folder")
+	}
+	if res.MatchedCount == 0 {
+		folder.UpdatedAt = readAt
+		return missingOrChanged(ctx, r.collection, folder.ID)
+	}
+	return nil
+}
+
+func (r *mongoFolderRepository) SetRetention(ctx context.Context, id primitive.ObjectID, previous, lock *models.RetentionLock) error {
+	return setRetention(ctx, r.collection, id, previous, lock, "failed to update folder retention")
+}
+
+func (r *mongoFolderRepository) SetLegalHold(ctx context.Context, id primitive.ObjectID, hold *models.LegalHold) error {
+	return setLegalHold(ctx, r.collection, id, hold, "failed to update folder legal hold")
+}
+
+func (r *mongoFolderRepository) GetByPath(ctx context.Context, ownerID primitive.ObjectID, folderPath string) (*models.Folder, error) {
+	// Uses folder_path_unique_idx (same collation)
+	filter := bson.M{"user_id": ownerID, "path": folderPath, "deleted_at": bson.M{"$exists": false}}
+	opts := options.FindOne().SetCollation(caseInsensitive)
+
+	var folder models.Folder
+	if err := r.collection.FindOne(ctx, filter, opts).Decode(&folder); err != nil {
+		return nil, translateError(err)
+	}
+	return &folder, nil
+}
+
+func (r *mongoFolderRepository) Ensure(ctx context.Context, folder *models.Folder) (*models.Folder, error) {
+	// FIND-OR-INSERT IN ONE STEP:
+	// An upsert with $setOnInsert returns the existing folder untouched, or
+	// inserts ours. user_id and path come from the filter, so they are left
+	// out of $setOnInsert (MongoDB rejects setting a field twice).
+	raw, err := bson.Marshal(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode folder: %w", err)
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to encode folder: %w", err)
+	}
+	delete(fields, "user_id")
+	delete(fields, "path")
+
+	filter := bson.M{"user_id": folder.UserID, "path": folder.Path, "deleted_at": bson.M{"$exists": false}}
+	update := bson.M{"$setOnInsert": fields}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetCollation(caseInsensitive)
+
+	// RACING CREATORS:
+	// Two upserts that both find nothing both try to insert; the unique
+	// index (folder_path_unique_idx) lets one win and fails the other with
+	// a duplicate key error. The loser's retry then finds the winner's folder.
+	for attempt := 0; attempt < 2; attempt++ {
+		var ensured models.Folder
+		err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&ensured)
+		if err == nil {
+			return &ensured, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, apperrors.Wrap(err, "failed to create folder")
+		}
+	}
+	return nil, apperrors.ErrConflict
+}
+
+// GetAncestors walks ParentFolderID links up to the root.
+//
+// WHY NOT ONE QUERY?
+// Folder trees are shallow in practice (a handful of levels), so following
+// parent links is cheap and, unlike path matching, stays correct while a
+// folder move is rewriting descendant paths.
+func (r *mongoFolderRepository) GetAncestors(ctx context.Context, folder *models.Folder) ([]*models.Folder, error) {
+	var ancestors []*models.Folder
+
+	parentID := folder.ParentFolderID
+	for depth := 0; parentID != nil; depth++ {
+		if depth >= maxFolderDepth {
+			return nil, apperrors.New("FOLDER_CYCLE", "Folder hierarchy is too deep or contains a cycle", http.StatusInternalServerError)
+		}
+
+		parent, err := r.GetByID(ctx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, parent)
+		parentID = parent.ParentFolderID
+	}
+
+	return ancestors, nil
+}
+
+func (r *mongoFolderRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return apperrors.Wrap(err, "failed to delete folder")
+	}
+	return nil
+}
+
+func (r *mongoFolderRepository) SoftDeleteSubtree(ctx context.Context, folder *models.Folder, deletedAt time.Time) (int64, error) {
+	filter := bson.M{
+		"user_id":    folder.UserID,
+		"deleted_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"_id": folder.ID},
+			bson.M{"path": underPath(folder.Path)},
+		},
+	}
+	update := bson.M{"$set": bson.M{"deleted_at": deletedAt, "updated_at": deletedAt}}
+
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to delete folder")
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *mongoFolderRepository) CountLockedUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, now time.Time) (int64, error) {
+	filter := bson.M{
+		"user_id": userID,
+		"path":    underPath(folderPath),
+		"$or": bson.A{
+			bson.M{"retention.retain_until": bson.M{"$gt": now}},
+			bson.M{"legal_hold": bson.M{"$exists": true}},
+		},
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to count locked folders")
+	}
+	return count, nil
+}
+
+func (r *mongoFolderRepository) AddTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	return addTag(ctx, r.collection, ids, tagID)
+}
+
+func (r *mongoFolderRepository) RemoveTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	return removeTag(ctx, r.collection, ids, tagID)
+}
+
+func (r *mongoFolderRepository) ReplaceTag(ctx context.Context, from, to primitive.ObjectID) error {
+	return replaceTag(ctx, r.collection, from, to)
+}
+
+func (r *mongoFolderRepository) FindByTag(ctx context.Context, tagID primitive.ObjectID, limit int64) ([]*models.Folder, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "path", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	return r.find(ctx, taggedFilter(tagID), opts)
+}
+
+func (r *mongoFolderRepository) FindByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*models.Folder, error) {
+	filter := bson.M{"_id": bson.M{"$in": ids}, "deleted_at": bson.M{"$exists": false}}
+	return r.find(ctx, filter, options.Find())
+}
+
+func (r *mongoFolderRepository) FindSharedWith(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.Folder, error) {
+	// Uses shared_folders_idx
+	filter := bson.M{
+		"shared_with.user_id": userID,
+		"user_id":             bson.M{"$ne": userID},
+		"deleted_at":          bson.M{"$exists": false},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "path", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoFolderRepository) ListChildren(ctx context.Context, ownerID primitive.ObjectID, parentID, tagID *primitive.ObjectID, page Page) ([]*models.Folder, error) {
+	// Uses folder_children_listing_idx (created with the listing collation)
+	filter := bson.M{
+		"user_id":          ownerID,
+		"parent_folder_id": parentID, // nil matches root-level folders
+		"deleted_at":       bson.M{"$exists": false},
+	}
+	if tagID != nil {
+		filter["tag_ids"] = *tagID
+	}
+	page.apply(filter)
+	return r.find(ctx, filter, page.options())
+}
+
+func (r *mongoFolderRepository) CountUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) (int64, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"path":       underPath(folderPath),
+		"deleted_at": bson.M{"$exists": false},
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to count subfolders")
+	}
+	return count, nil
+}
+
+func (r *mongoFolderRepository) FindUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string) ([]*models.Folder, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"path":       underPath(folderPath),
+		"deleted_at": bson.M{"$exists": false},
+	}
+	// "/A/B" sorts before "/A/B/C": a prefix always sorts first
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "path", Value: 1}}))
+}
+
+func (r *mongoFolderRepository) MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"path":       underPath(from),
+		"deleted_at": bson.M{"$exists": false},
+	}
+
+	res, err := r.collection.UpdateMany(ctx, filter, replacePrefix("path", from, to))
+	if err != nil {
+		return 0, translateWriteError(err, "failed to move subfolders")
+	}
+	return res.ModifiedCount, nil
+}
+
+// find runs a query and decodes every result.
+func (r *mongoFolderRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*models.Folder, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query folders")
+	}
+
+	var folders []*models.Folder
+	if err := cursor.All(ctx, &folders); err != nil {
+		return nil, fmt.Errorf("failed to decode folders: %w", err)
+	}
+	return folders, nil
+}
@@ -0,0 +1,187 @@
+// This file implements data access for the processing_jobs collection.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// JobRepository stores and queries ProcessingJob documents.
+type JobRepository interface {
+	// Create inserts a new job.
+	Create(ctx context.Context, job *models.ProcessingJob) error
+
+	// GetByID returns a job.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.ProcessingJob, error)
+
+	// Update replaces the whole document with the given job.
+	Update(ctx context.Context, job *models.ProcessingJob) error
+
+	// Claim atomically marks a job as running on behalf of one worker,
+	// counting the attempt and setting its lease. Only a queued job, or a
+	// running one whose lease has expired, can be claimed; anything else
+	// (finished, or running elsewhere) returns ErrNotFound.
+	Claim(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) (*models.ProcessingJob, error)
+
+	// RenewLease extends the lease of a running job.
+	RenewLease(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) error
+
+	// FindByStatus returns jobs in a status, highest priority first, then
+	// oldest first. Used to re-publish jobs after a broker outage.
+	FindByStatus(ctx context.Context, status models.JobStatus, limit int64) ([]*models.ProcessingJob, error)
+
+	// ListByFileID returns every job for a file, newest first.
+	ListByFileID(ctx context.Context, fileID primitive.ObjectID) ([]*models.ProcessingJob, error)
+
+	// ListByFileVersion returns the jobs enqueued for one version of a
+	// file, newest first.
+	ListByFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) ([]*models.ProcessingJob, error)
+
+	// SetProgress records a running job's progress without touching the
+	// rest of the document.
+	SetProgress(ctx context.Context, id primitive.ObjectID, progress *models.JobProgress) error
+}
+
+type mongoJobRepository struct {
+	collection *mongo.Collection
+}
+
+// NewJobRepository creates a JobRepository backed by MongoDB.
+func NewJobRepository(db *mongo.Database) JobRepository {
+	return &mongoJobRepository{collection: db.Collection(CollectionJobs)}
+}
+
+func (r *mongoJobRepository) Create(ctx context.Context, job *models.ProcessingJob) error {
+	if _, err := r.collection.InsertOne(ctx, job); err != nil {
+		return apperrors.Wrap(err, "failed to create processing job")
+	}
+	return nil
+}
+
+func (r *mongoJobRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.ProcessingJob, error) {
+	var job models.ProcessingJob
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		return nil, translateError(err)
+	}
+	return &job, nil
+}
+
+func (r *mongoJobRepository) Update(ctx context.Context, job *models.ProcessingJob) error {
+	res, err := r.collection.ReplaceOne(ctx, bson.M{"_id": job.ID}, job)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to update processing job")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoJobRepository) Claim(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) (*models.ProcessingJob, error) {
+	// FIND ONE AND UPDATE:
+	// The filter and the update run as one atomic operation on the
+	// document, so when a message is delivered twice only one worker's
+	// claim matches; the other gets no document back.
+	now := time.Now()
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"status": models.JobQueued},
+			// $not $gte also matches jobs without a lease
+			bson.M{"status": models.JobRunning, "lease_until": bson.M{"$not": bson.M{"$gte": now}}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      models.JobRunning,
+			"started_at":  now,
+			"lease_until": leaseUntil,
+			"updated_at":  now,
+		},
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"next_run_at": ""},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job models.ProcessingJob
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, apperrors.Wrap(err, "failed to claim processing job")
+	}
+	return &job, nil
+}
+
+func (r *mongoJobRepository) RenewLease(ctx context.Context, id primitive.ObjectID, leaseUntil time.Time) error {
+	filter := bson.M{"_id": id, "status": models.JobRunning}
+	update := bson.M{"$set": bson.M{"lease_until": leaseUntil}}
+
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to renew job lease")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoJobRepository) FindByStatus(ctx context.Context, status models.JobStatus, limit int64) ([]*models.ProcessingJob, error) {
+	// Uses job_status_priority_idx: { status: 1, priority: -1 }
+	opts := options.Find().SetSort(bson.D{
+		{Key: "priority", Value: -1},
+		{Key: "queued_at", Value: 1},
+	})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	return r.find(ctx, bson.M{"status": status}, opts)
+}
+
+func (r *mongoJobRepository) ListByFileID(ctx context.Context, fileID primitive.ObjectID) ([]*models.ProcessingJob, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "queued_at", Value: -1}})
+	return r.find(ctx, bson.M{"file_id": fileID}, opts)
+}
+
+func (r *mongoJobRepository) ListByFileVersion(ctx context.Context, fileID primitive.ObjectID, version int) ([]*models.ProcessingJob, error) {
+	// Uses job_file_idx: { file_id: 1 }; a file version has a handful of jobs
+	opts := options.Find().SetSort(bson.D{{Key: "queued_at", Value: -1}})
+	return r.find(ctx, bson.M{"file_id": fileID, "file_version": version}, opts)
+}
+
+func (r *mongoJobRepository) SetProgress(ctx context.Context, id primitive.ObjectID, progress *models.JobProgress) error {
+	update := bson.M{"$set": bson.M{"progress": progress, "updated_at": time.Now()}}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to update job progress")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoJobRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*models.ProcessingJob, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query processing jobs")
+	}
+
+	var jobs []*models.ProcessingJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode processing jobs: %w", err)
+	}
+	return jobs, nil
+}
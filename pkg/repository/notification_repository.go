@@ -0,0 +1,64 @@
+// This file implements data access for the notifications collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// NotificationRepository stores and queries Notification documents.
+type NotificationRepository interface {
+	// Create inserts a new notification.
+	Create(ctx context.Context, notification *models.Notification) error
+
+	// ListByUser returns a user's notifications, newest first.
+	ListByUser(ctx context.Context, userID primitive.ObjectID, unreadOnly bool, limit int64) ([]*models.Notification, error)
+}
+
+type mongoNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+// NewNotificationRepository creates a NotificationRepository backed by MongoDB.
+func NewNotificationRepository(db *mongo.Database) NotificationRepository {
+	return &mongoNotificationRepository{collection: db.Collection(CollectionNotifications)}
+}
+
+func (r *mongoNotificationRepository) Create(ctx context.Context, notification *models.Notification) error {
+	if _, err := r.collection.InsertOne(ctx, notification); err != nil {
+		return apperrors.Wrap(err, "failed to create notification")
+	}
+	return nil
+}
+
+func (r *mongoNotificationRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, unreadOnly bool, limit int64) ([]*models.Notification, error) {
+	// Uses user_notifications_idx: { user_id: 1, read: 1, created_at: -1 }
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read"] = false
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query notifications")
+	}
+
+	var notifications []*models.Notification
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, fmt.Errorf("failed to decode notifications: %w", err)
+	}
+	return notifications, nil
+}
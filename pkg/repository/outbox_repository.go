@@ -0,0 +1,120 @@
+// This file implements data access for the events outbox.
+//
+// LEARNING NOTES:
+// ===============
+// WRITING INSIDE A TRANSACTION:
+// Add takes no session parameter. When ctx is the mongo.SessionContext of
+// a transaction, the driver runs the insert as part of that transaction
+// automatically - which is all the outbox needs (see pkg/events/outbox.go).
+//
+// CLAIMING WITHOUT LOCKS:
+// Several relays may poll the same outbox. Claim uses FindOneAndUpdate to
+// find a due entry and push its available_at into the future in one atomic
+// step, so two relays never get the same entry while the lease lasts.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// OutboxRepository stores events waiting to be published.
+type OutboxRepository interface {
+	// Add inserts pending entries.
+	Add(ctx context.Context, entries ...*models.OutboxEntry) error
+
+	// Claim returns the pending entry that has been due the longest and
+	// hides it from other relays for lease. It returns ErrNotFound when
+	// nothing is due.
+	Claim(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error)
+
+	// MarkPublished records that the broker confirmed an entry.
+	MarkPublished(ctx context.Context, id primitive.ObjectID) error
+
+	// Release makes a claimed entry due again at retryAt, noting why its
+	// publish failed.
+	Release(ctx context.Context, id primitive.ObjectID, retryAt time.Time, reason string) error
+
+	// MarkFailed gives up on an entry that can never be published.
+	MarkFailed(ctx context.Context, id primitive.ObjectID, reason string) error
+}
+
+type mongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOutboxRepository creates an OutboxRepository backed by MongoDB.
+func NewOutboxRepository(db *mongo.Database) OutboxRepository {
+	return &mongoOutboxRepository{collection: db.Collection(CollectionEventsOutbox)}
+}
+
+func (r *mongoOutboxRepository) Add(ctx context.Context, entries ...*models.OutboxEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry
+	}
+	if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+		return apperrors.Wrap(err, "failed to add events to the outbox")
+	}
+	return nil
+}
+
+func (r *mongoOutboxRepository) Claim(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	now := time.Now()
+
+	// Uses outbox_due_idx: { status: 1, available_at: 1 }
+	filter := bson.M{"status": models.OutboxPending, "available_at": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"available_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "available_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var entry models.OutboxEntry
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry); err != nil {
+		return nil, translateError(err)
+	}
+	return &entry, nil
+}
+
+func (r *mongoOutboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"status": models.OutboxPublished, "published_at": time.Now()},
+		"$unset": bson.M{"last_error": ""},
+	}
+	return r.update(ctx, id, update, "failed to mark outbox entry published")
+}
+
+func (r *mongoOutboxRepository) Release(ctx context.Context, id primitive.ObjectID, retryAt time.Time, reason string) error {
+	update := bson.M{"$set": bson.M{"available_at": retryAt, "last_error": reason}}
+	return r.update(ctx, id, update, "failed to release outbox entry")
+}
+
+func (r *mongoOutboxRepository) MarkFailed(ctx context.Context, id primitive.ObjectID, reason string) error {
+	update := bson.M{"$set": bson.M{"status": models.OutboxFailed, "last_error": reason}}
+	return r.update(ctx, id, update, "failed to mark outbox entry failed")
+}
+
+func (r *mongoOutboxRepository) update(ctx context.Context, id primitive.ObjectID, update bson.M, message string) error {
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return apperrors.Wrap(err, message)
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// This file implements keyset ("cursor") pagination shared by listings.
+//
+// LEARNING NOTES:
+// ===============
+// WHY NOT SKIP/LIMIT?
+// "skip 10000, limit 50" makes MongoDB walk past 10000 documents on every
+// request, and if an item is added to page 1 while you read page 2, every
+// item shifts by one and you see one twice. Keyset pagination instead
+// remembers the sort values of the last item shown and asks for the items
+// AFTER it:
+//
+//	sort by (name, _id):   page 2 = name > "m.txt" OR (name = "m.txt" AND _id > X)
+//
+// That is an index range scan - equally fast on page 1 and page 1000 -
+// and insertions elsewhere don't shift anything. The _id tie-breaker makes
+// the order total, so two items with the same name can't be skipped.
+//
+// NATURAL ORDER:
+// Listings compare strings with a collation using numericOrdering, so
+// "file2" sorts before "file10", and strength 2, which ignores case
+// ("apple" and "Banana" sort as a person would expect). The same collation
+// applies to the cursor comparisons, so both always agree.
+package repository
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// naturalOrder is the collation used by listings (see above). Indexes
+// serving listings must be created with the same collation.
+var naturalOrder = &options.Collation{Locale: "en", NumericOrdering: true, Strength: 2}
+
+// Page selects one page of a keyset-paginated listing.
+type Page struct {
+	// SortFields are the BSON fields to sort by, most significant first.
+	// _id is always appended as the final tie-breaker.
+	SortFields []string
+
+	// Descending reverses the order of every field
+	Descending bool
+
+	// After holds the values of SortFields plus _id of the last item of the
+	// previous page, in the same order. Nil starts at the beginning.
+	After []interface{}
+
+	// Limit is the maximum number of items to return
+	Limit int64
+}
+
+// fields returns the sort fields including the _id tie-breaker.
+func (p Page) fields() []string {
+	return append(append([]string{}, p.SortFields...), "_id")
+}
+
+// apply adds the "after the cursor" condition to a filter, which must not
+// use $or itself.
+//
+// For fields (a, b, _id) the condition reads:
+//
+//	a > va  OR  (a = va AND b > vb)  OR  (a = va AND b = vb AND _id > vid)
+//
+// with < instead of > when descending.
+func (p Page) apply(filter bson.M) {
+	fields := p.fields()
+	if len(p.After) != len(fields) {
+		return
+	}
+
+	op := "$gt"
+	if p.Descending {
+		op = "$lt"
+	}
+
+	branches := make(bson.A, 0, len(fields))
+	for n, field := range fields {
+		branch := bson.M{field: bson.M{op: p.After[n]}}
+		for m := 0; m < n; m++ {
+			branch[fields[m]] = p.After[m]
+		}
+		branches = append(branches, branch)
+	}
+
+	filter["$or"] = branches
+}
+
+// options returns find options with the sort, limit and collation.
+func (p Page) options() *options.FindOptions {
+	direction := 1
+	if p.Descending {
+		direction = -1
+	}
+
+	sort := bson.D{}
+	for _, field := range p.fields() {
+		sort = append(sort, bson.E{Key: field, Value: direction})
+	}
+
+	opts := options.Find().SetSort(sort).SetCollation(naturalOrder)
+	if p.Limit > 0 {
+		opts.SetLimit(p.Limit)
+	}
+	return opts
+}
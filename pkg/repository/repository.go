@@ -0,0 +1,243 @@
+// Package repository provides MongoDB data access for the shared models.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. The repository pattern (hiding database details behind interfaces)
+// 2. BSON filters and updates with the official MongoDB driver
+// 3. Translating driver errors into application errors
+//
+// REPOSITORY PATTERN:
+// Business logic should not care whether data lives in MongoDB, Postgres or
+// a map in memory. A repository exposes intent-revealing methods such as
+// GetByID or FindTrashed, and hides the query syntax behind them.
+//
+//	Service  --->  FileRepository (interface)  --->  mongoFileRepository
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Collection names (must match scripts/init-mongo.js)
+const (
+	CollectionUsers         = "users"
+	CollectionFiles         = "files"
+	CollectionFolders       = "folders"
+	CollectionFileVersions  = "file_versions"
+	CollectionJobs          = "processing_jobs"
+	CollectionNotifications = "notifications"
+	CollectionTags          = "tags"
+	CollectionStars         = "stars"
+	CollectionUploads       = "uploads"
+	CollectionChanges       = "changes"
+
+	// CollectionChangeCounters holds each user's last change sequence number
+	CollectionChangeCounters = "change_counters"
+
+	// CollectionEventsOutbox holds domain events until the broker has them
+	CollectionEventsOutbox = "events_outbox"
+)
+
+// translateError converts "no documents" into our ErrNotFound so HTTP
+// handlers can return 404 without knowing about the MongoDB driver.
+func translateError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return apperrors.ErrNotFound
+	}
+	return err
+}
+
+// ErrNameTaken is returned when a write would give an owner two active
+// items with the same path. The unique path indexes enforce it, so it
+// holds even when two requests race.
+var ErrNameTaken = apperrors.New("NAME_TAKEN", "An item with this name already exists in the folder", http.StatusConflict)
+
+// ErrEditConflict is returned by Update when the document changed after the
+// caller read it. The caller reloads it and decides again.
+var ErrEditConflict = apperrors.New("EDIT_CONFLICT", "The item was changed at the same time; reload it and try again", http.StatusConflict)
+
+// translateWriteError turns a unique index violation into ErrNameTaken and
+// wraps anything else with msg.
+func translateWriteError(err error, msg string) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrNameTaken
+	}
+	return apperrors.Wrap(err, msg)
+}
+
+// missingOrChanged explains why a conditional write matched nothing: the
+// document is gone (ErrNotFound) or no longer as the caller read it
+// (ErrEditConflict).
+func missingOrChanged(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) error {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return apperrors.Wrap(err, "failed to look up document")
+	}
+	if count == 0 {
+		return apperrors.ErrNotFound
+	}
+	return ErrEditConflict
+}
+
+// caseInsensitive compares paths the way users expect names to clash:
+// "Report.pdf" and "report.pdf" are the same name. Path lookups and the
+// unique path indexes (see scripts/init-mongo.js) must use it together;
+// a query with a different collation can't use the index.
+//
+// Unlike the listing collation, it has no numericOrdering, which would
+// make "file02" and "file2" the same name.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// underPath builds a filter matching paths strictly below prefix.
+//
+// REGEX SAFETY:
+// Folder names may contain regex metacharacters like "(" or "+".
+// regexp.QuoteMeta escapes them so "/Photos (2024)" is matched literally.
+func underPath(prefix string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(prefix) + "/"}
+}
+
+// replacePrefix builds an update that swaps the leading from of a path
+// field for to, for documents matched by underPath(from).
+//
+// UPDATE PIPELINES:
+// A normal update can only set a field to a fixed value. An update written
+// as a pipeline (a bson.A of stages) can compute the new value from the
+// old one, so every document gets its own new path in one round trip:
+//
+//	"/A/x/y.txt" -> "/B" + "/x/y.txt"
+//
+// $substrBytes counts bytes, like len(from), and a negative length means
+// "to the end". updated_at is left alone: the items themselves didn't
+// change, and listings sorted by modification time shouldn't reshuffle.
+func replacePrefix(field, from, to string) bson.A {
+	return bson.A{
+		bson.M{"$set": bson.M{
+			field: bson.M{"$concat": bson.A{to, bson.M{"$substrBytes": bson.A{"$" + field, len(from), -1}}}},
+		}},
+	}
+}
+
+// setRetention writes the retention field of one file or folder. Locks
+// are never stored with Update: a compliance lock must not depend on
+// nobody else writing the whole document at the same moment.
+//
+// The filter compares the stored lock with previous as a whole embedded
+// document, so two concurrent changes can't both pass the extend/lift
+// rules against the same old lock. A nil previous matches "no lock".
+func setRetention(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, previous, lock *models.RetentionLock, failMsg string) error {
+	update := bson.M{"$set": bson.M{"retention": lock, "updated_at": time.Now()}}
+	if lock == nil {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"retention": ""}}
+	}
+
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": id, "retention": previous}, update)
+	if err != nil {
+		return apperrors.Wrap(err, failMsg)
+	}
+	if res.MatchedCount == 0 {
+		return missingOrChanged(ctx, collection, id)
+	}
+	return nil
+}
+
+// setLegalHold writes the legal_hold field of one file or folder. Unlike
+// a lock, a hold has no rules depending on the previous one, so the
+// write is unconditional.
+func setLegalHold(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, hold *models.LegalHold, failMsg string) error {
+	update := bson.M{"$set": bson.M{"legal_hold": hold, "updated_at": time.Now()}}
+	if hold == nil {
+		update = bson.M{"$set": bson.M{"updated_at": time.Now()}, "$unset": bson.M{"legal_hold": ""}}
+	}
+
+	res, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return apperrors.Wrap(err, failMsg)
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+// =============================================================================
+// AFTER COMMIT
+// =============================================================================
+
+// CommitHooks collects work that must wait until a transaction commits:
+// side writes that would otherwise make the transaction bigger and more
+// likely to conflict, and notifications that must not announce writes
+// which may still be rolled back.
+//
+// USAGE (by whoever runs the transaction, see events.Outbox.Commit):
+//
+//	hooks := repository.NewCommitHooks()
+//	_, err := session.WithTransaction(hooks.Context(ctx), func(sc mongo.SessionContext) (interface{}, error) {
+//	    hooks.Reset() // a retried attempt starts over
+//	    ...
+//	})
+//	if err == nil {
+//	    hooks.Run(ctx)
+//	}
+type CommitHooks struct {
+	mu  sync.Mutex
+	fns []func(ctx context.Context)
+}
+
+type commitHooksKey struct{}
+
+// NewCommitHooks creates an empty CommitHooks.
+func NewCommitHooks() *CommitHooks {
+	return &CommitHooks{}
+}
+
+// Context returns ctx carrying the hooks, for AfterCommit to find.
+func (h *CommitHooks) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commitHooksKey{}, h)
+}
+
+// Reset drops what an aborted attempt collected.
+func (h *CommitHooks) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = nil
+}
+
+// Run runs the collected functions with ctx, in the order they came.
+func (h *CommitHooks) Run(ctx context.Context) {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn(ctx)
+	}
+}
+
+// AfterCommit runs fn once the transaction ctx belongs to has committed,
+// with a context outside of it. Without a transaction fn runs right away.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	h, ok := ctx.Value(commitHooksKey{}).(*CommitHooks)
+	if !ok {
+		fn(ctx)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fn)
+}
@@ -0,0 +1,91 @@
+// This file implements data access for the stars collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// StarRepository stores and queries Star documents.
+type StarRepository interface {
+	// Add stars an item. Starring an already starred item keeps the
+	// original star (and its date).
+	Add(ctx context.Context, star *models.Star) error
+
+	// Remove unstars an item. Removing a star that doesn't exist is not
+	// an error.
+	Remove(ctx context.Context, userID primitive.ObjectID, itemType models.ItemType, itemID primitive.ObjectID) error
+
+	// ListByUser returns a user's stars, most recently added first.
+	ListByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.Star, error)
+
+	// CountByUser returns how many items a user has starred.
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+type mongoStarRepository struct {
+	collection *mongo.Collection
+}
+
+// NewStarRepository creates a StarRepository backed by MongoDB.
+func NewStarRepository(db *mongo.Database) StarRepository {
+	return &mongoStarRepository{collection: db.Collection(CollectionStars)}
+}
+
+func (r *mongoStarRepository) Add(ctx context.Context, star *models.Star) error {
+	// UPSERT WITH $setOnInsert:
+	// If the star exists, nothing is written; otherwise the whole document
+	// is inserted. Uses user_star_unique_idx, so two concurrent requests
+	// can't create duplicates either.
+	filter := bson.M{"user_id": star.UserID, "item_type": star.ItemType, "item_id": star.ItemID}
+	update := bson.M{"$setOnInsert": bson.M{"_id": star.ID, "created_at": star.CreatedAt}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return apperrors.Wrap(err, "failed to add star")
+	}
+	return nil
+}
+
+func (r *mongoStarRepository) Remove(ctx context.Context, userID primitive.ObjectID, itemType models.ItemType, itemID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "item_type": itemType, "item_id": itemID}
+	if _, err := r.collection.DeleteOne(ctx, filter); err != nil {
+		return apperrors.Wrap(err, "failed to remove star")
+	}
+	return nil
+}
+
+func (r *mongoStarRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*models.Star, error) {
+	// Uses user_stars_idx: { user_id: 1, created_at: -1 }
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query stars")
+	}
+
+	var stars []*models.Star
+	if err := cursor.All(ctx, &stars); err != nil {
+		return nil, fmt.Errorf("failed to decode stars: %w", err)
+	}
+	return stars, nil
+}
+
+func (r *mongoStarRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to count stars")
+	}
+	return count, nil
+}
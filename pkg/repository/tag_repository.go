@@ -0,0 +1,178 @@
+// This file implements data access for the tags collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// TagRepository stores and queries Tag documents.
+type TagRepository interface {
+	// Create inserts a new tag. Returns ErrConflict if the user already
+	// has a tag with the same key.
+	Create(ctx context.Context, tag *models.Tag) error
+
+	// GetByID returns a tag.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Tag, error)
+
+	// ListByUser returns a user's tags sorted by name.
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*models.Tag, error)
+
+	// CountByUser returns how many tags a user has.
+	CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+
+	// Update saves the name, key and color of a tag. Returns ErrConflict
+	// if the new key is taken by another of the user's tags.
+	Update(ctx context.Context, tag *models.Tag) error
+
+	// Delete removes a tag document. Items referencing it must be untagged
+	// separately (see FileRepository.RemoveTag).
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type mongoTagRepository struct {
+	collection *mongo.Collection
+}
+
+// NewTagRepository creates a TagRepository backed by MongoDB.
+func NewTagRepository(db *mongo.Database) TagRepository {
+	return &mongoTagRepository{collection: db.Collection(CollectionTags)}
+}
+
+func (r *mongoTagRepository) Create(ctx context.Context, tag *models.Tag) error {
+	// Uses user_tag_key_unique_idx: { user_id: 1, key: 1 }, unique
+	if _, err := r.collection.InsertOne(ctx, tag); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperrors.ErrConflict
+		}
+		return apperrors.Wrap(err, "failed to create tag")
+	}
+	return nil
+}
+
+func (r *mongoTagRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Tag, error) {
+	var tag models.Tag
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&tag); err != nil {
+		return nil, translateError(err)
+	}
+	return &tag, nil
+}
+
+func (r *mongoTagRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*models.Tag, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "key", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query tags")
+	}
+
+	var tags []*models.Tag
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *mongoTagRepository) CountByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to count tags")
+	}
+	return count, nil
+}
+
+func (r *mongoTagRepository) Update(ctx context.Context, tag *models.Tag) error {
+	tag.UpdatedAt = time.Now()
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": tag.ID}, bson.M{"$set": bson.M{
+		"name":       tag.Name,
+		"key":        tag.Key,
+		"color":      tag.Color,
+		"updated_at": tag.UpdatedAt,
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return apperrors.ErrConflict
+		}
+		return apperrors.Wrap(err, "failed to update tag")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoTagRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return apperrors.Wrap(err, "failed to delete tag")
+	}
+	return nil
+}
+
+// =============================================================================
+// TAGGED ITEMS
+// =============================================================================
+// Files and folders store tags the same way (a tag_ids array), so both
+// repositories share these helpers.
+//
+// Tagging doesn't touch updated_at: a tag is the user's private
+// organization, not a change to the item, and "recently modified" lists
+// shouldn't reshuffle because someone labelled a file.
+
+// addTag adds a tag to the given documents. $addToSet makes it idempotent.
+func addTag(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	res, err := collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$addToSet": bson.M{"tag_ids": tagID}},
+	)
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to add tag")
+	}
+	return res.ModifiedCount, nil
+}
+
+// removeTag removes a tag from the given documents, or from every document
+// carrying it when ids is nil.
+func removeTag(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	filter := bson.M{"tag_ids": tagID}
+	if ids != nil {
+		filter["_id"] = bson.M{"$in": ids}
+	}
+
+	res, err := collection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"tag_ids": tagID}})
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to remove tag")
+	}
+	return res.ModifiedCount, nil
+}
+
+// replaceTag moves every document from one tag to another.
+//
+// TWO UPDATES:
+// MongoDB refuses $addToSet and $pull on the same field in one update, so
+// we add the new tag first and then pull the old one. If we crash in
+// between, documents carry both tags and re-running the merge finishes
+// the job.
+func replaceTag(ctx context.Context, collection *mongo.Collection, from, to primitive.ObjectID) error {
+	filter := bson.M{"tag_ids": from}
+	if _, err := collection.UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"tag_ids": to}}); err != nil {
+		return apperrors.Wrap(err, "failed to merge tags")
+	}
+	if _, err := collection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"tag_ids": from}}); err != nil {
+		return apperrors.Wrap(err, "failed to merge tags")
+	}
+	return nil
+}
+
+// taggedFilter matches the active documents carrying a tag.
+// Uses the { tag_ids: 1 } multikey index.
+func taggedFilter(tagID primitive.ObjectID) bson.M {
+	return bson.M{"tag_ids": tagID, "deleted_at": bson.M{"$exists": false}}
+}
@@ -0,0 +1,180 @@
+// This file implements data access for the uploads collection.
+//
+// LEARNING NOTES:
+// ===============
+// WHY NOT THE FILES COLLECTION?
+// An unfinished resumable upload is a models.File with UploadStatus and
+// Chunks filled in, but it isn't a file yet: it must not show up in
+// listings, count against the name index or be found by search. Keeping
+// it in its own collection means none of the file queries need an extra
+// "and it's finished" condition. When the last byte arrives, the document
+// is deleted here and a regular file is created.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// UploadRepository stores unfinished resumable uploads.
+type UploadRepository interface {
+	// Create inserts a new upload.
+	Create(ctx context.Context, upload *models.File) error
+
+	// GetByID returns an upload, or ErrNotFound.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error)
+
+	// Lock claims an upload for writing the chunk at offset, until the
+	// given time. It returns false if the upload is at another offset or
+	// another request holds the lock.
+	Lock(ctx context.Context, id primitive.ObjectID, offset int64, until time.Time) (bool, error)
+
+	// Save replaces an upload, which also releases its lock.
+	Save(ctx context.Context, upload *models.File) error
+
+	// Unlock releases an upload's lock without changing anything else,
+	// for a write that ends without a Save.
+	Unlock(ctx context.Context, id primitive.ObjectID) error
+
+	// RecordChunk adds a chunk to an upload, replacing an earlier chunk
+	// with the same part number, and moves its expiry to expiresAt. Unlike
+	// Save it is safe for chunks that arrive concurrently.
+	RecordChunk(ctx context.Context, id primitive.ObjectID, chunk models.UploadChunk, expiresAt time.Time) error
+
+	// Delete removes an upload. Deleting a missing upload is not an error.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// FindExpired returns uploads whose expiry is before the given time.
+	FindExpired(ctx context.Context, before time.Time, limit int64) ([]*models.File, error)
+}
+
+type mongoUploadRepository struct {
+	collection *mongo.Collection
+}
+
+// NewUploadRepository creates an UploadRepository backed by MongoDB.
+func NewUploadRepository(db *mongo.Database) UploadRepository {
+	return &mongoUploadRepository{collection: db.Collection(CollectionUploads)}
+}
+
+func (r *mongoUploadRepository) Create(ctx context.Context, upload *models.File) error {
+	if _, err := r.collection.InsertOne(ctx, upload); err != nil {
+		return apperrors.Wrap(err, "failed to create upload")
+	}
+	return nil
+}
+
+func (r *mongoUploadRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.File, error) {
+	var upload models.File
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&upload); err != nil {
+		return nil, translateError(err)
+	}
+	return &upload, nil
+}
+
+func (r *mongoUploadRepository) Lock(ctx context.Context, id primitive.ObjectID, offset int64, until time.Time) (bool, error) {
+	// COMPARE-AND-SET:
+	// The filter only matches if nobody else is writing and the offset is
+	// still the one the client sent, so of two concurrent PATCH requests
+	// exactly one gets the lock. A crashed request's lock simply expires.
+	filter := bson.M{
+		"_id":              id,
+		"resumable.offset": offset,
+		"$or": bson.A{
+			bson.M{"resumable.locked_until": bson.M{"$exists": false}},
+			bson.M{"resumable.locked_until": bson.M{"$lt": time.Now()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"resumable.locked_until": until}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, apperrors.Wrap(err, "failed to lock upload")
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *mongoUploadRepository) Save(ctx context.Context, upload *models.File) error {
+	if upload.Resumable != nil {
+		upload.Resumable.LockedUntil = time.Time{}
+	}
+	upload.UpdatedAt = time.Now()
+
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": upload.ID}, upload)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to save upload")
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUploadRepository) Unlock(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"resumable.locked_until": ""}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return apperrors.Wrap(err, "failed to unlock upload")
+	}
+	return nil
+}
+
+func (r *mongoUploadRepository) RecordChunk(ctx context.Context, id primitive.ObjectID, chunk models.UploadChunk, expiresAt time.Time) error {
+	// $pull and $push can't target the same array in one update, hence two
+	filter := bson.M{"_id": id}
+	pull := bson.M{"$pull": bson.M{"chunks": bson.M{"part_number": chunk.PartNumber}}}
+	if _, err := r.collection.UpdateOne(ctx, filter, pull); err != nil {
+		return apperrors.Wrap(err, "failed to record chunk")
+	}
+
+	push := bson.M{
+		"$push": bson.M{"chunks": chunk},
+		"$set": bson.M{
+			"upload_status":        models.UploadInProgress,
+			"resumable.expires_at": expiresAt,
+			"updated_at":           time.Now(),
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, push)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to record chunk")
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUploadRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return apperrors.Wrap(err, "failed to delete upload")
+	}
+	return nil
+}
+
+func (r *mongoUploadRepository) FindExpired(ctx context.Context, before time.Time, limit int64) ([]*models.File, error) {
+	// Uses upload_expiry_idx
+	opts := options.Find().SetSort(bson.D{{Key: "resumable.expires_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"resumable.expires_at": bson.M{"$lt": before}}, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query expired uploads")
+	}
+
+	var uploads []*models.File
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, fmt.Errorf("failed to decode uploads: %w", err)
+	}
+	return uploads, nil
+}
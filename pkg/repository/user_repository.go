@@ -0,0 +1,77 @@
+// This file implements data access for the users collection.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// UserRepository stores and queries User documents.
+type UserRepository interface {
+	// GetByID returns a user by ID.
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+
+	// GetByEmail returns a user by email address (email_unique_idx).
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+
+	// AdjustStorageUsed atomically adds delta (which may be negative)
+	// to the user's storage_used counter.
+	AdjustStorageUsed(ctx context.Context, id primitive.ObjectID, delta int64) error
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewUserRepository creates a UserRepository backed by MongoDB.
+func NewUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{collection: db.Collection(CollectionUsers)}
+}
+
+func (r *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+// AdjustStorageUsed computes the new value on the server in a single update,
+// so concurrent uploads and deletes never overwrite each other's changes
+// (no read-modify-write race).
+//
+// The users collection validator requires storage_used >= 0, so a plain $inc
+// that would go negative is rejected by MongoDB. The aggregation pipeline
+// update clamps the result at zero instead.
+func (r *mongoUserRepository) AdjustStorageUsed(ctx context.Context, id primitive.ObjectID, delta int64) error {
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"storage_used": bson.M{"$max": bson.A{int64(0), bson.M{"$add": bson.A{"$storage_used", delta}}}},
+			"updated_at":   time.Now(),
+		}},
+	}
+
+	res, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return apperrors.Wrap(err, "failed to update storage usage")
+	}
+	if res.MatchedCount == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
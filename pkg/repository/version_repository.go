@@ -0,0 +1,89 @@
+// This file implements data access for the file_versions collection.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// VersionRepository stores and queries FileVersion documents.
+type VersionRepository interface {
+	// Create inserts a new version record.
+	Create(ctx context.Context, version *models.FileVersion) error
+
+	// ListByFileID returns all versions of a file, newest first.
+	ListByFileID(ctx context.Context, fileID primitive.ObjectID) ([]*models.FileVersion, error)
+
+	// MarkRestored records when a version was restored as the current
+	// content.
+	MarkRestored(ctx context.Context, id primitive.ObjectID, at time.Time) error
+
+	// Delete permanently removes a version record.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// DeleteByFileID removes every version record of a file.
+	DeleteByFileID(ctx context.Context, fileID primitive.ObjectID) error
+}
+
+type mongoVersionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewVersionRepository creates a VersionRepository backed by MongoDB.
+func NewVersionRepository(db *mongo.Database) VersionRepository {
+	return &mongoVersionRepository{collection: db.Collection(CollectionFileVersions)}
+}
+
+func (r *mongoVersionRepository) Create(ctx context.Context, version *models.FileVersion) error {
+	if _, err := r.collection.InsertOne(ctx, version); err != nil {
+		return apperrors.Wrap(err, "failed to create file version")
+	}
+	return nil
+}
+
+func (r *mongoVersionRepository) ListByFileID(ctx context.Context, fileID primitive.ObjectID) ([]*models.FileVersion, error) {
+	// Uses the file_version_idx index: { file_id: 1, version_number: -1 }
+	opts := options.Find().SetSort(bson.D{{Key: "version_number", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"file_id": fileID}, opts)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to query file versions")
+	}
+
+	var versions []*models.FileVersion
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("failed to decode file versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (r *mongoVersionRepository) MarkRestored(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.M{"$set": bson.M{"restored_at": at}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return apperrors.Wrap(err, "failed to update file version")
+	}
+	return nil
+}
+
+func (r *mongoVersionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return apperrors.Wrap(err, "failed to delete file version")
+	}
+	return nil
+}
+
+func (r *mongoVersionRepository) DeleteByFileID(ctx context.Context, fileID primitive.ObjectID) error {
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"file_id": fileID}); err != nil {
+		return apperrors.Wrap(err, "failed to delete file versions")
+	}
+	return nil
+}
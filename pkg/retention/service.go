@@ -0,0 +1,262 @@
+// This file implements placing, extending and lifting locks and holds.
+package retention
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Errors specific to managing locks
+var (
+	// ErrInvalidRetention indicates a bad mode or a date in the past
+	ErrInvalidRetention = apperrors.New("INVALID_RETENTION", "Retention mode must be governance or compliance and the date must be in the future", http.StatusBadRequest)
+
+	// ErrGovernanceLiftForbidden indicates a non-admin tried to lift a governance lock
+	ErrGovernanceLiftForbidden = apperrors.New("GOVERNANCE_LOCK", "Only administrators can shorten or remove a governance retention lock", http.StatusForbidden)
+
+	// ErrLegalHoldReleaseForbidden indicates a non-admin tried to release a legal hold
+	ErrLegalHoldReleaseForbidden = apperrors.New("LEGAL_HOLD_RELEASE_FORBIDDEN", "Only administrators can release a legal hold", http.StatusForbidden)
+)
+
+// Service manages retention locks and legal holds on files and folders.
+type Service struct {
+	files   repository.FileRepository
+	folders repository.FolderRepository
+}
+
+// NewService creates a retention Service.
+func NewService(files repository.FileRepository, folders repository.FolderRepository) *Service {
+	return &Service{files: files, folders: folders}
+}
+
+// =============================================================================
+// FILE LOCKS
+// =============================================================================
+
+// SetFileRetention places or changes the retention lock on a file.
+//
+// Extending a lock (later date, or governance -> compliance) is allowed for
+// anyone who manages the file. Shortening it or downgrading compliance to
+// governance counts as lifting and follows the lifting rules.
+func (s *Service) SetFileRetention(ctx context.Context, actor *models.User, fileID primitive.ObjectID, mode models.RetentionMode, retainUntil time.Time) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := file.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	lock, err := changeRetention(file.Retention, mode, retainUntil, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.files.SetRetention(ctx, file.ID, file.Retention, lock); err != nil {
+		return nil, err
+	}
+	file.Retention = lock
+	return file, nil
+}
+
+// RemoveFileRetention lifts the retention lock from a file.
+func (s *Service) RemoveFileRetention(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := file.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	if err := checkLift(file.Retention, actor); err != nil {
+		return nil, err
+	}
+
+	if err := s.files.SetRetention(ctx, file.ID, file.Retention, nil); err != nil {
+		return nil, err
+	}
+	file.Retention = nil
+	return file, nil
+}
+
+// SetFileLegalHold places a legal hold on a file.
+func (s *Service) SetFileLegalHold(ctx context.Context, actor *models.User, fileID primitive.ObjectID, reason string) (*models.File, error) {
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := file.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	hold := models.NewLegalHold(reason, actor.ID)
+	if err := s.files.SetLegalHold(ctx, file.ID, hold); err != nil {
+		return nil, err
+	}
+	file.LegalHold = hold
+	return file, nil
+}
+
+// ReleaseFileLegalHold removes a legal hold from a file.
+//
+// WHY ADMIN ONLY?
+// A legal hold exists to stop the owner from destroying evidence, so the
+// owner must not be able to release it themselves.
+func (s *Service) ReleaseFileLegalHold(ctx context.Context, actor *models.User, fileID primitive.ObjectID) (*models.File, error) {
+	if !actor.IsAdmin() {
+		return nil, ErrLegalHoldReleaseForbidden
+	}
+
+	file, err := s.files.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.files.SetLegalHold(ctx, file.ID, nil); err != nil {
+		return nil, err
+	}
+	file.LegalHold = nil
+	return file, nil
+}
+
+// =============================================================================
+// FOLDER LOCKS
+// =============================================================================
+// A lock on a folder protects everything beneath it. The rules for placing
+// and lifting are identical to file locks.
+
+// SetFolderRetention places or changes the retention lock on a folder.
+func (s *Service) SetFolderRetention(ctx context.Context, actor *models.User, folderID primitive.ObjectID, mode models.RetentionMode, retainUntil time.Time) (*models.Folder, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := folder.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	lock, err := changeRetention(folder.Retention, mode, retainUntil, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.folders.SetRetention(ctx, folder.ID, folder.Retention, lock); err != nil {
+		return nil, err
+	}
+	folder.Retention = lock
+	return folder, nil
+}
+
+// RemoveFolderRetention lifts the retention lock from a folder.
+func (s *Service) RemoveFolderRetention(ctx context.Context, actor *models.User, folderID primitive.ObjectID) (*models.Folder, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := folder.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	if err := checkLift(folder.Retention, actor); err != nil {
+		return nil, err
+	}
+
+	if err := s.folders.SetRetention(ctx, folder.ID, folder.Retention, nil); err != nil {
+		return nil, err
+	}
+	folder.Retention = nil
+	return folder, nil
+}
+
+// SetFolderLegalHold places a legal hold on a folder.
+func (s *Service) SetFolderLegalHold(ctx context.Context, actor *models.User, folderID primitive.ObjectID, reason string) (*models.Folder, error) {
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if permission, ok := folder.GetPermission(actor.ID); !canManage(actor, permission, ok) {
+		return nil, apperrors.ErrForbidden
+	}
+
+	hold := models.NewLegalHold(reason, actor.ID)
+	if err := s.folders.SetLegalHold(ctx, folder.ID, hold); err != nil {
+		return nil, err
+	}
+	folder.LegalHold = hold
+	return folder, nil
+}
+
+// ReleaseFolderLegalHold removes a legal hold from a folder (admins only).
+func (s *Service) ReleaseFolderLegalHold(ctx context.Context, actor *models.User, folderID primitive.ObjectID) (*models.Folder, error) {
+	if !actor.IsAdmin() {
+		return nil, ErrLegalHoldReleaseForbidden
+	}
+
+	folder, err := s.folders.GetByID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.folders.SetLegalHold(ctx, folder.ID, nil); err != nil {
+		return nil, err
+	}
+	folder.LegalHold = nil
+	return folder, nil
+}
+
+// =============================================================================
+// RULES
+// =============================================================================
+
+// canManage returns true if the actor may place locks on an item: system
+// administrators always can, otherwise the actor needs admin permission
+// on the item itself (the owner, or someone it was shared with as admin).
+func canManage(actor *models.User, permission models.FilePermission, hasAccess bool) bool {
+	return actor.IsAdmin() || (hasAccess && permission == models.PermissionAdmin)
+}
+
+// changeRetention validates a requested lock against the existing one and
+// returns the lock to store.
+func changeRetention(existing *models.RetentionLock, mode models.RetentionMode, retainUntil time.Time, actor *models.User) (*models.RetentionLock, error) {
+	now := time.Now()
+
+	if !mode.IsValid() || !retainUntil.After(now) {
+		return nil, ErrInvalidRetention
+	}
+
+	if existing.IsActive(now) {
+		shortens := retainUntil.Before(existing.RetainUntil)
+		downgrades := existing.IsCompliance() && mode != models.RetentionCompliance
+
+		if shortens || downgrades {
+			if err := checkLift(existing, actor); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return models.NewRetentionLock(mode, retainUntil, actor.ID), nil
+}
+
+// checkLift decides whether the actor may remove or weaken a lock.
+// Expired locks can always be cleaned up.
+func checkLift(existing *models.RetentionLock, actor *models.User) error {
+	if !existing.IsActive(time.Now()) {
+		return nil
+	}
+	if existing.IsCompliance() {
+		return apperrors.ErrComplianceLock
+	}
+	if !actor.IsAdmin() {
+		return ErrGovernanceLiftForbidden
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// This file turns API keys into S3 access keys.
+//
+// LEARNING NOTES:
+// ===============
+// WHY NOT USE THE API KEY AS THE SECRET:
+// SigV4 needs the secret in plain text on both sides, but we only store a
+// hash of each API key (like a password). So every API key gets an S3 key
+// pair derived from its hash with the gateway secret:
+//
+//	access key ID = USER ID (hex) + HMAC(gateway secret, "access-key:" + key hash)[:8]
+//	secret key    = base64(HMAC(gateway secret, "secret-key:" + key hash))
+//
+// The access key ID says whose key it is, so a lookup is one GetByID.
+// Nothing new is stored: revoking the API key revokes the S3 key, and
+// rotating the gateway secret revokes all S3 keys at once.
+package s3api
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Access key layout: 24 hex characters of user ID, 16 of fingerprint
+const (
+	userIDLength      = 24
+	fingerprintLength = 16
+)
+
+// Credential is an S3 key pair for one API key.
+type Credential struct {
+	Name            string     `json:"name"` // The API key's name
+	AccessKeyID     string     `json:"access_key_id"`
+	SecretAccessKey string     `json:"secret_access_key"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// credential derives the key pair of an API key.
+func (h *Handler) credential(user *models.User, key models.APIKey) Credential {
+	return Credential{
+		Name:            key.Name,
+		AccessKeyID:     strings.ToUpper(user.ID.Hex()) + h.fingerprint(key),
+		SecretAccessKey: h.secretKey(key),
+		ExpiresAt:       key.ExpiresAt,
+	}
+}
+
+func (h *Handler) fingerprint(key models.APIKey) string {
+	sum := hmacSHA256(h.secret, "access-key:"+key.Key)
+	return strings.ToUpper(hex.EncodeToString(sum)[:fingerprintLength])
+}
+
+func (h *Handler) secretKey(key models.APIKey) string {
+	sum := hmacSHA256(h.secret, "secret-key:"+key.Key)
+	return base64.StdEncoding.EncodeToString(sum[:30])
+}
+
+// lookup finds the user and secret key behind an access key ID.
+func (h *Handler) lookup(c *gin.Context, accessKey string) (*models.User, string, error) {
+	if len(accessKey) != userIDLength+fingerprintLength {
+		return nil, "", errInvalidAccessKeyID
+	}
+	userID, err := primitive.ObjectIDFromHex(strings.ToLower(accessKey[:userIDLength]))
+	if err != nil {
+		return nil, "", errInvalidAccessKeyID
+	}
+
+	user, err := h.users.GetByID(c.Request.Context(), userID)
+	if apperrors.Is(err, apperrors.ErrNotFound) {
+		return nil, "", errInvalidAccessKeyID
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.IsActive() {
+		return nil, "", errInvalidAccessKeyID
+	}
+
+	fingerprint := []byte(accessKey[userIDLength:])
+	for _, key := range user.APIKeys {
+		if !hmac.Equal([]byte(h.fingerprint(key)), fingerprint) {
+			continue
+		}
+		if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+			return nil, "", errInvalidAccessKeyID
+		}
+		return user, h.secretKey(key), nil
+	}
+	return nil, "", errInvalidAccessKeyID
+}
+
+// RegisterAPIRoutes mounts the credentials endpoint on the authenticated
+// API, next to the other JSON routes (the S3 routes have their own port).
+//
+// USAGE:
+//
+//	s3Handler.RegisterAPIRoutes(api)
+func (h *Handler) RegisterAPIRoutes(r gin.IRouter) {
+	r.GET("/s3/credentials", h.Credentials)
+}
+
+// Credentials lists an S3 key pair for each of the user's API keys.
+//
+// GET /s3/credentials
+func (h *Handler) Credentials(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	credentials := make([]Credential, 0, len(user.APIKeys))
+	for _, key := range user.APIKeys {
+		credentials = append(credentials, h.credential(user, key))
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"bucket":      BucketName,
+		"region":      h.region,
+		"credentials": credentials,
+	})
+}
@@ -0,0 +1,263 @@
+// Package s3api serves users' files over a subset of the Amazon S3 API, so
+// that S3 tools (aws s3, rclone, s3cmd, SDKs) can work with them.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Speaking someone else's protocol on top of our own service layer
+// 2. Verifying request signatures (see sigv4.go and chunked.go)
+// 3. Dispatching on method, path and query parameters by hand
+//
+// THE MAPPING:
+// Every user has exactly one bucket, "files", and its keys are paths in
+// the user's folder tree:
+//
+//	s3://files/Photos/2024/beach.jpg  <->  /Photos/2024/beach.jpg
+//	s3://files/Photos/2024/           <->  the folder /Photos/2024
+//
+// S3 has no folders, only keys that contain slashes. A key ending in "/"
+// is a "folder marker" (what the S3 console creates for "New folder"), so
+// we map those to folders. Listing with delimiter "/" shows folders as
+// CommonPrefixes, the way S3 shows shared key prefixes.
+//
+// SUPPORTED OPERATIONS:
+//
+//	GET    /                                    ListBuckets
+//	HEAD   /files                               HeadBucket
+//	GET    /files?location                      GetBucketLocation
+//	GET    /files?list-type=2                   ListObjectsV2 (and V1 without list-type)
+//	GET    /files/{key}, HEAD /files/{key}      GetObject, HeadObject (with Range)
+//	PUT    /files/{key}                         PutObject (overwrites as a new version)
+//	DELETE /files/{key}                         DeleteObject (moves to trash)
+//	POST   /files/{key}?uploads                 CreateMultipartUpload
+//	PUT    /files/{key}?partNumber=N&uploadId=X UploadPart
+//	POST   /files/{key}?uploadId=X              CompleteMultipartUpload
+//	DELETE /files/{key}?uploadId=X              AbortMultipartUpload
+//
+// Only path-style URLs are served (http://host:8090/files/key): clients
+// must be configured for path style, as they are for MinIO.
+package s3api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/folders"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// BucketName is the name of every user's only bucket.
+const BucketName = "files"
+
+// Deps holds the Handler's dependencies.
+type Deps struct {
+	Files       *files.Service
+	Folders     *folders.Service
+	Users       repository.UserRepository
+	Storage     storage.Backend
+	Secret      string // config.S3Gateway.Secret, see credentials.go
+	Region      string // config.S3Gateway.Region, reported by GetBucketLocation
+	MaxFileSize int64  // config.S3.MaxFileSize
+}
+
+// Handler serves the S3 API.
+type Handler struct {
+	files   *files.Service
+	folders *folders.Service
+	users   repository.UserRepository
+	storage storage.Backend
+	secret  []byte
+	region  string
+	maxSize int64
+}
+
+// NewHandler creates an S3 API Handler.
+func NewHandler(deps Deps) *Handler {
+	return &Handler{
+		files:   deps.Files,
+		folders: deps.Folders,
+		users:   deps.Users,
+		storage: deps.Storage,
+		secret:  []byte(deps.Secret),
+		region:  deps.Region,
+		maxSize: deps.MaxFileSize,
+	}
+}
+
+// request is an authenticated S3 request.
+type request struct {
+	c          *gin.Context
+	user       *models.User
+	sig        *signedRequest
+	signingKey []byte
+	key        string // Object key, "" for the bucket
+}
+
+// RegisterRoutes mounts the S3 API on a router. It must be the root of
+// its own engine: S3 clients put the bucket first in the path, and they
+// sign their own requests, so the JWT middleware mustn't run either.
+//
+// USAGE:
+//
+//	if cfg.S3Gateway.Enabled {
+//		s3Handler := s3api.NewHandler(s3api.Deps{...})
+//		s3Handler.RegisterAPIRoutes(api) // GET /api/v1/s3/credentials
+//
+//		gateway := gin.New()
+//		gateway.Use(gin.Recovery(), log.GinMiddleware())
+//		s3Handler.RegisterRoutes(gateway)
+//		go gateway.Run(fmt.Sprintf(":%d", cfg.S3Gateway.Port))
+//	}
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.Any("/*path", h.serve)
+}
+
+// serve authenticates a request and dispatches it to an operation.
+func (h *Handler) serve(c *gin.Context) {
+	req, err := h.authenticate(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	req.key = key
+	query := c.Request.URL.Query()
+	method := c.Request.Method
+
+	switch {
+	case bucketName == "" && method == http.MethodGet:
+		err = h.listBuckets(req)
+	case bucketName == "":
+		err = errNotImplemented
+	case bucketName != BucketName:
+		err = errNoSuchBucket
+
+	// Bucket operations
+	case key == "" && method == http.MethodHead:
+		c.Status(http.StatusOK)
+	case key == "" && method == http.MethodGet && query.Has("location"):
+		writeXML(c, http.StatusOK, locationResult{Xmlns: namespace, Location: h.location()})
+	case key == "" && method == http.MethodGet:
+		err = h.listObjects(req, query.Get("list-type") == "2")
+	case key == "" && method == http.MethodPut:
+		err = errBucketAlreadyOwned
+	case key == "":
+		err = errNotImplemented
+
+	// Object operations
+	case method == http.MethodGet, method == http.MethodHead:
+		err = h.getObject(req)
+	case method == http.MethodPut && query.Has("uploadId"):
+		err = h.uploadPart(req, query.Get("uploadId"), query.Get("partNumber"))
+	case method == http.MethodPut && c.GetHeader("X-Amz-Copy-Source") != "":
+		err = errNotImplemented
+	case method == http.MethodPut:
+		err = h.putObject(req)
+	case method == http.MethodPost && query.Has("uploads"):
+		err = h.createMultipart(req)
+	case method == http.MethodPost && query.Has("uploadId"):
+		err = h.completeMultipart(req, query.Get("uploadId"))
+	case method == http.MethodDelete && query.Has("uploadId"):
+		err = h.abortMultipart(req, query.Get("uploadId"))
+	case method == http.MethodDelete:
+		err = h.deleteObject(req)
+	default:
+		err = errNotImplemented
+	}
+
+	if err != nil {
+		writeError(c, err)
+	}
+}
+
+// authenticate checks the request's signature and finds its user.
+func (h *Handler) authenticate(c *gin.Context) (*request, error) {
+	sig, err := parseSignature(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	if sig.region != h.region {
+		// S3 answers the same way when a request is signed for another region
+		return nil, errMalformedAuth
+	}
+	if err := sig.checkTime(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	user, secret, err := h.lookup(c, sig.accessKey)
+	if err != nil {
+		return nil, err
+	}
+	if !sig.verify(c.Request, secret) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return &request{c: c, user: user, sig: sig, signingKey: sig.signingKey(secret)}, nil
+}
+
+// body returns the request body, checked against what the client signed,
+// and its decoded length.
+func (h *Handler) body(req *request) (io.Reader, int64, error) {
+	r := req.c.Request
+	size := r.ContentLength
+
+	var body io.Reader
+	switch req.sig.payloadHash {
+	case unsignedPayload:
+		body = r.Body
+	case streamingSigned, streamingTrailer:
+		// The framing makes the body longer than the content
+		decoded, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			return nil, 0, errMissingContentLength
+		}
+		size = decoded
+		if req.sig.payloadHash == streamingSigned {
+			body = newChunkedReader(r.Body, req.sig, req.signingKey)
+		} else {
+			body = newChunkedReader(r.Body, nil, nil)
+		}
+	default:
+		if len(req.sig.payloadHash) != sha256HexLength {
+			return nil, 0, errInvalidArgument
+		}
+		body = newHashingReader(r.Body, req.sig.payloadHash, size)
+	}
+
+	if size < 0 {
+		return nil, 0, errMissingContentLength
+	}
+	if h.maxSize > 0 && size > h.maxSize {
+		return nil, 0, errEntityTooLarge
+	}
+	return body, size, nil
+}
+
+// sha256HexLength is the length of a hex SHA-256 in X-Amz-Content-Sha256.
+const sha256HexLength = 64
+
+// listBuckets reports the user's one bucket.
+func (h *Handler) listBuckets(req *request) error {
+	writeXML(req.c, http.StatusOK, listBucketsResult{
+		Xmlns:   namespace,
+		Owner:   owner{ID: req.user.ID.Hex(), DisplayName: req.user.Name},
+		Buckets: []bucket{{Name: BucketName, CreationDate: formatTime(req.user.CreatedAt)}},
+	})
+	return nil
+}
+
+// location is the bucket's region as GetBucketLocation reports it.
+func (h *Handler) location() string {
+	if h.region == "us-east-1" {
+		return ""
+	}
+	return h.region
+}
@@ -0,0 +1,212 @@
+// This file implements ListObjects and ListObjectsV2.
+//
+// LEARNING NOTES:
+// ===============
+// FLAT KEYS FROM A TREE:
+// S3 lists keys in byte order, optionally grouped: with delimiter "/",
+// every key that has a "/" after the prefix is folded into one
+// CommonPrefix ("Photos/" instead of all the photos). That is a folder
+// listing, so with delimiter "/" we only load the folder the prefix points
+// into. Without a delimiter the whole subtree is loaded.
+//
+//	prefix "Photos/20"  ->  contents of /Photos, keys starting "Photos/20"
+//
+// Empty folders have no keys below them, so they are listed as folder
+// markers ("Photos/2024/") to keep them visible.
+//
+// PAGINATION:
+// The next page starts after the last key (or CommonPrefix) returned.
+// V1 calls that the marker; V2 wraps it in an opaque continuation token.
+package s3api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+)
+
+// maxListKeys is the most keys S3 returns in one listing.
+const maxListKeys = 1000
+
+// listEntry is one object of a listing.
+type listEntry struct {
+	key    string
+	object object
+}
+
+// listObjects lists the bucket, as V1 or V2.
+//
+// GET /files?list-type=2&prefix=Photos/&delimiter=/
+func (h *Handler) listObjects(req *request, v2 bool) error {
+	query := req.c.Request.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+
+	maxKeys := maxListKeys
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		return errInvalidArgument
+	}
+	encode := func(s string) string {
+		if encodingType == "" {
+			return s
+		}
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+
+	// Where this page starts
+	var after string
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				return errInvalidArgument
+			}
+			after = string(decoded)
+		}
+	} else {
+		after = query.Get("marker")
+	}
+
+	entries, err := h.listEntries(req.c.Request.Context(), req.user, prefix, delimiter == "/")
+	if err != nil {
+		return err
+	}
+
+	result := listObjectsResult{
+		Xmlns:        namespace,
+		Name:         BucketName,
+		Prefix:       encode(prefix),
+		Delimiter:    encode(delimiter),
+		MaxKeys:      maxKeys,
+		EncodingType: encodingType,
+	}
+
+	var last, lastPrefix string
+	count := 0
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.key, prefix) || entry.key <= after {
+			continue
+		}
+
+		// Keys with the delimiter after the prefix fold into a CommonPrefix
+		common := ""
+		if delimiter != "" {
+			if i := strings.Index(entry.key[len(prefix):], delimiter); i >= 0 {
+				common = entry.key[:len(prefix)+i+len(delimiter)]
+				if common == lastPrefix || common == after {
+					continue // Listed already, on this page or the last
+				}
+			}
+		}
+
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		count++
+		if common != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(common)})
+			last, lastPrefix = common, common
+			continue
+		}
+		entry.object.Key = encode(entry.key)
+		result.Contents = append(result.Contents, entry.object)
+		last = entry.key
+	}
+
+	if v2 {
+		result.KeyCount = &count
+		result.ContinuationToken = query.Get("continuation-token")
+		result.StartAfter = encode(query.Get("start-after"))
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		marker := encode(query.Get("marker"))
+		result.Marker = &marker
+		if result.IsTruncated {
+			result.NextMarker = encode(last)
+		}
+	}
+
+	writeXML(req.c, http.StatusOK, result)
+	return nil
+}
+
+// listEntries loads the objects a listing with prefix may contain, sorted
+// by key. shallow loads only the folder the prefix points into.
+func (h *Handler) listEntries(ctx context.Context, user *models.User, prefix string, shallow bool) ([]listEntry, error) {
+	dir := prefix[:strings.LastIndex(prefix, "/")+1] // "Photos/20" -> "Photos/"
+	folderPath := paths.Root + strings.TrimSuffix(dir, "/")
+	if _, err := paths.Clean(folderPath); err != nil {
+		return nil, nil // No folder can have that name, so no key has the prefix
+	}
+
+	folders, fileList, err := h.folders.Contents(ctx, user, folderPath, !shallow)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a delimiter only empty folders need markers; the others
+	// show up through the keys below them
+	nonEmpty := make(map[string]bool)
+	if !shallow {
+		for _, folder := range folders {
+			nonEmpty[parentPath(folder.Path)] = true
+		}
+		for _, file := range fileList {
+			nonEmpty[parentPath(file.FilePath)] = true
+		}
+	}
+
+	entries := make([]listEntry, 0, len(folders)+len(fileList))
+	for _, folder := range folders {
+		if nonEmpty[folder.Path] {
+			continue
+		}
+		entries = append(entries, listEntry{
+			key: strings.TrimPrefix(folder.Path, "/") + "/",
+			object: object{
+				LastModified: formatTime(folder.UpdatedAt),
+				ETag:         emptyETag,
+				StorageClass: "STANDARD",
+			},
+		})
+	}
+	for _, file := range fileList {
+		entries = append(entries, listEntry{
+			key: strings.TrimPrefix(file.FilePath, "/"),
+			object: object{
+				LastModified: formatTime(file.LastModified()),
+				ETag:         fileETag(file),
+				Size:         file.FileSize,
+				StorageClass: "STANDARD",
+			},
+		})
+	}
+
+	// S3 orders keys by their UTF-8 bytes, which is Go's string order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
+
+// parentPath returns the path of the folder containing path.
+func parentPath(path string) string {
+	return path[:strings.LastIndex(path, "/")]
+}
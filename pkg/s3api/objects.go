@@ -0,0 +1,309 @@
+// This file implements the object operations: get, put, delete and
+// multipart uploads.
+//
+// LEARNING NOTES:
+// ===============
+// ETAGS:
+// S3 clients compare ETags to tell whether an object changed. For a file
+// we use its SHA-256 checksum, which every listing also reports, so a
+// sync tool sees the same ETag whichever way it looked. (S3's own ETags
+// are MD5s, but clients only compare them for equality.)
+//
+// DELETE IS ALWAYS 204:
+// S3 answers a DELETE of a missing key with success too: afterwards the
+// key doesn't exist, which is all the client asked for. Deleted files go
+// to the trash like any other delete, so they can be restored.
+package s3api
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/paths"
+	"github.com/emaad/file-storage-service/pkg/storage"
+)
+
+// emptyETag is the ETag of a folder marker: the MD5 of no bytes, which is
+// what S3 reports for empty objects.
+const emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// maxCompleteBody bounds the CompleteMultipartUpload XML (10000 parts).
+const maxCompleteBody = 2 << 20
+
+// objectPath returns the tree path of a key and whether it names a folder.
+func objectPath(key string) (string, bool) {
+	return "/" + strings.TrimSuffix(key, "/"), strings.HasSuffix(key, "/")
+}
+
+// fileETag is the ETag of a file.
+func fileETag(file *models.File) string {
+	return `"` + file.Checksum + `"`
+}
+
+// getObject serves a file, or an empty object for a folder marker.
+//
+// GET /files/{key}
+func (h *Handler) getObject(req *request) error {
+	c, ctx := req.c, req.c.Request.Context()
+	path, isFolder := objectPath(req.key)
+
+	entry, err := h.folders.Resolve(ctx, req.user, path)
+	if err != nil {
+		return err
+	}
+
+	if isFolder {
+		if entry.Folder == nil {
+			return errNoSuchKey
+		}
+		c.Header("ETag", emptyETag)
+		c.Header("Content-Type", "application/x-directory")
+		http.ServeContent(c.Writer, c.Request, "", entry.Folder.UpdatedAt, strings.NewReader(""))
+		return nil
+	}
+	if entry.File == nil {
+		return errNoSuchKey
+	}
+
+	file, err := h.files.GetDownloadable(ctx, req.user, entry.File.ID)
+	if err != nil {
+		return err
+	}
+	content := storage.NewSeeker(ctx, h.storage, file.S3Key, file.FileSize)
+	defer content.Close()
+	if err := content.Open(); err != nil {
+		return err
+	}
+
+	c.Header("ETag", fileETag(file))
+	c.Header("Content-Type", file.MimeType)
+	http.ServeContent(c.Writer, c.Request, "", file.LastModified(), content)
+	return nil
+}
+
+// putObject stores a file at the key, or creates a folder for a marker.
+// An existing file is overwritten with a new version.
+//
+// PUT /files/{key}
+func (h *Handler) putObject(req *request) error {
+	c, ctx := req.c, req.c.Request.Context()
+	path, isFolder := objectPath(req.key)
+
+	body, size, err := h.body(req)
+	if err != nil {
+		return err
+	}
+
+	if isFolder {
+		if size != 0 {
+			return errInvalidArgument
+		}
+		if _, err := h.folders.Mkdir(ctx, req.user, path); err != nil {
+			return err
+		}
+		c.Header("ETag", emptyETag)
+		c.Status(http.StatusOK)
+		return nil
+	}
+
+	mimeType := c.ContentType()
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	result, err := h.files.Upload(ctx, req.user, files.UploadRequest{
+		Path:     path,
+		Content:  body,
+		Size:     size,
+		MimeType: mimeType,
+		Conflict: files.ConflictOverwrite,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Header("ETag", fileETag(result.File))
+	c.Status(http.StatusOK)
+	return nil
+}
+
+// deleteObject moves a file to the trash. A folder marker deletes the
+// folder only if it is empty: as long as keys below it exist, S3 would
+// still list the prefix.
+//
+// DELETE /files/{key}
+func (h *Handler) deleteObject(req *request) error {
+	ctx := req.c.Request.Context()
+	path, isFolder := objectPath(req.key)
+
+	entry, err := h.folders.Resolve(ctx, req.user, path)
+	switch {
+	case apperrors.Is(err, apperrors.ErrNotFound):
+		// Nothing to delete
+	case err != nil:
+		return err
+
+	case isFolder && entry.Folder != nil:
+		folders, fileList, err := h.folders.Contents(ctx, req.user, path, false)
+		if err != nil {
+			return err
+		}
+		if len(folders) == 0 && len(fileList) == 0 {
+			if err := h.files.DeleteFolder(ctx, req.user, entry.Folder.ID); err != nil {
+				return err
+			}
+		}
+
+	case !isFolder && entry.File != nil:
+		if err := h.files.Delete(ctx, req.user, entry.File.ID); err != nil {
+			return err
+		}
+	}
+
+	req.c.Status(http.StatusNoContent)
+	return nil
+}
+
+// =============================================================================
+// MULTIPART UPLOADS
+// =============================================================================
+
+// createMultipart starts a multipart upload.
+//
+// POST /files/{key}?uploads
+func (h *Handler) createMultipart(req *request) error {
+	path, isFolder := objectPath(req.key)
+	if isFolder {
+		return errInvalidArgument
+	}
+
+	mimeType := req.c.ContentType()
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	upload, err := h.files.StartMultipart(req.c.Request.Context(), req.user, path, mimeType, files.ConflictOverwrite)
+	if err != nil {
+		return err
+	}
+
+	writeXML(req.c, http.StatusOK, initiateMultipartResult{
+		Xmlns:    namespace,
+		Bucket:   BucketName,
+		Key:      req.key,
+		UploadID: upload.ID.Hex(),
+	})
+	return nil
+}
+
+// uploadPart stores one part of a multipart upload.
+//
+// PUT /files/{key}?partNumber=1&uploadId=...
+func (h *Handler) uploadPart(req *request, uploadID, partNumber string) error {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil {
+		return errInvalidArgument
+	}
+	id, err := h.upload(req, uploadID)
+	if err != nil {
+		return err
+	}
+	body, size, err := h.body(req)
+	if err != nil {
+		return err
+	}
+
+	chunk, err := h.files.UploadPart(req.c.Request.Context(), req.user, id, number, body, size)
+	if err != nil {
+		return uploadError(err)
+	}
+
+	req.c.Header("ETag", `"`+strings.Trim(chunk.ETag, `"`)+`"`)
+	req.c.Status(http.StatusOK)
+	return nil
+}
+
+// completeMultipart joins the listed parts into the file.
+//
+// POST /files/{key}?uploadId=...
+func (h *Handler) completeMultipart(req *request, uploadID string) error {
+	id, err := h.upload(req, uploadID)
+	if err != nil {
+		return err
+	}
+	body, _, err := h.body(req)
+	if err != nil {
+		return err
+	}
+
+	var complete completeMultipartRequest
+	if err := xml.NewDecoder(io.LimitReader(body, maxCompleteBody)).Decode(&complete); err != nil {
+		return errMalformedXML
+	}
+	parts := make([]storage.Part, len(complete.Parts))
+	for i, part := range complete.Parts {
+		parts[i] = storage.Part{Number: part.PartNumber, ETag: part.ETag}
+	}
+
+	result, err := h.files.CompleteMultipart(req.c.Request.Context(), req.user, id, parts)
+	if err != nil {
+		return uploadError(err)
+	}
+
+	writeXML(req.c, http.StatusOK, completeMultipartResult{
+		Xmlns:    namespace,
+		Location: "/" + BucketName + "/" + req.key,
+		Bucket:   BucketName,
+		Key:      req.key,
+		ETag:     fileETag(result.File),
+	})
+	return nil
+}
+
+// abortMultipart abandons a multipart upload and frees its parts.
+//
+// DELETE /files/{key}?uploadId=...
+func (h *Handler) abortMultipart(req *request, uploadID string) error {
+	id, err := h.upload(req, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := h.files.TerminateUpload(req.c.Request.Context(), req.user, id); err != nil {
+		return uploadError(err)
+	}
+	req.c.Status(http.StatusNoContent)
+	return nil
+}
+
+// upload parses an upload ID and checks that the upload belongs to the
+// request's key: upload IDs aren't secret, keys are part of the contract.
+func (h *Handler) upload(req *request, uploadID string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return primitive.NilObjectID, errNoSuchUpload
+	}
+	upload, err := h.files.GetUpload(req.c.Request.Context(), req.user, id)
+	if err != nil {
+		return primitive.NilObjectID, uploadError(err)
+	}
+
+	path, _ := objectPath(req.key)
+	if clean, err := paths.Clean(path); err != nil || clean != upload.FilePath {
+		return primitive.NilObjectID, errNoSuchUpload
+	}
+	return id, nil
+}
+
+// uploadError reports missing and expired uploads as S3 does.
+func uploadError(err error) error {
+	if apperrors.Is(err, apperrors.ErrNotFound) || apperrors.Is(err, files.ErrUploadExpired) {
+		return errNoSuchUpload
+	}
+	return err
+}
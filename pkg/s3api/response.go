@@ -0,0 +1,228 @@
+// This file defines the XML documents and errors of the S3 API.
+//
+// LEARNING NOTES:
+// ===============
+// XML, NOT JSON:
+// S3 predates JSON APIs; every response body is XML in the
+// "http://s3.amazonaws.com/doc/2006-03-01/" namespace. encoding/xml maps
+// structs to elements the way encoding/json maps them to objects:
+//
+//	Buckets []bucket `xml:"Buckets>Bucket"`   ->   <Buckets><Bucket>...</Bucket></Buckets>
+//
+// ERRORS:
+// Clients branch on the <Code> of an error ("NoSuchKey" means the object
+// isn't there, "SignatureDoesNotMatch" means wrong credentials), so our
+// application errors are translated into S3 codes before they are sent.
+package s3api
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+)
+
+// namespace is the XML namespace of S3 documents.
+const namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// timeFormat is how S3 writes times in XML (ISO 8601 with milliseconds).
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// =============================================================================
+// ERRORS
+// =============================================================================
+
+// s3Error is an error as S3 reports it.
+type s3Error struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *s3Error) Error() string { return e.Code + ": " + e.Message }
+
+// S3 errors
+var (
+	errAccessDenied          = &s3Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errInvalidAccessKeyID    = &s3Error{"InvalidAccessKeyId", "The access key ID does not exist", http.StatusForbidden}
+	errSignatureDoesNotMatch = &s3Error{"SignatureDoesNotMatch", "The request signature does not match", http.StatusForbidden}
+	errRequestTimeTooSkewed  = &s3Error{"RequestTimeTooSkewed", "The request time is too far from the server time", http.StatusForbidden}
+	errExpiredRequest        = &s3Error{"AccessDenied", "Request has expired", http.StatusForbidden}
+	errMalformedAuth         = &s3Error{"AuthorizationHeaderMalformed", "The authorization header is malformed", http.StatusBadRequest}
+	errUnsupportedSignature  = &s3Error{"InvalidRequest", "Only AWS Signature Version 4 is supported", http.StatusBadRequest}
+	errContentSHA256Mismatch = &s3Error{"XAmzContentSHA256Mismatch", "The body does not match X-Amz-Content-Sha256", http.StatusBadRequest}
+	errIncompleteBody        = &s3Error{"IncompleteBody", "The request body is incomplete or malformed", http.StatusBadRequest}
+	errMissingContentLength  = &s3Error{"MissingContentLength", "Content-Length is required", http.StatusLengthRequired}
+	errEntityTooLarge        = &s3Error{"EntityTooLarge", "The object exceeds the maximum size", http.StatusBadRequest}
+	errInvalidArgument       = &s3Error{"InvalidArgument", "Invalid argument", http.StatusBadRequest}
+	errMalformedXML          = &s3Error{"MalformedXML", "The XML is not well-formed", http.StatusBadRequest}
+	errNoSuchBucket          = &s3Error{"NoSuchBucket", "The bucket does not exist", http.StatusNotFound}
+	errNoSuchKey             = &s3Error{"NoSuchKey", "The key does not exist", http.StatusNotFound}
+	errNoSuchUpload          = &s3Error{"NoSuchUpload", "The upload does not exist", http.StatusNotFound}
+	errBucketAlreadyOwned    = &s3Error{"BucketAlreadyOwnedByYou", "Each user has exactly one bucket", http.StatusConflict}
+	errNotImplemented        = &s3Error{"NotImplemented", "This operation is not supported", http.StatusNotImplemented}
+	errInternal              = &s3Error{"InternalError", "We encountered an internal error", http.StatusInternalServerError}
+)
+
+// toS3Error translates any error into an S3 error.
+func toS3Error(err error) *s3Error {
+	var s3err *s3Error
+	if errors.As(err, &s3err) {
+		return s3err
+	}
+
+	switch {
+	case apperrors.Is(err, apperrors.ErrNotFound):
+		return errNoSuchKey
+	case apperrors.Is(err, apperrors.ErrForbidden):
+		return errAccessDenied
+	case apperrors.Is(err, files.ErrInvalidPart):
+		return &s3Error{"InvalidPart", files.ErrInvalidPart.Message, http.StatusBadRequest}
+	case apperrors.Is(err, files.ErrInvalidPartOrder):
+		return &s3Error{"InvalidPartOrder", files.ErrInvalidPartOrder.Message, http.StatusBadRequest}
+	}
+
+	// Other client errors keep our code and message; they have no S3
+	// equivalent, and clients show the message
+	if appErr, ok := apperrors.As(err); ok && appErr.StatusCode < http.StatusInternalServerError {
+		return &s3Error{appErr.Code, appErr.Message, appErr.StatusCode}
+	}
+	return errInternal
+}
+
+// errorDocument is the body of an error response.
+type errorDocument struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// writeError sends err as an S3 error response.
+func writeError(c *gin.Context, err error) {
+	s3err := toS3Error(err)
+	writeXML(c, s3err.Status, errorDocument{
+		Code:      s3err.Code,
+		Message:   s3err.Message,
+		Resource:  c.Request.URL.Path,
+		RequestID: c.GetString("request_id"),
+	})
+}
+
+// writeXML sends an XML document. HEAD responses get only the status.
+func writeXML(c *gin.Context, status int, document interface{}) {
+	c.Header("Content-Type", "application/xml")
+	c.Status(status)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	_, _ = c.Writer.WriteString(xml.Header)
+	_ = xml.NewEncoder(c.Writer).Encode(document)
+}
+
+// =============================================================================
+// DOCUMENTS
+// =============================================================================
+
+// owner identifies the user in listings.
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// listBucketsResult is the response of ListBuckets.
+type listBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   owner    `xml:"Owner"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+// locationResult is the response of GetBucketLocation. us-east-1 is
+// reported as empty, for historical reasons.
+type locationResult struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+// listObjectsResult is the response of ListObjects (V1) and
+// ListObjectsV2; each uses its own subset of the fields.
+type listObjectsResult struct {
+	XMLName xml.Name `xml:"ListBucketResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Name    string   `xml:"Name"`
+	Prefix  string   `xml:"Prefix"`
+
+	// V1
+	Marker     *string `xml:"Marker"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// V2
+	KeyCount              *int   `xml:"KeyCount"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []object       `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// initiateMultipartResult is the response of CreateMultipartUpload.
+type initiateMultipartResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// completeMultipartRequest is the body of CompleteMultipartUpload.
+type completeMultipartRequest struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+// completeMultipartResult is the response of CompleteMultipartUpload.
+type completeMultipartResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// formatTime formats a time for XML documents.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
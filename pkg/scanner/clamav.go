@@ -0,0 +1,194 @@
+// This file implements a client for the clamd socket protocol.
+//
+// LEARNING NOTES:
+// ===============
+// THE INSTREAM PROTOCOL:
+// Commands prefixed with "z" are terminated by a NUL byte (\x00).
+//
+//	client: "zINSTREAM\x00"
+//	client: <4-byte big-endian length><chunk bytes>   (repeated)
+//	client: <4 zero bytes>                            (end of stream)
+//	server: "stream: OK\x00"
+//	    or: "stream: Eicar-Test-Signature FOUND\x00"
+//	    or: "INSTREAM size limit exceeded. ERROR\x00"
+//
+// LENGTH PREFIXES:
+// The server can't tell where one chunk ends and the next begins, so every
+// chunk starts with its length. binary.BigEndian writes the number with the
+// most significant byte first ("network byte order").
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// chunkSize is how many bytes we send per INSTREAM chunk
+const chunkSize = 64 * 1024
+
+// ClamAV talks to a clamd daemon.
+type ClamAV struct {
+	network string        // "tcp" or "unix"
+	address string        // "host:port" or socket path
+	timeout time.Duration // Upper bound for one scan
+}
+
+// NewClamAV creates a client from an address such as
+// "tcp://clamav:3310" or "unix:///var/run/clamav/clamd.ctl".
+func NewClamAV(address string, timeout time.Duration) (*ClamAV, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address %q: %w", address, err)
+	}
+
+	c := &ClamAV{timeout: timeout}
+	switch u.Scheme {
+	case "tcp":
+		c.network, c.address = "tcp", u.Host
+	case "unix":
+		c.network, c.address = "unix", u.Path
+	default:
+		return nil, fmt.Errorf("invalid clamd address %q: scheme must be tcp or unix", address)
+	}
+	return c, nil
+}
+
+// Ping checks that the daemon is reachable.
+func (c *ClamAV) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd and interprets the verdict.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	writeErr := c.stream(conn, r)
+
+	// Even if writing failed, clamd may have told us why before closing
+	// the connection (typically the size limit), so always try to read.
+	reply, readErr := readReply(conn)
+	if readErr != nil {
+		if writeErr != nil {
+			return nil, writeErr
+		}
+		return nil, readErr
+	}
+
+	result, err := parseReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	// clamd answered before we finished sending: a detection is still a
+	// detection, but "OK" only covers part of the file and means nothing
+	if writeErr != nil && !result.Infected {
+		return nil, writeErr
+	}
+	return result, nil
+}
+
+// stream sends the INSTREAM command, the content and the terminator.
+func (c *ClamAV) stream(conn net.Conn, r io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	// One buffer holds the 4-byte length followed by the chunk, so each
+	// chunk goes out in a single Write call.
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// A zero-length chunk ends the stream
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// dial connects and applies a deadline to the whole conversation.
+func (c *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+
+	// DEADLINES:
+	// A deadline makes every Read/Write fail once the time has passed,
+	// which protects us from a daemon that accepts but never answers.
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if !deadline.IsZero() {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// readReply reads one NUL-terminated reply.
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseReply interprets a scan verdict.
+func parseReply(reply string) (*Result, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.Contains(verdict, "size limit exceeded"):
+		return nil, ErrStreamTooLarge
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, verdict)
+	}
+}
@@ -0,0 +1,45 @@
+// Package scanner checks file content for malware.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Speaking a simple binary protocol over a raw TCP/Unix socket
+// 2. Deadlines on net.Conn so a stuck daemon can't hang a worker
+// 3. A fake server for local development and tests
+//
+// CLAMAV:
+// ClamAV is an open-source antivirus engine. Its daemon (clamd) listens on
+// a socket and scans whatever bytes we stream to it with the INSTREAM
+// command. Any daemon that speaks the same protocol works with this client.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Result is the outcome of scanning one stream.
+type Result struct {
+	// Infected is true if a signature matched
+	Infected bool
+
+	// Signature names the detected threat, e.g. "Eicar-Test-Signature"
+	Signature string
+}
+
+// Scanner scans content for malware.
+type Scanner interface {
+	// Scan reads r to the end and reports whether it is infected.
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// Errors returned by scanners
+var (
+	// ErrStreamTooLarge means the daemon refused to scan the whole file
+	// (clamd's StreamMaxLength setting). Retrying won't help.
+	ErrStreamTooLarge = errors.New("scanner: stream exceeds the daemon's size limit")
+
+	// ErrScanFailed means the daemon reported an error for this stream
+	ErrScanFailed = errors.New("scanner: scan failed")
+)
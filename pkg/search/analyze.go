@@ -0,0 +1,164 @@
+// This file turns text into index terms and compares terms loosely.
+//
+// LEARNING NOTES:
+// ===============
+// ANALYSIS:
+// Before text goes into an inverted index it is "analyzed": split into
+// words (tokens) and normalized, so that a search for "report" finds
+// "Q3-Report.PDF". Queries go through the same analysis, which is what
+// makes the two comparable.
+//
+//	"Q3-Report_final.PDF"  ->  ["q3", "report", "final", "pdf"]
+//
+// EDIT DISTANCE:
+// Fuzzy matching counts the single-character edits (insert, delete,
+// substitute, swap two neighbours) needed to turn one word into another:
+// "recieve" -> "receive" is one swap. We accept small distances as typos.
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// maxTermLength drops "words" that are really hashes or base64 blobs.
+const maxTermLength = 64
+
+// tokenize splits text into lowercase terms.
+//
+// Anything that isn't a letter or digit separates words, so file name
+// conventions (dashes, underscores, dots, camera prefixes) all split the
+// same way.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if utf8.RuneCountInString(field) > maxTermLength {
+			continue
+		}
+		terms = append(terms, strings.ToLower(field))
+	}
+	return terms
+}
+
+// uniqueTerms tokenizes text and removes duplicates. The index only records
+// whether a term occurs in a field, not how often.
+func uniqueTerms(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, term := range tokenize(text) {
+		set[term] = struct{}{}
+	}
+	return set
+}
+
+// maxEdits is how many typos a query term may contain. Short words get
+// none: with one edit, "cat" would also match "car", "hat" and "at".
+func maxEdits(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// withinEdits reports whether a and b differ by at most limit edits, where
+// swapping two neighbouring letters counts as one edit ("reciept").
+//
+// DYNAMIC PROGRAMMING:
+// cur[j] holds the distance between the first i runes of a and the first
+// j runes of b, computed from the previous row (and the one before that,
+// for swaps). If a whole row exceeds the limit, no later row can get below
+// it, so we stop early.
+func withinEdits(a, b string, limit int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return false
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return false
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)] <= limit
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// metadataText collects the searchable strings of File.Metadata: camera
+// models, ID3 artists, PDF authors and so on.
+//
+// The content namespace is skipped - "application/pdf" is already indexed
+// as the MIME type, and a detected type is not something users type in.
+func metadataText(file *models.File) string {
+	var b strings.Builder
+	for namespace, value := range file.Metadata {
+		if namespace == models.MetadataContent || value == nil {
+			continue
+		}
+		// Values are structs when freshly extracted and documents when
+		// loaded from MongoDB; a BSON round trip reads both the same way
+		raw, err := bson.Marshal(value)
+		if err != nil {
+			continue
+		}
+		collectStrings(bson.Raw(raw), &b)
+	}
+	return b.String()
+}
+
+// collectStrings appends every string value of a document, recursing into
+// nested documents and arrays.
+func collectStrings(doc bson.Raw, b *strings.Builder) {
+	values, err := doc.Values()
+	if err != nil {
+		return
+	}
+	for _, value := range values {
+		switch value.Type {
+		case bson.TypeString:
+			b.WriteString(value.StringValue())
+			b.WriteByte(' ')
+		case bson.TypeEmbeddedDocument:
+			collectStrings(value.Document(), b)
+		case bson.TypeArray:
+			collectStrings(value.Array(), b)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// This file exposes search over HTTP.
+package search
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+)
+
+// dateLayout is accepted for date filters besides full RFC 3339 timestamps.
+const dateLayout = "2006-01-02"
+
+// Handler serves the search endpoint.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a search Handler.
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the search routes on a router group.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	r.GET("/search", h.Search)
+}
+
+// Search runs a search for the current user.
+//
+// GET /search?q=quarterly+report&type=document&modified_after=2024-01-01
+//
+// Parameters (all optional):
+//
+//	q                 words to find; each must match (as a prefix is enough)
+//	fuzzy             "true" to tolerate typos
+//	type              image, video, audio, document, text, archive,
+//	                  a MIME type or a wildcard like image/*
+//	min_size          bytes
+//	max_size          bytes
+//	created_after     2024-01-31 or 2024-01-31T12:00:00Z (likewise below)
+//	created_before
+//	modified_after
+//	modified_before
+//	owner             user ID
+//	shared_with_me    "true" for files others shared with you
+//	tag               tag ID; repeat to require several tags
+//	limit, offset     paging (default 20 results, at most 100)
+func (h *Handler) Search(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	query, err := parseQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	results, err := h.service.Search(c.Request.Context(), user, query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// parseQuery reads a Query from the URL parameters.
+//
+// The parse helpers share one error variable: the first failure is
+// remembered and the rest become no-ops, so the code below reads as a flat
+// list instead of a dozen "if err != nil" blocks.
+func parseQuery(c *gin.Context) (Query, error) {
+	var firstErr error
+	fail := func(name string) {
+		if firstErr == nil {
+			firstErr = apperrors.New("INVALID_SEARCH_QUERY", fmt.Sprintf("Invalid value for %q", name), http.StatusBadRequest)
+		}
+	}
+
+	parseInt := func(name string) int64 {
+		raw := c.Query(name)
+		if raw == "" {
+			return 0
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 0 {
+			fail(name)
+		}
+		return value
+	}
+	parseBool := func(name string) bool {
+		raw := c.Query(name)
+		if raw == "" {
+			return false
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			fail(name)
+		}
+		return value
+	}
+	parseTime := func(name string) time.Time {
+		raw := c.Query(name)
+		if raw == "" {
+			return time.Time{}
+		}
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t
+		}
+		t, err := time.Parse(dateLayout, raw)
+		if err != nil {
+			fail(name)
+		}
+		return t
+	}
+
+	query := Query{
+		Text:           c.Query("q"),
+		Fuzzy:          parseBool("fuzzy"),
+		Type:           c.Query("type"),
+		MinSize:        parseInt("min_size"),
+		MaxSize:        parseInt("max_size"),
+		CreatedAfter:   parseTime("created_after"),
+		CreatedBefore:  endOfDay(c.Query("created_before"), parseTime("created_before")),
+		ModifiedAfter:  parseTime("modified_after"),
+		ModifiedBefore: endOfDay(c.Query("modified_before"), parseTime("modified_before")),
+		SharedWithMe:   parseBool("shared_with_me"),
+		Limit:          int(parseInt("limit")),
+		Offset:         int(parseInt("offset")),
+	}
+
+	if raw := c.Query("owner"); raw != "" {
+		ownerID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			fail("owner")
+		}
+		query.OwnerID = &ownerID
+	}
+	for _, raw := range c.QueryArray("tag") {
+		tagID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			fail("tag")
+		}
+		query.TagIDs = append(query.TagIDs, tagID)
+	}
+	if query.Type != "" && !IsValidType(query.Type) {
+		fail("type")
+	}
+
+	return query, firstErr
+}
+
+// endOfDay makes a date-only upper bound inclusive: modified_before=2024-01-31
+// should include files changed during January 31st.
+func endOfDay(raw string, t time.Time) time.Time {
+	if len(raw) == len(dateLayout) && !t.IsZero() {
+		return t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t
+}
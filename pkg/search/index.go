@@ -0,0 +1,634 @@
+// This file implements the inverted index.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. An inverted index: term -> documents containing it
+// 2. sync.RWMutex for many concurrent readers and occasional writers
+// 3. Prefix search with sort.SearchStrings over a sorted term list
+// 4. Saving state with encoding/gob and an atomic rename
+//
+// INVERTED INDEX:
+// Instead of scanning every file for "invoice", we look "invoice" up in a
+// map and get the files that contain it. For each (term, file) pair we
+// remember WHICH fields contained the term as a bit mask, so a match in the
+// file name can rank above a match somewhere in page 12 of a PDF:
+//
+//	postings["invoice"] = { file1: name|content, file7: content }
+//
+// Prefix and fuzzy matching need to enumerate terms, so we also keep every
+// term in a sorted slice. All terms starting with "inv" are then one
+// contiguous run found by binary search.
+package search
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+	"github.com/emaad/file-storage-service/pkg/logger"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Defaults used when the corresponding settings are not configured
+const (
+	defaultSnapshotInterval = time.Minute
+	defaultMaxContentBytes  = 64 << 10 // 64 KB
+)
+
+// snapshotFormat is bumped whenever the document struct changes
+// incompatibly; older snapshots are then ignored and rebuilt.
+const snapshotFormat = 2
+
+// field is a bit mask of the fields a term occurs in.
+type field uint8
+
+const (
+	fieldName field = 1 << iota
+	fieldPath
+	fieldMimeType
+	fieldMetadata
+	fieldContent
+)
+
+// fieldWeights rank matches by where they occur, strongest first.
+var fieldWeights = []struct {
+	field  field
+	name   string
+	weight float64
+}{
+	{fieldName, "name", 5},
+	{fieldPath, "path", 2},
+	{fieldMetadata, "metadata", 1.5},
+	{fieldContent, "content", 1},
+	{fieldMimeType, "mime_type", 1},
+}
+
+// Match qualities: how well a query word matched an index term
+const (
+	qualityExact  = 1.0
+	qualityPrefix = 0.6
+	qualityFuzzy  = 0.4
+)
+
+// minPrefixLength stops one-letter words from expanding to most of the index.
+const minPrefixLength = 2
+
+// document is what the index stores about one file.
+//
+// Exported fields are saved in snapshots; terms is derived from them and
+// rebuilt on load.
+type document struct {
+	ID         primitive.ObjectID
+	OwnerID    primitive.ObjectID
+	SharedWith []primitive.ObjectID
+	Name       string
+	Path       string
+	MimeType   string
+	Size       int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Version    int
+	Deleted    bool // Trashed files stay indexed so a restore keeps their text
+	Metadata   string
+	TagIDs     []primitive.ObjectID
+
+	// Content is extracted document text, valid for ContentVersion only
+	Content        string
+	ContentVersion int
+
+	terms map[string]field
+}
+
+// newDocument copies the searchable parts of a file.
+func newDocument(file *models.File) *document {
+	doc := &document{
+		ID:        file.ID,
+		OwnerID:   file.OwnerID,
+		Name:      file.FileName,
+		Path:      file.FilePath,
+		MimeType:  file.MimeType,
+		Size:      file.FileSize,
+		CreatedAt: file.CreatedAt,
+		UpdatedAt: file.UpdatedAt,
+		Version:   file.Version,
+		Deleted:   !file.IsActive(),
+		Metadata:  metadataText(file),
+		TagIDs:    file.TagIDs,
+	}
+	for _, shared := range file.SharedWith {
+		doc.SharedWith = append(doc.SharedWith, shared.UserID)
+	}
+	return doc
+}
+
+// analyze computes the term -> fields mask of the document.
+func (d *document) analyze() {
+	d.terms = make(map[string]field)
+	add := func(text string, f field) {
+		for term := range uniqueTerms(text) {
+			d.terms[term] |= f
+		}
+	}
+	add(d.Name, fieldName)
+	add(d.Path, fieldPath)
+	add(d.MimeType, fieldMimeType)
+	add(d.Metadata, fieldMetadata)
+	add(d.Content, fieldContent)
+}
+
+// sharedWith reports whether the file is shared with the user.
+func (d *document) sharedWith(userID primitive.ObjectID) bool {
+	for _, id := range d.SharedWith {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleTo is a cheap pre-filter using the permissions as of indexing
+// time, plus the folders currently shared with the viewer (files below
+// them are shared too). The Service re-checks every hit against the
+// current file.
+func (d *document) visibleTo(viewer *models.User, sharedFolders []*models.Folder) bool {
+	if viewer.IsAdmin() || d.OwnerID == viewer.ID || d.sharedWith(viewer.ID) {
+		return true
+	}
+	for _, folder := range sharedFolders {
+		if d.OwnerID == folder.UserID && strings.HasPrefix(d.Path, folder.Path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Index is an embedded full-text index of file documents. It is safe for
+// concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[primitive.ObjectID]*document
+	postings map[string]map[primitive.ObjectID]field
+
+	// terms lists every key of postings, sorted. Adding terms only marks it
+	// stale; it is re-sorted before the next search.
+	terms      []string
+	termsStale bool
+
+	// changes counts modifications; saved is the count at the last snapshot
+	changes uint64
+	saved   uint64
+
+	path            string
+	interval        time.Duration
+	maxContentBytes int
+	log             *logger.Logger
+}
+
+// NewIndex creates an index and loads the snapshot at cfg.IndexPath if
+// there is one. Call Rebuild afterwards to catch up with changes made while
+// the service was down.
+func NewIndex(cfg config.SearchConfig, log *logger.Logger) (*Index, error) {
+	idx := &Index{
+		docs:            make(map[primitive.ObjectID]*document),
+		postings:        make(map[string]map[primitive.ObjectID]field),
+		path:            cfg.IndexPath,
+		interval:        cfg.SnapshotInterval,
+		maxContentBytes: cfg.MaxContentBytes,
+		log:             log,
+	}
+	if idx.interval <= 0 {
+		idx.interval = defaultSnapshotInterval
+	}
+	if idx.maxContentBytes <= 0 {
+		idx.maxContentBytes = defaultMaxContentBytes
+	}
+
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// =============================================================================
+// UPDATES
+// =============================================================================
+
+// Put adds or updates a file. Extracted text is kept if the file is still
+// at the version it was extracted from.
+func (i *Index) Put(file *models.File) {
+	doc := newDocument(file)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if old, ok := i.docs[file.ID]; ok && old.ContentVersion == doc.Version {
+		doc.Content, doc.ContentVersion = old.Content, old.ContentVersion
+	}
+	i.store(doc)
+}
+
+// SetContent records the extracted text of a file version. Text for a
+// version other than the indexed one is ignored: either the file changed
+// while the text was extracted, or the index hasn't seen the file yet and
+// Rebuild will pick it up.
+func (i *Index) SetContent(fileID primitive.ObjectID, version int, text string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	old, ok := i.docs[fileID]
+	if !ok || old.Version != version {
+		return
+	}
+	doc := *old
+	doc.Content = truncateText(text, i.maxContentBytes)
+	doc.ContentVersion = version
+	i.store(&doc)
+}
+
+// ContentLimit is how much extracted text per file is worth producing.
+func (i *Index) ContentLimit() int {
+	return i.maxContentBytes
+}
+
+// Remove deletes a file from the index.
+func (i *Index) Remove(fileID primitive.ObjectID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if old, ok := i.docs[fileID]; ok {
+		i.unlink(old)
+		delete(i.docs, fileID)
+		i.changes++
+	}
+}
+
+// Len returns the number of indexed files, trashed ones included.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// store replaces a document and its postings. The caller holds i.mu.
+func (i *Index) store(doc *document) {
+	if old, ok := i.docs[doc.ID]; ok {
+		i.unlink(old)
+	}
+
+	doc.analyze()
+	for term, fields := range doc.terms {
+		posting, ok := i.postings[term]
+		if !ok {
+			posting = make(map[primitive.ObjectID]field)
+			i.postings[term] = posting
+			i.termsStale = true
+		}
+		posting[doc.ID] = fields
+	}
+	i.docs[doc.ID] = doc
+	i.changes++
+}
+
+// unlink removes a document's postings. The caller holds i.mu.
+func (i *Index) unlink(doc *document) {
+	for term := range doc.terms {
+		posting := i.postings[term]
+		delete(posting, doc.ID)
+		if len(posting) == 0 {
+			delete(i.postings, term)
+			i.termsStale = true
+		}
+	}
+}
+
+// Rebuild reconciles the index with the database: every file is
+// (re)indexed and documents of files that no longer exist are dropped.
+//
+// Extracted text survives for files whose version didn't change. Text of
+// files that changed while the service was down is extracted again the
+// next time they are processed.
+func (i *Index) Rebuild(ctx context.Context, files repository.FileRepository) error {
+	seen := make(map[primitive.ObjectID]bool)
+	err := files.Walk(ctx, func(file *models.File) error {
+		i.Put(file)
+		seen[file.ID] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for id, doc := range i.docs {
+		if !seen[id] {
+			i.unlink(doc)
+			delete(i.docs, id)
+			i.changes++
+		}
+	}
+	return nil
+}
+
+// truncateText cuts text to at most limit bytes without splitting a
+// character.
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return strings.ToValidUTF8(text, " ")
+	}
+	// ToValidUTF8 drops the partial character the cut may leave behind
+	return strings.ToValidUTF8(text[:limit], "")
+}
+
+// =============================================================================
+// LOOKUP
+// =============================================================================
+
+// hit is a candidate result before permission checks.
+type hit struct {
+	id        primitive.ObjectID
+	score     float64
+	fields    field
+	updatedAt time.Time
+}
+
+// termHit is how well one query word matched one document.
+type termHit struct {
+	score  float64
+	fields field
+}
+
+// search returns the documents matching the text and filters of q that
+// viewer may see, best first. sharedFolders are the folders shared with
+// the viewer at query time.
+func (i *Index) search(q *Query, viewer *models.User, sharedFolders []*models.Folder) []hit {
+	i.sortTerms()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	words := dedupe(tokenize(q.Text))
+
+	var candidates map[primitive.ObjectID]*termHit
+	if len(words) == 0 {
+		// No text: every document is a candidate, filters decide
+		candidates = make(map[primitive.ObjectID]*termHit, len(i.docs))
+		for id := range i.docs {
+			candidates[id] = &termHit{}
+		}
+	}
+	for n, word := range words {
+		matches := i.lookup(word, q.Fuzzy)
+		if n == 0 {
+			candidates = matches
+			continue
+		}
+		// Every word must match: keep only documents matched so far
+		for id, acc := range candidates {
+			m, ok := matches[id]
+			if !ok {
+				delete(candidates, id)
+				continue
+			}
+			acc.score += m.score
+			acc.fields |= m.fields
+		}
+	}
+
+	hits := make([]hit, 0, len(candidates))
+	for id, m := range candidates {
+		doc := i.docs[id]
+		if doc.Deleted || !doc.visibleTo(viewer, sharedFolders) || !q.matchesFilters(doc, viewer.ID) {
+			continue
+		}
+		hits = append(hits, hit{id: id, score: m.score, fields: m.fields, updatedAt: doc.UpdatedAt})
+	}
+
+	// Best score first; ties (and text-less queries) newest first
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].score != hits[b].score {
+			return hits[a].score > hits[b].score
+		}
+		if !hits[a].updatedAt.Equal(hits[b].updatedAt) {
+			return hits[a].updatedAt.After(hits[b].updatedAt)
+		}
+		return hits[a].id.Hex() < hits[b].id.Hex()
+	})
+	return hits
+}
+
+// lookup finds the documents matching one query word exactly, by prefix
+// and (if fuzzy) with typos. Each document keeps its best match. The caller
+// holds i.mu for reading.
+func (i *Index) lookup(word string, fuzzy bool) map[primitive.ObjectID]*termHit {
+	matches := make(map[primitive.ObjectID]*termHit)
+	record := func(term string, quality float64) {
+		for id, fields := range i.postings[term] {
+			score := quality * weightOf(fields)
+			m, ok := matches[id]
+			if !ok {
+				matches[id] = &termHit{score: score, fields: fields}
+				continue
+			}
+			m.score = max(m.score, score)
+			m.fields |= fields
+		}
+	}
+
+	record(word, qualityExact)
+
+	if len([]rune(word)) >= minPrefixLength {
+		// Terms with this prefix are a contiguous run in the sorted slice
+		for n := sort.SearchStrings(i.terms, word); n < len(i.terms) && strings.HasPrefix(i.terms[n], word); n++ {
+			if i.terms[n] != word {
+				record(i.terms[n], qualityPrefix)
+			}
+		}
+	}
+
+	if limit := maxEdits(word); fuzzy && limit > 0 {
+		for _, term := range i.terms {
+			if term != word && !strings.HasPrefix(term, word) && withinEdits(word, term, limit) {
+				record(term, qualityFuzzy)
+			}
+		}
+	}
+	return matches
+}
+
+// sortTerms re-sorts the term list if terms were added or removed.
+func (i *Index) sortTerms() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.termsStale {
+		return
+	}
+
+	i.terms = i.terms[:0]
+	for term := range i.postings {
+		i.terms = append(i.terms, term)
+	}
+	sort.Strings(i.terms)
+	i.termsStale = false
+}
+
+// weightOf returns the weight of the strongest field in the mask.
+func weightOf(fields field) float64 {
+	for _, fw := range fieldWeights {
+		if fields&fw.field != 0 {
+			return fw.weight
+		}
+	}
+	return 0
+}
+
+// fieldNames lists the fields in a mask, strongest first.
+func fieldNames(fields field) []string {
+	var names []string
+	for _, fw := range fieldWeights {
+		if fields&fw.field != 0 {
+			names = append(names, fw.name)
+		}
+	}
+	return names
+}
+
+// dedupe removes repeated words, keeping the first occurrence.
+func dedupe(words []string) []string {
+	seen := make(map[string]bool, len(words))
+	unique := words[:0]
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+	return unique
+}
+
+// =============================================================================
+// SNAPSHOTS
+// =============================================================================
+
+// snapshot is the on-disk form of the index. Postings aren't saved; they
+// are cheaper to recompute than to store.
+type snapshot struct {
+	Format    int
+	Documents []*document
+}
+
+// Run saves the index every snapshot interval while it has unsaved
+// changes, and once more when ctx is cancelled (on shutdown).
+func (i *Index) Run(ctx context.Context) {
+	if i.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := i.Save(); err != nil {
+				i.log.Error().Err(err).Msg("Failed to save search index")
+			}
+			return
+		case <-ticker.C:
+			if err := i.Save(); err != nil {
+				i.log.Error().Err(err).Msg("Failed to save search index")
+			}
+		}
+	}
+}
+
+// Save writes a snapshot if anything changed since the last one.
+//
+// ATOMIC REPLACE:
+// We write to a temp file and rename it over the old snapshot. A rename
+// within one directory is atomic, so a crash mid-write leaves the previous
+// snapshot intact instead of a truncated one.
+func (i *Index) Save() error {
+	if i.path == "" {
+		return nil
+	}
+
+	i.mu.RLock()
+	changes := i.changes
+	if changes == i.saved {
+		i.mu.RUnlock()
+		return nil
+	}
+	snap := snapshot{Format: snapshotFormat, Documents: make([]*document, 0, len(i.docs))}
+	for _, doc := range i.docs {
+		// Documents are replaced, never modified, so sharing them is safe
+		snap.Documents = append(snap.Documents, doc)
+	}
+	i.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(i.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(i.path), filepath.Base(i.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	err = gob.NewEncoder(tmp).Encode(&snap)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), i.path); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.saved = max(i.saved, changes)
+	i.mu.Unlock()
+	return nil
+}
+
+// load reads the snapshot, if there is a usable one.
+func (i *Index) load() error {
+	if i.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(i.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil || snap.Format != snapshotFormat {
+		// A corrupt or outdated snapshot is only a cache; Rebuild refills
+		// the index, minus extracted text
+		i.log.Warn().Err(err).Str("path", i.path).Msg("Ignoring unusable search index snapshot")
+		return nil
+	}
+
+	for _, doc := range snap.Documents {
+		i.store(doc)
+	}
+	i.saved = i.changes
+	return nil
+}
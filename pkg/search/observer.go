@@ -0,0 +1,185 @@
+// This file keeps the index in sync with the files collection.
+//
+// LEARNING NOTES:
+// ===============
+// THE DECORATOR PATTERN:
+// IndexedFiles wraps a FileRepository and implements the same interface.
+// Reads pass straight through; writes go to MongoDB first and, if they
+// succeed, are replayed into the index. Everything that changes files -
+// uploads, renames, trash, the metadata job - already goes through the
+// repository, so wrapping it once catches every change without touching
+// the callers.
+//
+//	handlers / services / workers
+//	            |
+//	      IndexedFiles  --- on success --->  Index
+//	            |
+//	   mongoFileRepository
+//
+// EMBEDDING AN INTERFACE:
+// The struct embeds repository.FileRepository, which promotes all of its
+// methods. We only override the ones that change searchable fields; new
+// repository methods work unchanged until they need indexing too.
+package search
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// IndexedFiles is a FileRepository that updates a search index after every
+// successful write.
+//
+// Index updates are best effort: if re-reading a file fails, the index
+// keeps its previous entry until the next change or Rebuild. Stale entries
+// are harmless because the Service checks every hit against MongoDB.
+type IndexedFiles struct {
+	repository.FileRepository
+	index *Index
+}
+
+// NewIndexedFiles wraps a FileRepository.
+//
+// USAGE:
+//
+//	files := search.NewIndexedFiles(repository.NewFileRepository(db), index)
+//	// pass files to every service and worker instead of the plain repository
+func NewIndexedFiles(files repository.FileRepository, index *Index) *IndexedFiles {
+	return &IndexedFiles{FileRepository: files, index: index}
+}
+
+func (r *IndexedFiles) Create(ctx context.Context, file *models.File) error {
+	if err := r.FileRepository.Create(ctx, file); err != nil {
+		return err
+	}
+	r.index.Put(file)
+	return nil
+}
+
+func (r *IndexedFiles) Update(ctx context.Context, file *models.File) error {
+	if err := r.FileRepository.Update(ctx, file); err != nil {
+		return err
+	}
+	r.index.Put(file)
+	return nil
+}
+
+func (r *IndexedFiles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := r.FileRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.index.Remove(id)
+	return nil
+}
+
+func (r *IndexedFiles) SetMetadata(ctx context.Context, id primitive.ObjectID, fields map[string]interface{}) error {
+	if err := r.FileRepository.SetMetadata(ctx, id, fields); err != nil {
+		return err
+	}
+	r.refresh(ctx, id)
+	return nil
+}
+
+func (r *IndexedFiles) SoftDeleteUnderPath(ctx context.Context, userID primitive.ObjectID, folderPath string, deletedAt time.Time) (int64, error) {
+	// Look the files up first: afterwards they no longer match "active
+	// files under this path"
+	affected, err := r.FileRepository.FindUnderPath(ctx, userID, folderPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.FileRepository.SoftDeleteUnderPath(ctx, userID, folderPath, deletedAt)
+	if err != nil {
+		return count, err
+	}
+	for _, file := range affected {
+		file.DeletedAt = &deletedAt
+		r.index.Put(file)
+	}
+	return count, nil
+}
+
+func (r *IndexedFiles) MoveUnderPath(ctx context.Context, userID primitive.ObjectID, from, to string) (int64, error) {
+	count, err := r.FileRepository.MoveUnderPath(ctx, userID, from, to)
+	if err != nil {
+		return count, err
+	}
+
+	// Paths are searchable, so every moved file needs a new entry
+	moved, err := r.FileRepository.FindUnderPath(ctx, userID, to)
+	if err != nil {
+		return count, nil
+	}
+	for _, file := range moved {
+		r.index.Put(file)
+	}
+	return count, nil
+}
+
+func (r *IndexedFiles) AddTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	count, err := r.FileRepository.AddTag(ctx, ids, tagID)
+	if err != nil {
+		return count, err
+	}
+	r.refresh(ctx, ids...)
+	return count, nil
+}
+
+func (r *IndexedFiles) RemoveTag(ctx context.Context, ids []primitive.ObjectID, tagID primitive.ObjectID) (int64, error) {
+	if ids == nil {
+		// "Everywhere": find out where that is before the tag is gone
+		var err error
+		if ids, err = r.taggedIDs(ctx, tagID); err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := r.FileRepository.RemoveTag(ctx, ids, tagID)
+	if err != nil {
+		return count, err
+	}
+	r.refresh(ctx, ids...)
+	return count, nil
+}
+
+func (r *IndexedFiles) ReplaceTag(ctx context.Context, from, to primitive.ObjectID) error {
+	ids, err := r.taggedIDs(ctx, from)
+	if err != nil {
+		return err
+	}
+	if err := r.FileRepository.ReplaceTag(ctx, from, to); err != nil {
+		return err
+	}
+	r.refresh(ctx, ids...)
+	return nil
+}
+
+// taggedIDs returns the IDs of the active files carrying a tag. Trashed
+// files aren't searchable, and a restore re-indexes them completely.
+func (r *IndexedFiles) taggedIDs(ctx context.Context, tagID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	tagged, err := r.FileRepository.FindByTag(ctx, tagID, 0)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(tagged))
+	for n, file := range tagged {
+		ids[n] = file.ID
+	}
+	return ids, nil
+}
+
+// refresh re-reads files after a partial update and re-indexes them.
+func (r *IndexedFiles) refresh(ctx context.Context, ids ...primitive.ObjectID) {
+	for _, id := range ids {
+		file, err := r.FileRepository.GetByID(ctx, id)
+		if err != nil {
+			continue
+		}
+		r.index.Put(file)
+	}
+}
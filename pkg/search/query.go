@@ -0,0 +1,155 @@
+// This file defines search queries and their filters.
+package search
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Limits for one page of results
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	MaxOffset    = 1000 // Deep pages get expensive: every skipped hit is permission-checked
+)
+
+// Query describes a search. Text and every filter are optional; all given
+// conditions must hold (AND).
+type Query struct {
+	// Text is matched against the name, path, MIME type, metadata and
+	// extracted document text. Every word must match, either exactly or
+	// as a prefix ("rep" finds "report").
+	Text string
+
+	// Fuzzy also accepts words with small typos ("reciept" finds "receipt")
+	Fuzzy bool
+
+	// Type is a category ("image", "video", "audio", "document", "text",
+	// "archive"), a MIME type ("image/png") or a wildcard ("image/*")
+	Type string
+
+	MinSize int64 // Bytes, inclusive; 0 = no minimum
+	MaxSize int64 // Bytes, inclusive; 0 = no maximum
+
+	CreatedAfter   time.Time // Zero = unbounded
+	CreatedBefore  time.Time
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// OwnerID restricts results to files owned by one user
+	OwnerID *primitive.ObjectID
+
+	// SharedWithMe restricts results to files other users shared with the
+	// searching user
+	SharedWithMe bool
+
+	// TagIDs restricts results to files carrying all of these tags
+	TagIDs []primitive.ObjectID
+
+	Limit  int // Results per page (DefaultLimit if 0, at most MaxLimit)
+	Offset int // Results to skip
+}
+
+// normalize applies defaults and bounds to paging.
+func (q *Query) normalize() {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	q.Limit = min(q.Limit, MaxLimit)
+	q.Offset = min(max(q.Offset, 0), MaxOffset)
+	q.Type = strings.ToLower(strings.TrimSpace(q.Type))
+}
+
+// categories map Type values to MIME type tests.
+var categories = map[string]func(mimeType string) bool{
+	"image": func(m string) bool { return strings.HasPrefix(m, "image/") },
+	"video": func(m string) bool { return strings.HasPrefix(m, "video/") },
+	"audio": func(m string) bool { return strings.HasPrefix(m, "audio/") },
+	"text":  func(m string) bool { return strings.HasPrefix(m, "text/") },
+	"document": func(m string) bool {
+		return (&models.File{MimeType: m}).IsDocument() ||
+			strings.HasPrefix(m, "application/vnd.oasis.opendocument.") ||
+			strings.HasPrefix(m, "application/vnd.openxmlformats-officedocument.") ||
+			m == "application/vnd.ms-powerpoint" || m == "application/rtf"
+	},
+	"archive": func(m string) bool { return archiveTypes[m] },
+}
+
+// archiveTypes are the MIME types of the "archive" category.
+var archiveTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-tar":            true,
+	"application/x-7z-compressed":  true,
+	"application/vnd.rar":          true,
+	"application/x-rar-compressed": true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/zstd":             true,
+}
+
+// IsValidType reports whether a Type value is understood.
+func IsValidType(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, ok := categories[value]; ok {
+		return true
+	}
+	major, minor, found := strings.Cut(value, "/")
+	return found && major != "" && minor != ""
+}
+
+// matchesType tests a MIME type against the Type filter.
+func (q *Query) matchesType(mimeType string) bool {
+	if q.Type == "" {
+		return true
+	}
+	mimeType = strings.ToLower(mimeType)
+	if test, ok := categories[q.Type]; ok {
+		return test(mimeType)
+	}
+	if prefix, ok := strings.CutSuffix(q.Type, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return mimeType == q.Type
+}
+
+// matchesFilters checks every filter except Text against a document.
+func (q *Query) matchesFilters(doc *document, viewerID primitive.ObjectID) bool {
+	switch {
+	case !q.matchesType(doc.MimeType):
+		return false
+	case q.MinSize > 0 && doc.Size < q.MinSize:
+		return false
+	case q.MaxSize > 0 && doc.Size > q.MaxSize:
+		return false
+	case !inRange(doc.CreatedAt, q.CreatedAfter, q.CreatedBefore):
+		return false
+	case !inRange(doc.UpdatedAt, q.ModifiedAfter, q.ModifiedBefore):
+		return false
+	case q.OwnerID != nil && doc.OwnerID != *q.OwnerID:
+		return false
+	case q.SharedWithMe && (doc.OwnerID == viewerID || !doc.sharedWith(viewerID)):
+		return false
+	}
+	for _, tagID := range q.TagIDs {
+		if !models.HasTag(doc.TagIDs, tagID) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRange checks after <= t <= before, treating zero bounds as open.
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && t.After(before) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// Package search provides full-text search over files: names, paths, MIME
+// types, extracted metadata and document text.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Building a small search engine from maps and sorted slices
+// 2. Wrapping an interface (the decorator pattern) to observe changes
+// 3. Separating "what matches" (the index) from "what may be shown"
+//
+// EMBEDDED, NOT A SERVER:
+// The index lives inside the service process and is saved to a local file,
+// so search works without running Elasticsearch or similar. The trade-off:
+// every API instance keeps its own index, built from MongoDB on startup.
+//
+// WIRING:
+//
+//	index, _ := search.NewIndex(cfg.Search, log)
+//	fileRepo := search.NewIndexedFiles(repository.NewFileRepository(db), index)
+//	go index.Rebuild(ctx, fileRepo)
+//	go index.Run(ctx)
+//	// processing.Deps{..., Search: index} adds document text
+//	search.NewHandler(search.NewService(index, fileService)).RegisterRoutes(api)
+package search
+
+import (
+	"context"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Hit is one search result.
+type Hit struct {
+	File          *models.File `json:"file"`
+	Score         float64      `json:"score"`
+	MatchedFields []string     `json:"matched_fields,omitempty"` // "name", "content"... strongest first
+}
+
+// Results is one page of search results.
+type Results struct {
+	Hits    []Hit `json:"hits"`
+	HasMore bool  `json:"has_more"` // Another page exists (use offset + limit)
+}
+
+// Service answers search queries for a user.
+type Service struct {
+	index *Index
+	files *files.Service
+}
+
+// NewService creates a search Service. Hits are loaded and permission
+// checked through the file service.
+func NewService(index *Index, fileService *files.Service) *Service {
+	return &Service{index: index, files: fileService}
+}
+
+// Search runs a query on behalf of actor.
+//
+// PERMISSIONS ON EVERY HIT:
+// The index pre-filters by the owner and shares it saw when the file was
+// indexed, but that may be seconds out of date. Each hit is therefore
+// loaded through files.Service.Get, which applies the real permission
+// rules to the current document; files that fail the check, or no longer
+// match the filters, are dropped. Offsets count permitted hits only, so
+// pages never leak how many hidden files matched.
+func (s *Service) Search(ctx context.Context, actor *models.User, query Query) (*Results, error) {
+	query.normalize()
+
+	sharedFolders, err := s.files.SharedFolders(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	hits := s.index.search(&query, actor, sharedFolders)
+
+	results := &Results{Hits: []Hit{}}
+	skipped := 0
+	for _, h := range hits {
+		file, err := s.files.Get(ctx, actor, h.id)
+		if apperrors.Is(err, apperrors.ErrNotFound) {
+			continue // Deleted, trashed or no longer shared since indexing
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !query.matchesFilters(newDocument(file), actor.ID) {
+			continue // Changed since indexing
+		}
+
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		if len(results.Hits) == query.Limit {
+			results.HasMore = true
+			break
+		}
+		results.Hits = append(results.Hits, Hit{
+			File:          file,
+			Score:         h.score,
+			MatchedFields: fieldNames(h.fields),
+		})
+	}
+	return results, nil
+}
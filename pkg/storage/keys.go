@@ -0,0 +1,84 @@
+// This file centralizes how object keys are built.
+//
+// LEARNING NOTES:
+// ===============
+// Object stores are flat: there are no real directories, just keys that
+// happen to contain "/". Keeping the key layout in one place makes it easy
+// to find every object that belongs to a user or a file.
+//
+// KEY LAYOUT:
+//
+//	users/{user_id}/files/{file_id}.{ext}                        - current content
+//	users/{user_id}/versions/{file_id}_v{version}.{ext}          - historical versions
+//	users/{user_id}/thumbnails/{file_id}_v{version}_{size}.{ext} - generated thumbnails
+//	users/{user_id}/compressed/{file_id}_v{version}.{gz|zst}     - pre-compressed copies
+//	users/{user_id}/renditions/{file_id}_v{version}_{name}.mp4   - transcoded videos
+//	users/{user_id}/previews/{file_id}_v{version}_p{page}.{ext}  - rendered document pages
+//	archives/{user_id}/{job_id}.{zip|tar.gz}                     - archives built by background jobs
+//	uploads/{user_id}/{upload_id}_{offset}.tail                  - unfinished resumable upload bytes
+//
+// Archives are temporary and live under their own top-level prefix, so a
+// single bucket lifecycle rule on "archives/" can expire them (e.g. after
+// a day) without touching anyone's files. Upload tails are cleaned up by
+// PurgeExpiredUploads, but an "uploads/" rule is a cheap safety net.
+package storage
+
+import (
+	"fmt"
+	"path"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FileKey returns the key for a file's current content.
+//
+// path.Ext returns the extension including the dot (".pdf"), or "" if none.
+func FileKey(userID, fileID primitive.ObjectID, fileName string) string {
+	return fmt.Sprintf("users/%s/files/%s%s", userID.Hex(), fileID.Hex(), path.Ext(fileName))
+}
+
+// VersionKey returns the key for an archived version of a file.
+func VersionKey(userID, fileID primitive.ObjectID, version int, fileName string) string {
+	return fmt.Sprintf("users/%s/versions/%s_v%d%s", userID.Hex(), fileID.Hex(), version, path.Ext(fileName))
+}
+
+// ThumbnailKey returns the key for one thumbnail size of a file version.
+// ext includes the dot, e.g. ".jpg".
+//
+// Derived objects carry the version in their key: a slow job for an old
+// version then writes next to the new version's objects instead of over
+// them.
+func ThumbnailKey(userID, fileID primitive.ObjectID, version, size int, ext string) string {
+	return fmt.Sprintf("users/%s/thumbnails/%s_v%d_%d%s", userID.Hex(), fileID.Hex(), version, size, ext)
+}
+
+// CompressedKey returns the key for a pre-compressed copy of a file version.
+// ext includes the dot, e.g. ".gz".
+func CompressedKey(userID, fileID primitive.ObjectID, version int, ext string) string {
+	return fmt.Sprintf("users/%s/compressed/%s_v%d%s", userID.Hex(), fileID.Hex(), version, ext)
+}
+
+// RenditionKey returns the key for a transcoded copy of a video version.
+// ext includes the dot, e.g. ".mp4".
+func RenditionKey(userID, fileID primitive.ObjectID, version int, name, ext string) string {
+	return fmt.Sprintf("users/%s/renditions/%s_v%d_%s%s", userID.Hex(), fileID.Hex(), version, name, ext)
+}
+
+// PreviewKey returns the key for one rendered page of a document version.
+// ext includes the dot, e.g. ".jpg".
+func PreviewKey(userID, fileID primitive.ObjectID, version, page int, ext string) string {
+	return fmt.Sprintf("users/%s/previews/%s_v%d_p%d%s", userID.Hex(), fileID.Hex(), version, page, ext)
+}
+
+// ArchiveKey returns the key for an archive built by a background job.
+// ext includes the dot, e.g. ".zip".
+func ArchiveKey(userID, jobID primitive.ObjectID, ext string) string {
+	return fmt.Sprintf("archives/%s/%s%s", userID.Hex(), jobID.Hex(), ext)
+}
+
+// UploadTailKey returns the key holding the bytes of a resumable upload
+// that don't fill a multipart part yet. offset is the upload offset the
+// tail ends at, so a new tail never overwrites the one still recorded.
+func UploadTailKey(userID, uploadID primitive.ObjectID, offset int64) string {
+	return fmt.Sprintf("uploads/%s/%s_%d.tail", userID.Hex(), uploadID.Hex(), offset)
+}
@@ -0,0 +1,226 @@
+// This file implements Backend entirely in memory.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Protecting shared state with sync.RWMutex
+// 2. Implementing the same interface as the S3 backend
+// 3. Returning copies so callers can't mutate stored data
+//
+// USE CASES:
+// - Running a service locally without MinIO
+// - Unit tests that need a working Backend
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// memoryObject is a stored object: its bytes plus metadata.
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// MemoryBackend keeps all objects in a map. Data is lost when the process exits.
+//
+// MUTEX EXPLANATION:
+// Maps are not safe for concurrent use. sync.RWMutex lets many readers
+// (RLock) proceed in parallel, while a writer (Lock) gets exclusive access.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+	uploads map[string]*memoryUpload // Unfinished multipart uploads by ID
+}
+
+// memoryUpload is an unfinished multipart upload.
+type memoryUpload struct {
+	key         string
+	contentType string
+	parts       map[int][]byte
+}
+
+// NewMemoryBackend creates an empty in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		objects: make(map[string]*memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+// Put reads r fully and stores it under key.
+func (b *MemoryBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %q: %w", key, err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return nil, fmt.Errorf("object %q: expected %d bytes, got %d", key, size, len(data))
+	}
+
+	sum := md5.Sum(data) // S3 ETags for single-part uploads are MD5 hashes
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: time.Now(),
+	}
+
+	b.mu.Lock()
+	b.objects[key] = &memoryObject{data: data, info: info}
+	b.mu.Unlock()
+
+	return &info, nil
+}
+
+// Get returns a reader over a copy-free view of the stored bytes.
+// Stored slices are never modified after Put, so sharing them is safe.
+func (b *MemoryBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	b.mu.RLock()
+	obj, ok := b.objects[key]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, ErrObjectNotFound
+	}
+
+	info := obj.info
+	return io.NopCloser(bytes.NewReader(obj.data)), &info, nil
+}
+
+// GetRange returns a reader over part of the stored bytes.
+func (b *MemoryBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	b.mu.RLock()
+	obj, ok := b.objects[key]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	size := int64(len(obj.data))
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("offset %d out of range for object %q", offset, key)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+// Stat returns object information.
+func (b *MemoryBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	b.mu.RLock()
+	obj, ok := b.objects[key]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	info := obj.info
+	return &info, nil
+}
+
+// Delete removes the object if present.
+func (b *MemoryBackend) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	delete(b.objects, key) // delete on a missing key is a no-op
+	b.mu.Unlock()
+	return nil
+}
+
+// Copy duplicates an object under a new key.
+func (b *MemoryBackend) Copy(ctx context.Context, srcKey, dstKey string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	obj, ok := b.objects[srcKey]
+	if !ok {
+		return ErrObjectNotFound
+	}
+
+	info := obj.info
+	info.Key = dstKey
+	info.LastModified = time.Now()
+	b.objects[dstKey] = &memoryObject{data: obj.data, info: info}
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload.
+func (b *MemoryBackend) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID := fmt.Sprintf("upload-%d", time.Now().UnixNano())
+
+	b.mu.Lock()
+	b.uploads[uploadID] = &memoryUpload{key: key, contentType: contentType, parts: make(map[int][]byte)}
+	b.mu.Unlock()
+	return uploadID, nil
+}
+
+// UploadPart stores one part. Uploading a part number again replaces it.
+func (b *MemoryBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read part %d of %q: %w", partNumber, key, err)
+	}
+	if int64(len(data)) != size {
+		return "", fmt.Errorf("part %d of %q: expected %d bytes, got %d", partNumber, key, size, len(data))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return "", ErrObjectNotFound
+	}
+	upload.parts[partNumber] = data
+
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CompleteMultipartUpload joins the parts into the object, enforcing the
+// same minimum part size as S3 so tests catch violations.
+func (b *MemoryBackend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (*ObjectInfo, error) {
+	b.mu.Lock()
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		b.mu.Unlock()
+		return nil, ErrObjectNotFound
+	}
+
+	var buf bytes.Buffer
+	for i, part := range parts {
+		data, ok := upload.parts[part.Number]
+		if !ok {
+			b.mu.Unlock()
+			return nil, fmt.Errorf("upload of %q has no part %d", key, part.Number)
+		}
+		if i < len(parts)-1 && len(data) < MinPartSize {
+			b.mu.Unlock()
+			return nil, fmt.Errorf("part %d of %q is smaller than %d bytes", part.Number, key, MinPartSize)
+		}
+		buf.Write(data)
+	}
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+
+	return b.Put(ctx, key, &buf, int64(buf.Len()), upload.contentType)
+}
+
+// AbortMultipartUpload discards an unfinished upload.
+func (b *MemoryBackend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	b.mu.Lock()
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+	return nil
+}
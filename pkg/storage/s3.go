@@ -0,0 +1,244 @@
+// This file implements Backend on top of AWS S3 / MinIO.
+//
+// LEARNING NOTES:
+// ===============
+// Demonstrates:
+// 1. Wrapping a third-party SDK behind our own interface
+// 2. Translating SDK-specific errors into our own sentinel errors
+// 3. Endpoint parsing (MinIO URL vs. AWS default)
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/emaad/file-storage-service/pkg/config"
+)
+
+// S3Backend stores objects in a single S3 (or MinIO) bucket.
+//
+// WHY MINIO-GO?
+// The minio-go SDK speaks the S3 protocol and works against both MinIO
+// (our local development store) and AWS S3. minio.Core additionally exposes
+// the low-level multipart API that chunked uploads need.
+type S3Backend struct {
+	core          *minio.Core   // S3 client with low-level API access
+	bucket        string        // Bucket all keys live in
+	presignExpiry time.Duration // Lifetime of pre-signed URLs
+}
+
+// NewS3Backend creates an S3 backend from S3Config.
+//
+// ENDPOINT HANDLING:
+// S3Config.Endpoint may be a full URL ("http://minio:9000") or empty for AWS.
+// minio-go wants a bare host ("minio:9000") plus a Secure flag.
+func NewS3Backend(cfg config.S3Config) (*S3Backend, error) {
+	endpoint := "s3.amazonaws.com"
+	secure := cfg.UseSSL
+
+	if cfg.Endpoint != "" {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || u.Host == "" {
+			// Not a URL - treat the value as host[:port]
+			endpoint = cfg.Endpoint
+		} else {
+			endpoint = u.Host
+			secure = u.Scheme == "https"
+		}
+	}
+
+	core, err := minio.NewCore(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: secure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Backend{core: core, bucket: cfg.Bucket, presignExpiry: cfg.PresignExpiry}, nil
+}
+
+// Put uploads content. minio-go switches to multipart automatically for
+// large or unknown-size streams.
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	info, err := b.core.Client.PutObject(ctx, b.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to put object %q: %w", key, translateError(err))
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size,
+		ContentType:  contentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// Get opens an object for streaming.
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	obj, err := b.core.Client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object %q: %w", key, translateError(err))
+	}
+
+	// GetObject is lazy: errors such as "no such key" only surface on the
+	// first read or Stat call, so we Stat immediately to fail early.
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, fmt.Errorf("failed to get object %q: %w", key, translateError(err))
+	}
+
+	return obj, toObjectInfo(stat), nil
+}
+
+// GetRange opens part of an object with an HTTP Range request, so only
+// the requested bytes leave S3.
+func (b *S3Backend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	var err error
+	switch {
+	case length >= 0:
+		err = opts.SetRange(offset, offset+length-1)
+	case offset > 0:
+		err = opts.SetRange(offset, 0) // "bytes=offset-"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %q: %w", key, err)
+	}
+
+	obj, err := b.core.Client.GetObject(ctx, b.bucket, key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %q: %w", key, translateError(err))
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to get object %q: %w", key, translateError(err))
+	}
+	return obj, nil
+}
+
+// Stat returns object information.
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	stat, err := b.core.Client.StatObject(ctx, b.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object %q: %w", key, translateError(err))
+	}
+	return toObjectInfo(stat), nil
+}
+
+// Delete removes an object. S3 treats deleting a missing key as success.
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	if err := b.core.Client.RemoveObject(ctx, b.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object %q: %w", key, translateError(err))
+	}
+	return nil
+}
+
+// Copy performs a server-side copy; no bytes pass through our service.
+func (b *S3Backend) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := b.core.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: b.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: b.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy object %q to %q: %w", srcKey, dstKey, translateError(err))
+	}
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload.
+func (b *S3Backend) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID, err := b.core.NewMultipartUpload(ctx, b.bucket, key, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %q: %w", key, err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart uploads one part of a multipart upload.
+func (b *S3Backend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	part, err := b.core.PutObjectPart(ctx, b.bucket, key, uploadID, partNumber, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d of %q: %w", partNumber, key, translateError(err))
+	}
+	return part.ETag, nil
+}
+
+// CompleteMultipartUpload joins the uploaded parts into the object.
+func (b *S3Backend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (*ObjectInfo, error) {
+	completed := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completed[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+
+	if _, err := b.core.CompleteMultipartUpload(ctx, b.bucket, key, uploadID, completed, minio.PutObjectOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to complete upload of %q: %w", key, translateError(err))
+	}
+	// The completion response lacks size and content type
+	return b.Stat(ctx, key)
+}
+
+// AbortMultipartUpload discards an unfinished upload. S3 keeps the parts
+// of forgotten uploads (and bills for them) until they are aborted.
+func (b *S3Backend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if err := b.core.AbortMultipartUpload(ctx, b.bucket, key, uploadID); err != nil {
+		if errors.Is(translateError(err), ErrObjectNotFound) {
+			return nil // already completed or aborted
+		}
+		return fmt.Errorf("failed to abort upload of %q: %w", key, err)
+	}
+	return nil
+}
+
+// PresignGet returns a URL that downloads an object without credentials
+// until S3Config.PresignExpiry has passed. The browser saves the download
+// as downloadName.
+func (b *S3Backend) PresignGet(ctx context.Context, key, downloadName string) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+
+	u, err := b.core.Client.PresignedGetObject(ctx, b.bucket, key, b.presignExpiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign object %q: %w", key, translateError(err))
+	}
+	return u, nil
+}
+
+// =============================================================================
+// HELPERS
+// =============================================================================
+
+// toObjectInfo converts the SDK's object info into ours.
+func toObjectInfo(stat minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          stat.Key,
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}
+}
+
+// translateError maps "not found" responses onto ErrObjectNotFound so callers
+// don't need to know about minio-go's error types.
+func translateError(err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+// This file adapts stored objects to io.ReadSeeker.
+//
+// LEARNING NOTES:
+// ===============
+// Some standard APIs want to jump around in a file: http.ServeContent
+// seeks to serve byte ranges (video seeking, resumed downloads), and
+// WebDAV clients read files at arbitrary offsets. An object store has no
+// file handle to seek, but it can serve any byte range on request.
+//
+// LAZY REOPENING:
+// Seek only remembers the new offset. The next Read checks whether the
+// open stream is at that offset; if not, it closes it and opens the object
+// again from there with GetRange. Seeking away and back (http.ServeContent
+// seeks to the end to learn the size) keeps the stream, so sequential
+// reads use a single request no matter how they are chunked.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Seeker reads an object through the io.ReadSeeker interface.
+// It is not safe for concurrent use.
+type Seeker struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+
+	offset int64         // Position of the next Read
+	body   io.ReadCloser // Open stream, or nil
+	bodyAt int64         // Position of body
+}
+
+// NewSeeker returns a Seeker over the object at key, which is size bytes
+// long. Nothing is read until the first Read (or Open). Close it when done.
+func NewSeeker(ctx context.Context, backend Backend, key string, size int64) *Seeker {
+	return &Seeker{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+// Open opens the stream at the current offset right away instead of on
+// the first Read, so that a missing object is reported before the caller
+// has committed to anything (e.g. sent response headers).
+func (s *Seeker) Open() error {
+	if s.body != nil && s.bodyAt == s.offset {
+		return nil
+	}
+	s.closeBody()
+
+	body, err := s.backend.GetRange(s.ctx, s.key, s.offset, -1)
+	if err != nil {
+		return err
+	}
+	s.body, s.bodyAt = body, s.offset
+	return nil
+}
+
+// Read reads from the current offset.
+func (s *Seeker) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if err := s.Open(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	s.bodyAt = s.offset
+	return n, err
+}
+
+// Seek sets the offset of the next Read, like os.File.Seek.
+func (s *Seeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	case io.SeekStart:
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	s.offset = offset
+	return offset, nil
+}
+
+// Close releases the open stream, if any.
+func (s *Seeker) Close() error {
+	return s.closeBody()
+}
+
+// closeBody closes and forgets the open stream.
+func (s *Seeker) closeBody() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
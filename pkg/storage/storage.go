@@ -0,0 +1,117 @@
+// Package storage provides access to the object store that holds file content.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Interfaces as an abstraction over external systems
+// 2. Streaming data with io.Reader / io.ReadCloser
+// 3. Multiple implementations of one interface (S3 and in-memory)
+//
+// WHY AN INTERFACE?
+// MongoDB stores *metadata* (names, sizes, owners). The bytes themselves live
+// in S3 (or MinIO during development). Services only talk to the Backend
+// interface, so we can:
+// - Swap AWS S3 for MinIO without touching business logic
+// - Run everything in memory for local experiments and tests
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// =============================================================================
+// OBJECT INFO
+// =============================================================================
+
+// ObjectInfo describes a stored object without its content.
+type ObjectInfo struct {
+	Key          string    // Object key, e.g. "users/{user_id}/files/{file_id}.pdf"
+	Size         int64     // Size in bytes
+	ContentType  string    // MIME type stored with the object
+	ETag         string    // Entity tag reported by the backend
+	LastModified time.Time // When the object was last written
+}
+
+// =============================================================================
+// BACKEND INTERFACE
+// =============================================================================
+
+// Backend is the minimal set of object store operations the services need.
+//
+// INTERFACE EXPLANATION:
+// An interface lists method signatures. Any type that has all these methods
+// satisfies the interface automatically - no "implements" keyword needed.
+//
+// STREAMING:
+// Put takes an io.Reader and Get returns an io.ReadCloser. Files can be
+// gigabytes large, so we never load a whole file into memory.
+type Backend interface {
+	// Put stores content under key, replacing any existing object.
+	// size may be -1 if unknown (the backend will buffer or stream as needed).
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*ObjectInfo, error)
+
+	// Get opens the object for reading. The caller must Close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+
+	// GetRange opens length bytes of the object starting at offset, or
+	// everything from offset on if length is -1. The caller must Close it.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+
+	// Stat returns object information without downloading content.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Copy duplicates srcKey to dstKey inside the bucket (server-side copy).
+	Copy(ctx context.Context, srcKey, dstKey string) error
+
+	// CreateMultipartUpload starts uploading an object in parts and returns
+	// the upload ID. Nothing appears under key until the upload completes.
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+
+	// UploadPart stores one part (numbered from 1) and returns its ETag.
+	// Every part but the last must be at least MinPartSize bytes.
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, r io.Reader, size int64) (string, error)
+
+	// CompleteMultipartUpload joins the parts, in order, into the object.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (*ObjectInfo, error)
+
+	// AbortMultipartUpload discards an unfinished upload and its parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// =============================================================================
+// MULTIPART UPLOADS
+// =============================================================================
+
+// MinPartSize is the smallest size S3 accepts for a part that isn't the
+// last one of an upload.
+const MinPartSize = 5 << 20 // 5 MiB
+
+// Part identifies an uploaded part when completing a multipart upload.
+type Part struct {
+	Number int    // Part number, from 1
+	ETag   string // As returned by UploadPart
+}
+
+// Presigner is implemented by backends that can hand out time-limited
+// download URLs, so large downloads go straight from the object store to
+// the client. The in-memory backend can't; check with a type assertion:
+//
+//	if presigner, ok := backend.(storage.Presigner); ok { ... }
+type Presigner interface {
+	// PresignGet returns a URL that downloads key as downloadName.
+	PresignGet(ctx context.Context, key, downloadName string) (*url.URL, error)
+}
+
+// ErrObjectNotFound is returned when a key does not exist in the backend.
+//
+// SENTINEL ERRORS:
+// A sentinel is a package-level error value that callers compare against
+// with errors.Is(err, storage.ErrObjectNotFound).
+var ErrObjectNotFound = errors.New("storage: object not found")
@@ -0,0 +1,269 @@
+// This file exposes tags over HTTP.
+package tags
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/models"
+)
+
+// Handler serves the tag endpoints.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a tag Handler.
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes mounts the tag routes on a router group.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	group := r.Group("/tags")
+	group.GET("", h.List)
+	group.POST("", h.Create)
+	group.PATCH("/:id", h.Update)
+	group.DELETE("/:id", h.Delete)
+	group.POST("/:id/merge", h.Merge)
+	group.GET("/:id/items", h.Items)
+	group.POST("/:id/items", h.Tag)
+	group.POST("/:id/items/remove", h.Untag)
+
+	r.GET("/files/:id/tags", h.FileTags)
+	r.GET("/folders/:id/tags", h.FolderTags)
+}
+
+// createRequest is the body of POST /tags.
+type createRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Color string `json:"color"`
+}
+
+// updateRequest is the body of PATCH /tags/:id.
+//
+// POINTER FIELDS:
+// A *string distinguishes "not sent" (nil) from "set to empty" (""), so
+// {"color": ""} clears the color while {} leaves it alone.
+type updateRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// mergeRequest is the body of POST /tags/:id/merge.
+type mergeRequest struct {
+	Into primitive.ObjectID `json:"into" binding:"required"`
+}
+
+// List returns the current user's tags.
+//
+// GET /tags
+func (h *Handler) List(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.service.List(c.Request.Context(), user)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// Create adds a tag.
+//
+// POST /tags {"name": "Tax 2024", "color": "#ff8800"}
+func (h *Handler) Create(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	tag, err := h.service.Create(c.Request.Context(), user, req.Name, req.Color)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, tag)
+}
+
+// Update renames or recolors a tag.
+//
+// PATCH /tags/:id {"name": "Taxes 2024"}
+func (h *Handler) Update(c *gin.Context) {
+	user, tagID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	var req updateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	tag, err := h.service.Update(c.Request.Context(), user, tagID, req.Name, req.Color)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// Delete removes a tag from everything and deletes it.
+//
+// DELETE /tags/:id
+func (h *Handler) Delete(c *gin.Context) {
+	user, tagID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), user, tagID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Merge moves everything tagged :id to another tag and deletes :id.
+//
+// POST /tags/:id/merge {"into": "<tag id>"}
+func (h *Handler) Merge(c *gin.Context) {
+	user, tagID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	var req mergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	target, err := h.service.Merge(c.Request.Context(), user, tagID, req.Into)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// Items lists the files and folders carrying a tag.
+//
+// GET /tags/:id/items
+func (h *Handler) Items(c *gin.Context) {
+	user, tagID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.service.Items(c.Request.Context(), user, tagID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// Tag adds a tag to files and folders.
+//
+// POST /tags/:id/items {"file_ids": [...], "folder_ids": [...]}
+func (h *Handler) Tag(c *gin.Context) {
+	h.bulk(c, h.service.Tag)
+}
+
+// Untag removes a tag from files and folders.
+//
+// POST /tags/:id/items/remove {"file_ids": [...], "folder_ids": [...]}
+func (h *Handler) Untag(c *gin.Context) {
+	h.bulk(c, h.service.Untag)
+}
+
+// FileTags lists the current user's tags on a file.
+//
+// GET /files/:id/tags
+func (h *Handler) FileTags(c *gin.Context) {
+	h.itemTags(c, h.service.FileTags)
+}
+
+// FolderTags lists the current user's tags on a folder.
+//
+// GET /folders/:id/tags
+func (h *Handler) FolderTags(c *gin.Context) {
+	h.itemTags(c, h.service.FolderTags)
+}
+
+// itemTags runs FileTags or FolderTags; :id is the item, not a tag.
+func (h *Handler) itemTags(c *gin.Context, op func(ctx context.Context, actor *models.User, itemID primitive.ObjectID) ([]*models.Tag, error)) {
+	user, itemID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	tags, err := op(c.Request.Context(), user, itemID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// bulk runs Tag or Untag - they take the same input and return the same
+// result, so one function value parameter covers both.
+func (h *Handler) bulk(c *gin.Context, op func(ctx context.Context, actor *models.User, tagID primitive.ObjectID, items Items) (*BulkResult, error)) {
+	user, tagID, ok := userAndTag(c)
+	if !ok {
+		return
+	}
+
+	var items Items
+	if err := c.ShouldBindJSON(&items); err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return
+	}
+
+	result, err := op(c.Request.Context(), user, tagID, items)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// currentUser returns the authenticated user or records 401.
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+	}
+	return user, ok
+}
+
+// userAndTag reads the user and the :id parameter, recording an error if
+// either is missing or malformed.
+func userAndTag(c *gin.Context) (*models.User, primitive.ObjectID, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		return nil, primitive.NilObjectID, false
+	}
+	tagID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrBadRequest)
+		return nil, primitive.NilObjectID, false
+	}
+	return user, tagID, true
+}
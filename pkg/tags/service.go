@@ -0,0 +1,391 @@
+// Package tags implements user-defined tags on files and folders.
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. A small service with its own repository plus shared ones
+// 2. Bulk operations that validate everything before changing anything
+// 3. Merging two records that other documents refer to
+//
+// TAGS ARE PERSONAL:
+// Every user has their own tags. You can tag anything you can read -
+// including files others shared with you - without the owner seeing it,
+// and nobody else can use or list your tags.
+package tags
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+	"github.com/emaad/file-storage-service/pkg/models"
+	"github.com/emaad/file-storage-service/pkg/repository"
+)
+
+// Limits
+const (
+	MaxTagsPerUser = 500
+	MaxBulkItems   = 1000 // Files plus folders in one tag/untag request
+	MaxListedItems = 1000 // Files (and folders) returned by Items
+	maxColorLength = 32
+)
+
+// Errors returned by the tag service
+var (
+	ErrTagExists      = apperrors.New("TAG_EXISTS", "You already have a tag with this name; merge the tags instead", http.StatusConflict)
+	ErrInvalidTagName = apperrors.New("INVALID_TAG_NAME", "Tag names must be 1-64 characters", http.StatusBadRequest)
+	ErrInvalidColor   = apperrors.New("INVALID_TAG_COLOR", "Tag colors must be at most 32 characters", http.StatusBadRequest)
+	ErrTooManyTags    = apperrors.New("TOO_MANY_TAGS", "You have reached the maximum number of tags", http.StatusConflict)
+	ErrTooManyItems   = apperrors.New("TOO_MANY_ITEMS", "Too many items in one request", http.StatusBadRequest)
+	ErrMergeIntoSelf  = apperrors.New("MERGE_INTO_SELF", "A tag can't be merged into itself", http.StatusBadRequest)
+)
+
+// Deps bundles the collaborators a Service needs. Pass the same file
+// repository as everywhere else, so search sees tag changes.
+type Deps struct {
+	Tags    repository.TagRepository
+	Files   repository.FileRepository
+	Folders repository.FolderRepository
+
+	// Access answers "may this user read that item?", including shares
+	// inherited from folders
+	Access *files.Service
+}
+
+// Service manages tags and tagged items.
+type Service struct {
+	tags    repository.TagRepository
+	files   repository.FileRepository
+	folders repository.FolderRepository
+	access  *files.Service
+}
+
+// NewService creates a tag Service.
+func NewService(deps Deps) *Service {
+	return &Service{tags: deps.Tags, files: deps.Files, folders: deps.Folders, access: deps.Access}
+}
+
+// Items identifies files and folders in bulk requests.
+type Items struct {
+	FileIDs   []primitive.ObjectID `json:"file_ids"`
+	FolderIDs []primitive.ObjectID `json:"folder_ids"`
+}
+
+// BulkResult reports how many items a bulk request changed. Items that
+// already had (or didn't have) the tag are not counted.
+type BulkResult struct {
+	Files   int64 `json:"files"`
+	Folders int64 `json:"folders"`
+}
+
+// TaggedItems lists what carries a tag.
+type TaggedItems struct {
+	Tag     *models.Tag      `json:"tag"`
+	Files   []*models.File   `json:"files"`
+	Folders []*models.Folder `json:"folders"`
+}
+
+// =============================================================================
+// TAGS
+// =============================================================================
+
+// List returns the actor's tags sorted by name.
+func (s *Service) List(ctx context.Context, actor *models.User) ([]*models.Tag, error) {
+	return s.tags.ListByUser(ctx, actor.ID)
+}
+
+// Create adds a tag.
+func (s *Service) Create(ctx context.Context, actor *models.User, name, color string) (*models.Tag, error) {
+	if err := validate(name, color); err != nil {
+		return nil, err
+	}
+
+	count, err := s.tags.CountByUser(ctx, actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxTagsPerUser {
+		return nil, ErrTooManyTags
+	}
+
+	tag := models.NewTag(actor.ID, name, strings.TrimSpace(color))
+	if err := s.tags.Create(ctx, tag); err != nil {
+		if apperrors.Is(err, apperrors.ErrConflict) {
+			return nil, ErrTagExists
+		}
+		return nil, err
+	}
+	return tag, nil
+}
+
+// Update renames and/or recolors a tag. Nil arguments are left unchanged.
+//
+// Renaming to the name of another existing tag fails with ErrTagExists:
+// silently combining them would be surprising, so the client asks for a
+// Merge explicitly.
+func (s *Service) Update(ctx context.Context, actor *models.User, tagID primitive.ObjectID, name, color *string) (*models.Tag, error) {
+	tag, err := s.getOwned(ctx, actor, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		tag.Name = strings.TrimSpace(*name)
+		tag.Key = models.TagKey(*name)
+	}
+	if color != nil {
+		tag.Color = strings.TrimSpace(*color)
+	}
+	if err := validate(tag.Name, tag.Color); err != nil {
+		return nil, err
+	}
+
+	if err := s.tags.Update(ctx, tag); err != nil {
+		if apperrors.Is(err, apperrors.ErrConflict) {
+			return nil, ErrTagExists
+		}
+		return nil, err
+	}
+	return tag, nil
+}
+
+// Merge moves everything tagged with source to target and deletes source.
+//
+// ORDER MATTERS:
+// Items are retagged before the source tag is deleted. If anything fails
+// half way, the source tag still exists and the merge can simply be
+// retried; deleting it first could strand items with a dangling tag ID.
+func (s *Service) Merge(ctx context.Context, actor *models.User, sourceID, targetID primitive.ObjectID) (*models.Tag, error) {
+	if sourceID == targetID {
+		return nil, ErrMergeIntoSelf
+	}
+	if _, err := s.getOwned(ctx, actor, sourceID); err != nil {
+		return nil, err
+	}
+	target, err := s.getOwned(ctx, actor, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.files.ReplaceTag(ctx, sourceID, targetID); err != nil {
+		return nil, err
+	}
+	if err := s.folders.ReplaceTag(ctx, sourceID, targetID); err != nil {
+		return nil, err
+	}
+	if err := s.tags.Delete(ctx, sourceID); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Delete removes a tag from every item and then deletes it.
+func (s *Service) Delete(ctx context.Context, actor *models.User, tagID primitive.ObjectID) error {
+	if _, err := s.getOwned(ctx, actor, tagID); err != nil {
+		return err
+	}
+
+	if _, err := s.files.RemoveTag(ctx, nil, tagID); err != nil {
+		return err
+	}
+	if _, err := s.folders.RemoveTag(ctx, nil, tagID); err != nil {
+		return err
+	}
+	return s.tags.Delete(ctx, tagID)
+}
+
+// =============================================================================
+// TAGGED ITEMS
+// =============================================================================
+
+// Tag adds a tag to files and folders.
+//
+// ALL OR NOTHING:
+// Every item is checked before any is tagged. If one ID is wrong, the
+// request fails without tagging the others, so the client never has to
+// work out which half of its request was applied.
+func (s *Service) Tag(ctx context.Context, actor *models.User, tagID primitive.ObjectID, items Items) (*BulkResult, error) {
+	if err := checkSize(items); err != nil {
+		return nil, err
+	}
+	if _, err := s.getOwned(ctx, actor, tagID); err != nil {
+		return nil, err
+	}
+
+	for _, id := range items.FileIDs {
+		if _, err := s.access.Get(ctx, actor, id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range items.FolderIDs {
+		if _, err := s.access.GetFolder(ctx, actor, id); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BulkResult{}
+	var err error
+	if len(items.FileIDs) > 0 {
+		if result.Files, err = s.files.AddTag(ctx, items.FileIDs, tagID); err != nil {
+			return nil, err
+		}
+	}
+	if len(items.FolderIDs) > 0 {
+		if result.Folders, err = s.folders.AddTag(ctx, items.FolderIDs, tagID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Untag removes a tag from files and folders.
+//
+// No read permission is needed: the tag is the actor's own, and they must
+// be able to clean it off a file that has since been unshared from them.
+func (s *Service) Untag(ctx context.Context, actor *models.User, tagID primitive.ObjectID, items Items) (*BulkResult, error) {
+	if err := checkSize(items); err != nil {
+		return nil, err
+	}
+	if _, err := s.getOwned(ctx, actor, tagID); err != nil {
+		return nil, err
+	}
+
+	result := &BulkResult{}
+	var err error
+	if len(items.FileIDs) > 0 {
+		if result.Files, err = s.files.RemoveTag(ctx, items.FileIDs, tagID); err != nil {
+			return nil, err
+		}
+	}
+	if len(items.FolderIDs) > 0 {
+		if result.Folders, err = s.folders.RemoveTag(ctx, items.FolderIDs, tagID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Items lists the files and folders carrying a tag that the actor can
+// still read.
+func (s *Service) Items(ctx context.Context, actor *models.User, tagID primitive.ObjectID) (*TaggedItems, error) {
+	tag, err := s.getOwned(ctx, actor, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	taggedFiles, err := s.files.FindByTag(ctx, tagID, MaxListedItems)
+	if err != nil {
+		return nil, err
+	}
+	taggedFolders, err := s.folders.FindByTag(ctx, tagID, MaxListedItems)
+	if err != nil {
+		return nil, err
+	}
+
+	items := &TaggedItems{Tag: tag, Files: []*models.File{}, Folders: []*models.Folder{}}
+	for _, file := range taggedFiles {
+		ok, err := s.access.MayRead(ctx, actor, file)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items.Files = append(items.Files, file)
+		}
+	}
+	for _, folder := range taggedFolders {
+		ok, err := s.access.MayReadFolder(ctx, actor, folder)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items.Folders = append(items.Folders, folder)
+		}
+	}
+	return items, nil
+}
+
+// FileTags returns the actor's tags on a file they can read. Other users'
+// tags on the same file are left out: the file's TagIDs are shared by
+// everyone who tagged it.
+func (s *Service) FileTags(ctx context.Context, actor *models.User, fileID primitive.ObjectID) ([]*models.Tag, error) {
+	file, err := s.access.Get(ctx, actor, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ownTags(ctx, actor, file.TagIDs)
+}
+
+// FolderTags returns the actor's tags on a folder they can read.
+func (s *Service) FolderTags(ctx context.Context, actor *models.User, folderID primitive.ObjectID) ([]*models.Tag, error) {
+	folder, err := s.access.GetFolder(ctx, actor, folderID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ownTags(ctx, actor, folder.TagIDs)
+}
+
+// ownTags picks the actor's tags out of an item's TagIDs, sorted by name.
+// A user has at most MaxTagsPerUser tags, so listing them all is cheap.
+func (s *Service) ownTags(ctx context.Context, actor *models.User, tagIDs []primitive.ObjectID) ([]*models.Tag, error) {
+	all, err := s.tags.ListByUser(ctx, actor.ID)
+	if err != nil {
+		return nil, err
+	}
+	own := []*models.Tag{}
+	for _, tag := range all {
+		if models.HasTag(tagIDs, tag.ID) {
+			own = append(own, tag)
+		}
+	}
+	return own, nil
+}
+
+// getOwned loads a tag of the actor. Other users' tags are reported as
+// not found, for administrators too: tags are private.
+func (s *Service) getOwned(ctx context.Context, actor *models.User, tagID primitive.ObjectID) (*models.Tag, error) {
+	tag, err := s.tags.GetByID(ctx, tagID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.UserID != actor.ID {
+		return nil, apperrors.ErrNotFound
+	}
+	return tag, nil
+}
+
+// validate checks a tag name and color.
+func validate(name, color string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > models.MaxTagNameLength {
+		return ErrInvalidTagName
+	}
+	if strings.IndexFunc(name, isControl) >= 0 {
+		return ErrInvalidTagName
+	}
+	if len(color) > maxColorLength {
+		return ErrInvalidColor
+	}
+	return nil
+}
+
+// isControl matches characters that don't belong in a name (newlines, tabs).
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// checkSize rejects empty and oversized bulk requests.
+func checkSize(items Items) error {
+	n := len(items.FileIDs) + len(items.FolderIDs)
+	if n == 0 {
+		return apperrors.ErrBadRequest
+	}
+	if n > MaxBulkItems {
+		return ErrTooManyItems
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+// Package tus serves resumable uploads over the tus 1.0 protocol
+// (https://tus.io/protocols/resumable-upload).
+//
+// LEARNING NOTES FOR GO BEGINNERS:
+// =================================
+// This package demonstrates:
+// 1. Implementing a published wire protocol on top of a service layer
+// 2. Custom HTTP methods and headers with gin
+// 3. Keeping protocol details (headers, status codes) out of the service
+//
+// THE PROTOCOL IN FIVE REQUESTS:
+//
+//	OPTIONS /uploads          -> what the server supports
+//	POST    /uploads          -> 201, Location: /uploads/{id}   (creation)
+//	HEAD    /uploads/{id}     -> Upload-Offset: how much arrived so far
+//	PATCH   /uploads/{id}     -> append bytes at Upload-Offset, 204
+//	DELETE  /uploads/{id}     -> abandon the upload               (termination)
+//
+// A client that loses its connection sends HEAD to learn the offset and
+// continues with PATCH from there. Nothing is ever sent twice.
+//
+// SUPPORTED EXTENSIONS:
+//   - creation: POST with Upload-Length and Upload-Metadata
+//   - termination: DELETE
+//   - checksum: Upload-Checksum on PATCH; a mismatch is 460
+//   - expiration: Upload-Expires; expired uploads are 410 Gone
+//
+// METADATA:
+// Upload-Metadata is a list of "key base64(value)" pairs. We read:
+//
+//	filename  the file name (stored in the root folder without "path")
+//	filetype  the content type
+//	path      the full target path, e.g. "/Photos/2024/beach.jpg"
+//	conflict  fail (default), overwrite, rename or skip
+//
+// When the last chunk arrives the file is created, and the final PATCH
+// response names it with X-File-Id and X-Upload-Outcome.
+package tus
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/emaad/file-storage-service/pkg/auth"
+	apperrors "github.com/emaad/file-storage-service/pkg/errors"
+	"github.com/emaad/file-storage-service/pkg/files"
+)
+
+// Protocol constants
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,termination,checksum,expiration"
+
+	// offsetContentType is the only body type PATCH accepts
+	offsetContentType = "application/offset+octet-stream"
+)
+
+// Protocol errors
+var (
+	ErrUnsupportedVersion = apperrors.New("TUS_VERSION_UNSUPPORTED", "Unsupported tus version", http.StatusPreconditionFailed)
+	ErrInvalidLength      = apperrors.New("INVALID_UPLOAD_LENGTH", "Upload-Length must be a non-negative integer", http.StatusBadRequest)
+	ErrInvalidOffset      = apperrors.New("INVALID_UPLOAD_OFFSET", "Upload-Offset must be a non-negative integer", http.StatusBadRequest)
+	ErrInvalidMetadata    = apperrors.New("INVALID_UPLOAD_METADATA", "Upload-Metadata must name the file", http.StatusBadRequest)
+	ErrInvalidContentType = apperrors.New("INVALID_CONTENT_TYPE", "PATCH requires Content-Type: "+offsetContentType, http.StatusUnsupportedMediaType)
+	ErrUploadTooLarge     = apperrors.New("UPLOAD_TOO_LARGE", "The upload exceeds the maximum file size", http.StatusRequestEntityTooLarge)
+)
+
+// Handler serves the tus endpoints.
+type Handler struct {
+	files   *files.Service
+	maxSize int64
+}
+
+// NewHandler creates a tus Handler. maxSize is the largest upload accepted
+// (config.S3.MaxFileSize).
+func NewHandler(fileService *files.Service, maxSize int64) *Handler {
+	return &Handler{files: fileService, maxSize: maxSize}
+}
+
+// RegisterRoutes mounts the tus routes on a router group.
+//
+// USAGE:
+//
+//	tus.NewHandler(fileService, cfg.S3.MaxFileSize).RegisterRoutes(api)
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	uploads := r.Group("/uploads", h.protocol)
+	uploads.OPTIONS("", h.Options)
+	uploads.OPTIONS("/:id", h.Options)
+	uploads.POST("", h.Create)
+	uploads.HEAD("/:id", h.Head)
+	uploads.PATCH("/:id", h.Patch)
+	uploads.DELETE("/:id", h.Terminate)
+}
+
+// protocol sets Tus-Resumable on every response and rejects clients that
+// speak another version. OPTIONS is exempt: it is how clients find out.
+func (h *Handler) protocol(c *gin.Context) {
+	c.Header("Tus-Resumable", Version)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != Version {
+		c.Header("Tus-Version", Version)
+		_ = c.Error(ErrUnsupportedVersion)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// Options describes the server's capabilities.
+//
+// OPTIONS /uploads
+func (h *Handler) Options(c *gin.Context) {
+	c.Header("Tus-Version", Version)
+	c.Header("Tus-Extension", Extensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	c.Header("Tus-Checksum-Algorithm", strings.Join(files.ChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// Create starts an upload.
+//
+// POST /uploads
+// Upload-Length: 104857600
+// Upload-Metadata: filename cmVwb3J0LnBkZg==,filetype YXBwbGljYXRpb24vcGRm
+func (h *Handler) Create(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		_ = c.Error(ErrInvalidLength)
+		return
+	}
+	if h.maxSize > 0 && size > h.maxSize {
+		_ = c.Error(ErrUploadTooLarge)
+		return
+	}
+
+	meta, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	path := meta["path"]
+	if path == "" {
+		if meta["filename"] == "" {
+			_ = c.Error(ErrInvalidMetadata)
+			return
+		}
+		path = "/" + meta["filename"]
+	}
+	mimeType := meta["filetype"]
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	policy, err := files.ParseConflictPolicy(meta["conflict"])
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	result, err := h.files.CreateUpload(c.Request.Context(), user, files.ResumableRequest{
+		Path:     path,
+		Size:     size,
+		MimeType: mimeType,
+		Conflict: policy,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if result.Result != nil {
+		// An empty upload is complete already, there is nothing to resume
+		writeOutcome(c, result.Result)
+		c.Header("Upload-Offset", "0")
+		c.Status(http.StatusCreated)
+		return
+	}
+
+	upload := result.Upload
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID.Hex())
+	c.Header("Upload-Expires", upload.Resumable.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Head reports how much of an upload has arrived.
+//
+// HEAD /uploads/:id
+func (h *Handler) Head(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	uploadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrNotFound)
+		return
+	}
+
+	upload, err := h.files.GetUpload(c.Request.Context(), user, uploadID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Resumable.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.FileSize, 10))
+	c.Header("Upload-Expires", upload.Resumable.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store") // the offset changes with every PATCH
+	c.Status(http.StatusOK)
+}
+
+// Patch appends the request body to an upload.
+//
+// PATCH /uploads/:id
+// Content-Type: application/offset+octet-stream
+// Upload-Offset: 5242880
+// Upload-Checksum: sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0=
+func (h *Handler) Patch(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	uploadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrNotFound)
+		return
+	}
+
+	if c.ContentType() != offsetContentType {
+		_ = c.Error(ErrInvalidContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		_ = c.Error(ErrInvalidOffset)
+		return
+	}
+	checksum, err := parseChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	result, err := h.files.WriteChunk(c.Request.Context(), user, uploadID, offset, c.Request.Body, checksum)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	upload := result.Upload
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Resumable.Offset, 10))
+	c.Header("Upload-Expires", upload.Resumable.ExpiresAt.UTC().Format(http.TimeFormat))
+	if result.Result != nil {
+		writeOutcome(c, result.Result)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Terminate abandons an upload and frees what was stored of it.
+//
+// DELETE /uploads/:id
+func (h *Handler) Terminate(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		_ = c.Error(apperrors.ErrUnauthorized)
+		return
+	}
+	uploadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		_ = c.Error(apperrors.ErrNotFound)
+		return
+	}
+
+	if err := h.files.TerminateUpload(c.Request.Context(), user, uploadID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeOutcome names the file a completed upload ended up in.
+func writeOutcome(c *gin.Context, result *files.UploadResult) {
+	if result.File != nil {
+		c.Header("X-File-Id", result.File.ID.Hex())
+	}
+	c.Header("X-Upload-Outcome", string(result.Outcome))
+}
+
+// parseMetadata decodes Upload-Metadata: comma-separated pairs of a key
+// and an optional base64 value.
+func parseMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, ErrInvalidMetadata
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, ErrInvalidMetadata
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// parseChecksum decodes Upload-Checksum: an algorithm and a base64 digest.
+// An absent header means no checksum.
+func parseChecksum(header string) (*files.ChunkChecksum, error) {
+	if header == "" {
+		return nil, nil
+	}
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) == 0 {
+		return nil, files.ErrInvalidChecksum
+	}
+	return &files.ChunkChecksum{Algorithm: algorithm, Sum: sum}, nil
+}
@@ -101,6 +101,27 @@ db.createCollection('processing_jobs');
 print('Creating notifications collection...');
 db.createCollection('notifications');
 
+// Create tags collection
+print('Creating tags collection...');
+db.createCollection('tags');
+
+// Create stars collection
+print('Creating stars collection...');
+db.createCollection('stars');
+
+// Create uploads collection (unfinished resumable uploads)
+print('Creating uploads collection...');
+db.createCollection('uploads');
+
+// Create changes collection (per-user change journals) and its counters
+print('Creating changes collections...');
+db.createCollection('changes');
+db.createCollection('change_counters');
+
+// Create events_outbox collection (domain events waiting for the broker)
+print('Creating events_outbox collection...');
+db.createCollection('events_outbox');
+
 // Create activity_logs collection with TTL (Time To Live)
 print('Creating activity_logs collection...');
 db.createCollection('activity_logs');
@@ -195,6 +216,26 @@ db.files.createIndex(
     { name: 'folder_files_idx' }
 );
 
+// Folder listing, sorted by name in natural order ("file2" before "file10")
+// QUERY: "list this folder" (GET /folders/:id/items)
+// COLLATION: must match the collation of the query (see
+// pkg/repository/pagination.go), or MongoDB can't use the index for the sort.
+// Sorting by size or date sorts one folder's files in memory, which is fine
+// for folders of normal size.
+db.files.createIndex(
+    { user_id: 1, folder_id: 1, file_name: 1 },
+    { collation: { locale: 'en', numericOrdering: true, strength: 2 }, name: 'folder_listing_idx' }
+);
+
+// Unique index: one active file per path and user, ignoring case, so a
+// folder can't hold "report.pdf" twice. Works like folder_path_unique_idx:
+// trashed files keep their deleted_at and don't block the name.
+// QUERY: "what is at /Documents/Work/report.pdf?"
+db.files.createIndex(
+    { user_id: 1, file_path: 1, deleted_at: 1 },
+    { unique: true, collation: { locale: 'en', strength: 2 }, name: 'file_path_unique_idx' }
+);
+
 // Index on shared_with.user_id for sharing queries
 // QUERY: "find all files shared with me"
 db.files.createIndex(
@@ -216,6 +257,45 @@ db.files.createIndex(
     { name: 'processing_status_idx' }
 );
 
+// Partial indexes on retention locks and legal holds
+// QUERY: "is anything inside this folder locked?" (checked before folder deletes)
+// PARTIAL: most files are never locked, so only locked ones are indexed
+// (a sparse compound index would still index every file via user_id)
+db.files.createIndex(
+    { user_id: 1, 'retention.retain_until': 1 },
+    { partialFilterExpression: { retention: { $exists: true } }, name: 'file_retention_idx' }
+);
+db.files.createIndex(
+    { user_id: 1, legal_hold: 1 },
+    { partialFilterExpression: { legal_hold: { $exists: true } }, name: 'file_legal_hold_idx' }
+);
+
+// Partial index for the admin quarantine list (virus scanner detections)
+// QUERY: "list quarantined files, oldest detection first"
+db.files.createIndex(
+    { 'quarantine.quarantined_at': 1 },
+    { partialFilterExpression: { quarantine: { $exists: true } }, name: 'file_quarantine_idx' }
+);
+
+// Multikey index on tag_ids (indexes every element of the array)
+// QUERY: "show everything tagged 'Tax 2024'"
+db.files.createIndex(
+    { tag_ids: 1 },
+    { name: 'file_tags_idx' }
+);
+
+// Recently accessed files, for owners and for direct shares
+// QUERY: "what did I open lately?" (sorted by last_accessed_at)
+// PARTIAL: files nobody ever opened aren't in the feed, so they're skipped
+db.files.createIndex(
+    { user_id: 1, last_accessed_at: -1 },
+    { partialFilterExpression: { last_accessed_at: { $exists: true } }, name: 'user_recent_files_idx' }
+);
+db.files.createIndex(
+    { 'shared_with.user_id': 1, last_accessed_at: -1 },
+    { partialFilterExpression: { last_accessed_at: { $exists: true } }, name: 'shared_recent_files_idx' }
+);
+
 // ---------------------------------------------------------------------------
 // FOLDERS COLLECTION INDEXES
 // ---------------------------------------------------------------------------
@@ -228,6 +308,22 @@ db.folders.createIndex(
     { name: 'user_folder_hierarchy_idx' }
 );
 
+// Unique index: one active folder per path and user, ignoring case
+// ("/Docs" and "/docs" are the same folder). Trashed folders keep their
+// deleted_at timestamp, so a new folder can take the path of a trashed one.
+// Concurrent "create /a/b" requests rely on this to end up with one folder.
+// COLLATION: path lookups use the same one (strength 2, case-insensitive)
+db.folders.createIndex(
+    { user_id: 1, path: 1, deleted_at: 1 },
+    { unique: true, collation: { locale: 'en', strength: 2 }, name: 'folder_path_unique_idx' }
+);
+
+// Folder listing, as for files
+db.folders.createIndex(
+    { user_id: 1, parent_folder_id: 1, name: 1 },
+    { collation: { locale: 'en', numericOrdering: true, strength: 2 }, name: 'folder_children_listing_idx' }
+);
+
 // Index on path for prefix queries
 // QUERY: "find all items under /Documents/Work"
 db.folders.createIndex(
@@ -247,6 +343,29 @@ db.folders.createIndex(
     { sparse: true, name: 'folder_deleted_idx' }
 );
 
+// Partial indexes on retention locks and legal holds (inherited by contents)
+db.folders.createIndex(
+    { user_id: 1, 'retention.retain_until': 1 },
+    { partialFilterExpression: { retention: { $exists: true } }, name: 'folder_retention_idx' }
+);
+db.folders.createIndex(
+    { user_id: 1, legal_hold: 1 },
+    { partialFilterExpression: { legal_hold: { $exists: true } }, name: 'folder_legal_hold_idx' }
+);
+
+// Multikey index on tag_ids, as for files
+db.folders.createIndex(
+    { tag_ids: 1 },
+    { name: 'folder_tags_idx' }
+);
+
+// Index on shared_with.user_id, as for files
+// QUERY: "find all folders shared with me"
+db.folders.createIndex(
+    { 'shared_with.user_id': 1 },
+    { name: 'shared_folders_idx' }
+);
+
 // ---------------------------------------------------------------------------
 // FILE_VERSIONS COLLECTION INDEXES
 // ---------------------------------------------------------------------------
@@ -309,6 +428,93 @@ db.notifications.createIndex(
     { name: 'user_notifications_idx' }
 );
 
+// ---------------------------------------------------------------------------
+// TAGS COLLECTION INDEXES
+// ---------------------------------------------------------------------------
+print('Creating indexes for tags collection...');
+
+// Unique index on user_id and normalized name
+// Each user's tag names are unique, ignoring case ("Work" = "work")
+// Also serves "list my tags, sorted by name"
+db.tags.createIndex(
+    { user_id: 1, key: 1 },
+    { unique: true, name: 'user_tag_key_unique_idx' }
+);
+
+// ---------------------------------------------------------------------------
+// STARS COLLECTION INDEXES
+// ---------------------------------------------------------------------------
+print('Creating indexes for stars collection...');
+
+// Unique index: an item is starred at most once per user
+// (starring twice is an upsert that finds the existing star)
+db.stars.createIndex(
+    { user_id: 1, item_type: 1, item_id: 1 },
+    { unique: true, name: 'user_star_unique_idx' }
+);
+
+// QUERY: "show my starred items, most recently starred first"
+db.stars.createIndex(
+    { user_id: 1, created_at: -1 },
+    { name: 'user_stars_idx' }
+);
+
+// ---------------------------------------------------------------------------
+// UPLOADS COLLECTION INDEXES
+// ---------------------------------------------------------------------------
+print('Creating indexes for uploads collection...');
+
+// QUERY: "which of my uploads are still unfinished?"
+db.uploads.createIndex(
+    { user_id: 1 },
+    { name: 'user_uploads_idx' }
+);
+
+// QUERY: "which uploads were abandoned?" (PurgeExpiredUploads)
+// Not a TTL index: the parts in object storage must be aborted first
+db.uploads.createIndex(
+    { 'resumable.expires_at': 1 },
+    { name: 'upload_expiry_idx' }
+);
+
+// ---------------------------------------------------------------------------
+// CHANGES COLLECTION INDEXES (with TTL)
+// ---------------------------------------------------------------------------
+print('Creating indexes for changes collection...');
+
+// Unique index: one change per sequence number and user
+// QUERY: "what changed for me after change 41?" (GET /changes)
+db.changes.createIndex(
+    { user_id: 1, seq: 1 },
+    { unique: true, name: 'user_change_seq_unique_idx' }
+);
+
+// TTL index: journals keep 30 days (2,592,000 seconds); clients with an
+// older cursor get CURSOR_EXPIRED and list everything again
+db.changes.createIndex(
+    { created_at: 1 },
+    { expireAfterSeconds: 2592000, name: 'change_ttl_idx' }
+);
+
+// ---------------------------------------------------------------------------
+// EVENTS_OUTBOX COLLECTION INDEXES (with TTL)
+// ---------------------------------------------------------------------------
+print('Creating indexes for events_outbox collection...');
+
+// QUERY: "which pending event has been due the longest?" (the relay)
+db.events_outbox.createIndex(
+    { status: 1, available_at: 1 },
+    { name: 'outbox_due_idx' }
+);
+
+// TTL index: published entries are kept 7 days (604,800 seconds) for
+// debugging. Pending and failed entries have no published_at, so they
+// never expire.
+db.events_outbox.createIndex(
+    { published_at: 1 },
+    { expireAfterSeconds: 604800, name: 'outbox_published_ttl_idx' }
+);
+
 // ---------------------------------------------------------------------------
 // ACTIVITY_LOGS COLLECTION INDEXES (with TTL)
 // ---------------------------------------------------------------------------